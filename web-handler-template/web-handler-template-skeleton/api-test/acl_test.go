@@ -0,0 +1,85 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gavv/httpexpect/v2"
+)
+
+func TestInstanceACLIsEnforcedOnItself(t *testing.T) {
+	if signToken == nil {
+		t.Skip("needs tokens of other identities, which are only signed in-process")
+	}
+
+	outsiderToken, err := signToken("outsider")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := httpexpect.New(t, *orgUrl).Builder(func(req *httpexpect.Request) {
+		req.WithHeader("Authorization", "Bearer "+token)
+	})
+	outsider := httpexpect.New(t, *orgUrl).Builder(func(req *httpexpect.Request) {
+		req.WithHeader("Authorization", "Bearer "+outsiderToken)
+	})
+
+	id := e.POST("/sp-connect/connector-instances").
+		WithJSON(map[string]interface{}{
+			"name":            "sp-connect acl test",
+			"connectorSpecId": "internal",
+			"config":          map[string]interface{}{},
+		}).
+		Expect().
+		Status(http.StatusOK).JSON().Object().Value("id").String().Raw()
+	defer deleteConnectorInstance(e, id)
+
+	acl := map[string]interface{}{
+		"entries": []map[string]interface{}{
+			{"principalType": "identity", "principalId": hermeticIdentityID, "verbs": []string{"read", "update"}},
+		},
+	}
+
+	e.PUT("/sp-connect/connector-instances/" + id + "/acl").
+		WithJSON(acl).
+		Expect().
+		Status(http.StatusOK)
+
+	// Someone outside the ACL can't grant themselves access, or read or remove it.
+	outsider.PUT("/sp-connect/connector-instances/" + id + "/acl").
+		WithJSON(map[string]interface{}{
+			"entries": []map[string]interface{}{
+				{"principalType": "identity", "principalId": "outsider", "verbs": []string{"read", "update"}},
+			},
+		}).
+		Expect().
+		Status(http.StatusForbidden)
+	outsider.GET("/sp-connect/connector-instances/" + id + "/acl").
+		Expect().
+		Status(http.StatusForbidden)
+	outsider.DELETE("/sp-connect/connector-instances/" + id + "/acl").
+		Expect().
+		Status(http.StatusForbidden)
+
+	// Nor can they find the instance, or its config, by listing.
+	outsider.GET("/sp-connect/connector-instances").
+		WithQuery("filters", `id eq "`+id+`"`).
+		Expect().
+		Status(http.StatusOK).JSON().Array().Empty()
+
+	e.GET("/sp-connect/connector-instances/" + id + "/acl").
+		Expect().
+		Status(http.StatusOK).JSON().Object().Value("entries").Array().Length().Equal(1)
+}
+
+func TestInstanceACLOfMissingInstance(t *testing.T) {
+	e := httpexpect.New(t, *orgUrl).Builder(func(req *httpexpect.Request) {
+		req.WithHeader("Authorization", "Bearer "+token)
+	})
+
+	e.PUT("/sp-connect/connector-instances/does-not-exist/acl").
+		WithJSON(map[string]interface{}{"entries": []interface{}{}}).
+		Expect().
+		Status(http.StatusNotFound)
+}
@@ -147,3 +147,52 @@ func TestBadCrudOperation(t *testing.T) {
 		Expect().
 		Status(http.StatusNotFound)
 }
+
+func TestListConnectorInstancesWithFilters(t *testing.T) {
+	e := httpexpect.New(t, *orgUrl)
+	e = e.Builder(func(req *httpexpect.Request) {
+		req.WithHeader("Authorization", "Bearer "+token)
+	})
+
+	var ids []string
+	for _, name := range []string{"sp-connect filter test a", "sp-connect filter test b"} {
+		create := e.POST("/sp-connect/connector-instances").
+			WithJSON(map[string]interface{}{
+				"name":            name,
+				"connectorSpecId": "internal",
+				"config":          map[string]interface{}{},
+			}).
+			Expect().
+			Status(http.StatusOK).JSON().Object()
+		ids = append(ids, create.Value("id").String().Raw())
+	}
+	defer func() {
+		for _, id := range ids {
+			deleteConnectorInstance(e, id)
+		}
+	}()
+
+	filtered := e.GET("/sp-connect/connector-instances").
+		WithQuery("filters", `name eq "sp-connect filter test b"`).
+		WithQuery("count", true).
+		Expect().
+		Status(http.StatusOK)
+	filtered.Header("X-Total-Count").Equal("1")
+	filtered.JSON().Array().Length().Equal(1)
+	filtered.JSON().Array().Element(0).Object().Value("id").Equal(ids[1])
+
+	sorted := e.GET("/sp-connect/connector-instances").
+		WithQuery("filters", `name sw "sp-connect filter test"`).
+		WithQuery("sorters", "-name").
+		WithQuery("limit", 1).
+		WithQuery("count", true).
+		Expect().
+		Status(http.StatusOK)
+	sorted.Header("X-Total-Count").Equal("2")
+	sorted.JSON().Array().Element(0).Object().Value("id").Equal(ids[1])
+
+	e.GET("/sp-connect/connector-instances").
+		WithQuery("filters", `config eq "x"`).
+		Expect().
+		Status(http.StatusBadRequest)
+}
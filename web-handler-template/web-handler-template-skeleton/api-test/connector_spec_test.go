@@ -76,3 +76,24 @@ func TestValidateSpecs(t *testing.T) {
 		Status(http.StatusBadRequest).JSON().Object()
 
 }
+
+func TestListConnectorSpecsWithFilters(t *testing.T) {
+	e := httpexpect.New(t, *orgUrl)
+	e = e.Builder(func(req *httpexpect.Request) {
+		req.WithHeader("Authorization", "Bearer "+token)
+	})
+
+	list := e.GET("/sp-connect/connector-specifications").
+		WithQuery("filters", `id eq "internal"`).
+		WithQuery("count", true).
+		Expect().
+		Status(http.StatusOK)
+	list.Header("X-Total-Count").Equal("1")
+	list.JSON().Array().Element(0).Object().Value("topology").Equal("internal")
+
+	// The total is only counted on request.
+	e.GET("/sp-connect/connector-specifications").
+		Expect().
+		Status(http.StatusOK).
+		Header("X-Total-Count").Empty()
+}
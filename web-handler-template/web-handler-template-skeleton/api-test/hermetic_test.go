@@ -0,0 +1,110 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sailpoint/atlas-go/atlas/application"
+	"github.com/sailpoint/atlas-go/atlas/auth"
+	"github.com/sailpoint/atlas-go/atlas/auth/access"
+	"github.com/sailpoint/atlas-go/atlas/feature"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/memory"
+)
+
+// The identity of the hermetic suite's token.
+const (
+	hermeticTenantID   = "00000000-0000-0000-0000-000000000001"
+	hermeticPod        = "dev"
+	hermeticOrg        = "acme-solar"
+	hermeticIdentityID = "api-test"
+)
+
+// hermeticRights are the rights granted to the hermetic suite's token.
+var hermeticRights = []access.Right{
+	"sp:connector:create",
+	"sp:connector:read",
+	"sp:connector:update",
+	"sp:connector:delete",
+	"sp:connector:invoke",
+}
+
+// hermeticConfig is a configuration Source that reads the hermetic service's settings, falling back
+// to the environment.
+type hermeticConfig map[string]string
+
+// GetString gets the value of key.
+func (c hermeticConfig) GetString(key string) string {
+	if v, ok := c[key]; ok {
+		return v
+	}
+
+	return os.Getenv(key)
+}
+
+// staticSummarizer is an access Summarizer that grants every token the same rights.
+type staticSummarizer []access.Right
+
+// Summarize builds the access summary of the token.
+func (s staticSummarizer) Summarize(ctx context.Context, t *auth.Token) (*access.Summary, error) {
+	return &access.Summary{RightSets: []access.RightSetID{}, FlattenedRights: s}, nil
+}
+
+// signToken signs a token for an identity of the hermetic suite's org. It's nil when the tests run
+// against a remote org, where tests that need other identities are skipped.
+var signToken func(identityID string) (string, error)
+
+// startHermeticServer starts the service in-process on a random port, with in-memory backends and a
+// generated JWT signing key. It returns the org URL to test against, a function that signs tokens
+// with the key, and a function that stops the server.
+func startHermeticServer() (string, func(identityID string) (string, error), func(), error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, nil, err
+	}
+
+	cfg := hermeticConfig{
+		"ATLAS_PRODUCTION": "false",
+		"ATLAS_JWT_KEY":    hex.EncodeToString(key),
+		"DIST_DIR":         "../dist",
+	}
+
+	service, err := infra.NewConnectService(
+		application.WithConfig(cfg),
+		func(app *application.Application) error {
+			app.TokenValidator = auth.NewComposedTokenValidator(key, jwt.SigningMethodHS256)
+			app.AccessSummarizer = staticSummarizer(hermeticRights)
+			app.RedisClient = memory.NewRedis()
+			app.EventPublisher = memory.NewEventPublisher()
+			app.FeatureStore = feature.NewMemoryStore()
+			return nil
+		},
+	)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	sign := func(identityID string) (string, error) {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"tenant_id":   hermeticTenantID,
+			"pod":         hermeticPod,
+			"org":         hermeticOrg,
+			"identity_id": identityID,
+			"user_name":   identityID,
+			"authorities": []string{"ORG_ADMIN"},
+			"exp":         time.Now().Add(time.Hour).Unix(),
+		}).SignedString(key)
+	}
+
+	// The tests address the service by its path on the org's API gateway.
+	server := httptest.NewServer(http.StripPrefix("/sp-connect", service.Handler()))
+
+	return server.URL, sign, server.Close, nil
+}
@@ -15,7 +15,7 @@ import (
 var token string
 
 var (
-	orgUrl   = flag.String("url", "", "Org URL")
+	orgUrl   = flag.String("url", "", "Org URL; if empty, the tests run against an in-process server")
 	username = flag.String("username", "", "Username")
 	password = flag.String("password", "", "Password")
 	env      = flag.String("env", "", "Environment")
@@ -23,6 +23,26 @@ var (
 
 func TestMain(m *testing.M) {
 	flag.Parse()
+
+	if *orgUrl == "" {
+		url, sign, stop, err := startHermeticServer()
+		if err != nil {
+			log.Fatalf("failed to start in-process server: %s", err)
+		}
+
+		token, err = sign(hermeticIdentityID)
+		if err != nil {
+			log.Fatalf("failed to sign token: %s", err)
+		}
+
+		*orgUrl = url
+		signToken = sign
+
+		code := m.Run()
+		stop()
+		os.Exit(code)
+	}
+
 	var err error
 	tokenSource := client.NewPasswordTokenSource(http.DefaultClient, *orgUrl+"/oauth/token", *username, *password, *env == "prod")
 	tokenReturn, err := tokenSource.GetToken(context.Background())
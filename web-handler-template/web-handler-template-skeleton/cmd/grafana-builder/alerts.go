@@ -0,0 +1,403 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// alertsSpec configures the Prometheus alerting rules generated for the metrics charted by a spec.
+// Every metric gets an absence alert unless it disables it; the other alerts are only generated for
+// metrics that configure them.
+type alertsSpec struct {
+	// Group is the rule group name (default: the dashboard uid).
+	Group string `yaml:"group"`
+
+	// AbsentFor is how long a metric must be missing before its absence alert fires (default: 15m).
+	AbsentFor string `yaml:"absentFor"`
+
+	Metrics map[string]metricAlertSpec `yaml:"metrics"`
+}
+
+// metricAlertSpec holds the alert thresholds of a single metric family.
+type metricAlertSpec struct {
+	Latency    *latencyAlertSpec    `yaml:"latency"`
+	ErrorRatio *errorRatioAlertSpec `yaml:"errorRatio"`
+
+	// Absent disables the alert for the metric not being reported when set to false. Vectors have
+	// no series until they're first observed, so it should be disabled for series that are rare.
+	Absent *bool `yaml:"absent"`
+
+	// AbsentFor overrides alertsSpec.AbsentFor for this metric.
+	AbsentFor string `yaml:"absentFor"`
+}
+
+// latencyAlertSpec is a latency SLO: the Objective share of observations should be at or below
+// Threshold, which must be one of the histogram's bucket boundaries.
+type latencyAlertSpec struct {
+	Objective float64 `yaml:"objective"`
+	Threshold float64 `yaml:"threshold"`
+}
+
+// errorRatioAlertSpec alerts when the share of the counter's rate matching Selector exceeds Max. If
+// Total is set, the counter only counts failures and Total counts every operation.
+type errorRatioAlertSpec struct {
+	Selector string  `yaml:"selector"`
+	Total    string  `yaml:"total"`
+	Max      float64 `yaml:"max"`
+	For      string  `yaml:"for"`
+}
+
+// burnRateWindow is a pair of windows over which the rate a latency SLO's error budget is being
+// spent is checked against a multiple of the rate that would spend it exactly. The long window stops
+// brief spikes from firing the alert, and the short window stops it soon after the problem is fixed.
+// The factors are those that spend 2% of a 30 day budget in an hour, 5% in six hours, 10% in a day and
+// 10% in three days.
+type burnRateWindow struct {
+	name     string
+	long     string
+	short    string
+	factor   float64
+	for_     string
+	severity string
+}
+
+var burnRateWindows = []burnRateWindow{
+	{name: "FastBurn", long: "1h", short: "5m", factor: 14.4, for_: "2m", severity: "page"},
+	{name: "SlowBurn", long: "6h", short: "30m", factor: 6, for_: "15m", severity: "page"},
+	{name: "BudgetBurn", long: "1d", short: "2h", factor: 3, for_: "1h", severity: "ticket"},
+	{name: "SustainedBudgetBurn", long: "3d", short: "6h", factor: 1, for_: "3h", severity: "ticket"},
+}
+
+// ruleGroups is the Prometheus rule file format.
+type ruleGroups struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// metricFamily is a metric charted by the dashboard, and whether it's a histogram.
+type metricFamily struct {
+	name      string
+	histogram bool
+}
+
+// histogramKinds are the panel kinds that chart histograms.
+var histogramKinds = map[string]bool{"latency": true, "rate": true, "heatmap": true}
+
+// metricFamilies returns the distinct metrics charted by the spec, in the order they first appear.
+func (s *dashboardSpec) metricFamilies() []metricFamily {
+	var families []metricFamily
+	index := map[string]int{}
+
+	for _, r := range s.Rows {
+		for _, p := range r.Panels {
+			i, ok := index[p.Metric]
+			if !ok {
+				i = len(families)
+				index[p.Metric] = i
+				families = append(families, metricFamily{name: p.Metric})
+			}
+			families[i].histogram = families[i].histogram || histogramKinds[p.Kind]
+
+			if _, ok := index[p.Total]; p.Total != "" && !ok {
+				index[p.Total] = len(families)
+				families = append(families, metricFamily{name: p.Total})
+			}
+		}
+	}
+
+	return families
+}
+
+// buildRules generates the alerting rules for every metric family charted by the spec.
+func (s *dashboardSpec) buildRules() ruleGroups {
+	group := ruleGroup{Name: s.Alerts.Group}
+	if group.Name == "" {
+		group.Name = s.UID
+	}
+
+	absentFor := s.Alerts.AbsentFor
+	if absentFor == "" {
+		absentFor = "15m"
+	}
+
+	for _, f := range s.metricFamilies() {
+		cfg := s.Alerts.Metrics[f.name]
+		name := alertName(f.name)
+
+		if cfg.Latency != nil {
+			for _, w := range burnRateWindows {
+				group.Rules = append(group.Rules, rule{
+					Alert: name + "Latency" + w.name,
+					Expr: fmt.Sprintf("%s > %g * (1 - %g) and %s > %g * (1 - %g)",
+						slowRatioExpr(f.name, cfg.Latency.Threshold, w.long), w.factor, cfg.Latency.Objective,
+						slowRatioExpr(f.name, cfg.Latency.Threshold, w.short), w.factor, cfg.Latency.Objective),
+					For:    w.for_,
+					Labels: map[string]string{"severity": w.severity},
+					Annotations: map[string]string{
+						"summary":     fmt.Sprintf("%s is burning its latency error budget %gx too fast", f.name, w.factor),
+						"description": fmt.Sprintf("Over both the last %s and %s, %s observations above %gms have spent the error budget of its %g objective at over %gx the sustainable rate.", w.long, w.short, f.name, cfg.Latency.Threshold, cfg.Latency.Objective, w.factor),
+					},
+				})
+			}
+		}
+
+		if cfg.ErrorRatio != nil {
+			forDuration := cfg.ErrorRatio.For
+			if forDuration == "" {
+				forDuration = "10m"
+			}
+
+			failures, total := f.name, cfg.ErrorRatio.Total
+			if cfg.ErrorRatio.Selector != "" {
+				failures += "{" + cfg.ErrorRatio.Selector + "}"
+			}
+			if total == "" {
+				total = f.name
+			}
+
+			group.Rules = append(group.Rules, rule{
+				Alert:  name + "ErrorRatio",
+				Expr:   fmt.Sprintf("sum(rate(%s[5m])) by (pod) / sum(rate(%s[5m])) by (pod) > %g", failures, total, cfg.ErrorRatio.Max),
+				For:    forDuration,
+				Labels: map[string]string{"severity": "page"},
+				Annotations: map[string]string{
+					"summary":     fmt.Sprintf("%s error ratio above %g on {{ $labels.pod }}", f.name, cfg.ErrorRatio.Max),
+					"description": fmt.Sprintf("The ratio of %s to %s has been above %g over the last 5m.", failures, total, cfg.ErrorRatio.Max),
+				},
+			})
+		}
+
+		if cfg.Absent == nil || *cfg.Absent {
+			series := f.name
+			if f.histogram {
+				series += "_count"
+			}
+
+			forDuration := absentFor
+			if cfg.AbsentFor != "" {
+				forDuration = cfg.AbsentFor
+			}
+
+			group.Rules = append(group.Rules, rule{
+				Alert:  name + "Absent",
+				Expr:   fmt.Sprintf("absent(%s)", series),
+				For:    forDuration,
+				Labels: map[string]string{"severity": "ticket"},
+				Annotations: map[string]string{
+					"summary": fmt.Sprintf("%s is not being reported", f.name),
+				},
+			})
+		}
+	}
+
+	return ruleGroups{Groups: []ruleGroup{group}}
+}
+
+// slowRatioExpr builds the share of a histogram's observations over a window that were above the
+// threshold, across every pod.
+func slowRatioExpr(metric string, threshold float64, window string) string {
+	return fmt.Sprintf(`(1 - sum(rate(%s_bucket{le="%g"}[%s])) / sum(rate(%s_count[%s])))`, metric, threshold, window, metric, window)
+}
+
+// alertName converts a metric name to an alert name (eg. "sp_connect_queue_latency_ms" to "SpConnectQueueLatencyMs").
+func alertName(metric string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(metric, "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+
+	return b.String()
+}
+
+// forMetrics returns a copy of the alert configuration limited to the given metric families.
+func (a alertsSpec) forMetrics(families []metricFamily) alertsSpec {
+	metrics := a.Metrics
+	a.Metrics = map[string]metricAlertSpec{}
+
+	for _, f := range families {
+		if cfg, ok := metrics[f.name]; ok {
+			a.Metrics[f.name] = cfg
+		}
+	}
+
+	return a
+}
+
+// validate checks the alert configuration, reporting problems with their path in the spec.
+func (a *alertsSpec) validate(families []metricFamily, problem func(format string, args ...interface{})) {
+	charted := map[string]metricFamily{}
+	for _, f := range families {
+		charted[f.name] = f
+	}
+
+	if a.AbsentFor != "" {
+		if _, err := model.ParseDuration(a.AbsentFor); err != nil {
+			problem("alerts.absentFor: %v", err)
+		}
+	}
+
+	for metric, cfg := range a.Metrics {
+		path := "alerts.metrics." + metric
+
+		f, ok := charted[metric]
+		if !ok {
+			problem("%s: metric isn't charted by any panel", path)
+		}
+
+		if cfg.Latency != nil {
+			if !f.histogram {
+				problem("%s.latency: metric isn't charted as a histogram", path)
+			}
+			if cfg.Latency.Objective <= 0 || cfg.Latency.Objective >= 1 {
+				problem("%s.latency.objective: must be between 0 and 1", path)
+			}
+			if cfg.Latency.Threshold <= 0 {
+				problem("%s.latency.threshold: must be positive", path)
+			}
+		}
+
+		if cfg.ErrorRatio != nil {
+			if cfg.ErrorRatio.Selector == "" && cfg.ErrorRatio.Total == "" {
+				problem("%s.errorRatio: selector or total is required", path)
+			}
+			if _, ok := charted[cfg.ErrorRatio.Total]; cfg.ErrorRatio.Total != "" && !ok {
+				problem("%s.errorRatio.total: metric isn't charted by any panel", path)
+			}
+			if cfg.ErrorRatio.Max <= 0 || cfg.ErrorRatio.Max >= 1 {
+				problem("%s.errorRatio.max: must be between 0 and 1", path)
+			}
+			if cfg.ErrorRatio.For != "" {
+				if _, err := model.ParseDuration(cfg.ErrorRatio.For); err != nil {
+					problem("%s.errorRatio.for: %v", path, err)
+				}
+			}
+		}
+
+		if cfg.AbsentFor != "" {
+			if cfg.Absent != nil && !*cfg.Absent {
+				problem("%s.absentFor: absent is disabled", path)
+			}
+			if _, err := model.ParseDuration(cfg.AbsentFor); err != nil {
+				problem("%s.absentFor: %v", path, err)
+			}
+		}
+	}
+}
+
+// checkRules checks the generated rules with the prometheus/common parsers before they're written:
+// alert names must be valid metric names, durations must parse, label names must be valid and label
+// values valid UTF-8. prometheus/common has no PromQL parser, so expressions are only checked for
+// balanced brackets and quotes.
+func checkRules(groups ruleGroups) error {
+	var problems []string
+	seen := map[string]bool{}
+
+	for _, g := range groups.Groups {
+		for _, r := range g.Rules {
+			if !model.IsValidMetricName(model.LabelValue(r.Alert)) {
+				problems = append(problems, fmt.Sprintf("%s: invalid alert name", r.Alert))
+			}
+			if seen[r.Alert] {
+				problems = append(problems, fmt.Sprintf("%s: duplicate alert name", r.Alert))
+			}
+			seen[r.Alert] = true
+
+			if _, err := model.ParseDuration(r.For); r.For != "" && err != nil {
+				problems = append(problems, fmt.Sprintf("%s: for: %v", r.Alert, err))
+			}
+
+			for _, labels := range []map[string]string{r.Labels, r.Annotations} {
+				for k, v := range labels {
+					if !model.LabelName(k).IsValid() {
+						problems = append(problems, fmt.Sprintf("%s: invalid label name %q", r.Alert, k))
+					}
+					if !model.LabelValue(v).IsValid() {
+						problems = append(problems, fmt.Sprintf("%s: invalid label value for %q", r.Alert, k))
+					}
+				}
+			}
+
+			if err := checkBalanced(r.Expr); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: expr: %v", r.Alert, err))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid rules:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+// checkBalanced verifies that the brackets in an expression are balanced, ignoring quoted strings.
+func checkBalanced(expr string) error {
+	pairs := map[rune]rune{')': '(', ']': '[', '}': '{'}
+	var stack []rune
+	var quote rune
+
+	for _, c := range expr {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			stack = append(stack, c)
+		case pairs[c] != 0:
+			if len(stack) == 0 || stack[len(stack)-1] != pairs[c] {
+				return fmt.Errorf("unbalanced %q", c)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if quote != 0 {
+		return fmt.Errorf("unterminated string")
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("unclosed %q", stack[len(stack)-1])
+	}
+
+	return nil
+}
+
+// writeRules checks the rules and writes them as a Prometheus rule file.
+func writeRules(path string, groups ruleGroups) error {
+	if err := checkRules(groups); err != nil {
+		return err
+	}
+
+	raw, err := yaml.Marshal(groups)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, raw, 0644)
+}
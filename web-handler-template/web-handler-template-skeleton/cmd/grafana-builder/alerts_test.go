@@ -0,0 +1,149 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildRules(t *testing.T) {
+	spec, err := parseSpec([]byte(`
+title: T
+uid: t
+rows:
+  - title: R
+    panels:
+      - {title: Latency, kind: latency, metric: x_latency_ms}
+      - {title: Failures, kind: error-ratio, metric: x_total, errorSelector: 'status="failed"'}
+      - {title: Depth, kind: gauge, metric: x_depth}
+alerts:
+  absentFor: 30m
+  metrics:
+    x_latency_ms:
+      latency: {objective: 0.99, threshold: 200}
+    x_total:
+      errorRatio: {selector: 'status="failed"', max: 0.05}
+      absent: false
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := spec.buildRules()
+	if err := checkRules(groups); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := map[string]rule{}
+	for _, r := range groups.Groups[0].Rules {
+		rules[r.Alert] = r
+	}
+
+	if groups.Groups[0].Name != "t" || len(rules) != 7 {
+		t.Fatalf("unexpected rules: %+v", groups)
+	}
+
+	fast := rules["XLatencyMsLatencyFastBurn"]
+	if fast.Labels["severity"] != "page" || fast.Expr != `(1 - sum(rate(x_latency_ms_bucket{le="200"}[1h])) / sum(rate(x_latency_ms_count[1h]))) > 14.4 * (1 - 0.99)`+
+		` and (1 - sum(rate(x_latency_ms_bucket{le="200"}[5m])) / sum(rate(x_latency_ms_count[5m]))) > 14.4 * (1 - 0.99)` {
+		t.Errorf("unexpected fast burn rule: %+v", fast)
+	}
+	if rules["XLatencyMsLatencySlowBurn"].Labels["severity"] != "page" {
+		t.Error("expected slow burn rule to page")
+	}
+	if r := rules["XLatencyMsLatencySustainedBudgetBurn"]; r.Labels["severity"] != "ticket" || !strings.Contains(r.Expr, "[3d]") {
+		t.Errorf("unexpected sustained budget burn rule: %+v", r)
+	}
+
+	ratio := rules["XTotalErrorRatio"]
+	if ratio.Expr != `sum(rate(x_total{status="failed"}[5m])) by (pod) / sum(rate(x_total[5m])) by (pod) > 0.05` {
+		t.Errorf("unexpected error ratio expr: %s", ratio.Expr)
+	}
+
+	if r := rules["XLatencyMsAbsent"]; r.Expr != "absent(x_latency_ms_count)" || r.For != "30m" {
+		t.Errorf("unexpected absent rule: %+v", r)
+	}
+	if r := rules["XDepthAbsent"]; r.Expr != "absent(x_depth)" {
+		t.Errorf("unexpected absent rule: %+v", r)
+	}
+	if _, ok := rules["XTotalAbsent"]; ok {
+		t.Error("expected no absent rule for a metric that disables it")
+	}
+}
+
+func TestAlertValidation(t *testing.T) {
+	const rows = `{title: T, uid: t, rows: [{title: R, panels: [{title: P, kind: gauge, metric: m}]}], `
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{rows + `alerts: {metrics: {other: {absent: true}}}}`, `alerts.metrics.other: metric isn't charted by any panel`},
+		{rows + `alerts: {metrics: {m: {absent: false, absentFor: 5m}}}}`, `alerts.metrics.m.absentFor: absent is disabled`},
+		{rows + `alerts: {metrics: {m: {latency: {objective: 0.9, threshold: 1}}}}}`, `alerts.metrics.m.latency: metric isn't charted as a histogram`},
+		{rows + `alerts: {metrics: {m: {errorRatio: {selector: 'a="b"', max: 5}}}}}`, `alerts.metrics.m.errorRatio.max: must be between 0 and 1`},
+		{rows + `alerts: {absentFor: soon}}`, `alerts.absentFor: not a valid duration string: "soon"`},
+	}
+
+	for _, tt := range tests {
+		_, err := parseSpec([]byte(tt.spec))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.spec, tt.expected, err)
+		}
+	}
+}
+
+func TestCheckRules(t *testing.T) {
+	err := checkRules(ruleGroups{Groups: []ruleGroup{{Name: "g", Rules: []rule{
+		{Alert: "Bad-Name", Expr: "up"},
+		{Alert: "Unbalanced", Expr: `sum(rate(x{a="b"}[5m])`},
+		{Alert: "BadFor", Expr: "up", For: "1 minute"},
+		{Alert: "BadLabel", Expr: "up", Labels: map[string]string{"a-b": "c"}},
+		{Alert: "BadFor", Expr: "up"},
+	}}}})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	for _, expected := range []string{
+		"Bad-Name: invalid alert name",
+		`Unbalanced: expr: unclosed '('`,
+		"BadFor: for: not a valid duration string",
+		`BadLabel: invalid label name "a-b"`,
+		"BadFor: duplicate alert name",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestBuildErrorRatioRuleWithTotal(t *testing.T) {
+	spec, err := parseSpec([]byte(`
+title: T
+uid: t
+rows:
+  - title: R
+    panels:
+      - {title: Failures, kind: error-ratio, metric: x_failed_total, total: x_created_total}
+alerts:
+  metrics:
+    x_failed_total:
+      errorRatio: {total: x_created_total, max: 0.1}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var alerts []string
+	for _, r := range spec.buildRules().Groups[0].Rules {
+		alerts = append(alerts, r.Alert)
+		if r.Alert == "XFailedTotalErrorRatio" && r.Expr != `sum(rate(x_failed_total[5m])) by (pod) / sum(rate(x_created_total[5m])) by (pod) > 0.1` {
+			t.Errorf("unexpected error ratio expr: %s", r.Expr)
+		}
+	}
+
+	// The total is charted too, so it gets an absence alert of its own.
+	if !reflect.DeepEqual(alerts, []string{"XFailedTotalErrorRatio", "XFailedTotalAbsent", "XCreatedTotalAbsent"}) {
+		t.Errorf("unexpected rules: %v", alerts)
+	}
+}
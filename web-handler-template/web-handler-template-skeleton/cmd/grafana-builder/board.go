@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/grafana-tools/sdk"
+)
+
+// datasourceVariable is the name of the template variable that selects the Prometheus datasource.
+const datasourceVariable = "datasource"
+
+// Panel layout on Grafana's 24 column grid.
+const (
+	panelWidth  = 12
+	panelHeight = 8
+	gridWidth   = 24
+)
+
+// boardRow is a titled row of panels, typically one per subsystem.
+type boardRow struct {
+	title  string
+	panels []*sdk.Panel
+}
+
+// buildBoard assembles rows of panels into a dashboard. Each row starts with a row panel, and its
+// panels are laid out left to right, wrapping onto a new line when the grid is full.
+func buildBoard(title string, uid string, rows []boardRow) *sdk.Board {
+	board := sdk.NewBoard(title)
+	board.UID = uid
+	board.Tags = []string{"sp-connect"}
+	board.SchemaVersion = 27
+	board.Time = sdk.Time{From: "now-6h", To: "now"}
+	board.Timepicker.RefreshIntervals = []string{"30s", "1m", "5m", "15m", "30m", "1h"}
+	board.Templating.List = []sdk.TemplateVar{
+		datasourceTemplateVar(),
+		queryTemplateVar("pod"),
+		queryTemplateVar("op"),
+	}
+
+	var id uint
+	y := 0
+
+	for _, r := range rows {
+		id++
+		row := &sdk.Panel{
+			CommonPanel: sdk.CommonPanel{ID: id, OfType: sdk.RowType, Title: r.title, Type: "row"},
+			RowPanel:    &sdk.RowPanel{Panels: []sdk.Panel{}},
+		}
+		setGridPos(row, 0, y, gridWidth, 1)
+		board.Panels = append(board.Panels, row)
+		y++
+
+		for i, p := range r.panels {
+			id++
+			p.ID = id
+			setGridPos(p, (i%(gridWidth/panelWidth))*panelWidth, y+(i/(gridWidth/panelWidth))*panelHeight, panelWidth, panelHeight)
+			board.Panels = append(board.Panels, p)
+		}
+
+		y += (len(r.panels) + gridWidth/panelWidth - 1) / (gridWidth / panelWidth) * panelHeight
+	}
+
+	return board
+}
+
+func setGridPos(panel *sdk.Panel, x int, y int, w int, h int) {
+	panel.GridPos.X = intP(x)
+	panel.GridPos.Y = intP(y)
+	panel.GridPos.W = intP(w)
+	panel.GridPos.H = intP(h)
+}
+
+// datasourceTemplateVar builds the variable that lets the viewer choose a Prometheus datasource.
+func datasourceTemplateVar() sdk.TemplateVar {
+	return sdk.TemplateVar{
+		Name:    datasourceVariable,
+		Label:   "Datasource",
+		Type:    "datasource",
+		Query:   "prometheus",
+		Options: []sdk.Option{},
+		Current: sdk.Current{
+			Text:  &sdk.StringSliceString{Value: []string{"prometheus"}, Valid: true},
+			Value: "prometheus",
+		},
+	}
+}
+
+// queryTemplateVar builds a multi-value variable populated from the values of a label. "All"
+// matches any value, including series without the label.
+func queryTemplateVar(label string) sdk.TemplateVar {
+	datasource := "$" + datasourceVariable
+	refresh := int64(2)
+
+	return sdk.TemplateVar{
+		Name:       label,
+		Label:      label,
+		Type:       "query",
+		Datasource: &datasource,
+		Query:      "label_values(" + label + ")",
+		Refresh:    sdk.BoolInt{Flag: true, Value: &refresh},
+		Options:    []sdk.Option{},
+		IncludeAll: true,
+		AllValue:   ".*",
+		Multi:      true,
+		Sort:       1,
+		Current: sdk.Current{
+			Text:  &sdk.StringSliceString{Value: []string{"All"}, Valid: true},
+			Value: []string{"$__all"},
+		},
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana-tools/sdk"
+)
+
+func TestBuildBoardLayout(t *testing.T) {
+	board := buildBoard("Test", "test", []boardRow{
+		{title: "A", panels: []*sdk.Panel{buildHistRateGraph("1", "m"), buildHistRateGraph("2", "m"), buildHistRateGraph("3", "m")}},
+		{title: "B", panels: []*sdk.Panel{buildHistRateGraph("4", "m")}},
+	})
+
+	expected := [][4]int{
+		{0, 0, 24, 1},
+		{0, 1, 12, 8},
+		{12, 1, 12, 8},
+		{0, 9, 12, 8},
+		{0, 17, 24, 1},
+		{0, 18, 12, 8},
+	}
+
+	if len(board.Panels) != len(expected) {
+		t.Fatalf("expected %d panels, got %d", len(expected), len(board.Panels))
+	}
+
+	for i, p := range board.Panels {
+		actual := [4]int{*p.GridPos.X, *p.GridPos.Y, *p.GridPos.W, *p.GridPos.H}
+		if actual != expected[i] {
+			t.Errorf("panel %d (%s): expected %v, got %v", i, p.Title, expected[i], actual)
+		}
+		if p.ID != uint(i+1) {
+			t.Errorf("panel %d: expected id %d, got %d", i, i+1, p.ID)
+		}
+	}
+}
+
+func TestPushBoard(t *testing.T) {
+	var received struct {
+		Dashboard map[string]interface{} `json:"dashboard"`
+		Overwrite bool                   `json:"overwrite"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/dashboards/db" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	board := buildBoard("Test", "test", nil)
+	if err := pushBoard(context.Background(), server.URL, "admin:admin", 0, board); err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Dashboard["uid"] != "test" || received.Dashboard["id"] != nil || !received.Overwrite {
+		t.Errorf("unexpected request: %+v", received)
+	}
+}
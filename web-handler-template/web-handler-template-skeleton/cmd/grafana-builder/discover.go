@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// scrapeMetrics reads a Prometheus text exposition from a URL (eg. http://localhost:8080/metrics) or a file.
+func scrapeMetrics(source string) (map[string]*dto.MetricFamily, error) {
+	var r io.Reader
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		resp, err := http.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: unexpected status %s", source, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	return families, nil
+}
+
+// discoveredPanels returns the panels a metric family should have, by its type: latency and rate
+// panels for histograms in milliseconds, a rate panel for other histograms and counters, and a gauge
+// panel for gauges. Summaries and untyped metrics get no panels.
+func discoveredPanels(name string, family *dto.MetricFamily, prefix string) []panelSpec {
+	byOp := hasLabel(family, "op")
+	title := metricTitle(strings.TrimPrefix(name, prefix))
+
+	switch family.GetType() {
+	case dto.MetricType_HISTOGRAM:
+		rate := panelSpec{Title: title + " Rate", Kind: "rate", Metric: name, ByOp: byOp}
+		if !strings.HasSuffix(name, "_ms") {
+			return []panelSpec{rate}
+		}
+		return []panelSpec{{Title: title + " Latency", Kind: "latency", Metric: name, ByOp: byOp}, rate}
+	case dto.MetricType_COUNTER:
+		return []panelSpec{{Title: title + " Rate", Kind: "counter", Metric: name, ByOp: byOp}}
+	case dto.MetricType_GAUGE:
+		return []panelSpec{{Title: title, Kind: "gauge", Metric: name, ByOp: byOp}}
+	}
+
+	return nil
+}
+
+// discoverSpec generates a spec with a row per subsystem (the first word of the metric name after the
+// prefix) for the metric families whose names start with prefix.
+func discoverSpec(title string, uid string, families map[string]*dto.MetricFamily, prefix string) *dashboardSpec {
+	spec := &dashboardSpec{Title: title, UID: uid}
+	rows := map[string]int{}
+
+	for _, name := range sortedFamilyNames(families, prefix) {
+		panels := discoveredPanels(name, families[name], prefix)
+		if len(panels) == 0 {
+			continue
+		}
+
+		subsystem := metricTitle(strings.SplitN(strings.TrimPrefix(name, prefix), "_", 2)[0])
+		i, ok := rows[subsystem]
+		if !ok {
+			i = len(spec.Rows)
+			rows[subsystem] = i
+			spec.Rows = append(spec.Rows, rowSpec{Title: subsystem})
+		}
+		spec.Rows[i].Panels = append(spec.Rows[i].Panels, panels...)
+	}
+
+	return spec
+}
+
+// reportDrift compares a spec against scraped metrics. It reports metrics that have no panel, or are
+// missing one of the panels their type calls for, and panels whose metric wasn't scraped.
+func reportDrift(spec *dashboardSpec, families map[string]*dto.MetricFamily, prefix string) []string {
+	charted := map[string]map[string]bool{}
+	var drift []string
+
+	for i, r := range spec.Rows {
+		for j, p := range r.Panels {
+			if charted[p.Metric] == nil {
+				charted[p.Metric] = map[string]bool{}
+			}
+			charted[p.Metric][p.Kind] = true
+			if p.Total != "" {
+				if charted[p.Total] == nil {
+					charted[p.Total] = map[string]bool{}
+				}
+				charted[p.Total][p.Kind] = true
+			}
+
+			if _, ok := families[p.Metric]; !ok {
+				drift = append(drift, fmt.Sprintf("rows[%d].panels[%d] %q: metric %s wasn't scraped", i, j, p.Title, p.Metric))
+			}
+		}
+	}
+
+	for _, name := range sortedFamilyNames(families, prefix) {
+		expected := discoveredPanels(name, families[name], prefix)
+		if len(expected) == 0 {
+			continue
+		}
+
+		kinds, ok := charted[name]
+		if !ok {
+			drift = append(drift, fmt.Sprintf("metric %s has no panel", name))
+			continue
+		}
+
+		for _, p := range expected {
+			if !kinds[p.Kind] {
+				drift = append(drift, fmt.Sprintf("metric %s has no %s panel", name, p.Kind))
+			}
+		}
+	}
+
+	return drift
+}
+
+// sortedFamilyNames returns the names of the metric families that start with prefix, sorted.
+func sortedFamilyNames(families map[string]*dto.MetricFamily, prefix string) []string {
+	var names []string
+	for name := range families {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// hasLabel reports whether any of the family's series has the label.
+func hasLabel(family *dto.MetricFamily, label string) bool {
+	for _, m := range family.GetMetric() {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == label {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// unitSuffixes are dropped from metric names when titling panels.
+var unitSuffixes = []string{"_ms", "_total", "_seconds", "_bytes"}
+
+// metricTitle converts a metric name to a panel title (eg. "queue_latency_ms" to "Queue Latency").
+func metricTitle(name string) string {
+	for _, suffix := range unitSuffixes {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	name = strings.TrimSuffix(name, "_latency")
+
+	var words []string
+	for _, word := range strings.Split(name, "_") {
+		if word != "" {
+			words = append(words, strings.ToUpper(word[:1])+word[1:])
+		}
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const exposition = `# HELP go_goroutines Number of goroutines that currently exist.
+# TYPE go_goroutines gauge
+go_goroutines 12
+# HELP sp_connect_queue_latency_ms Queue latency.
+# TYPE sp_connect_queue_latency_ms histogram
+sp_connect_queue_latency_ms_bucket{op="send",le="10"} 1
+sp_connect_queue_latency_ms_bucket{op="send",le="+Inf"} 2
+sp_connect_queue_latency_ms_sum{op="send"} 12
+sp_connect_queue_latency_ms_count{op="send"} 2
+# HELP sp_connect_queue_depth Queue depth.
+# TYPE sp_connect_queue_depth gauge
+sp_connect_queue_depth 3
+# HELP sp_connect_invocations_created_total Invocations created.
+# TYPE sp_connect_invocations_created_total counter
+sp_connect_invocations_created_total{type="std:test-connection"} 4
+`
+
+func TestDiscoverSpec(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(exposition))
+	}))
+	defer srv.Close()
+
+	families, err := scrapeMetrics(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := discoverSpec("T", "t", families, "sp_connect_")
+	expected := []rowSpec{
+		{Title: "Invocations", Panels: []panelSpec{
+			{Title: "Invocations Created Rate", Kind: "counter", Metric: "sp_connect_invocations_created_total"},
+		}},
+		{Title: "Queue", Panels: []panelSpec{
+			{Title: "Queue Depth", Kind: "gauge", Metric: "sp_connect_queue_depth"},
+			{Title: "Queue Latency", Kind: "latency", Metric: "sp_connect_queue_latency_ms", ByOp: true},
+			{Title: "Queue Rate", Kind: "rate", Metric: "sp_connect_queue_latency_ms", ByOp: true},
+		}},
+	}
+	if !reflect.DeepEqual(spec.Rows, expected) {
+		t.Errorf("unexpected rows: %+v", spec.Rows)
+	}
+
+	if err := spec.validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReportDrift(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.txt")
+	if err := ioutil.WriteFile(path, []byte(exposition), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := scrapeMetrics(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := parseSpec([]byte(`
+title: T
+uid: t
+rows:
+  - title: Queue
+    panels:
+      - {title: Queue Latency, kind: latency, metric: sp_connect_queue_latency_ms, byOp: true}
+      - {title: Invocation Failures, kind: error-ratio, metric: sp_connect_invocations_created_total, errorSelector: 'a="b"'}
+      - {title: Gone, kind: gauge, metric: sp_connect_gone}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`rows[0].panels[2] "Gone": metric sp_connect_gone wasn't scraped`,
+		"metric sp_connect_invocations_created_total has no counter panel",
+		"metric sp_connect_queue_depth has no panel",
+		"metric sp_connect_queue_latency_ms has no rate panel",
+	}
+	if drift := reportDrift(spec, families, "sp_connect_"); !reflect.DeepEqual(drift, expected) {
+		t.Errorf("unexpected drift: %q", drift)
+	}
+}
@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
+	_ "embed"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"strings"
+	"net/http"
+	"os"
+	"path/filepath"
 
 	"github.com/grafana-tools/sdk"
 )
 
+// Label selectors applied to every query so that panels follow the dashboard's template variables.
+const (
+	histVecSelector = `pod=~"$pod",op=~"$op"`
+	histSelector    = `pod=~"$pod"`
+)
+
 func intP(i int) *int {
 	return &i
 }
@@ -23,17 +34,12 @@ func boolP(b bool) *bool {
 }
 
 func addGraphPanelDefaults(graph *sdk.Panel) {
-	var datasource = "prometheus"
+	var datasource = "$" + datasourceVariable
 
 	graph.Datasource = &datasource
 	graph.Lines = true
 	graph.Span = 0
 
-	graph.GridPos.H = intP(8)
-	graph.GridPos.W = intP(12)
-	graph.GridPos.X = intP(12)
-	graph.GridPos.Y = intP(0)
-
 	graph.GraphPanel.AliasColors = map[string]interface{}{}
 	graph.GraphPanel.Dashes = boolP(false)
 	graph.GraphPanel.DashLength = uintP(10)
@@ -80,12 +86,12 @@ func buildHistVecLatencyGraph(panelName string, metricName string) *sdk.Panel {
 	graph.AddTarget(&sdk.Target{
 		RefID:        "A",
 		LegendFormat: "{{op}} 90th Percentile",
-		Expr:         fmt.Sprintf("histogram_quantile(0.9, sum(rate(%s_bucket[$__rate_interval])) by (op,le))", metricName),
+		Expr:         fmt.Sprintf("histogram_quantile(0.9, sum(rate(%s_bucket{%s}[$__rate_interval])) by (op,le))", metricName, histVecSelector),
 	})
 	graph.AddTarget(&sdk.Target{
 		RefID:        "B",
 		LegendFormat: "{{op}} Average",
-		Expr:         fmt.Sprintf("(sum(rate(%s_sum[$__rate_interval])) by (op)) / (sum(rate(%s_count[$__rate_interval])) by (op))", metricName, metricName),
+		Expr:         fmt.Sprintf("(sum(rate(%s_sum{%s}[$__rate_interval])) by (op)) / (sum(rate(%s_count{%s}[$__rate_interval])) by (op))", metricName, histVecSelector, metricName, histVecSelector),
 	})
 	return graph
 }
@@ -99,7 +105,7 @@ func buildHistVecRateGraph(panelName string, metricName string) *sdk.Panel {
 	graph.AddTarget(&sdk.Target{
 		RefID:        "A",
 		LegendFormat: "{{op}} / sec",
-		Expr:         fmt.Sprintf("sum(rate(%s_count[5m])) by (op)", metricName),
+		Expr:         fmt.Sprintf("sum(rate(%s_count{%s}[5m])) by (op)", metricName, histVecSelector),
 	})
 	return graph
 }
@@ -113,12 +119,12 @@ func buildHistLatencyGraph(panelName string, metricName string) *sdk.Panel {
 	graph.AddTarget(&sdk.Target{
 		RefID:        "A",
 		LegendFormat: "90th Percentile",
-		Expr:         fmt.Sprintf("histogram_quantile(0.9, sum(rate(%s_bucket[$__rate_interval])) by (le))", metricName),
+		Expr:         fmt.Sprintf("histogram_quantile(0.9, sum(rate(%s_bucket{%s}[$__rate_interval])) by (le))", metricName, histSelector),
 	})
 	graph.AddTarget(&sdk.Target{
 		RefID:        "B",
 		LegendFormat: "Average",
-		Expr:         fmt.Sprintf("(sum(rate(%s_sum[$__rate_interval]))) / (sum(rate(%s_count[$__rate_interval])))", metricName, metricName),
+		Expr:         fmt.Sprintf("(sum(rate(%s_sum{%s}[$__rate_interval]))) / (sum(rate(%s_count{%s}[$__rate_interval])))", metricName, histSelector, metricName, histSelector),
 	})
 	return graph
 }
@@ -132,83 +138,190 @@ func buildHistRateGraph(panelName string, metricName string) *sdk.Panel {
 	graph.AddTarget(&sdk.Target{
 		RefID:        "A",
 		LegendFormat: "Per Second",
-		Expr:         fmt.Sprintf("sum(rate(%s_count[$__rate_interval]))", metricName),
+		Expr:         fmt.Sprintf("sum(rate(%s_count{%s}[$__rate_interval]))", metricName, histSelector),
+	})
+	return graph
+}
+
+// Graph the per second rate of a counter
+func buildCounterRateGraph(panelName string, metricName string, byOp bool) *sdk.Panel {
+	graph := sdk.NewGraph(panelName)
+	addGraphPanelDefaults(graph)
+
+	selector, by, legend := histSelector, "", "Per Second"
+	if byOp {
+		selector, by, legend = histVecSelector, " by (op)", "{{op}} / sec"
+	}
+
+	graph.GraphPanel.Yaxes[0].Format = "ops"
+	graph.AddTarget(&sdk.Target{
+		RefID:        "A",
+		LegendFormat: legend,
+		Expr:         fmt.Sprintf("sum(rate(%s{%s}[$__rate_interval]))%s", metricName, selector, by),
+	})
+	return graph
+}
+
+// Graph the share of operations that failed, where errorSelector picks out the failures. If totalName is
+// set, metricName only counts failures and totalName counts every operation.
+func buildErrorRatioGraph(panelName string, metricName string, totalName string, errorSelector string, byOp bool) *sdk.Panel {
+	graph := sdk.NewGraph(panelName)
+	addGraphPanelDefaults(graph)
+
+	selector, by, legend := histSelector, "", "Error Ratio"
+	if byOp {
+		selector, by, legend = histVecSelector, " by (op)", "{{op}} Error Ratio"
+	}
+
+	failures := selector
+	if errorSelector != "" {
+		failures += "," + errorSelector
+	}
+	if totalName == "" {
+		totalName = metricName
+	}
+
+	graph.GraphPanel.Yaxes[0].Format = "percentunit"
+	graph.AddTarget(&sdk.Target{
+		RefID:        "A",
+		LegendFormat: legend,
+		Expr:         fmt.Sprintf("sum(rate(%s{%s}[$__rate_interval]))%s / sum(rate(%s{%s}[$__rate_interval]))%s", metricName, failures, by, totalName, selector, by),
+	})
+	return graph
+}
+
+// Graph the current value of a gauge
+func buildGaugeGraph(panelName string, metricName string, byOp bool) *sdk.Panel {
+	graph := sdk.NewGraph(panelName)
+	addGraphPanelDefaults(graph)
+
+	selector, by, legend := histSelector, "", "Value"
+	if byOp {
+		selector, by, legend = histVecSelector, " by (op)", "{{op}}"
+	}
+
+	graph.AddTarget(&sdk.Target{
+		RefID:        "A",
+		LegendFormat: legend,
+		Expr:         fmt.Sprintf("sum(%s{%s})%s", metricName, selector, by),
 	})
 	return graph
 }
 
-func slugName(panelName string) string {
-	return strings.ReplaceAll(strings.ToLower(panelName), " ", "_")
+// Graph the distribution of a histogram metric over time
+func buildHistHeatmap(panelName string, metricName string) *sdk.Panel {
+	heatmap := sdk.NewHeatmap(panelName)
+	datasource := "$" + datasourceVariable
+
+	heatmap.Datasource = &datasource
+	heatmap.HeatmapPanel.DataFormat = "tsbuckets"
+	heatmap.HeatmapPanel.Color.CardColor = "#b4ff00"
+	heatmap.HeatmapPanel.Color.ColorScale = "sqrt"
+	heatmap.HeatmapPanel.Color.ColorScheme = "interpolateSpectral"
+	heatmap.HeatmapPanel.Color.Exponent = 0.5
+	heatmap.HeatmapPanel.Color.Mode = "spectrum"
+	heatmap.HeatmapPanel.Legend.Show = true
+	heatmap.HeatmapPanel.Tooltip.Show = true
+	heatmap.HeatmapPanel.XAxis.Show = true
+	heatmap.HeatmapPanel.YAxis.Format = "ms"
+	heatmap.HeatmapPanel.YAxis.LogBase = 1
+	heatmap.HeatmapPanel.YAxis.Show = true
+	heatmap.HeatmapPanel.YBucketBound = "auto"
+	heatmap.AddTarget(&sdk.Target{
+		RefID:        "A",
+		LegendFormat: "{{le}}",
+		Format:       "heatmap",
+		Expr:         fmt.Sprintf("sum(increase(%s_bucket{%s}[$__rate_interval])) by (le)", metricName, histVecSelector),
+	})
+	return heatmap
 }
 
-func writePanel(panelName string, panel *sdk.Panel) error {
-	raw, err := json.Marshal(panel)
+func writeBoard(path string, board *sdk.Board) error {
+	raw, err := json.MarshalIndent(board, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(fmt.Sprintf("_data/%s.json", slugName(panelName)), raw, 0644)
-	if err != nil {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
 	}
 
-	return nil
+	return ioutil.WriteFile(path, raw, 0644)
+}
+
+// pushBoard creates or overwrites the dashboard through the Grafana HTTP API. The credentials are
+// either an API key or "user:password" for basic auth (eg. "admin:admin" for a local container).
+func pushBoard(ctx context.Context, url string, credentials string, folderID int, board *sdk.Board) error {
+	client := sdk.NewClient(url, credentials, http.DefaultClient)
+
+	// Dashboards are matched by UID, so the generated ID must not be sent.
+	b := *board
+	b.ID = 0
+	b.UpdateSlug()
+
+	_, err := client.SetDashboard(ctx, b, sdk.SetDashboardParams{FolderID: folderID, Overwrite: true})
+	return err
 }
 
+//go:embed dashboard.yaml
+var defaultSpec []byte
+
 func main() {
-	histVecLatencyPanels := map[string]string{
-		"sp_connect_dynamo_connector_group_latency_ms": "Connector Group Repo Op Latency",
-		"sp_connect_dynamo_connector_latency_ms":       "Connector Repo Op Latency",
-		"sp_connect_dynamo_invocation_latency_ms":      "Invocation Repo Op Latency",
-		"sp_connect_queue_latency_ms":                  "Queue Op Latency",
-		"sp_connect_redis_lock_latency_ms":             "Redis Lock Op Latency",
-		"sp_connect_redis_kvs_latency_ms":              "Redis KVS Op Latency",
-		"sp_connect_response_gateway_latency_recv_ms":  "Gateway to Connect Latency",
+	specPath := flag.String("spec", "", "dashboard spec file (yaml or json); defaults to the built-in sp-connect dashboard")
+	out := flag.String("out", "_data/dashboard.json", "path the dashboard json is written to")
+	rulesOut := flag.String("rules-out", "_data/rules.yaml", "path the prometheus alerting rules are written to; empty to skip")
+	grafanaURL := flag.String("grafana-url", "", "if set, the dashboard is also pushed to this Grafana (eg. http://localhost:3000)")
+	grafanaCredentials := flag.String("grafana-credentials", os.Getenv("GRAFANA_API_KEY"), "Grafana API key or user:password (default $GRAFANA_API_KEY)")
+	folderID := flag.Int("grafana-folder-id", 0, "Grafana folder the dashboard is pushed to")
+	discover := flag.String("discover", "", "if set, panels are generated from the metrics exposed at this URL or file instead of the spec, and drift from the spec is reported")
+	discoverPrefix := flag.String("discover-prefix", "sp_connect_", "only metrics with this prefix are discovered")
+	failOnDrift := flag.Bool("fail-on-drift", false, "exit with an error if -discover finds drift between the spec and the metrics")
+	flag.Parse()
+
+	var spec *dashboardSpec
+	var err error
+	if *specPath != "" {
+		spec, err = readSpec(*specPath)
+	} else {
+		spec, err = parseSpec(defaultSpec)
 	}
-	for metricName, panelName := range histVecLatencyPanels {
-		panel := buildHistVecLatencyGraph(panelName, metricName)
-		err := writePanel(panelName, panel)
-		if err != nil {
-			log.Fatal(err)
-		}
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	histVecRatePanels := map[string]string{
-		"sp_connect_dynamo_connector_group_latency_ms": "Connector Group Op Rate",
-		"sp_connect_dynamo_connector_latency_ms":       "Connector Repo Op Rate",
-		"sp_connect_dynamo_invocation_latency_ms":      "Invocation Repo Op Rate",
-		"sp_connect_queue_latency_ms":                  "Queue Op Rate",
-		"sp_connect_redis_lock_latency_ms":             "Redis Lock Op Rate",
-		"sp_connect_redis_kvs_latency_ms":              "Redis KVS Op Rate",
-	}
-	for metricName, panelName := range histVecRatePanels {
-		panel := buildHistVecRateGraph(panelName, metricName)
-		err := writePanel(panelName, panel)
+	if *discover != "" {
+		families, err := scrapeMetrics(*discover)
 		if err != nil {
 			log.Fatal(err)
 		}
+
+		drift := reportDrift(spec, families, *discoverPrefix)
+		for _, d := range drift {
+			log.Printf("drift: %s", d)
+		}
+		if len(drift) > 0 && *failOnDrift {
+			log.Fatalf("%d differences between the spec and %s", len(drift), *discover)
+		}
+
+		discovered := discoverSpec(spec.Title, spec.UID, families, *discoverPrefix)
+		discovered.Alerts = spec.Alerts.forMetrics(discovered.metricFamilies())
+		spec = discovered
 	}
 
-	histLatencyPanels := map[string]string{
-		"sp_connect_publish_response_kafka_latency_ms": "Publish to Kafka Latency",
-		"sp_connect_publish_sqs_response_latency_ms":   "Publish to SQS Latency",
+	board := buildBoard(spec.Title, spec.UID, spec.buildRows())
+
+	if err := writeBoard(*out, board); err != nil {
+		log.Fatal(err)
 	}
-	for metricName, panelName := range histLatencyPanels {
-		panel := buildHistLatencyGraph(panelName, metricName)
-		err := writePanel(panelName, panel)
-		if err != nil {
+
+	if *rulesOut != "" {
+		if err := writeRules(*rulesOut, spec.buildRules()); err != nil {
 			log.Fatal(err)
 		}
 	}
 
-	histRatePanels := map[string]string{
-		"sp_connect_publish_response_kafka_latency_ms": "Publish to Kafka Rate",
-		"sp_connect_publish_sqs_response_latency_ms":   "Publish to SQS Rate",
-	}
-	for metricName, panelName := range histRatePanels {
-		panel := buildHistRateGraph(panelName, metricName)
-		err := writePanel(panelName, panel)
-		if err != nil {
+	if *grafanaURL != "" {
+		if err := pushBoard(context.Background(), *grafanaURL, *grafanaCredentials, *folderID, board); err != nil {
 			log.Fatal(err)
 		}
 	}
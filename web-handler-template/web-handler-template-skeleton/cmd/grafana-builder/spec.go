@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/grafana-tools/sdk"
+	"gopkg.in/yaml.v2"
+)
+
+// dashboardSpec is a declarative dashboard definition. Specs are written in YAML, and since YAML
+// is a superset of JSON, JSON specs are accepted too.
+type dashboardSpec struct {
+	Title  string     `yaml:"title"`
+	UID    string     `yaml:"uid"`
+	Rows   []rowSpec  `yaml:"rows"`
+	Alerts alertsSpec `yaml:"alerts"`
+}
+
+// rowSpec is a titled row of panels.
+type rowSpec struct {
+	Title  string      `yaml:"title"`
+	Panels []panelSpec `yaml:"panels"`
+}
+
+// panelSpec describes a single panel.
+type panelSpec struct {
+	Title  string `yaml:"title"`
+	Kind   string `yaml:"kind"`
+	Metric string `yaml:"metric"`
+
+	// ByOp breaks the panel down by the metric's "op" label.
+	ByOp bool `yaml:"byOp"`
+
+	// Unit overrides the kind's default y-axis unit (eg. "ms", "ops", "percentunit").
+	Unit string `yaml:"unit"`
+
+	// ErrorSelector is the label selector that picks out failures, for error-ratio panels
+	// (eg. `status="failed"`).
+	ErrorSelector string `yaml:"errorSelector"`
+
+	// Total is the metric counting every operation, for error-ratio panels whose metric only counts
+	// failures (eg. `my_invocations_created_total` for `my_invocations_failed_total`).
+	Total string `yaml:"total"`
+
+	Thresholds []thresholdSpec `yaml:"thresholds"`
+}
+
+// thresholdSpec is a threshold line drawn on a graph panel.
+type thresholdSpec struct {
+	Value float32 `yaml:"value"`
+
+	// Op is "gt" (the default) to shade above the value, or "lt" to shade below it.
+	Op string `yaml:"op"`
+
+	// Severity is "critical" (the default), "warning" or "ok".
+	Severity string `yaml:"severity"`
+}
+
+// panelKind builds the panel for a spec and supplies its default unit.
+type panelKind struct {
+	build func(p panelSpec) *sdk.Panel
+	unit  string
+}
+
+// panelKinds are the kinds of panel a spec can ask for.
+var panelKinds = map[string]panelKind{
+	"latency": {
+		build: func(p panelSpec) *sdk.Panel {
+			if p.ByOp {
+				return buildHistVecLatencyGraph(p.Title, p.Metric)
+			}
+			return buildHistLatencyGraph(p.Title, p.Metric)
+		},
+		unit: "ms",
+	},
+	"rate": {
+		build: func(p panelSpec) *sdk.Panel {
+			if p.ByOp {
+				return buildHistVecRateGraph(p.Title, p.Metric)
+			}
+			return buildHistRateGraph(p.Title, p.Metric)
+		},
+		unit: "ops",
+	},
+	"counter": {
+		build: func(p panelSpec) *sdk.Panel {
+			return buildCounterRateGraph(p.Title, p.Metric, p.ByOp)
+		},
+		unit: "ops",
+	},
+	"error-ratio": {
+		build: func(p panelSpec) *sdk.Panel {
+			return buildErrorRatioGraph(p.Title, p.Metric, p.Total, p.ErrorSelector, p.ByOp)
+		},
+		unit: "percentunit",
+	},
+	"gauge": {
+		build: func(p panelSpec) *sdk.Panel {
+			return buildGaugeGraph(p.Title, p.Metric, p.ByOp)
+		},
+		unit: "short",
+	},
+	"heatmap": {
+		build: func(p panelSpec) *sdk.Panel {
+			return buildHistHeatmap(p.Title, p.Metric)
+		},
+		unit: "ms",
+	},
+}
+
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// readSpec reads and validates a spec file.
+func readSpec(path string) (*dashboardSpec, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := parseSpec(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return spec, nil
+}
+
+// parseSpec parses and validates a spec. Unknown fields are rejected so that typos don't go unnoticed.
+func parseSpec(raw []byte) (*dashboardSpec, error) {
+	spec := &dashboardSpec{}
+	if err := yaml.UnmarshalStrict(raw, spec); err != nil {
+		return nil, err
+	}
+
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// validate checks the whole spec and reports every problem found, one per line.
+func (s *dashboardSpec) validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if s.Title == "" {
+		problem("title is required")
+	}
+	if s.UID == "" {
+		problem("uid is required")
+	}
+	if len(s.Rows) == 0 {
+		problem("at least one row is required")
+	}
+
+	for i, r := range s.Rows {
+		if r.Title == "" {
+			problem("rows[%d]: title is required", i)
+		}
+
+		for j, p := range r.Panels {
+			path := fmt.Sprintf("rows[%d].panels[%d]", i, j)
+
+			if p.Title == "" {
+				problem("%s: title is required", path)
+			}
+
+			if _, ok := panelKinds[p.Kind]; !ok {
+				problem("%s: unknown panel kind %q (expected one of %s)", path, p.Kind, strings.Join(kindNames(), ", "))
+			}
+
+			if !metricNamePattern.MatchString(p.Metric) {
+				problem("%s: invalid metric name %q", path, p.Metric)
+			}
+
+			if p.Kind == "error-ratio" && p.ErrorSelector == "" && p.Total == "" {
+				problem("%s: errorSelector or total is required for error-ratio panels", path)
+			}
+			if p.Kind != "error-ratio" && (p.ErrorSelector != "" || p.Total != "") {
+				problem("%s: errorSelector and total only apply to error-ratio panels", path)
+			}
+			if p.Total != "" && !metricNamePattern.MatchString(p.Total) {
+				problem("%s: invalid total metric name %q", path, p.Total)
+			}
+
+			if p.Kind == "heatmap" && len(p.Thresholds) > 0 {
+				problem("%s: thresholds aren't supported on heatmap panels", path)
+			}
+
+			for k, t := range p.Thresholds {
+				if t.Op != "" && t.Op != "gt" && t.Op != "lt" {
+					problem("%s.thresholds[%d]: op must be gt or lt", path, k)
+				}
+				if t.Severity != "" && t.Severity != "critical" && t.Severity != "warning" && t.Severity != "ok" {
+					problem("%s.thresholds[%d]: severity must be critical, warning or ok", path, k)
+				}
+			}
+		}
+	}
+
+	s.Alerts.validate(s.metricFamilies(), problem)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid spec:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+// kindNames returns the names of the panel kinds, sorted.
+func kindNames() []string {
+	names := make([]string, 0, len(panelKinds))
+	for name := range panelKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// buildRows builds the panels of every row in the spec.
+func (s *dashboardSpec) buildRows() []boardRow {
+	rows := make([]boardRow, 0, len(s.Rows))
+	for _, r := range s.Rows {
+		row := boardRow{title: r.Title}
+		for _, p := range r.Panels {
+			row.panels = append(row.panels, buildPanel(p))
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// buildPanel builds a panel of the spec's kind, then applies its unit and thresholds.
+func buildPanel(p panelSpec) *sdk.Panel {
+	kind := panelKinds[p.Kind]
+	panel := kind.build(p)
+
+	unit := p.Unit
+	if unit == "" {
+		unit = kind.unit
+	}
+
+	if panel.HeatmapPanel != nil {
+		panel.HeatmapPanel.YAxis.Format = unit
+		return panel
+	}
+
+	panel.GraphPanel.Yaxes[0].Format = unit
+	for _, t := range p.Thresholds {
+		threshold := sdk.Threshold{Value: t.Value, Op: t.Op, ColorMode: t.Severity, Fill: true, Line: true}
+		if threshold.Op == "" {
+			threshold.Op = "gt"
+		}
+		if threshold.ColorMode == "" {
+			threshold.ColorMode = "critical"
+		}
+		panel.GraphPanel.Thresholds = append(panel.GraphPanel.Thresholds, threshold)
+	}
+
+	return panel
+}
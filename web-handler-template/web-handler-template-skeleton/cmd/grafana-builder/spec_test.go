@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDefaultSpec(t *testing.T) {
+	spec, err := parseSpec(defaultSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(spec.buildRows()) != 6 {
+		t.Errorf("expected 6 rows, got %d", len(spec.buildRows()))
+	}
+}
+
+func TestParseJSONSpec(t *testing.T) {
+	spec, err := parseSpec([]byte(`{
+		"title": "T", "uid": "t",
+		"rows": [{"title": "R", "panels": [
+			{"title": "Failures", "kind": "error-ratio", "metric": "x_total", "errorSelector": "status=\"failed\"", "thresholds": [{"value": 0.05}]},
+			{"title": "Depth", "kind": "gauge", "metric": "x_depth", "unit": "none"},
+			{"title": "Distribution", "kind": "heatmap", "metric": "x_latency_ms"}
+		]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	panels := spec.buildRows()[0].panels
+
+	ratio := panels[0].GraphPanel
+	if ratio.Yaxes[0].Format != "percentunit" || len(ratio.Thresholds) != 1 || ratio.Thresholds[0].Op != "gt" {
+		t.Errorf("unexpected error-ratio panel: %+v", ratio)
+	}
+	if !strings.Contains(ratio.Targets[0].Expr, `x_total{pod=~"$pod",status="failed"}`) {
+		t.Errorf("unexpected error-ratio expr: %s", ratio.Targets[0].Expr)
+	}
+
+	if panels[1].GraphPanel.Yaxes[0].Format != "none" {
+		t.Errorf("expected unit override, got %s", panels[1].GraphPanel.Yaxes[0].Format)
+	}
+
+	if panels[2].HeatmapPanel == nil || panels[2].HeatmapPanel.DataFormat != "tsbuckets" {
+		t.Error("expected heatmap panel")
+	}
+}
+
+func TestSpecValidation(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{`{title: T, uid: t, rows: [{title: R, panels: [{title: P, kind: pie, metric: m}]}]}`, `rows[0].panels[0]: unknown panel kind "pie" (expected one of counter, error-ratio, gauge, heatmap, latency, rate)`},
+		{`{title: T, uid: t, rows: [{title: R, panels: [{title: P, kind: error-ratio, metric: m}]}]}`, `errorSelector or total is required`},
+		{`{title: T, uid: t, rows: [{title: R, panels: [{title: P, kind: rate, metric: "bad-name"}]}]}`, `invalid metric name "bad-name"`},
+		{`{title: T, uid: t, rows: [{title: R, panels: [{title: P, kind: rate, metric: m, colour: red}]}]}`, `field colour not found`},
+		{`{uid: t, rows: []}`, `title is required`},
+	}
+
+	for _, tt := range tests {
+		_, err := parseSpec([]byte(tt.spec))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.spec, tt.expected, err)
+		}
+	}
+}
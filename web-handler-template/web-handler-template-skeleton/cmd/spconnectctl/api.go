@@ -0,0 +1,274 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sailpoint/atlas-go/atlas/client"
+)
+
+// apiPrefix is the path of the sp-connect API on an org's URL.
+const apiPrefix = "/sp-connect"
+
+// errNotFound is returned when the API answers with a 404.
+var errNotFound = errors.New("not found")
+
+// apiError is an error response of the API, in the standard atlas format.
+type apiError struct {
+	StatusCode int    `json:"-"`
+	DetailCode string `json:"detailCode"`
+	TrackingID string `json:"trackingId"`
+	Messages   []struct {
+		Text string `json:"text"`
+	} `json:"messages"`
+}
+
+// Error gets the messages of the response, or its status if it has none.
+func (e *apiError) Error() string {
+	texts := make([]string, 0, len(e.Messages))
+	for _, m := range e.Messages {
+		texts = append(texts, m.Text)
+	}
+	if len(texts) == 0 {
+		texts = append(texts, http.StatusText(e.StatusCode))
+	}
+
+	msg := fmt.Sprintf("%d %s", e.StatusCode, strings.Join(texts, "; "))
+	if e.TrackingID != "" {
+		msg += " (tracking id " + e.TrackingID + ")"
+	}
+
+	return msg
+}
+
+// Unwrap makes 404s match errNotFound.
+func (e *apiError) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	return nil
+}
+
+// apiFlags are the flags shared by the subcommands that call the API: where it is, how to
+// authenticate and how to print what it returns.
+type apiFlags struct {
+	url          *string
+	token        *string
+	tokenURL     *string
+	clientID     *string
+	clientSecret *string
+	username     *string
+	password     *string
+	prod         *bool
+	output       *string
+}
+
+// addAPIFlags adds the API flags to fs. Those that aren't set are read from the environment, so they
+// needn't be repeated on every call.
+func addAPIFlags(fs *flag.FlagSet) *apiFlags {
+	return &apiFlags{
+		url:          fs.String("url", "", "org URL, eg. https://acme.api.identitynow.com (default $SP_CONNECT_URL)"),
+		token:        fs.String("token", "", "bearer token to call the API with (default $SP_CONNECT_TOKEN)"),
+		tokenURL:     fs.String("token-url", "", "URL tokens are requested from (default <url>/oauth/token)"),
+		clientID:     fs.String("client-id", "", "OAuth client ID, to authenticate with client credentials (default $SP_CONNECT_CLIENT_ID)"),
+		clientSecret: fs.String("client-secret", "", "OAuth client secret (default $SP_CONNECT_CLIENT_SECRET)"),
+		username:     fs.String("username", "", "username, to authenticate with a password (default $SP_CONNECT_USERNAME)"),
+		password:     fs.String("password", "", "password (default $SP_CONNECT_PASSWORD)"),
+		prod:         fs.Bool("prod", false, "whether the org of -username is in production"),
+		output:       fs.String("o", formatTable, "output format: table, json or yaml"),
+	}
+}
+
+// newAPIClient builds a client for the API from the flags. It authenticates with -token if it's set,
+// otherwise with client credentials or a username and password.
+func (f *apiFlags) newAPIClient() (*apiClient, error) {
+	for v, env := range map[*string]string{
+		f.url:          "SP_CONNECT_URL",
+		f.token:        "SP_CONNECT_TOKEN",
+		f.clientID:     "SP_CONNECT_CLIENT_ID",
+		f.clientSecret: "SP_CONNECT_CLIENT_SECRET",
+		f.username:     "SP_CONNECT_USERNAME",
+		f.password:     "SP_CONNECT_PASSWORD",
+	} {
+		if *v == "" {
+			*v = os.Getenv(env)
+		}
+	}
+
+	if *f.url == "" {
+		return nil, errors.New("-url is required")
+	}
+	if !isFormat(*f.output) {
+		return nil, fmt.Errorf("unknown output format %q", *f.output)
+	}
+
+	baseURL := strings.TrimSuffix(*f.url, "/")
+	tokenURL := *f.tokenURL
+	if tokenURL == "" {
+		tokenURL = baseURL + "/oauth/token"
+	}
+
+	var ts client.TokenSource
+	switch {
+	case *f.token != "":
+		ts = staticTokenSource(*f.token)
+	case *f.clientID != "":
+		ts = client.NewTokenSource(http.DefaultClient, tokenURL, *f.clientID, *f.clientSecret)
+	case *f.username != "":
+		ts = client.NewPasswordTokenSource(http.DefaultClient, tokenURL, *f.username, *f.password, *f.prod)
+	default:
+		return nil, errors.New("one of -token, -client-id or -username is required")
+	}
+
+	return &apiClient{
+		baseURL: baseURL + apiPrefix,
+		http:    &http.Client{Transport: &tokenTransport{source: ts, next: http.DefaultTransport}},
+		format:  *f.output,
+	}, nil
+}
+
+// staticTokenSource is a TokenSource that always gets the same token.
+type staticTokenSource string
+
+// GetToken gets the token, which never expires.
+func (s staticTokenSource) GetToken(ctx context.Context) (*client.Token, error) {
+	return &client.Token{EncodedToken: string(s)}, nil
+}
+
+// tokenTransport authenticates requests with a token from a TokenSource. The token is reused until
+// it's nearly expired.
+type tokenTransport struct {
+	source client.TokenSource
+	next   http.RoundTripper
+
+	mu    sync.Mutex
+	token *client.Token
+}
+
+// RoundTrip sends the request with a valid token.
+func (t *tokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	token, err := t.getToken(r.Context())
+	if err != nil {
+		return nil, fmt.Errorf("get token: %w", err)
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return t.next.RoundTrip(r)
+}
+
+// getToken gets the current token, or a new one if there's none or it's nearly expired. Static tokens
+// have no expiration, so they're never renewed.
+func (t *tokenTransport) getToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token == nil || (!t.token.Expiration.IsZero() && t.token.IsNearlyExpired()) {
+		token, err := t.source.GetToken(ctx)
+		if err != nil {
+			return "", err
+		}
+		t.token = token
+	}
+
+	return t.token.EncodedToken, nil
+}
+
+// apiClient calls the sp-connect API.
+type apiClient struct {
+	baseURL string
+	http    *http.Client
+	format  string
+}
+
+// do sends a request with a JSON body, unless body is nil, to the path under the API, and decodes
+// the JSON response into out, unless out is nil. Error responses are returned as an *apiError.
+func (c *apiClient) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		raw, ok := body.(json.RawMessage)
+		if !ok {
+			var err error
+			if raw, err = json.Marshal(body); err != nil {
+				return err
+			}
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		e := &apiError{StatusCode: res.StatusCode}
+		raw, _ := ioutil.ReadAll(res.Body)
+		_ = json.Unmarshal(raw, e)
+		return e
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// readJSONFile reads a file that must hold JSON, or stdin if path is "-".
+func readJSONFile(path string) (json.RawMessage, error) {
+	var (
+		raw []byte
+		err error
+	)
+	if path == "-" {
+		raw, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		raw, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(raw) {
+		return nil, fmt.Errorf("%s isn't valid JSON", path)
+	}
+
+	return raw, nil
+}
+
+// parseInterspersed parses args with fs, allowing flags after the positional arguments (eg. "invoke
+// <instance> <type> --input file"), and returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		_ = fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
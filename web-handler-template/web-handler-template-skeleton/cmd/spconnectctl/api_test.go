@@ -0,0 +1,323 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/client"
+)
+
+// fakeAPI is an sp-connect API that keeps specs and instances in memory, and answers next-result
+// with a fixed sequence of pages.
+type fakeAPI struct {
+	mu        sync.Mutex
+	specs     map[string]map[string]interface{}
+	instances map[string]map[string]interface{}
+	pages     []resultPage
+	requests  []string
+	tokens    int
+}
+
+// newFakeAPI starts a fakeAPI, which also issues client credentials tokens at /oauth/token.
+func newFakeAPI(t *testing.T) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{
+		specs:     map[string]map[string]interface{}{},
+		instances: map[string]map[string]interface{}{},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(api.serveHTTP))
+	t.Cleanup(ts.Close)
+
+	return api, ts
+}
+
+func (api *fakeAPI) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if r.URL.Path == "/oauth/token" {
+		if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		api.tokens++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "issued", "expires_in": 3600})
+		return
+	}
+
+	if r.Header.Get("Authorization") == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	api.requests = append(api.requests, r.Method+" "+r.URL.Path)
+
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	var out interface{}
+	switch {
+	case path == "/connector-specifications/validate":
+		out = map[string]interface{}{}
+	case parts[0] == "connector-specifications":
+		out = api.serveObject(w, r.Method, api.specs, parts, body)
+	case len(parts) == 3 && parts[2] == "commands":
+		out = map[string]interface{}{"invocationId": "inv-1", "connectorInstanceId": parts[1], "type": body["type"], "input": body["input"]}
+	case parts[0] == "connector-instances":
+		out = api.serveObject(w, r.Method, api.instances, parts, body)
+	case len(parts) == 3 && parts[2] == "next-result":
+		out, api.pages = api.pages[0], api.pages[1:]
+	}
+
+	if out != nil {
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
+
+// serveObject serves the collection and objects of a resource.
+func (api *fakeAPI) serveObject(w http.ResponseWriter, method string, objects map[string]map[string]interface{}, parts []string, body map[string]interface{}) interface{} {
+	if len(parts) == 1 {
+		if method == http.MethodGet {
+			list := []interface{}{}
+			for _, o := range objects {
+				list = append(list, o)
+			}
+			return list
+		}
+
+		if _, ok := body["id"]; !ok {
+			body["id"] = "id-1"
+			body["created"] = "2022-01-01T00:00:00Z"
+		}
+		objects[body["id"].(string)] = body
+		return body
+	}
+
+	o, ok := objects[parts[1]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return map[string]interface{}{"detailCode": "404 Not Found", "messages": []interface{}{map[string]interface{}{"text": "not found"}}}
+	}
+
+	switch method {
+	case http.MethodPut:
+		body["id"], body["created"] = o["id"], o["created"]
+		objects[parts[1]] = body
+		return body
+	case http.MethodDelete:
+		delete(objects, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	return o
+}
+
+// run runs a subcommand against the fake API and gets what it printed.
+func run(t *testing.T, ts *httptest.Server, name string, args ...string) (string, error) {
+	t.Helper()
+	return runWithToken(t, ts.URL, "token", name, args...)
+}
+
+// runWithToken runs a subcommand against the API at url with a bearer token and gets what it printed.
+func runWithToken(t *testing.T, url string, token string, name string, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = &out
+
+	args = append(args, "-url", url, "-token", token)
+	err := commands[name].run(args)
+
+	return out.String(), err
+}
+
+// writeFile writes a file in a temporary directory and gets its path.
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "file.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestSpecPushCreatesOrUpdates(t *testing.T) {
+	api, ts := newFakeAPI(t)
+	spec := writeFile(t, `{"id": "acme", "name": "Acme", "topology": "global", "visibility": "private"}`)
+
+	if _, err := run(t, ts, "spec", "validate", spec); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, ts, "spec", "push", spec); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, ts, "spec", "push", spec); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"POST /sp-connect/connector-specifications/validate",
+		"GET /sp-connect/connector-specifications/acme",
+		"POST /sp-connect/connector-specifications",
+		"GET /sp-connect/connector-specifications/acme",
+		"PUT /sp-connect/connector-specifications/acme",
+	}
+	if strings.Join(api.requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected requests:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(api.requests, "\n"))
+	}
+
+	out, err := run(t, ts, "spec", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "ID    NAME  TOPOLOGY  VISIBILITY\nacme  Acme  global    private\n" {
+		t.Errorf("unexpected table:\n%s", out)
+	}
+}
+
+func TestInstanceLifecycle(t *testing.T) {
+	api, ts := newFakeAPI(t)
+
+	if _, err := run(t, ts, "instance", "create", "-name", "test", "-spec", "internal"); err != nil {
+		t.Fatal(err)
+	}
+
+	config := writeFile(t, `{"mockKey": "mockValue"}`)
+	if _, err := run(t, ts, "instance", "update", "id-1", "-config", config); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(t, ts, "instance", "get", "id-1", "-o", "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "config:\n  mockKey: mockValue\nconnectorSpecId: internal\ncreated: \"2022-01-01T00:00:00Z\"\nid: id-1\nname: test\n"
+	if out != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	if _, err := run(t, ts, "instance", "delete", "id-1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.instances) != 0 {
+		t.Errorf("expected the instance to be deleted, got %v", api.instances)
+	}
+
+	_, err = run(t, ts, "instance", "get", "id-1")
+	if err == nil || err.Error() != "404 not found" {
+		t.Errorf("expected a 404, got %v", err)
+	}
+}
+
+func TestInvokeFollowsResultsUntilDone(t *testing.T) {
+	api, ts := newFakeAPI(t)
+	api.pages = []resultPage{
+		{Output: []interface{}{map[string]interface{}{"identity": "john.doe"}}},
+		{Output: []interface{}{}},
+		{Done: true, Output: []interface{}{map[string]interface{}{"identity": "jane.doe"}}},
+	}
+
+	input := writeFile(t, `{}`)
+	out, err := run(t, ts, "invoke", "id-1", "std:account:list", "--input", input, "--follow", "-o", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "{\"identity\":\"john.doe\"}\n{\"identity\":\"jane.doe\"}\n" {
+		t.Errorf("unexpected results:\n%s", out)
+	}
+	if len(api.requests) != 4 || api.requests[3] != "POST /sp-connect/invocations/inv-1/next-result" {
+		t.Errorf("unexpected requests %v", api.requests)
+	}
+}
+
+func TestResultsReturnsInvocationFailure(t *testing.T) {
+	api, ts := newFakeAPI(t)
+	api.pages = []resultPage{
+		{Done: false, Output: []interface{}{map[string]interface{}{"identity": "john.doe", "uuid": "1234"}}},
+		{Done: true, Output: []interface{}{}, Error: "[ConnectorError] Account jane.doe does not exist", ErrorType: "notFound"},
+	}
+
+	out, err := run(t, ts, "results", "inv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "IDENTITY  UUID\njohn.doe  1234\n" {
+		t.Errorf("unexpected table:\n%s", out)
+	}
+
+	_, err = run(t, ts, "results", "inv-1", "--follow")
+	if err == nil || err.Error() != "invocation failed (notFound): [ConnectorError] Account jane.doe does not exist" {
+		t.Errorf("expected the invocation's failure, got %v", err)
+	}
+}
+
+func TestClientCredentialsTokenIsReused(t *testing.T) {
+	api, ts := newFakeAPI(t)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := addAPIFlags(fs)
+	if err := fs.Parse([]string{"-url", ts.URL, "-client-id", "client", "-client-secret", "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := f.newAPIClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.do(context.Background(), http.MethodGet, "/connector-instances", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if api.tokens != 1 {
+		t.Errorf("expected 1 token to be issued, got %d", api.tokens)
+	}
+}
+
+// tokenSourceFunc is a TokenSource that gets tokens with a function.
+type tokenSourceFunc func() *client.Token
+
+func (f tokenSourceFunc) GetToken(ctx context.Context) (*client.Token, error) {
+	return f(), nil
+}
+
+func TestTokenTransportRenewsNearlyExpiredTokens(t *testing.T) {
+	var issued int
+	source := tokenSourceFunc(func() *client.Token {
+		issued++
+		return &client.Token{EncodedToken: "token", Expiration: time.Now().Add(time.Minute)}
+	})
+
+	tt := &tokenTransport{source: source}
+	for i := 0; i < 2; i++ {
+		if _, err := tt.getToken(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if issued != 2 {
+		t.Errorf("expected a token to be issued each time, got %d", issued)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sailpoint/sp-connect/pkg/contract"
+)
+
+// errContractFailed is returned when a connector doesn't honour its commands' contracts.
+var errContractFailed = errors.New("connector failed its contract test")
+
+// bearerTransport authenticates requests with a bearer token.
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+// RoundTrip sends the request with the token.
+func (t *bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(r)
+}
+
+// runContractTest checks the connector at an endpoint, a runtime that connects to this command or
+// sp-connect's internal connector against the standard commands of its spec, and writes a JUnit
+// report.
+func runContractTest(args []string) error {
+	fs := flag.NewFlagSet("contract-test", flag.ExitOnError)
+	specPath := fs.String("spec", "", "connector spec file whose commands are checked (required)")
+	distDir := fs.String("dist", "dist", "directory of the standard command definitions")
+	endpoint := fs.String("endpoint", "", "connector endpoint to send commands to, as for the global topology")
+	token := fs.String("token", os.Getenv("SP_CONNECT_CONNECTOR_TOKEN"), "bearer token sent to -endpoint (default $SP_CONNECT_CONNECTOR_TOKEN)")
+	runtimeListen := fs.String("runtime-listen", "", "address to accept a runtime's connection on (eg. :7100), instead of -endpoint")
+	internal := fs.Bool("internal", false, "check sp-connect's implementation of the internal topology, instead of -endpoint")
+	connectTimeout := fs.Duration("connect-timeout", 5*time.Minute, "how long to wait for the runtime to connect")
+	timeout := fs.Duration("timeout", contract.DefaultTimeout, "timeout of each command")
+	junit := fs.String("junit", "contract-test.xml", "path the JUnit report is written to; - for stdout")
+	_ = fs.Parse(args)
+
+	targets := 0
+	for _, set := range []bool{*endpoint != "", *runtimeListen != "", *internal} {
+		if set {
+			targets++
+		}
+	}
+	if *specPath == "" || targets != 1 {
+		fs.Usage()
+		return errors.New("-spec and one of -endpoint, -runtime-listen or -internal are required")
+	}
+
+	spec, err := contract.LoadSpec(*specPath)
+	if err != nil {
+		return err
+	}
+
+	runner, err := contract.NewRunner(*distDir, *timeout)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	var target contract.Target
+	switch {
+	case *endpoint != "":
+		client := &http.Client{}
+		if *token != "" {
+			client.Transport = &bearerTransport{token: *token, next: http.DefaultTransport}
+		}
+		target = contract.NewEndpointTarget(*endpoint, client)
+	case *internal:
+		internalTarget, err := contract.NewInternalTarget(*distDir)
+		if err != nil {
+			return err
+		}
+		target = internalTarget
+	default:
+		rt, stop, err := listenForRuntime(*runtimeListen)
+		if err != nil {
+			return err
+		}
+		defer stop()
+
+		fmt.Fprintf(os.Stderr, "waiting for a runtime to connect to ws://%s%s\n", *runtimeListen, contract.RuntimePath)
+		select {
+		case <-rt.Connected():
+		case <-time.After(*connectTimeout):
+			return fmt.Errorf("no runtime connected within %s", *connectTimeout)
+		}
+		target = rt
+	}
+
+	report := runner.Run(ctx, spec, target)
+
+	for _, c := range report.Cases {
+		switch {
+		case c.Failure != "":
+			fmt.Fprintf(os.Stderr, "FAIL  %s: %s\n", c.Command, c.Failure)
+		case c.Error != "":
+			fmt.Fprintf(os.Stderr, "ERROR %s: %s\n", c.Command, c.Error)
+		default:
+			fmt.Fprintf(os.Stderr, "ok    %s (%s)\n", c.Command, c.Duration.Round(time.Millisecond))
+		}
+	}
+
+	if err := writeJUnit(*junit, report); err != nil {
+		return err
+	}
+
+	if !report.Passed() {
+		return errContractFailed
+	}
+
+	return nil
+}
+
+// listenForRuntime serves a RuntimeTarget on addr, returning a function that stops it.
+func listenForRuntime(addr string) (*contract.RuntimeTarget, func(), error) {
+	rt := contract.NewRuntimeTarget(contract.DefaultRuntimeConfig())
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	server := &http.Server{Handler: rt.Handler()}
+	go func() { _ = server.Serve(l) }()
+
+	return rt, func() { _ = server.Close() }, nil
+}
+
+// writeJUnit writes the report to path, or stdout if path is "-".
+func writeJUnit(path string, report *contract.Report) error {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return contract.WriteJUnit(w, report)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunContractTest(t *testing.T) {
+	// The connector answers every command with an empty result, which only std:test-connection and
+	// std:account:delete accept.
+	var authorization string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&struct{}{})
+		_, _ = w.Write([]byte("{}\n"))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "spec.json")
+	if err := ioutil.WriteFile(spec, []byte(`{"id": "empty", "commands": ["std:test-connection", "std:account:read"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	junit := filepath.Join(dir, "report.xml")
+
+	err := runContractTest([]string{"-spec", spec, "-dist", "../../dist", "-endpoint", ts.URL, "-token", "secret", "-junit", junit})
+	if !errors.Is(err, errContractFailed) {
+		t.Fatalf("expected the contract test to fail, got %v", err)
+	}
+	if authorization != "Bearer secret" {
+		t.Errorf("expected the token to be sent, got %q", authorization)
+	}
+
+	report, err := ioutil.ReadFile(junit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), `<testsuite name="empty" tests="2" failures="1" errors="0"`) {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
+
+func TestRunContractTestOfInternalConnector(t *testing.T) {
+	junit := filepath.Join(t.TempDir(), "report.xml")
+
+	err := runContractTest([]string{"-spec", "../../dist/connectors/internal_connector.json", "-dist", "../../dist", "-internal", "-junit", junit})
+	if err != nil {
+		t.Fatalf("expected the internal connector to pass, got %v", err)
+	}
+
+	report, err := ioutil.ReadFile(junit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), `failures="0" errors="0"`) {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// instanceCommands are the subcommands of "instance", by name.
+var instanceCommands = map[string]command{
+	"create": {"create a connector instance", runInstanceCreate},
+	"get":    {"get a connector instance, or list them all", runInstanceGet},
+	"update": {"update the name, spec or config of a connector instance", runInstanceUpdate},
+	"delete": {"delete a connector instance", runInstanceDelete},
+}
+
+// instanceColumns are the columns of connector instances in tables.
+var instanceColumns = []column{
+	{"ID", "id"},
+	{"NAME", "name"},
+	{"SPEC", "connectorSpecId"},
+	{"CREATED", "created"},
+}
+
+// runInstance runs an "instance" subcommand.
+func runInstance(args []string) error {
+	return runGroup("instance", instanceCommands, args)
+}
+
+// instancePath gets the path of a connector instance.
+func instancePath(id string) string {
+	return "/connector-instances/" + url.PathEscape(id)
+}
+
+// runInstanceCreate creates an instance of a spec, with the config in a file.
+func runInstanceCreate(args []string) error {
+	fs := flag.NewFlagSet("instance create", flag.ExitOnError)
+	api := addAPIFlags(fs)
+	name := fs.String("name", "", "name of the instance (required)")
+	specID := fs.String("spec", "", "ID of the instance's connector spec (required)")
+	configPath := fs.String("config", "", "JSON file of the instance's config; - for stdin (default {})")
+	_ = fs.Parse(args)
+
+	if *name == "" || *specID == "" {
+		return errors.New("-name and -spec are required")
+	}
+
+	c, err := api.newAPIClient()
+	if err != nil {
+		return err
+	}
+
+	config := json.RawMessage(`{}`)
+	if *configPath != "" {
+		if config, err = readJSONFile(*configPath); err != nil {
+			return err
+		}
+	}
+
+	body := map[string]interface{}{
+		"name":            *name,
+		"connectorSpecId": *specID,
+		"config":          config,
+	}
+
+	var created interface{}
+	if err := c.do(context.Background(), http.MethodPost, "/connector-instances", body, &created); err != nil {
+		return err
+	}
+
+	return newPrinter(stdout, c.format, instanceColumns...).print(created)
+}
+
+// runInstanceGet gets an instance, or lists them all if no ID is given.
+func runInstanceGet(args []string) error {
+	fs := flag.NewFlagSet("instance get", flag.ExitOnError)
+	api := addAPIFlags(fs)
+	positional := parseInterspersed(fs, args)
+	if len(positional) > 1 {
+		return errors.New("usage: instance get [id] [flags]")
+	}
+
+	c, err := api.newAPIClient()
+	if err != nil {
+		return err
+	}
+
+	path := "/connector-instances"
+	if len(positional) == 1 {
+		path = instancePath(positional[0])
+	}
+
+	var instance interface{}
+	if err := c.do(context.Background(), http.MethodGet, path, nil, &instance); err != nil {
+		return err
+	}
+
+	return newPrinter(stdout, c.format, instanceColumns...).print(instance)
+}
+
+// runInstanceUpdate replaces the name, spec or config of an instance, keeping what isn't given.
+func runInstanceUpdate(args []string) error {
+	fs := flag.NewFlagSet("instance update", flag.ExitOnError)
+	api := addAPIFlags(fs)
+	name := fs.String("name", "", "new name of the instance")
+	specID := fs.String("spec", "", "ID of the instance's new connector spec")
+	configPath := fs.String("config", "", "JSON file of the instance's new config; - for stdin")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		return errors.New("usage: instance update <id> [-name name] [-spec id] [-config file] [flags]")
+	}
+
+	c, err := api.newAPIClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	path := instancePath(positional[0])
+
+	var current struct {
+		Name            string          `json:"name"`
+		ConnectorSpecID string          `json:"connectorSpecId"`
+		Config          json.RawMessage `json:"config"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &current); err != nil {
+		return fmt.Errorf("get instance: %w", err)
+	}
+
+	if *name != "" {
+		current.Name = *name
+	}
+	if *specID != "" {
+		current.ConnectorSpecID = *specID
+	}
+	if *configPath != "" {
+		if current.Config, err = readJSONFile(*configPath); err != nil {
+			return err
+		}
+	}
+	if len(current.Config) == 0 {
+		current.Config = json.RawMessage(`{}`)
+	}
+
+	var updated interface{}
+	if err := c.do(ctx, http.MethodPut, path, current, &updated); err != nil {
+		return err
+	}
+
+	return newPrinter(stdout, c.format, instanceColumns...).print(updated)
+}
+
+// runInstanceDelete deletes an instance.
+func runInstanceDelete(args []string) error {
+	fs := flag.NewFlagSet("instance delete", flag.ExitOnError)
+	api := addAPIFlags(fs)
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		return errors.New("usage: instance delete <id> [flags]")
+	}
+
+	c, err := api.newAPIClient()
+	if err != nil {
+		return err
+	}
+
+	if err := c.do(context.Background(), http.MethodDelete, instancePath(positional[0]), nil, nil); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "deleted %s\n", positional[0])
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// invocationColumns are the columns of invocations in tables.
+var invocationColumns = []column{
+	{"INVOCATION", "invocationId"},
+	{"TYPE", "type"},
+	{"INSTANCE", "connectorInstanceId"},
+}
+
+// resultPage is a page of an invocation's results, as returned by next-result.
+type resultPage struct {
+	Done      bool          `json:"done"`
+	Output    []interface{} `json:"output"`
+	Context   interface{}   `json:"context"`
+	Error     string        `json:"error"`
+	ErrorType string        `json:"errorType"`
+}
+
+// pageFlags are the flags of how results are paged.
+type pageFlags struct {
+	limit *int
+	wait  *time.Duration
+}
+
+// addPageFlags adds the paging flags to fs.
+func addPageFlags(fs *flag.FlagSet) *pageFlags {
+	return &pageFlags{
+		limit: fs.Int("limit", 100, "maximum number of results per page"),
+		wait:  fs.Duration("wait", 10*time.Second, "how long each page waits for results"),
+	}
+}
+
+// runInvoke invokes a command against an instance, optionally following its results.
+func runInvoke(args []string) error {
+	fs := flag.NewFlagSet("invoke", flag.ExitOnError)
+	api := addAPIFlags(fs)
+	inputPath := fs.String("input", "", "JSON file of the command's input; - for stdin (default {})")
+	follow := fs.Bool("follow", false, "stream the command's results until it's done")
+	paging := addPageFlags(fs)
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 2 {
+		return errors.New("usage: invoke <instance> <type> [--input file] [--follow] [flags]")
+	}
+
+	c, err := api.newAPIClient()
+	if err != nil {
+		return err
+	}
+
+	instanceID, commandType := positional[0], positional[1]
+
+	input := json.RawMessage(`{}`)
+	if *inputPath != "" {
+		if input, err = readJSONFile(*inputPath); err != nil {
+			return err
+		}
+	}
+
+	body := map[string]interface{}{
+		"type":  commandType,
+		"input": input,
+	}
+
+	ctx := context.Background()
+
+	var invocation map[string]interface{}
+	if err := c.do(ctx, http.MethodPost, instancePath(instanceID)+"/commands", body, &invocation); err != nil {
+		return err
+	}
+
+	invocationID, _ := invocation["invocationId"].(string)
+	if !*follow {
+		return newPrinter(stdout, c.format, invocationColumns...).print(invocation)
+	}
+
+	fmt.Fprintf(os.Stderr, "invoked %s as %s\n", commandType, invocationID)
+	return streamResults(ctx, c, invocationID, paging, true)
+}
+
+// runResults gets the next page of an invocation's results, or all of them with --follow.
+func runResults(args []string) error {
+	fs := flag.NewFlagSet("results", flag.ExitOnError)
+	api := addAPIFlags(fs)
+	follow := fs.Bool("follow", false, "get pages until the invocation is done")
+	paging := addPageFlags(fs)
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		return errors.New("usage: results <invocationId> [--follow] [flags]")
+	}
+
+	c, err := api.newAPIClient()
+	if err != nil {
+		return err
+	}
+
+	return streamResults(context.Background(), c, positional[0], paging, *follow)
+}
+
+// streamResults prints the results of an invocation as they arrive, getting next-result pages until
+// it's done, or just one page unless follow is set. An invocation that failed is returned as an
+// error, after its results.
+func streamResults(ctx context.Context, c *apiClient, invocationID string, paging *pageFlags, follow bool) error {
+	p := newPrinter(stdout, c.format)
+	path := "/invocations/" + url.PathEscape(invocationID) + "/next-result"
+	body := map[string]interface{}{
+		"limit":   *paging.limit,
+		"timeout": paging.wait.String(),
+	}
+
+	for {
+		var page resultPage
+		if err := c.do(ctx, http.MethodPost, path, body, &page); err != nil {
+			return err
+		}
+
+		if err := p.stream(page.Output); err != nil {
+			return err
+		}
+
+		if page.Error != "" {
+			return fmt.Errorf("invocation failed (%s): %s", page.ErrorType, page.Error)
+		}
+
+		if page.Done {
+			return nil
+		}
+
+		if !follow {
+			fmt.Fprintf(os.Stderr, "invocation %s isn't done; get more results with --follow\n", invocationID)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// command is a subcommand of spconnectctl. run gets the arguments after the subcommand's name.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+// commands are the subcommands of spconnectctl, by name. The API commands are experimental: their
+// flags and output may still change.
+var commands = map[string]command{
+	"contract-test": {"check a connector against the standard command contracts", runContractTest},
+	"spec":          {"(experimental) validate, push and list connector specs", runSpec},
+	"instance":      {"(experimental) create, get, update and delete connector instances", runInstance},
+	"invoke":        {"(experimental) invoke a command against a connector instance", runInvoke},
+	"results":       {"(experimental) get the results of an invocation", runResults},
+}
+
+// stdout is where the API commands print what they get.
+var stdout io.Writer = os.Stdout
+
+func main() {
+	if len(os.Args) < 2 {
+		usage("spconnectctl", commands)
+		os.Exit(2)
+	}
+
+	c, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		usage("spconnectctl", commands)
+		os.Exit(2)
+	}
+
+	if err := c.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// runGroup runs the subcommand of a group of commands (eg. "spec push") named by the first argument.
+func runGroup(group string, cmds map[string]command, args []string) error {
+	if len(args) == 0 {
+		usage("spconnectctl "+group, cmds)
+		return fmt.Errorf("a %s command is required", group)
+	}
+
+	c, ok := cmds[args[0]]
+	if !ok {
+		usage("spconnectctl "+group, cmds)
+		return fmt.Errorf("unknown %s command %q", group, args[0])
+	}
+
+	return c.run(args[1:])
+}
+
+// usage prints the subcommands of a command.
+func usage(name string, cmds map[string]command) {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n", name)
+	fmt.Fprintln(os.Stderr, "commands:")
+
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, cmds[name].usage)
+	}
+}
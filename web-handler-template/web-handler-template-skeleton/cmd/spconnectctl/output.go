@@ -0,0 +1,198 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The output formats of the API subcommands.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// isFormat gets whether format is a known output format.
+func isFormat(format string) bool {
+	return format == formatTable || format == formatJSON || format == formatYAML
+}
+
+// column is a column of a table: its header, and the field of the JSON objects printed in it.
+type column struct {
+	header string
+	field  string
+}
+
+// printer prints values returned by the API in an output format. Tables show the given columns, or
+// every top-level field of the first object if there are none.
+type printer struct {
+	w       io.Writer
+	format  string
+	columns []column
+
+	// header is whether the table's header has been printed, so streamed rows share one header.
+	header bool
+}
+
+// newPrinter constructs a printer that writes to w.
+func newPrinter(w io.Writer, format string, columns ...column) *printer {
+	return &printer{w: w, format: format, columns: columns}
+}
+
+// print prints a value: an object, or an array of objects that are printed as the rows of a table.
+func (p *printer) print(v interface{}) error {
+	switch p.format {
+	case formatJSON:
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case formatYAML:
+		return p.printYAML(v)
+	}
+
+	return p.printRows(rows(v))
+}
+
+// stream prints the items of a stream as they arrive: as table rows under one header, one JSON
+// document per line or one YAML document each.
+func (p *printer) stream(items []interface{}) error {
+	switch p.format {
+	case formatJSON:
+		enc := json.NewEncoder(p.w)
+		for _, item := range items {
+			if err := enc.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatYAML:
+		for _, item := range items {
+			if _, err := io.WriteString(p.w, "---\n"); err != nil {
+				return err
+			}
+			if err := p.printYAML(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return p.printRows(items)
+}
+
+// printYAML prints v as YAML. v goes through JSON first, so fields are named as in the API.
+func (p *printer) printYAML(v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+
+	out, err := yaml.Marshal(generic)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.w.Write(out)
+	return err
+}
+
+// printRows prints the items as the rows of a table, with a header the first time it's called.
+func (p *printer) printRows(items []interface{}) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	if len(p.columns) == 0 {
+		p.columns = fieldColumns(items[0])
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	if !p.header {
+		headers := make([]string, len(p.columns))
+		for i, c := range p.columns {
+			headers[i] = c.header
+		}
+		fmt.Fprintln(tw, strings.Join(headers, "\t"))
+		p.header = true
+	}
+
+	for _, item := range items {
+		generic, err := toGeneric(item)
+		if err != nil {
+			return err
+		}
+		object, _ := generic.(map[string]interface{})
+
+		cells := make([]string, len(p.columns))
+		for i, c := range p.columns {
+			cells[i] = cell(object[c.field])
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// rows gets the items of an array, or v itself as the only item.
+func rows(v interface{}) []interface{} {
+	if items, ok := v.([]interface{}); ok {
+		return items
+	}
+	return []interface{}{v}
+}
+
+// fieldColumns gets a column per top-level field of an object, in alphabetical order.
+func fieldColumns(v interface{}) []column {
+	generic, _ := toGeneric(v)
+	object, _ := generic.(map[string]interface{})
+
+	fields := make([]string, 0, len(object))
+	for field := range object {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	columns := make([]column, len(fields))
+	for i, field := range fields {
+		columns[i] = column{header: strings.ToUpper(field), field: field}
+	}
+
+	return columns
+}
+
+// cell formats a field in a table cell: strings as is, other values as compact JSON.
+func cell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+// toGeneric converts v to the generic values encoding/json decodes into, unless it already is one.
+func toGeneric(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}, string, float64, bool, nil:
+		return v, nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	err = json.Unmarshal(raw, &generic)
+	return generic, err
+}
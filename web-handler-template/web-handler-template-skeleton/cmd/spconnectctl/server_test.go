@@ -0,0 +1,127 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sailpoint/atlas-go/atlas/application"
+	"github.com/sailpoint/atlas-go/atlas/auth"
+	"github.com/sailpoint/atlas-go/atlas/auth/access"
+	"github.com/sailpoint/atlas-go/atlas/feature"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/memory"
+)
+
+// serverConfig is a configuration Source of the in-process service, falling back to the environment.
+type serverConfig map[string]string
+
+func (c serverConfig) GetString(key string) string {
+	if v, ok := c[key]; ok {
+		return v
+	}
+
+	return os.Getenv(key)
+}
+
+// serverSummarizer grants every token the rights to manage and invoke connectors.
+type serverSummarizer struct{}
+
+func (serverSummarizer) Summarize(ctx context.Context, t *auth.Token) (*access.Summary, error) {
+	rights := []access.Right{"sp:connector:create", "sp:connector:read", "sp:connector:update", "sp:connector:delete", "sp:connector:invoke"}
+	return &access.Summary{RightSets: []access.RightSetID{}, FlattenedRights: rights}, nil
+}
+
+// startServer starts the service in-process with in-memory backends, at its path on an org's URL, and
+// gets its URL and a token for it.
+func startServer(t *testing.T) (string, string) {
+	t.Helper()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := infra.NewConnectService(
+		application.WithConfig(serverConfig{"ATLAS_PRODUCTION": "false", "DIST_DIR": "../../dist"}),
+		func(app *application.Application) error {
+			app.TokenValidator = auth.NewComposedTokenValidator(key, jwt.SigningMethodHS256)
+			app.AccessSummarizer = serverSummarizer{}
+			app.RedisClient = memory.NewRedis()
+			app.EventPublisher = memory.NewEventPublisher()
+			app.FeatureStore = feature.NewMemoryStore()
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"tenant_id":   "00000000-0000-0000-0000-000000000001",
+		"pod":         "dev",
+		"org":         "acme-solar",
+		"identity_id": "spconnectctl",
+		"user_name":   "spconnectctl",
+		"authorities": []string{"ORG_ADMIN"},
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.StripPrefix(apiPrefix, service.Handler()))
+	t.Cleanup(ts.Close)
+
+	return ts.URL, token
+}
+
+func TestInstanceCommandsAgainstTheService(t *testing.T) {
+	url, token := startServer(t)
+
+	out, err := runWithToken(t, url, token, "instance", "create", "-name", "test", "-spec", "internal", "-o", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var created map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &created); err != nil {
+		t.Fatalf("parse created instance %q: %v", out, err)
+	}
+	id, _ := created["id"].(string)
+	if id == "" || created["connectorSpecId"] != "internal" {
+		t.Fatalf("unexpected instance: %s", out)
+	}
+
+	config := writeFile(t, `{"mockKey": "mockValue"}`)
+	if _, err := runWithToken(t, url, token, "instance", "update", id, "-config", config); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = runWithToken(t, url, token, "instance", "get", id, "-o", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var instance map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &instance); err != nil {
+		t.Fatalf("parse instance %q: %v", out, err)
+	}
+	if config, _ := instance["config"].(map[string]interface{}); instance["name"] != "test" || config["mockKey"] != "mockValue" {
+		t.Errorf("unexpected instance: %s", out)
+	}
+
+	if _, err := runWithToken(t, url, token, "instance", "delete", id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runWithToken(t, url, token, "instance", "get", id); err == nil || !strings.HasPrefix(err.Error(), "404 ") {
+		t.Errorf("expected the deleted instance not to be found, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// specCommands are the subcommands of "spec", by name.
+var specCommands = map[string]command{
+	"validate": {"validate a connector spec file without saving it", runSpecValidate},
+	"push":     {"create a connector spec from a file, or update it if it exists", runSpecPush},
+	"list":     {"list the connector specs", runSpecList},
+}
+
+// specColumns are the columns of connector specs in tables.
+var specColumns = []column{
+	{"ID", "id"},
+	{"NAME", "name"},
+	{"TOPOLOGY", "topology"},
+	{"VISIBILITY", "visibility"},
+}
+
+// runSpec runs a "spec" subcommand.
+func runSpec(args []string) error {
+	return runGroup("spec", specCommands, args)
+}
+
+// runSpecValidate validates the spec in a file.
+func runSpecValidate(args []string) error {
+	fs := flag.NewFlagSet("spec validate", flag.ExitOnError)
+	api := addAPIFlags(fs)
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		return errors.New("usage: spec validate <file> [flags]")
+	}
+
+	c, err := api.newAPIClient()
+	if err != nil {
+		return err
+	}
+
+	spec, err := readJSONFile(positional[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.do(context.Background(), http.MethodPost, "/connector-specifications/validate", spec, nil); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s is valid\n", positional[0])
+	return nil
+}
+
+// runSpecPush creates the spec in a file, or replaces it if a spec with its ID exists.
+func runSpecPush(args []string) error {
+	fs := flag.NewFlagSet("spec push", flag.ExitOnError)
+	api := addAPIFlags(fs)
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		return errors.New("usage: spec push <file> [flags]")
+	}
+
+	c, err := api.newAPIClient()
+	if err != nil {
+		return err
+	}
+
+	spec, err := readJSONFile(positional[0])
+	if err != nil {
+		return err
+	}
+
+	var id struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(spec, &id)
+
+	ctx := context.Background()
+
+	method, path := http.MethodPost, "/connector-specifications"
+	if id.ID != "" {
+		specPath := path + "/" + url.PathEscape(id.ID)
+		err := c.do(ctx, http.MethodGet, specPath, nil, nil)
+		switch {
+		case err == nil:
+			method, path = http.MethodPut, specPath
+		case !errors.Is(err, errNotFound):
+			return err
+		}
+	}
+
+	var saved interface{}
+	if err := c.do(ctx, method, path, spec, &saved); err != nil {
+		return err
+	}
+
+	return newPrinter(stdout, c.format, specColumns...).print(saved)
+}
+
+// runSpecList lists the specs.
+func runSpecList(args []string) error {
+	fs := flag.NewFlagSet("spec list", flag.ExitOnError)
+	api := addAPIFlags(fs)
+	_ = fs.Parse(args)
+
+	c, err := api.newAPIClient()
+	if err != nil {
+		return err
+	}
+
+	var specs interface{}
+	if err := c.do(context.Background(), http.MethodGet, "/connector-specifications", nil, &specs); err != nil {
+		return err
+	}
+
+	return newPrinter(stdout, c.format, specColumns...).print(specs)
+}
@@ -5,6 +5,8 @@ go 1.16
 require (
 	github.com/aws/aws-sdk-go v1.37.24
 	github.com/cespare/xxhash/v2 v2.1.1
+	github.com/deckarep/golang-set v1.7.1
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/evanphx/json-patch v4.9.0+incompatible
 	github.com/gavv/httpexpect/v2 v2.3.1
 	github.com/go-redis/redis/v8 v8.5.0
@@ -12,14 +14,19 @@ require (
 	github.com/golang/mock v1.6.0
 	github.com/google/uuid v1.3.0
 	github.com/gorilla/mux v1.7.4
+	github.com/gorilla/websocket v1.4.2
 	github.com/grafana-tools/sdk v0.0.0-20210310213032-c3f3511b3e9b
 	github.com/mattn/go-isatty v0.0.12 // indirect
 	github.com/prometheus/client_golang v1.7.1
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.10.0
 	github.com/qri-io/jsonschema v0.2.1
 	github.com/sailpoint/atlas-go v0.0.3-0.20220428192458-a9e672f85928
 	github.com/sailpoint/saas-kafka-artifacts v1.0.113
 	github.com/testcontainers/testcontainers-go v0.12.0
+	go.opentelemetry.io/otel v0.16.0
 	go.uber.org/zap v1.15.0
 	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
 	gopkg.in/square/go-jose.v2 v2.6.0
+	gopkg.in/yaml.v2 v2.4.0
 )
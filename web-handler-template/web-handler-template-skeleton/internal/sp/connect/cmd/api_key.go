@@ -0,0 +1,226 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sailpoint/atlas-go/atlas/crypto"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// ErrInvalidAPIKey is returned when an API key is malformed, unknown, expired or doesn't match.
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// ErrAPIKeyNotFound is returned when an API key to manage doesn't exist in the caller's tenant.
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// CreateAPIKey is a command that mints an API key scoped to connector instances and command types.
+type CreateAPIKey struct {
+	TenantID     string
+	Pod          string
+	Org          string
+	Actor        string
+	Name         string              `json:"name"`
+	InstanceIDs  []string            `json:"instanceIds"`
+	CommandTypes []model.CommandType `json:"commandTypes"`
+	Expires      time.Time           `json:"expires"`
+}
+
+// APIKeyResult is an API key along with its plain key, which is only returned when the key is
+// created or rotated.
+type APIKeyResult struct {
+	*model.APIKey
+
+	// KeyHash hides the hash of the embedded key from responses.
+	KeyHash string `json:"keyHash,omitempty"`
+
+	Key string `json:"key"`
+}
+
+// NewCreateAPIKey constructs a new CreateAPIKey command from the body of a create request. The key
+// must expire within maxLifetime.
+func NewCreateAPIKey(tenantID string, pod string, org string, actor string, body []byte, maxLifetime time.Duration) (*CreateAPIKey, error) {
+	cmd := &CreateAPIKey{}
+	if err := json.Unmarshal(body, cmd); err != nil {
+		return nil, model.NewBadRequestError("parse api key: %v", err)
+	}
+	cmd.TenantID = tenantID
+	cmd.Pod = pod
+	cmd.Org = org
+	cmd.Actor = actor
+
+	if cmd.Name == "" {
+		return nil, model.NewBadRequestError("name is required")
+	}
+
+	if len(cmd.InstanceIDs) == 0 {
+		return nil, model.NewBadRequestError("at least one connector instance id is required")
+	}
+
+	if len(cmd.CommandTypes) == 0 {
+		return nil, model.NewBadRequestError("at least one command type is required")
+	}
+
+	now := time.Now()
+	if !cmd.Expires.After(now) {
+		return nil, model.NewBadRequestError("expires must be in the future")
+	}
+
+	if cmd.Expires.After(now.Add(maxLifetime)) {
+		return nil, model.NewBadRequestError("expires must be within %s", maxLifetime)
+	}
+
+	return cmd, nil
+}
+
+// Handle mints the key. The key has the form "<id>.<secret>", and only a hash of the secret is stored.
+func (cmd *CreateAPIKey) Handle(ctx context.Context, store model.APIKeyStore) (*APIKeyResult, error) {
+	key := &model.APIKey{
+		ID:           uuid.New().String(),
+		TenantID:     cmd.TenantID,
+		Pod:          cmd.Pod,
+		Org:          cmd.Org,
+		Name:         cmd.Name,
+		InstanceIDs:  cmd.InstanceIDs,
+		CommandTypes: cmd.CommandTypes,
+		Created:      time.Now().UTC(),
+		CreatedBy:    cmd.Actor,
+		Expires:      cmd.Expires.UTC(),
+	}
+
+	return issueAPIKey(ctx, store, key)
+}
+
+// RotateAPIKey is a command that replaces the secret of an API key, keeping its scope and expiry.
+type RotateAPIKey struct {
+	TenantID string
+	ID       string
+}
+
+// NewRotateAPIKey constructs a new RotateAPIKey command.
+func NewRotateAPIKey(tenantID string, id string) (*RotateAPIKey, error) {
+	if id == "" {
+		return nil, model.NewBadRequestError("api key id is required")
+	}
+
+	cmd := &RotateAPIKey{}
+	cmd.TenantID = tenantID
+	cmd.ID = id
+
+	return cmd, nil
+}
+
+// Handle rotates the key. The old secret stops working immediately.
+func (cmd *RotateAPIKey) Handle(ctx context.Context, store model.APIKeyStore) (*APIKeyResult, error) {
+	key, err := getTenantAPIKey(ctx, store, cmd.TenantID, cmd.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Rotated = time.Now().UTC()
+
+	return issueAPIKey(ctx, store, key)
+}
+
+// RevokeAPIKey is a command that deletes an API key.
+type RevokeAPIKey struct {
+	TenantID string
+	ID       string
+}
+
+// NewRevokeAPIKey constructs a new RevokeAPIKey command.
+func NewRevokeAPIKey(tenantID string, id string) (*RevokeAPIKey, error) {
+	if id == "" {
+		return nil, model.NewBadRequestError("api key id is required")
+	}
+
+	cmd := &RevokeAPIKey{}
+	cmd.TenantID = tenantID
+	cmd.ID = id
+
+	return cmd, nil
+}
+
+// Handle revokes the key, returning it as it was.
+func (cmd *RevokeAPIKey) Handle(ctx context.Context, store model.APIKeyStore) (*model.APIKey, error) {
+	key, err := getTenantAPIKey(ctx, store, cmd.TenantID, cmd.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.DeleteAPIKey(ctx, cmd.ID); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// AuthenticateAPIKey gets the unexpired API key identified by a key of the form "<id>.<secret>".
+func AuthenticateAPIKey(ctx context.Context, store model.APIKeyStore, key string) (*model.APIKey, error) {
+	i := strings.LastIndex(key, ".")
+	if i <= 0 || i == len(key)-1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := store.GetAPIKey(ctx, key[:i])
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil || apiKey.Expired(time.Now()) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashKeySecret(apiKey.ID, key[i+1:])), []byte(apiKey.KeyHash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	return apiKey, nil
+}
+
+// issueAPIKey gives the key a new secret and saves it.
+func issueAPIKey(ctx context.Context, store model.APIKeyStore, key *model.APIKey) (*APIKeyResult, error) {
+	secret, err := crypto.GenerateHexSecret(32)
+	if err != nil {
+		return nil, err
+	}
+
+	key.KeyHash = hashKeySecret(key.ID, secret)
+
+	if err := store.SaveAPIKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return &APIKeyResult{APIKey: key, Key: key.ID + "." + secret}, nil
+}
+
+// getTenantAPIKey gets an API key of the tenant.
+func getTenantAPIKey(ctx context.Context, store model.APIKeyStore, tenantID string, id string) (*model.APIKey, error) {
+	key, err := store.GetAPIKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil || key.TenantID != tenantID {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return key, nil
+}
+
+// hashKeySecret hashes the secret part of an API key or a runtime key for storage: the hex
+// HMAC-SHA256 of the secret keyed with the key's ID, so that a hash only matches the key it was
+// issued for. Secrets are random, so they don't need a slow hash.
+func hashKeySecret(id string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(id))
+	mac.Write([]byte(secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
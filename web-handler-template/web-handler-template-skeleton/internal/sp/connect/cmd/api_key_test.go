@@ -0,0 +1,147 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeAPIKeyStore struct {
+	keys map[string]*model.APIKey
+}
+
+func (s *fakeAPIKeyStore) SaveAPIKey(ctx context.Context, key *model.APIKey) error {
+	if s.keys == nil {
+		s.keys = map[string]*model.APIKey{}
+	}
+	s.keys[key.ID] = key
+	return nil
+}
+
+func (s *fakeAPIKeyStore) GetAPIKey(ctx context.Context, id string) (*model.APIKey, error) {
+	return s.keys[id], nil
+}
+
+func (s *fakeAPIKeyStore) DeleteAPIKey(ctx context.Context, id string) error {
+	delete(s.keys, id)
+	return nil
+}
+
+func apiKeyBody(expires time.Time) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"name":         "pipeline",
+		"instanceIds":  []string{"inst-1"},
+		"commandTypes": []string{"std:account:list"},
+		"expires":      expires,
+	})
+	return body
+}
+
+func TestNewCreateAPIKeyValidation(t *testing.T) {
+	tests := [][]byte{
+		[]byte(`{"instanceIds":["inst-1"],"commandTypes":["std:account:list"],"expires":"2999-01-01T00:00:00Z"}`),
+		[]byte(`{"name":"pipeline","commandTypes":["std:account:list"],"expires":"2999-01-01T00:00:00Z"}`),
+		[]byte(`{"name":"pipeline","instanceIds":["inst-1"],"expires":"2999-01-01T00:00:00Z"}`),
+		apiKeyBody(time.Now().Add(-time.Minute)),
+		apiKeyBody(time.Now().Add(48 * time.Hour)),
+	}
+
+	for _, body := range tests {
+		var badRequest *model.BadRequestError
+		if _, err := NewCreateAPIKey("acme", "pod", "org", "alice", body, 24*time.Hour); !errors.As(err, &badRequest) {
+			t.Errorf("expected %s to be rejected, got %v", body, err)
+		}
+	}
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeAPIKeyStore{}
+
+	create, err := NewCreateAPIKey("acme", "pod", "org", "alice", apiKeyBody(time.Now().Add(time.Hour)), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := create.Handle(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(created)
+	if strings.Contains(string(body), "keyHash") || strings.Contains(created.Key, created.APIKey.KeyHash) {
+		t.Errorf("the key's hash was exposed: %s", body)
+	}
+
+	key, err := AuthenticateAPIKey(ctx, store, created.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.TenantID != "acme" || key.CreatedBy != "alice" || !key.Allows("inst-1", model.ACLInvoke("std:account:list")) || key.Allows("inst-1", model.ACLInvoke("std:account:delete")) || key.Allows("inst-2", model.ACLRead) {
+		t.Errorf("unexpected key: %+v", key)
+	}
+
+	if _, err := NewRotateAPIKey("other", key.ID); err != nil {
+		t.Fatal(err)
+	}
+	rotateOther, _ := NewRotateAPIKey("other", key.ID)
+	if _, err := rotateOther.Handle(ctx, store); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected another tenant's key not to be found, got %v", err)
+	}
+
+	rotate, _ := NewRotateAPIKey("acme", key.ID)
+	rotated, err := rotate.Handle(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AuthenticateAPIKey(ctx, store, created.Key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected the old key to be rejected, got %v", err)
+	}
+	if _, err := AuthenticateAPIKey(ctx, store, rotated.Key); err != nil {
+		t.Errorf("expected the rotated key to be accepted, got %v", err)
+	}
+
+	revoke, _ := NewRevokeAPIKey("acme", key.ID)
+	if _, err := revoke.Handle(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AuthenticateAPIKey(ctx, store, rotated.Key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected the revoked key to be rejected, got %v", err)
+	}
+}
+
+func TestAuthenticateAPIKeyRejectsExpiredKeys(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeAPIKeyStore{}
+
+	create, _ := NewCreateAPIKey("acme", "pod", "org", "alice", apiKeyBody(time.Now().Add(time.Hour)), 24*time.Hour)
+	created, err := create.Handle(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.keys[created.ID].Expires = time.Now().Add(-time.Second)
+
+	for _, key := range []string{created.Key, "", created.ID, created.ID + ".", "unknown.secret"} {
+		if _, err := AuthenticateAPIKey(ctx, store, key); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("expected %q to be rejected, got %v", key, err)
+		}
+	}
+}
+
+func TestHashAPIKeySecretIsBoundToTheKey(t *testing.T) {
+	// HMAC-SHA256 of "secret" keyed with "id".
+	if hash := hashKeySecret("id", "secret"); hash != "bb54053e8dd35f4808a990768a9144879fa049c8e7baf92f2061b6c217ce3154" {
+		t.Errorf("expected a hex HMAC-SHA256, got %s", hash)
+	}
+	if hashKeySecret("id", "secret") == hashKeySecret("other", "secret") {
+		t.Error("expected the hash to depend on the key's ID")
+	}
+}
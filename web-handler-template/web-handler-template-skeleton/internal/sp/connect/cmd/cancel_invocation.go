@@ -0,0 +1,45 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// ErrInvocationNotFound is returned when an invocation doesn't exist.
+var ErrInvocationNotFound = errors.New("invocation not found")
+
+// CancelInvocation is a command that cancels an invocation of the tenant that hasn't finished.
+type CancelInvocation struct {
+	TenantID     string
+	InvocationID string
+}
+
+// NewCancelInvocation constructs a new CancelInvocation command.
+func NewCancelInvocation(tenantID string, invocationID string) (*CancelInvocation, error) {
+	if invocationID == "" {
+		return nil, model.NewBadRequestError("invocation id is required")
+	}
+
+	cmd := &CancelInvocation{}
+	cmd.TenantID = tenantID
+	cmd.InvocationID = invocationID
+
+	return cmd, nil
+}
+
+// Handle cancels the invocation, returning it as it is afterwards. An invocation that has already
+// finished is returned unchanged. It fails with ErrInvocationNotFound if the invocation doesn't exist.
+func (cmd *CancelInvocation) Handle(ctx context.Context, canceller model.InvocationCanceller) (*model.Invocation, error) {
+	inv, err := canceller.CancelInvocation(ctx, cmd.TenantID, cmd.InvocationID)
+	if err != nil {
+		return nil, err
+	}
+	if inv == nil {
+		return nil, ErrInvocationNotFound
+	}
+
+	return inv, nil
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeCanceller struct {
+	invocations map[string]*model.Invocation
+}
+
+func (c *fakeCanceller) CancelInvocation(ctx context.Context, tenantID string, id string) (*model.Invocation, error) {
+	inv := c.invocations[tenantID+"/"+id]
+	if inv != nil && !inv.Status.Final() {
+		inv.Status = model.InvocationCancelled
+	}
+	return inv, nil
+}
+
+func TestCancelInvocation(t *testing.T) {
+	canceller := &fakeCanceller{invocations: map[string]*model.Invocation{
+		"acme/running": {ID: "running", Status: model.InvocationRunning},
+	}}
+
+	cmd, err := NewCancelInvocation("acme", "running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := cmd.Handle(context.Background(), canceller)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Status != model.InvocationCancelled {
+		t.Errorf("expected the invocation to be cancelled, got %s", inv.Status)
+	}
+
+	cmd, _ = NewCancelInvocation("other", "running")
+	if _, err := cmd.Handle(context.Background(), canceller); !errors.Is(err, ErrInvocationNotFound) {
+		t.Errorf("expected another tenant's invocation not to be found, got %v", err)
+	}
+
+	if _, err := NewCancelInvocation("acme", ""); err == nil {
+		t.Error("expected an invocation ID to be required")
+	}
+}
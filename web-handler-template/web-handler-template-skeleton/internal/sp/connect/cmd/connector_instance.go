@@ -0,0 +1,200 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// ErrConnectorInstanceNotFound is returned when a connector instance doesn't exist in the caller's tenant.
+var ErrConnectorInstanceNotFound = errors.New("connector instance not found")
+
+// connectorInstanceBody is the body of a request to create or replace a connector instance.
+type connectorInstanceBody struct {
+	Name            string          `json:"name"`
+	ConnectorSpecID string          `json:"connectorSpecId"`
+	Config          json.RawMessage `json:"config"`
+}
+
+// CreateConnectorInstance is a command that creates a connector instance of a spec.
+type CreateConnectorInstance struct {
+	TenantID string
+	connectorInstanceBody
+}
+
+// NewCreateConnectorInstance constructs a new CreateConnectorInstance command from the body of a
+// request. The instance must have a name and a spec, and its config, if any, must be an object.
+func NewCreateConnectorInstance(tenantID string, body []byte) (*CreateConnectorInstance, error) {
+	cmd := &CreateConnectorInstance{}
+	if err := parseConnectorInstance(body, &cmd.connectorInstanceBody); err != nil {
+		return nil, err
+	}
+	cmd.TenantID = tenantID
+
+	return cmd, nil
+}
+
+// Handle saves the instance. Its spec must be built in or one of the tenant's.
+func (cmd *CreateConnectorInstance) Handle(ctx context.Context, specs model.ConnectorSpecStore, instances model.ConnectorInstanceStore) (*model.ConnectorInstance, error) {
+	if err := requireConnectorSpec(ctx, specs, cmd.TenantID, cmd.ConnectorSpecID); err != nil {
+		return nil, err
+	}
+
+	instance := &model.ConnectorInstance{
+		ID:              uuid.New().String(),
+		TenantID:        cmd.TenantID,
+		Name:            cmd.Name,
+		ConnectorSpecID: cmd.ConnectorSpecID,
+		Config:          cmd.Config,
+		Created:         time.Now().UTC(),
+	}
+	instance.Modified = instance.Created
+
+	if err := instances.SaveInstance(ctx, instance); err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+// UpdateConnectorInstance is a command that replaces the name, spec and config of a connector instance.
+type UpdateConnectorInstance struct {
+	TenantID string
+	ID       string
+	connectorInstanceBody
+}
+
+// NewUpdateConnectorInstance constructs a new UpdateConnectorInstance command from the body of a
+// request, which is validated like that of a create.
+func NewUpdateConnectorInstance(tenantID string, id string, body []byte) (*UpdateConnectorInstance, error) {
+	if id == "" {
+		return nil, model.NewBadRequestError("connector instance id is required")
+	}
+
+	cmd := &UpdateConnectorInstance{}
+	if err := parseConnectorInstance(body, &cmd.connectorInstanceBody); err != nil {
+		return nil, err
+	}
+	cmd.TenantID = tenantID
+	cmd.ID = id
+
+	return cmd, nil
+}
+
+// Handle saves the updated instance, keeping its creation time.
+func (cmd *UpdateConnectorInstance) Handle(ctx context.Context, specs model.ConnectorSpecStore, instances model.ConnectorInstanceStore) (*model.ConnectorInstance, error) {
+	current, err := instances.GetInstance(ctx, cmd.TenantID, cmd.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, ErrConnectorInstanceNotFound
+	}
+
+	if err := requireConnectorSpec(ctx, specs, cmd.TenantID, cmd.ConnectorSpecID); err != nil {
+		return nil, err
+	}
+
+	instance := &model.ConnectorInstance{
+		ID:              cmd.ID,
+		TenantID:        cmd.TenantID,
+		Name:            cmd.Name,
+		ConnectorSpecID: cmd.ConnectorSpecID,
+		Config:          cmd.Config,
+		Created:         current.Created,
+		Modified:        time.Now().UTC(),
+	}
+
+	if err := instances.SaveInstance(ctx, instance); err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+// DeleteConnectorInstance is a command that deletes a connector instance along with its ACL.
+type DeleteConnectorInstance struct {
+	TenantID string
+	ID       string
+}
+
+// NewDeleteConnectorInstance constructs a new DeleteConnectorInstance command.
+func NewDeleteConnectorInstance(tenantID string, id string) (*DeleteConnectorInstance, error) {
+	if id == "" {
+		return nil, model.NewBadRequestError("connector instance id is required")
+	}
+
+	cmd := &DeleteConnectorInstance{}
+	cmd.TenantID = tenantID
+	cmd.ID = id
+
+	return cmd, nil
+}
+
+// Handle deletes the instance, returning it as it was. Its ACL is deleted after it, so that the
+// instance is never left unguarded.
+func (cmd *DeleteConnectorInstance) Handle(ctx context.Context, instances model.ConnectorInstanceStore, acls model.ACLStore) (*model.ConnectorInstance, error) {
+	instance, err := instances.GetInstance(ctx, cmd.TenantID, cmd.ID)
+	if err != nil {
+		return nil, err
+	}
+	if instance == nil {
+		return nil, ErrConnectorInstanceNotFound
+	}
+
+	if _, err := instances.DeleteInstance(ctx, cmd.TenantID, cmd.ID); err != nil {
+		return nil, err
+	}
+
+	if err := acls.DeleteACL(ctx, cmd.TenantID, cmd.ID); err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+// parseConnectorInstance parses and validates the body of a create or replace request into b.
+func parseConnectorInstance(body []byte, b *connectorInstanceBody) error {
+	if err := json.Unmarshal(body, b); err != nil {
+		return model.NewBadRequestError("parse connector instance: %v", err)
+	}
+
+	if b.Name == "" {
+		return model.NewBadRequestError("name is required")
+	}
+
+	if b.ConnectorSpecID == "" {
+		return model.NewBadRequestError("connectorSpecId is required")
+	}
+
+	if len(b.Config) == 0 || bytes.Equal(b.Config, []byte("null")) {
+		b.Config = json.RawMessage(`{}`)
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal(b.Config, &config); err != nil {
+		return model.NewBadRequestError("config must be an object")
+	}
+
+	return nil
+}
+
+// requireConnectorSpec returns a BadRequestError unless the spec exists for the tenant.
+func requireConnectorSpec(ctx context.Context, specs model.ConnectorSpecStore, tenantID string, specID string) error {
+	spec, err := specs.GetSpec(ctx, tenantID, specID)
+	if err != nil {
+		return err
+	}
+
+	if spec == nil {
+		return model.NewBadRequestError("connector spec %s doesn't exist", specID)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeConnectorInstanceStore struct {
+	instances map[string]*model.ConnectorInstance
+}
+
+func (s *fakeConnectorInstanceStore) ListInstances(ctx context.Context, tenantID string) ([]*model.ConnectorInstance, error) {
+	instances := []*model.ConnectorInstance{}
+	for _, instance := range s.instances {
+		if instance.TenantID == tenantID {
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
+
+func (s *fakeConnectorInstanceStore) GetInstance(ctx context.Context, tenantID string, id string) (*model.ConnectorInstance, error) {
+	return s.instances[tenantID+"/"+id], nil
+}
+
+func (s *fakeConnectorInstanceStore) SaveInstance(ctx context.Context, instance *model.ConnectorInstance) error {
+	if s.instances == nil {
+		s.instances = map[string]*model.ConnectorInstance{}
+	}
+	s.instances[instance.TenantID+"/"+instance.ID] = instance
+	return nil
+}
+
+func (s *fakeConnectorInstanceStore) DeleteInstance(ctx context.Context, tenantID string, id string) (bool, error) {
+	_, ok := s.instances[tenantID+"/"+id]
+	delete(s.instances, tenantID+"/"+id)
+	return ok, nil
+}
+
+func TestNewCreateConnectorInstanceValidation(t *testing.T) {
+	tests := []string{
+		`{"connectorSpecId":"internal","config":{}}`,
+		`{"name":"test","config":{}}`,
+		`{"name":"test","connectorSpecId":"internal","config":[]}`,
+		`not json`,
+	}
+
+	for _, body := range tests {
+		var badRequest *model.BadRequestError
+		if _, err := NewCreateConnectorInstance("acme", []byte(body)); !errors.As(err, &badRequest) {
+			t.Errorf("expected %s to be rejected, got %v", body, err)
+		}
+	}
+}
+
+func TestConnectorInstanceLifecycle(t *testing.T) {
+	ctx := context.Background()
+	specs := newFakeConnectorSpecStore()
+	instances := &fakeConnectorInstanceStore{}
+	acls := &fakeACLStore{}
+
+	create, err := NewCreateConnectorInstance("acme", []byte(`{"name":"test","connectorSpecId":"internal"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := create.Handle(ctx, specs, instances)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || string(created.Config) != `{}` || created.Created.IsZero() {
+		t.Errorf("unexpected instance %+v", created)
+	}
+
+	update, _ := NewUpdateConnectorInstance("acme", created.ID, []byte(`{"name":"test2","connectorSpecId":"internal","config":{"mockKey":"mockValue"}}`))
+	updated, err := update.Handle(ctx, specs, instances)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "test2" || !updated.Created.Equal(created.Created) || string(updated.Config) != `{"mockKey":"mockValue"}` {
+		t.Errorf("unexpected instance %+v", updated)
+	}
+
+	_ = acls.SaveACL(ctx, &model.InstanceACL{TenantID: "acme", InstanceID: created.ID})
+
+	del, _ := NewDeleteConnectorInstance("acme", created.ID)
+	deleted, err := del.Handle(ctx, instances, acls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.Name != "test2" {
+		t.Errorf("expected the deleted instance, got %+v", deleted)
+	}
+	if len(instances.instances) != 0 || len(acls.acls) != 0 {
+		t.Errorf("expected the instance and its acl to be deleted, got %v and %v", instances.instances, acls.acls)
+	}
+
+	if _, err := del.Handle(ctx, instances, acls); !errors.Is(err, ErrConnectorInstanceNotFound) {
+		t.Errorf("expected ErrConnectorInstanceNotFound, got %v", err)
+	}
+}
+
+func TestConnectorInstanceRequiresSpec(t *testing.T) {
+	ctx := context.Background()
+	specs := newFakeConnectorSpecStore()
+	instances := &fakeConnectorInstanceStore{}
+	_ = specs.SaveSpec(ctx, &model.ConnectorSpec{ID: "acme-hr", TenantID: "acme"})
+
+	// Another tenant's spec doesn't exist for the caller.
+	create, _ := NewCreateConnectorInstance("other", []byte(`{"name":"test","connectorSpecId":"acme-hr"}`))
+
+	var badRequest *model.BadRequestError
+	if _, err := create.Handle(ctx, specs, instances); !errors.As(err, &badRequest) {
+		t.Errorf("expected a bad request, got %v", err)
+	}
+
+	update, _ := NewUpdateConnectorInstance("acme", "missing", []byte(`{"name":"test","connectorSpecId":"acme-hr"}`))
+	if _, err := update.Handle(ctx, specs, instances); !errors.Is(err, ErrConnectorInstanceNotFound) {
+		t.Errorf("expected ErrConnectorInstanceNotFound, got %v", err)
+	}
+}
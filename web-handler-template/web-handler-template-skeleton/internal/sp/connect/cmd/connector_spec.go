@@ -0,0 +1,193 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/google/uuid"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// ErrConnectorSpecNotFound is returned when a connector spec to change doesn't exist in the caller's tenant.
+var ErrConnectorSpecNotFound = errors.New("connector spec not found")
+
+// ValidateConnectorSpec is a command that validates a connector spec without saving it.
+type ValidateConnectorSpec struct {
+	Spec *model.ConnectorSpec
+}
+
+// NewValidateConnectorSpec constructs a new ValidateConnectorSpec command from the body of a request.
+func NewValidateConnectorSpec(body []byte) (*ValidateConnectorSpec, error) {
+	spec, err := parseConnectorSpec(body)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &ValidateConnectorSpec{}
+	cmd.Spec = spec
+
+	return cmd, nil
+}
+
+// Handle validates the spec against the connector spec schema, returning it as parsed.
+func (cmd *ValidateConnectorSpec) Handle(ctx context.Context, validator model.SchemaValidator) (*model.ConnectorSpec, error) {
+	if err := validateConnectorSpec(ctx, validator, cmd.Spec); err != nil {
+		return nil, err
+	}
+
+	return cmd.Spec, nil
+}
+
+// CreateConnectorSpec is a command that creates a connector spec in a tenant.
+type CreateConnectorSpec struct {
+	TenantID string
+	Spec     *model.ConnectorSpec
+}
+
+// NewCreateConnectorSpec constructs a new CreateConnectorSpec command from the body of a request. The
+// spec may name its own ID; otherwise one is generated.
+func NewCreateConnectorSpec(tenantID string, body []byte) (*CreateConnectorSpec, error) {
+	spec, err := parseConnectorSpec(body)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &CreateConnectorSpec{}
+	cmd.TenantID = tenantID
+	cmd.Spec = spec
+
+	return cmd, nil
+}
+
+// Handle validates and saves the spec. Its ID can't be that of a built-in spec or an existing spec.
+func (cmd *CreateConnectorSpec) Handle(ctx context.Context, validator model.SchemaValidator, store model.ConnectorSpecStore) (*model.ConnectorSpec, error) {
+	if err := validateConnectorSpec(ctx, validator, cmd.Spec); err != nil {
+		return nil, err
+	}
+
+	spec := cmd.Spec
+	if spec.ID == "" {
+		spec.ID = uuid.New().String()
+	} else {
+		if store.IsBuiltIn(spec.ID) {
+			return nil, model.NewBadRequestError("connector spec %s is built in", spec.ID)
+		}
+
+		existing, err := store.GetSpec(ctx, cmd.TenantID, spec.ID)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, model.NewBadRequestError("connector spec %s already exists", spec.ID)
+		}
+	}
+
+	spec.TenantID = cmd.TenantID
+	spec.Created = time.Now().UTC()
+	spec.Modified = spec.Created
+
+	if err := store.SaveSpec(ctx, spec); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// UpdateConnectorSpec is a command that replaces or patches a connector spec of a tenant.
+type UpdateConnectorSpec struct {
+	TenantID string
+	ID       string
+	Body     json.RawMessage
+
+	// Patch is whether Body is a JSON merge patch (RFC 7396) of the spec, rather than its replacement.
+	Patch bool
+}
+
+// NewUpdateConnectorSpec constructs a new UpdateConnectorSpec command from the body of a request.
+func NewUpdateConnectorSpec(tenantID string, id string, body []byte, patch bool) (*UpdateConnectorSpec, error) {
+	if id == "" {
+		return nil, model.NewBadRequestError("connector spec id is required")
+	}
+
+	if !json.Valid(body) {
+		return nil, model.NewBadRequestError("parse connector spec: invalid json")
+	}
+
+	cmd := &UpdateConnectorSpec{}
+	cmd.TenantID = tenantID
+	cmd.ID = id
+	cmd.Body = body
+	cmd.Patch = patch
+
+	return cmd, nil
+}
+
+// Handle validates and saves the updated spec, keeping its ID and creation time. Built-in specs
+// can't be updated.
+func (cmd *UpdateConnectorSpec) Handle(ctx context.Context, validator model.SchemaValidator, store model.ConnectorSpecStore) (*model.ConnectorSpec, error) {
+	if store.IsBuiltIn(cmd.ID) {
+		return nil, model.NewBadRequestError("connector spec %s is built in", cmd.ID)
+	}
+
+	current, err := store.GetSpec(ctx, cmd.TenantID, cmd.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, ErrConnectorSpecNotFound
+	}
+
+	doc := []byte(cmd.Body)
+	if cmd.Patch {
+		if doc, err = jsonpatch.MergePatch(current.Document, cmd.Body); err != nil {
+			return nil, model.NewBadRequestError("patch connector spec: %v", err)
+		}
+	}
+
+	spec, err := parseConnectorSpec(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.ID != "" && spec.ID != cmd.ID {
+		return nil, model.NewBadRequestError("connector spec id %s doesn't match %s", spec.ID, cmd.ID)
+	}
+
+	if err := validateConnectorSpec(ctx, validator, spec); err != nil {
+		return nil, err
+	}
+
+	spec.ID = cmd.ID
+	spec.TenantID = cmd.TenantID
+	spec.Created = current.Created
+	spec.Modified = time.Now().UTC()
+
+	if err := store.SaveSpec(ctx, spec); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// parseConnectorSpec parses the body of a connector spec request.
+func parseConnectorSpec(body []byte) (*model.ConnectorSpec, error) {
+	spec := &model.ConnectorSpec{}
+	if err := json.Unmarshal(body, spec); err != nil {
+		return nil, model.NewBadRequestError("parse connector spec: %v", err)
+	}
+
+	return spec, nil
+}
+
+// validateConnectorSpec validates the document of a spec against the connector spec schema.
+func validateConnectorSpec(ctx context.Context, validator model.SchemaValidator, spec *model.ConnectorSpec) error {
+	if err := validator.ValidateSpec(ctx, spec.Document); err != nil {
+		return &model.BadRequestError{Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeConnectorSpecStore struct {
+	builtIn map[string]*model.ConnectorSpec
+	specs   map[string]*model.ConnectorSpec
+}
+
+func (s *fakeConnectorSpecStore) ListSpecs(ctx context.Context, tenantID string) ([]*model.ConnectorSpec, error) {
+	specs := []*model.ConnectorSpec{}
+	for _, spec := range s.builtIn {
+		specs = append(specs, spec)
+	}
+	for _, spec := range s.specs {
+		if spec.TenantID == tenantID {
+			specs = append(specs, spec)
+		}
+	}
+	return specs, nil
+}
+
+func (s *fakeConnectorSpecStore) GetSpec(ctx context.Context, tenantID string, id string) (*model.ConnectorSpec, error) {
+	if spec, ok := s.builtIn[id]; ok {
+		return spec, nil
+	}
+	return s.specs[tenantID+"/"+id], nil
+}
+
+func (s *fakeConnectorSpecStore) IsBuiltIn(id string) bool {
+	_, ok := s.builtIn[id]
+	return ok
+}
+
+func (s *fakeConnectorSpecStore) SaveSpec(ctx context.Context, spec *model.ConnectorSpec) error {
+	if s.specs == nil {
+		s.specs = map[string]*model.ConnectorSpec{}
+	}
+	s.specs[spec.TenantID+"/"+spec.ID] = spec
+	return nil
+}
+
+func newFakeConnectorSpecStore() *fakeConnectorSpecStore {
+	return &fakeConnectorSpecStore{builtIn: map[string]*model.ConnectorSpec{
+		"internal": {ID: "internal", Name: "Internal", Topology: model.TopologyInternal},
+	}}
+}
+
+func TestCreateConnectorSpec(t *testing.T) {
+	store := newFakeConnectorSpecStore()
+
+	cmd, err := NewCreateConnectorSpec("acme", []byte(`{"id":"acme-hr","name":"Acme HR","sourceConfig":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := cmd.Handle(context.Background(), fakeValidator{}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.ID != "acme-hr" || spec.TenantID != "acme" || spec.Created.IsZero() || !spec.Modified.Equal(spec.Created) {
+		t.Errorf("unexpected spec %+v", spec)
+	}
+
+	// Fields the service doesn't interpret are kept.
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	_ = json.Unmarshal(raw, &doc)
+	if _, ok := doc["sourceConfig"]; !ok || doc["id"] != "acme-hr" || doc["created"] == nil {
+		t.Errorf("unexpected document %s", raw)
+	}
+}
+
+func TestCreateConnectorSpecRejectsTakenIDs(t *testing.T) {
+	store := newFakeConnectorSpecStore()
+	_ = store.SaveSpec(context.Background(), &model.ConnectorSpec{ID: "acme-hr", TenantID: "acme"})
+
+	for _, body := range []string{`{"id":"internal","name":"Internal"}`, `{"id":"acme-hr","name":"Acme HR"}`, `{"name":""}`} {
+		cmd, err := NewCreateConnectorSpec("acme", []byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var badRequest *model.BadRequestError
+		if _, err := cmd.Handle(context.Background(), fakeValidator{}, store); !errors.As(err, &badRequest) {
+			t.Errorf("expected %s to be rejected, got %v", body, err)
+		}
+	}
+}
+
+func TestUpdateConnectorSpec(t *testing.T) {
+	store := newFakeConnectorSpecStore()
+
+	create, _ := NewCreateConnectorSpec("acme", []byte(`{"id":"acme-hr","name":"Acme HR","topology":"runtime","sourceConfig":[]}`))
+	created, err := create.Handle(context.Background(), fakeValidator{}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch, err := NewUpdateConnectorSpec("acme", "acme-hr", []byte(`{"name":"Acme People","sourceConfig":null}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched, err := patch.Handle(context.Background(), fakeValidator{}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if patched.Name != "Acme People" || patched.Topology != model.TopologyRuntime || !patched.Created.Equal(created.Created) {
+		t.Errorf("unexpected patched spec %+v", patched)
+	}
+
+	var doc map[string]interface{}
+	_ = json.Unmarshal(patched.Document, &doc)
+	if _, ok := doc["sourceConfig"]; ok {
+		t.Errorf("expected the patch to remove sourceConfig, got %s", patched.Document)
+	}
+
+	put, _ := NewUpdateConnectorSpec("acme", "acme-hr", []byte(`{"name":"Acme HR"}`), false)
+	replaced, err := put.Handle(context.Background(), fakeValidator{}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced.Name != "Acme HR" || replaced.Topology != "" {
+		t.Errorf("expected the spec to be replaced, got %+v", replaced)
+	}
+}
+
+func TestUpdateConnectorSpecErrors(t *testing.T) {
+	store := newFakeConnectorSpecStore()
+	_ = store.SaveSpec(context.Background(), &model.ConnectorSpec{ID: "acme-hr", TenantID: "acme", Document: json.RawMessage(`{}`)})
+
+	tests := []struct {
+		tenantID string
+		id       string
+		body     string
+		expected error
+	}{
+		{"acme", "missing", `{"name":"Missing"}`, ErrConnectorSpecNotFound},
+		{"other", "acme-hr", `{"name":"Acme HR"}`, ErrConnectorSpecNotFound},
+		{"acme", "internal", `{"name":"Internal"}`, &model.BadRequestError{}},
+		{"acme", "acme-hr", `{"id":"other","name":"Acme HR"}`, &model.BadRequestError{}},
+		{"acme", "acme-hr", `{"name":""}`, &model.BadRequestError{}},
+	}
+
+	for _, tt := range tests {
+		cmd, err := NewUpdateConnectorSpec(tt.tenantID, tt.id, []byte(tt.body), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = cmd.Handle(context.Background(), fakeValidator{}, store)
+
+		var badRequest *model.BadRequestError
+		if _, ok := tt.expected.(*model.BadRequestError); ok {
+			if !errors.As(err, &badRequest) {
+				t.Errorf("%s %s: expected a bad request, got %v", tt.id, tt.body, err)
+			}
+		} else if !errors.Is(err, tt.expected) {
+			t.Errorf("%s %s: expected %v, got %v", tt.id, tt.body, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// MaxConnectorEvents is the maximum number of events that can be submitted in a single request.
+const MaxConnectorEvents = 100
+
+// IngestConnectorEvents is a command that validates events submitted by a connector instance,
+// drops any that were already received and forwards the rest to the standard event topic.
+type IngestConnectorEvents struct {
+	TenantID   string
+	InstanceID string
+	Events     []model.ConnectorEvent
+	DedupTTL   time.Duration
+}
+
+// IngestConnectorEventsResult reports which of the submitted events were published and which were
+// dropped as duplicates.
+type IngestConnectorEventsResult struct {
+	Published  []string `json:"published"`
+	Duplicates []string `json:"duplicates"`
+}
+
+// NewIngestConnectorEvents constructs a new IngestConnectorEvents command.
+func NewIngestConnectorEvents(tenantID string, instanceID string, events []model.ConnectorEvent, dedupTTL time.Duration) (*IngestConnectorEvents, error) {
+	if instanceID == "" {
+		return nil, model.NewBadRequestError("connector instance id is required")
+	}
+
+	if len(events) == 0 {
+		return nil, model.NewBadRequestError("at least one event is required")
+	}
+
+	if len(events) > MaxConnectorEvents {
+		return nil, model.NewBadRequestError("at most %d events can be submitted at once", MaxConnectorEvents)
+	}
+
+	seen := make(map[string]bool, len(events))
+	for i, e := range events {
+		if e.ID == "" {
+			return nil, model.NewBadRequestError("events[%d]: id is required", i)
+		}
+		if seen[e.ID] {
+			return nil, model.NewBadRequestError("events[%d]: duplicate id %s", i, e.ID)
+		}
+		seen[e.ID] = true
+
+		if e.Type == "" {
+			return nil, model.NewBadRequestError("events[%d]: type is required", i)
+		}
+	}
+
+	cmd := &IngestConnectorEvents{}
+	cmd.TenantID = tenantID
+	cmd.InstanceID = instanceID
+	cmd.Events = events
+	cmd.DedupTTL = dedupTTL
+
+	return cmd, nil
+}
+
+// Handle validates every event before any are published, so that a request is either rejected as a
+// whole or accepted as a whole. An event is claimed in the key/value store before it is published and
+// the claim is released if publication fails, allowing the connector to safely retry the request.
+func (cmd *IngestConnectorEvents) Handle(ctx context.Context, validator model.SchemaValidator, kvs model.KeyValueStore, publisher model.StandardEventPublisher) (*IngestConnectorEventsResult, error) {
+	for i, e := range cmd.Events {
+		if err := validator.ValidateEvent(ctx, e.Type, e.Payload); err != nil {
+			return nil, &model.BadRequestError{Err: fmt.Errorf("events[%d]: %w", i, err)}
+		}
+	}
+
+	result := &IngestConnectorEventsResult{Published: []string{}, Duplicates: []string{}}
+	claimed := make([]model.ConnectorEvent, 0, len(cmd.Events))
+
+	for _, e := range cmd.Events {
+		ok, err := kvs.SetIfAbsent(ctx, cmd.dedupKey(e.ID), "1", cmd.DedupTTL)
+		if err != nil {
+			cmd.release(ctx, kvs, claimed)
+			return nil, fmt.Errorf("claim event %s: %w", e.ID, err)
+		}
+
+		if !ok {
+			result.Duplicates = append(result.Duplicates, e.ID)
+			continue
+		}
+
+		claimed = append(claimed, e)
+	}
+
+	if len(claimed) == 0 {
+		return result, nil
+	}
+
+	failedIDs, err := publisher.PublishConnectorEvents(ctx, cmd.InstanceID, claimed)
+	if err != nil {
+		cmd.release(ctx, kvs, claimed)
+		return nil, err
+	}
+
+	failed := make(map[string]bool, len(failedIDs))
+	for _, id := range failedIDs {
+		failed[id] = true
+	}
+
+	var unpublished []model.ConnectorEvent
+	for _, e := range claimed {
+		if failed[e.ID] {
+			unpublished = append(unpublished, e)
+		} else {
+			result.Published = append(result.Published, e.ID)
+		}
+	}
+
+	if len(unpublished) > 0 {
+		cmd.release(ctx, kvs, unpublished)
+		return nil, errors.New("failed to publish connector events")
+	}
+
+	return result, nil
+}
+
+// dedupKey returns the key that records receipt of an event. Event IDs are only required to be
+// unique per connector instance.
+func (cmd *IngestConnectorEvents) dedupKey(eventID string) string {
+	return fmt.Sprintf("connector-event:%s:%s:%s", cmd.TenantID, cmd.InstanceID, eventID)
+}
+
+// release removes the claims on events that weren't published. Failures are ignored, since the
+// claims expire on their own.
+func (cmd *IngestConnectorEvents) release(ctx context.Context, kvs model.KeyValueStore, events []model.ConnectorEvent) {
+	for _, e := range events {
+		_ = kvs.Delete(ctx, cmd.dedupKey(e.ID))
+	}
+}
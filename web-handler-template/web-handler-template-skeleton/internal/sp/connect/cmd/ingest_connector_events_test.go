@@ -0,0 +1,160 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeValidator struct{}
+
+func (fakeValidator) ValidateEvent(ctx context.Context, eventType model.StandardEventType, payload json.RawMessage) error {
+	if eventType != model.StandardEventAccountUpdated {
+		return errors.New("unknown event type")
+	}
+	return nil
+}
+
+func (fakeValidator) ValidateSpec(ctx context.Context, document json.RawMessage) error {
+	var spec struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(document, &spec); err != nil || spec.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func (fakeValidator) ValidateCommandInput(ctx context.Context, commandType model.CommandType, input json.RawMessage) error {
+	if commandType == model.CommandTestConnection && string(input) != `{}` {
+		return errors.New("additional properties not allowed")
+	}
+	return nil
+}
+
+type fakeKeyValueStore map[string]string
+
+func (s fakeKeyValueStore) Get(ctx context.Context, key string) (string, bool, error) {
+	v, ok := s[key]
+	return v, ok, nil
+}
+
+func (s fakeKeyValueStore) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	s[key] = value
+	return nil
+}
+
+func (s fakeKeyValueStore) SetIfAbsent(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	if _, ok := s[key]; ok {
+		return false, nil
+	}
+	s[key] = value
+	return true, nil
+}
+
+func (s fakeKeyValueStore) Delete(ctx context.Context, key string) error {
+	delete(s, key)
+	return nil
+}
+
+type fakePublisher struct {
+	published []string
+	failIDs   []string
+}
+
+func (p *fakePublisher) PublishConnectorEvents(ctx context.Context, instanceID string, events []model.ConnectorEvent) ([]string, error) {
+	for _, e := range events {
+		p.published = append(p.published, e.ID)
+	}
+	return p.failIDs, nil
+}
+
+func testEvent(id string) model.ConnectorEvent {
+	return model.ConnectorEvent{ID: id, Type: model.StandardEventAccountUpdated, Payload: json.RawMessage(`{"identity":"jdoe"}`)}
+}
+
+func TestIngestConnectorEventsDeduplicates(t *testing.T) {
+	ctx := context.Background()
+	kvs := fakeKeyValueStore{}
+	publisher := &fakePublisher{}
+
+	cmd, err := NewIngestConnectorEvents("acme", "i1", []model.ConnectorEvent{testEvent("a"), testEvent("b")}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cmd.Handle(ctx, fakeValidator{}, kvs, publisher); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, _ = NewIngestConnectorEvents("acme", "i1", []model.ConnectorEvent{testEvent("b"), testEvent("c")}, time.Hour)
+	result, err := cmd.Handle(ctx, fakeValidator{}, kvs, publisher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := deep.Equal(result, &IngestConnectorEventsResult{Published: []string{"c"}, Duplicates: []string{"b"}}); diff != nil {
+		t.Error(diff)
+	}
+
+	if diff := deep.Equal(publisher.published, []string{"a", "b", "c"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestIngestConnectorEventsRejectsInvalidBatch(t *testing.T) {
+	kvs := fakeKeyValueStore{}
+	publisher := &fakePublisher{}
+
+	invalid := testEvent("b")
+	invalid.Type = "std:unknown"
+
+	cmd, _ := NewIngestConnectorEvents("acme", "i1", []model.ConnectorEvent{testEvent("a"), invalid}, time.Hour)
+	_, err := cmd.Handle(context.Background(), fakeValidator{}, kvs, publisher)
+
+	var badRequest *model.BadRequestError
+	if !errors.As(err, &badRequest) {
+		t.Fatalf("expected bad request, got %v", err)
+	}
+
+	if len(publisher.published) != 0 || len(kvs) != 0 {
+		t.Error("expected nothing to be claimed or published")
+	}
+}
+
+func TestIngestConnectorEventsReleasesFailedEvents(t *testing.T) {
+	kvs := fakeKeyValueStore{}
+	publisher := &fakePublisher{failIDs: []string{"b"}}
+
+	cmd, _ := NewIngestConnectorEvents("acme", "i1", []model.ConnectorEvent{testEvent("a"), testEvent("b")}, time.Hour)
+	if _, err := cmd.Handle(context.Background(), fakeValidator{}, kvs, publisher); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, ok := kvs[cmd.dedupKey("a")]; !ok {
+		t.Error("expected published event to remain claimed")
+	}
+	if _, ok := kvs[cmd.dedupKey("b")]; ok {
+		t.Error("expected failed event to be released")
+	}
+}
+
+func TestNewIngestConnectorEventsValidation(t *testing.T) {
+	tests := [][]model.ConnectorEvent{
+		nil,
+		{{Type: model.StandardEventAccountUpdated}},
+		{testEvent("a"), testEvent("a")},
+		{{ID: "a"}},
+	}
+
+	for i, events := range tests {
+		if _, err := NewIngestConnectorEvents("acme", "i1", events, time.Hour); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
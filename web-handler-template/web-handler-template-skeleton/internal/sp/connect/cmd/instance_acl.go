@@ -0,0 +1,134 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// SaveInstanceACL is a command that creates or replaces the ACL of a connector instance.
+type SaveInstanceACL struct {
+	TenantID   string
+	InstanceID string
+	Entries    []model.ACLEntry `json:"entries"`
+}
+
+// NewSaveInstanceACL constructs a new SaveInstanceACL command from the body of a request. Every entry
+// must name a principal and grant at least one valid verb.
+func NewSaveInstanceACL(tenantID string, instanceID string, body []byte) (*SaveInstanceACL, error) {
+	cmd := &SaveInstanceACL{}
+	if err := json.Unmarshal(body, cmd); err != nil {
+		return nil, model.NewBadRequestError("parse acl: %v", err)
+	}
+	cmd.TenantID = tenantID
+	cmd.InstanceID = instanceID
+
+	if instanceID == "" {
+		return nil, model.NewBadRequestError("connector instance id is required")
+	}
+
+	if cmd.Entries == nil {
+		cmd.Entries = []model.ACLEntry{}
+	}
+
+	for i, e := range cmd.Entries {
+		switch e.PrincipalType {
+		case model.ACLIdentity, model.ACLClient, model.ACLGroup:
+		default:
+			return nil, model.NewBadRequestError("entry %d: unknown principal type %q", i, e.PrincipalType)
+		}
+
+		if e.PrincipalID == "" {
+			return nil, model.NewBadRequestError("entry %d: principal id is required", i)
+		}
+
+		if len(e.Verbs) == 0 {
+			return nil, model.NewBadRequestError("entry %d: at least one verb is required", i)
+		}
+
+		for _, v := range e.Verbs {
+			if !v.Valid() {
+				return nil, model.NewBadRequestError("entry %d: invalid verb %q (expected read, update or invoke:<command-type>)", i, v)
+			}
+		}
+	}
+
+	return cmd, nil
+}
+
+// Handle saves the ACL.
+func (cmd *SaveInstanceACL) Handle(ctx context.Context, store model.ACLStore) (*model.InstanceACL, error) {
+	acl := &model.InstanceACL{
+		TenantID:   cmd.TenantID,
+		InstanceID: cmd.InstanceID,
+		Entries:    cmd.Entries,
+		Modified:   time.Now().UTC(),
+	}
+
+	if err := store.SaveACL(ctx, acl); err != nil {
+		return nil, err
+	}
+
+	return acl, nil
+}
+
+// AuthorizeInstanceAccess is a command that decides whether a principal may perform a verb on a
+// connector instance. It's checked after the principal's rights, so instances without an ACL allow
+// every principal.
+type AuthorizeInstanceAccess struct {
+	TenantID   string
+	InstanceID string
+	Principal  *model.Principal
+	Verb       model.ACLVerb
+}
+
+// NewAuthorizeInstanceAccess constructs a new AuthorizeInstanceAccess command.
+func NewAuthorizeInstanceAccess(tenantID string, instanceID string, principal *model.Principal, verb model.ACLVerb) (*AuthorizeInstanceAccess, error) {
+	if principal == nil {
+		return nil, model.NewBadRequestError("principal is required")
+	}
+
+	if !verb.Valid() {
+		return nil, model.NewBadRequestError("invalid verb %q", verb)
+	}
+
+	cmd := &AuthorizeInstanceAccess{}
+	cmd.TenantID = tenantID
+	cmd.InstanceID = instanceID
+	cmd.Principal = principal
+	cmd.Verb = verb
+
+	return cmd, nil
+}
+
+// Handle decides on the access, allowing it if the instance has no ACL or one of the entries that
+// apply to the principal grants the verb.
+func (cmd *AuthorizeInstanceAccess) Handle(ctx context.Context, store model.ACLStore) (*model.AccessDecision, error) {
+	acl, err := store.GetACL(ctx, cmd.TenantID, cmd.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if acl == nil {
+		return &model.AccessDecision{Allowed: true, Reason: "instance has no acl"}, nil
+	}
+
+	for i := range acl.Entries {
+		e := &acl.Entries[i]
+		if !cmd.Principal.Matches(e) {
+			continue
+		}
+
+		for _, v := range e.Verbs {
+			if v.Grants(cmd.Verb) {
+				return &model.AccessDecision{Allowed: true, Reason: fmt.Sprintf("granted %s by %s %s", v, e.PrincipalType, e.PrincipalID)}, nil
+			}
+		}
+	}
+
+	return &model.AccessDecision{Allowed: false, Reason: fmt.Sprintf("no acl entry grants %s", cmd.Verb)}, nil
+}
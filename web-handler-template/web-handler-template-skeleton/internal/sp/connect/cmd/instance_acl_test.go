@@ -0,0 +1,102 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeACLStore struct {
+	acls map[string]*model.InstanceACL
+}
+
+func (s *fakeACLStore) GetACL(ctx context.Context, tenantID string, instanceID string) (*model.InstanceACL, error) {
+	return s.acls[tenantID+"/"+instanceID], nil
+}
+
+func (s *fakeACLStore) SaveACL(ctx context.Context, acl *model.InstanceACL) error {
+	if s.acls == nil {
+		s.acls = map[string]*model.InstanceACL{}
+	}
+	s.acls[acl.TenantID+"/"+acl.InstanceID] = acl
+	return nil
+}
+
+func (s *fakeACLStore) DeleteACL(ctx context.Context, tenantID string, instanceID string) error {
+	delete(s.acls, tenantID+"/"+instanceID)
+	return nil
+}
+
+func TestNewSaveInstanceACLValidation(t *testing.T) {
+	tests := []string{
+		`{"entries":[{"principalType":"user","principalId":"a","verbs":["read"]}]}`,
+		`{"entries":[{"principalType":"identity","principalId":"","verbs":["read"]}]}`,
+		`{"entries":[{"principalType":"identity","principalId":"a","verbs":[]}]}`,
+		`{"entries":[{"principalType":"identity","principalId":"a","verbs":["delete"]}]}`,
+		`{"entries":[{"principalType":"identity","principalId":"a","verbs":["invoke:"]}]}`,
+		`not json`,
+	}
+
+	for _, body := range tests {
+		var badRequest *model.BadRequestError
+		if _, err := NewSaveInstanceACL("acme", "inst-1", []byte(body)); !errors.As(err, &badRequest) {
+			t.Errorf("expected %s to be rejected, got %v", body, err)
+		}
+	}
+}
+
+func TestAuthorizeInstanceAccess(t *testing.T) {
+	store := &fakeACLStore{}
+
+	save, err := NewSaveInstanceACL("acme", "inst-1", []byte(`{"entries":[
+		{"principalType":"identity","principalId":"alice","verbs":["read","invoke:std:account:list"]},
+		{"principalType":"group","principalId":"ORG_ADMIN","verbs":["update","invoke:*"]},
+		{"principalType":"client","principalId":"ci-bot","verbs":["invoke:std:test-connection"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := save.Handle(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &model.Principal{IdentityID: "alice"}
+	admin := &model.Principal{IdentityID: "bob", Groups: []string{"ORG_ADMIN"}}
+	bot := &model.Principal{ClientID: "ci-bot"}
+
+	tests := []struct {
+		instanceID string
+		principal  *model.Principal
+		verb       model.ACLVerb
+		allowed    bool
+	}{
+		{"inst-1", alice, model.ACLRead, true},
+		{"inst-1", alice, model.ACLInvoke("std:account:list"), true},
+		{"inst-1", alice, model.ACLInvoke("std:account:delete"), false},
+		{"inst-1", alice, model.ACLUpdate, false},
+		{"inst-1", admin, model.ACLInvoke("std:account:delete"), true},
+		{"inst-1", admin, model.ACLRead, false},
+		{"inst-1", bot, model.ACLInvoke("std:test-connection"), true},
+		{"inst-1", bot, model.ACLInvoke("std:account:list"), false},
+		{"inst-2", bot, model.ACLInvoke("std:account:delete"), true},
+	}
+
+	for _, tt := range tests {
+		cmd, err := NewAuthorizeInstanceAccess("acme", tt.instanceID, tt.principal, tt.verb)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decision, err := cmd.Handle(context.Background(), store)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if decision.Allowed != tt.allowed {
+			t.Errorf("%s %s on %s: expected allowed=%v, got %+v", tt.principal, tt.verb, tt.instanceID, tt.allowed, decision)
+		}
+	}
+}
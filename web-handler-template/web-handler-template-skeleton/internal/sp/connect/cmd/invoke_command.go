@@ -0,0 +1,113 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// InvokeCommand is a command that invokes a command against a connector instance on behalf of a
+// caller, subject to the tenant's and the instance's invocation limits.
+type InvokeCommand struct {
+	TenantID            string
+	ConnectorInstanceID string
+	InvocationID        string
+	Type                model.CommandType `json:"type"`
+	Input               json.RawMessage   `json:"input"`
+
+	// Context is the caller's context of the invocation, handed back with its last results.
+	Context json.RawMessage `json:"context"`
+
+	// Timeout is how long the invocation may run before it expires, or zero for the spec's timeout.
+	Timeout time.Duration `json:"-"`
+
+	// Response is what a connector with the internal topology answers the command with.
+	Response json.RawMessage `json:"response"`
+}
+
+// invokeOptions are the fields of an invoke request that aren't taken as they are.
+type invokeOptions struct {
+	Timeout string `json:"timeout"`
+}
+
+// NewInvokeCommand constructs a new InvokeCommand command from the body of an invoke request.
+func NewInvokeCommand(tenantID string, instanceID string, body []byte) (*InvokeCommand, error) {
+	cmd := &InvokeCommand{}
+	if err := json.Unmarshal(body, cmd); err != nil {
+		return nil, model.NewBadRequestError("parse command: %v", err)
+	}
+	cmd.TenantID = tenantID
+	cmd.ConnectorInstanceID = instanceID
+	cmd.InvocationID = uuid.New().String()
+
+	options := invokeOptions{}
+	if err := json.Unmarshal(body, &options); err != nil {
+		return nil, model.NewBadRequestError("parse command: %v", err)
+	}
+	if options.Timeout != "" {
+		timeout, err := time.ParseDuration(options.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, model.NewBadRequestError("timeout must be a positive duration, eg. \"30s\"")
+		}
+		cmd.Timeout = timeout
+	}
+
+	if instanceID == "" {
+		return nil, model.NewBadRequestError("connector instance id is required")
+	}
+
+	if cmd.Type == "" {
+		return nil, model.NewBadRequestError("command type is required")
+	}
+
+	if len(cmd.Input) == 0 {
+		cmd.Input = json.RawMessage(`{}`)
+	}
+
+	return cmd, nil
+}
+
+// Handle admits the invocation and invokes the command, unless the org is suspended or the input
+// doesn't conform to the command's schema, returning the new invocation. The concurrency slot taken
+// by the invocation is released when it finishes, or here if it couldn't be started.
+func (cmd *InvokeCommand) Handle(ctx context.Context, validator model.SchemaValidator, store model.OrgStatusStore, limiter model.InvocationLimiter, starter model.InvocationStarter) (*model.Invocation, error) {
+	if err := validator.ValidateCommandInput(ctx, cmd.Type, cmd.Input); err != nil {
+		return nil, &model.BadRequestError{Err: fmt.Errorf("input: %w", err)}
+	}
+
+	suspended, err := store.IsSuspended(ctx, cmd.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if suspended {
+		return nil, model.ErrOrgSuspended
+	}
+
+	if err := limiter.Acquire(ctx, cmd.TenantID, cmd.ConnectorInstanceID, cmd.InvocationID); err != nil {
+		return nil, err
+	}
+
+	inv, err := starter.StartInvocation(ctx, &model.InvocationRequest{
+		InvocationID:        cmd.InvocationID,
+		ConnectorInstanceID: cmd.ConnectorInstanceID,
+		Type:                cmd.Type,
+		Input:               cmd.Input,
+		Context:             cmd.Context,
+		Timeout:             cmd.Timeout,
+		Response:            cmd.Response,
+	})
+	if err != nil {
+		if releaseErr := limiter.Release(ctx, cmd.TenantID, cmd.ConnectorInstanceID, cmd.InvocationID); releaseErr != nil {
+			return nil, fmt.Errorf("%w (release invocation slot: %v)", err, releaseErr)
+		}
+		return nil, err
+	}
+
+	return inv, nil
+}
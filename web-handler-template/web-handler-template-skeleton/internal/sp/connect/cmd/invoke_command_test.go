@@ -0,0 +1,154 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeLimiter struct {
+	err      error
+	acquired []string
+	released []string
+}
+
+func (l *fakeLimiter) Acquire(ctx context.Context, tenantID string, instanceID string, invocationID string) error {
+	if l.err != nil {
+		return l.err
+	}
+	l.acquired = append(l.acquired, invocationID)
+	return nil
+}
+
+func (l *fakeLimiter) Release(ctx context.Context, tenantID string, instanceID string, invocationID string) error {
+	l.released = append(l.released, invocationID)
+	return nil
+}
+
+type fakeStarter struct {
+	err      error
+	started  []string
+	contexts []string
+	timeouts []time.Duration
+}
+
+func (s *fakeStarter) StartInvocation(ctx context.Context, req *model.InvocationRequest) (*model.Invocation, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.started = append(s.started, req.InvocationID)
+	s.contexts = append(s.contexts, string(req.Context))
+	s.timeouts = append(s.timeouts, req.Timeout)
+	return &model.Invocation{ID: req.InvocationID, ConnectorInstanceID: req.ConnectorInstanceID, Type: req.Type, Status: model.InvocationPending}, nil
+}
+
+func TestInvokeCommandAcquiresSlot(t *testing.T) {
+	cmd, err := NewInvokeCommand("acme", "instance", []byte(`{"type":"std:account:list"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter := &fakeLimiter{}
+	starter := &fakeStarter{}
+	inv, err := cmd.Handle(context.Background(), fakeValidator{}, fakeOrgStatusStore{}, limiter, starter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv == nil || inv.ID != cmd.InvocationID {
+		t.Errorf("expected the started invocation, got %+v", inv)
+	}
+
+	if len(limiter.acquired) != 1 || limiter.acquired[0] != cmd.InvocationID || len(limiter.released) != 0 {
+		t.Errorf("unexpected slots: acquired %v, released %v", limiter.acquired, limiter.released)
+	}
+	if len(starter.started) != 1 || starter.started[0] != cmd.InvocationID || string(cmd.Input) != `{}` {
+		t.Errorf("unexpected invocations: %v", starter.started)
+	}
+	if starter.timeouts[0] != 0 {
+		t.Errorf("expected the spec's timeout to be left to the starter, got %s", starter.timeouts[0])
+	}
+}
+
+func TestInvokeCommandPassesTheTimeoutAndContext(t *testing.T) {
+	cmd, err := NewInvokeCommand("acme", "instance", []byte(`{"type":"std:account:list","timeout":"10s","context":{"page":1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	starter := &fakeStarter{}
+	if _, err := cmd.Handle(context.Background(), fakeValidator{}, fakeOrgStatusStore{}, &fakeLimiter{}, starter); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(starter.timeouts) != 1 || starter.timeouts[0] != 10*time.Second {
+		t.Errorf("expected a timeout of 10s, got %v", starter.timeouts)
+	}
+	if starter.contexts[0] != `{"page":1}` {
+		t.Errorf("expected the caller's context, got %s", starter.contexts[0])
+	}
+}
+
+func TestInvokeCommandOverLimit(t *testing.T) {
+	cmd, _ := NewInvokeCommand("acme", "instance", []byte(`{"type":"std:account:list"}`))
+
+	limited := &model.TooManyRequestsError{Reason: "rate limit exceeded", RetryAfter: time.Second}
+	starter := &fakeStarter{}
+	_, err := cmd.Handle(context.Background(), fakeValidator{}, fakeOrgStatusStore{}, &fakeLimiter{err: limited}, starter)
+
+	var tooMany *model.TooManyRequestsError
+	if !errors.As(err, &tooMany) || tooMany.RetryAfter != time.Second {
+		t.Errorf("expected too many requests, got %v", err)
+	}
+	if len(starter.started) != 0 {
+		t.Errorf("expected no invocations, got %v", starter.started)
+	}
+}
+
+func TestInvokeCommandReleasesSlotOnFailure(t *testing.T) {
+	cmd, _ := NewInvokeCommand("acme", "instance", []byte(`{"type":"std:account:list"}`))
+
+	limiter := &fakeLimiter{}
+	if _, err := cmd.Handle(context.Background(), fakeValidator{}, fakeOrgStatusStore{}, limiter, &fakeStarter{err: errors.New("boom")}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if len(limiter.released) != 1 || limiter.released[0] != cmd.InvocationID {
+		t.Errorf("expected slot to be released, got %v", limiter.released)
+	}
+}
+
+func TestInvokeCommandRejectsInvalidInput(t *testing.T) {
+	cmd, _ := NewInvokeCommand("acme", "instance", []byte(`{"type":"std:test-connection","input":{"identity":"john.doe"}}`))
+
+	limiter := &fakeLimiter{}
+	starter := &fakeStarter{}
+	_, err := cmd.Handle(context.Background(), fakeValidator{}, fakeOrgStatusStore{}, limiter, starter)
+
+	var badRequest *model.BadRequestError
+	if !errors.As(err, &badRequest) {
+		t.Errorf("expected a bad request, got %v", err)
+	}
+	if len(limiter.acquired) != 0 || len(starter.started) != 0 {
+		t.Errorf("expected nothing to be admitted or started, got %v, %v", limiter.acquired, starter.started)
+	}
+}
+
+func TestNewInvokeCommandValidation(t *testing.T) {
+	var badRequest *model.BadRequestError
+
+	if _, err := NewInvokeCommand("acme", "instance", []byte(`{}`)); !errors.As(err, &badRequest) {
+		t.Errorf("expected command type to be required, got %v", err)
+	}
+	if _, err := NewInvokeCommand("acme", "instance", []byte(`[`)); !errors.As(err, &badRequest) {
+		t.Errorf("expected malformed body to be rejected, got %v", err)
+	}
+	for _, timeout := range []string{"soon", "-1s", "0s"} {
+		if _, err := NewInvokeCommand("acme", "instance", []byte(`{"type":"std:account:list","timeout":"`+timeout+`"}`)); !errors.As(err, &badRequest) {
+			t.Errorf("expected timeout %q to be rejected, got %v", timeout, err)
+		}
+	}
+}
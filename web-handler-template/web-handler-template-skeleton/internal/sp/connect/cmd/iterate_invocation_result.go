@@ -0,0 +1,145 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// DefaultInvocationResultLimit is how many results a page holds when the request doesn't say.
+const DefaultInvocationResultLimit = 100
+
+// MaxInvocationResultLimit is the most results a page holds.
+const MaxInvocationResultLimit = 1000
+
+// invocationResultPollInterval is how often a long-poll checks for new results of an invocation.
+const invocationResultPollInterval = 250 * time.Millisecond
+
+// IterateInvocationResult is a command that long-polls for the next page of an invocation's results.
+// Each page starts after the results of the last, so that callers read every result exactly once.
+type IterateInvocationResult struct {
+	TenantID     string
+	InvocationID string
+	Limit        int
+	Wait         time.Duration
+}
+
+// InvocationResultPage is a page of an invocation's results. Done is set on the last page, which
+// carries the invocation's context if it completed, or why it didn't otherwise.
+type InvocationResultPage struct {
+	Done      bool              `json:"done"`
+	Context   json.RawMessage   `json:"context"`
+	Output    []json.RawMessage `json:"output"`
+	Error     string            `json:"error,omitempty"`
+	ErrorType string            `json:"errorType,omitempty"`
+}
+
+// iterateOptions are the fields of a next-result request.
+type iterateOptions struct {
+	Limit   int    `json:"limit"`
+	Timeout string `json:"timeout"`
+}
+
+// NewIterateInvocationResult constructs a new IterateInvocationResult command from the body of a
+// next-result request, which may be empty. The wait is capped at maxWait, and the limit at
+// MaxInvocationResultLimit.
+func NewIterateInvocationResult(tenantID string, invocationID string, body []byte, maxWait time.Duration) (*IterateInvocationResult, error) {
+	if invocationID == "" {
+		return nil, model.NewBadRequestError("invocation id is required")
+	}
+
+	options := iterateOptions{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &options); err != nil {
+			return nil, model.NewBadRequestError("parse request: %v", err)
+		}
+	}
+
+	if options.Limit < 0 {
+		return nil, model.NewBadRequestError("limit must not be negative")
+	}
+	if options.Limit == 0 {
+		options.Limit = DefaultInvocationResultLimit
+	}
+	if options.Limit > MaxInvocationResultLimit {
+		options.Limit = MaxInvocationResultLimit
+	}
+
+	var wait time.Duration
+	if options.Timeout != "" {
+		var err error
+		if wait, err = time.ParseDuration(options.Timeout); err != nil || wait < 0 {
+			return nil, model.NewBadRequestError("timeout must be a duration, eg. \"10s\"")
+		}
+	}
+	if wait > maxWait {
+		wait = maxWait
+	}
+
+	cmd := &IterateInvocationResult{}
+	cmd.TenantID = tenantID
+	cmd.InvocationID = invocationID
+	cmd.Limit = options.Limit
+	cmd.Wait = wait
+
+	return cmd, nil
+}
+
+// Handle waits up to cmd.Wait for results of the invocation that haven't been read, returning as
+// soon as there are some or the invocation is done. An invocation that doesn't exist gets an empty
+// page that isn't done, as it may not have been persisted yet.
+func (cmd *IterateInvocationResult) Handle(ctx context.Context, store model.InvocationStore) (*InvocationResultPage, error) {
+	deadline := time.Now().Add(cmd.Wait)
+	for {
+		inv, results, err := store.NextResults(ctx, cmd.TenantID, cmd.InvocationID, cmd.Limit)
+		if err != nil {
+			return nil, err
+		}
+
+		if inv == nil {
+			return &InvocationResultPage{Output: []json.RawMessage{}}, nil
+		}
+
+		done := inv.Status.Final() && inv.ResultsRead >= inv.ResultCount
+		if len(results) > 0 || done || !time.Now().Before(deadline) {
+			return newInvocationResultPage(inv, results, done), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(invocationResultPollInterval):
+		}
+	}
+}
+
+// newInvocationResultPage builds a page of the invocation's results.
+func newInvocationResultPage(inv *model.Invocation, results []json.RawMessage, done bool) *InvocationResultPage {
+	page := &InvocationResultPage{Done: done, Output: results}
+	if page.Output == nil {
+		page.Output = []json.RawMessage{}
+	}
+	if !done {
+		return page
+	}
+
+	switch {
+	case inv.Status == model.InvocationCompleted:
+		page.Context = inv.Context
+	case inv.Failure != nil && inv.Failure.Connector != nil:
+		page.Error = fmt.Sprintf("[%s] %s", inv.Failure.Connector.Category, inv.Failure.Connector.Message)
+		page.ErrorType = inv.Failure.Connector.Type
+	case inv.Failure != nil:
+		page.Error = inv.Failure.Message
+		page.ErrorType = string(inv.Failure.Type)
+	default:
+		page.Error = fmt.Sprintf("invocation %s", inv.Status)
+		page.ErrorType = string(inv.Status)
+	}
+
+	return page
+}
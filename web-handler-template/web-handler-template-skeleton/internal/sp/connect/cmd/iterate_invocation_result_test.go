@@ -0,0 +1,165 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// fakeResultStore is an InvocationStore that reads the results of its invocations, by tenant and ID.
+type fakeResultStore struct {
+	model.InvocationStore
+	invocations map[string]*model.Invocation
+	results     map[string][]json.RawMessage
+
+	// reads is the number of NextResults calls so far, and onRead is called after each.
+	reads  int
+	onRead func(reads int)
+}
+
+func (s *fakeResultStore) NextResults(ctx context.Context, tenantID string, id string, limit int) (*model.Invocation, []json.RawMessage, error) {
+	s.reads++
+	defer func() {
+		if s.onRead != nil {
+			s.onRead(s.reads)
+		}
+	}()
+
+	inv := s.invocations[tenantID+"/"+id]
+	if inv == nil {
+		return nil, nil, nil
+	}
+
+	results := s.results[tenantID+"/"+id][inv.ResultsRead:]
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	inv.ResultsRead += len(results)
+
+	copied := *inv
+	return &copied, results, nil
+}
+
+func TestIterateInvocationResultPages(t *testing.T) {
+	store := &fakeResultStore{
+		invocations: map[string]*model.Invocation{
+			"acme/i1": {ID: "i1", Status: model.InvocationCompleted, ResultCount: 3, Context: json.RawMessage(`{"page":1}`)},
+		},
+		results: map[string][]json.RawMessage{
+			"acme/i1": {json.RawMessage(`1`), json.RawMessage(`2`), json.RawMessage(`3`)},
+		},
+	}
+
+	cmd, err := NewIterateInvocationResult("acme", "i1", []byte(`{"limit":2,"timeout":"1s"}`), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := cmd.Handle(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(page); string(got) != `{"done":false,"context":null,"output":[1,2]}` {
+		t.Errorf("unexpected first page %s", got)
+	}
+
+	page, err = cmd.Handle(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(page); string(got) != `{"done":true,"context":{"page":1},"output":[3]}` {
+		t.Errorf("unexpected last page %s", got)
+	}
+}
+
+func TestIterateInvocationResultReportsFailures(t *testing.T) {
+	connectorErr := &model.ConnectorError{Category: "ConnectorError", Type: "notFound", Message: "Account john.doe does not exist"}
+	store := &fakeResultStore{invocations: map[string]*model.Invocation{
+		"acme/i1": {ID: "i1", Status: model.InvocationFailed, Failure: connectorErr.Failure()},
+		"acme/i2": {ID: "i2", Status: model.InvocationExpired},
+	}}
+
+	for id, expected := range map[string]string{
+		"i1": `{"done":true,"context":null,"output":[],"error":"[ConnectorError] Account john.doe does not exist","errorType":"notFound"}`,
+		"i2": `{"done":true,"context":null,"output":[],"error":"invocation expired","errorType":"expired"}`,
+	} {
+		cmd, err := NewIterateInvocationResult("acme", id, nil, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		page, err := cmd.Handle(context.Background(), store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := json.Marshal(page); string(got) != expected {
+			t.Errorf("unexpected page of %s: %s", id, got)
+		}
+	}
+}
+
+func TestIterateInvocationResultWaitsForResults(t *testing.T) {
+	inv := &model.Invocation{ID: "i1", Status: model.InvocationRunning}
+	store := &fakeResultStore{
+		invocations: map[string]*model.Invocation{"acme/i1": inv},
+		results:     map[string][]json.RawMessage{},
+	}
+
+	// The invocation fails after its first result arrives during the wait.
+	store.onRead = func(reads int) {
+		if reads == 2 {
+			store.results["acme/i1"] = []json.RawMessage{json.RawMessage(`1`)}
+			inv.ResultCount = 1
+			inv.Status = model.InvocationFailed
+			inv.Failure = &model.InvocationFailure{Type: model.InvocationErrorTimeout, Message: "no response"}
+		}
+	}
+
+	cmd, _ := NewIterateInvocationResult("acme", "i1", []byte(`{"timeout":"5s"}`), 10*time.Second)
+	page, err := cmd.Handle(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(page); string(got) != `{"done":true,"context":null,"output":[1],"error":"no response","errorType":"timeout"}` {
+		t.Errorf("unexpected page %s", got)
+	}
+	if store.reads != 3 {
+		t.Errorf("expected the results to be polled until they arrived, got %d reads", store.reads)
+	}
+
+	// An invocation that doesn't exist gets an empty page without waiting.
+	cmd, _ = NewIterateInvocationResult("other", "i1", []byte(`{"timeout":"5s"}`), 10*time.Second)
+	start := time.Now()
+	page, err = cmd.Handle(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(page); string(got) != `{"done":false,"context":null,"output":[]}` || time.Since(start) > time.Second {
+		t.Errorf("unexpected page of a missing invocation %s", got)
+	}
+}
+
+func TestNewIterateInvocationResultValidation(t *testing.T) {
+	cmd, err := NewIterateInvocationResult("acme", "i1", nil, 10*time.Second)
+	if err != nil || cmd.Limit != DefaultInvocationResultLimit || cmd.Wait != 0 {
+		t.Errorf("unexpected defaults %+v, %v", cmd, err)
+	}
+
+	cmd, err = NewIterateInvocationResult("acme", "i1", []byte(`{"limit":5000,"timeout":"1m"}`), 10*time.Second)
+	if err != nil || cmd.Limit != MaxInvocationResultLimit || cmd.Wait != 10*time.Second {
+		t.Errorf("expected the limit and wait to be capped, got %+v, %v", cmd, err)
+	}
+
+	for _, body := range []string{`{"limit":-1}`, `{"timeout":"soon"}`, `[]`} {
+		if _, err := NewIterateInvocationResult("acme", "i1", []byte(body), 10*time.Second); err == nil {
+			t.Errorf("expected %s to be rejected", body)
+		}
+	}
+	if _, err := NewIterateInvocationResult("acme", "", nil, 10*time.Second); err == nil {
+		t.Error("expected an invocation ID to be required")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// PurgeOrg is a command that removes all of a deleted org's connector data.
+type PurgeOrg struct {
+	TenantID string
+}
+
+// NewPurgeOrg constructs a new PurgeOrg command.
+func NewPurgeOrg(tenantID string) (*PurgeOrg, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant id is required")
+	}
+
+	cmd := &PurgeOrg{}
+	cmd.TenantID = tenantID
+
+	return cmd, nil
+}
+
+// Handle purges the org from every store. All purgers are run even if one fails, so that a
+// redelivered event only has to finish the stores that failed.
+func (cmd *PurgeOrg) Handle(ctx context.Context, purgers []model.OrgPurger) error {
+	var failures []string
+	for _, p := range purgers {
+		if err := p.PurgeOrg(ctx, cmd.TenantID); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("purge org %s: %s", cmd.TenantID, strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// SuspendOrg is a command that pauses or resumes connector activity for an org.
+type SuspendOrg struct {
+	TenantID  string
+	Suspended bool
+}
+
+// NewSuspendOrg constructs a new SuspendOrg command.
+func NewSuspendOrg(tenantID string, suspended bool) (*SuspendOrg, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant id is required")
+	}
+
+	cmd := &SuspendOrg{}
+	cmd.TenantID = tenantID
+	cmd.Suspended = suspended
+
+	return cmd, nil
+}
+
+// Handle records the org's suspension status.
+func (cmd *SuspendOrg) Handle(ctx context.Context, store model.OrgStatusStore) error {
+	return store.SetSuspended(ctx, cmd.TenantID, cmd.Suspended)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeOrgStatusStore map[string]bool
+
+func (s fakeOrgStatusStore) IsSuspended(ctx context.Context, tenantID string) (bool, error) {
+	return s[tenantID], nil
+}
+
+func (s fakeOrgStatusStore) SetSuspended(ctx context.Context, tenantID string, suspended bool) error {
+	s[tenantID] = suspended
+	return nil
+}
+
+type fakePurger struct {
+	purged []string
+	err    error
+}
+
+func (p *fakePurger) PurgeOrg(ctx context.Context, tenantID string) error {
+	p.purged = append(p.purged, tenantID)
+	return p.err
+}
+
+type fakeInvoker struct {
+	invoked []model.CommandType
+}
+
+func (i *fakeInvoker) Invoke(ctx context.Context, instanceID string, commandType model.CommandType, input json.RawMessage) error {
+	i.invoked = append(i.invoked, commandType)
+	return nil
+}
+
+func TestPurgeOrgRunsAllPurgers(t *testing.T) {
+	failing := &fakePurger{err: errors.New("boom")}
+	ok := &fakePurger{}
+
+	cmd, _ := NewPurgeOrg("acme")
+	if err := cmd.Handle(context.Background(), []model.OrgPurger{failing, ok}); err == nil {
+		t.Error("expected error")
+	}
+
+	if len(ok.purged) != 1 {
+		t.Error("expected every purger to run")
+	}
+}
+
+func TestTriggerAggregation(t *testing.T) {
+	ctx := context.Background()
+	store := fakeOrgStatusStore{}
+	invoker := &fakeInvoker{}
+
+	if _, err := NewTriggerAggregation("acme", []byte(`{"connectorInstanceId":"i1","type":"std:account:create"}`)); err == nil {
+		t.Error("expected non-aggregation command to be rejected")
+	}
+
+	cmd, err := NewTriggerAggregation("acme", []byte(`{"connectorInstanceId":"i1","type":"std:account:list"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suspend, _ := NewSuspendOrg("acme", true)
+	_ = suspend.Handle(ctx, store)
+
+	if err := cmd.Handle(ctx, store, invoker); !errors.Is(err, model.ErrOrgSuspended) {
+		t.Errorf("expected suspended error, got %v", err)
+	}
+
+	resume, _ := NewSuspendOrg("acme", false)
+	_ = resume.Handle(ctx, store)
+
+	if err := cmd.Handle(ctx, store, invoker); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(invoker.invoked) != 1 || invoker.invoked[0] != model.CommandAccountList {
+		t.Errorf("unexpected invocations: %v", invoker.invoked)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/google/uuid"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// Redacted replaces secret values in audit diffs. RedactedChanged marks a secret that was changed.
+const (
+	Redacted        = "[REDACTED]"
+	RedactedChanged = "[REDACTED:changed]"
+)
+
+// sensitiveKeys are keys whose values are always redacted, whatever the spec says. They're compared
+// case-insensitively.
+var sensitiveKeys = []string{"password", "secret", "token", "apikey", "privatekey", "clientsecret", "credentials"}
+
+// RecordAudit is a command that records a change to a connector instance or spec.
+type RecordAudit struct {
+	Record *model.AuditRecord
+}
+
+// NewRecordAudit constructs a new RecordAudit command. before is nil for creates and after is nil for
+// deletes. The values of secretKeys (eg. the keys of the spec's secret config fields) and of
+// well-known sensitive keys are redacted from the diff at any depth.
+func NewRecordAudit(tenantID string, actor string, action model.AuditAction, resourceType model.AuditResourceType, resourceID string, before interface{}, after interface{}, secretKeys []string) (*RecordAudit, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant id is required")
+	}
+	if actor == "" {
+		return nil, fmt.Errorf("actor is required")
+	}
+	if resourceID == "" {
+		return nil, fmt.Errorf("resource id is required")
+	}
+
+	diff, err := auditDiff(before, after, secretKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &RecordAudit{}
+	cmd.Record = &model.AuditRecord{
+		ID:           uuid.New().String(),
+		TenantID:     tenantID,
+		Actor:        actor,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Timestamp:    time.Now().UTC(),
+		Diff:         diff,
+	}
+
+	return cmd, nil
+}
+
+// Handle persists and publishes the audit record.
+func (cmd *RecordAudit) Handle(ctx context.Context, recorder model.AuditRecorder) error {
+	return recorder.Record(ctx, cmd.Record)
+}
+
+// auditDiff builds a merge patch from before to after, with secret values redacted.
+func auditDiff(before interface{}, after interface{}, secretKeys []string) (json.RawMessage, error) {
+	secret := func(key string) bool {
+		for _, k := range secretKeys {
+			if k == key {
+				return true
+			}
+		}
+		for _, k := range sensitiveKeys {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	b, err := toDocument(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := toDocument(after)
+	if err != nil {
+		return nil, err
+	}
+
+	// The after document is redacted first, since redacting before loses whether a secret changed.
+	redactedAfter := redact(a, b, secret)
+	redactedBefore := redact(b, nil, secret)
+
+	beforeJSON, err := json.Marshal(redactedBefore)
+	if err != nil {
+		return nil, err
+	}
+	afterJSON, err := json.Marshal(redactedAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonpatch.CreateMergePatch(beforeJSON, afterJSON)
+}
+
+// toDocument converts a resource to a generic JSON object. A nil resource is an empty object.
+func toDocument(v interface{}) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return doc, nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("audited resources must be JSON objects: %w", err)
+	}
+
+	return doc, nil
+}
+
+// redact returns a copy of doc with secret values replaced. If previous is given, secrets whose value
+// differs from the one at the same path in previous are marked as changed.
+func redact(doc map[string]interface{}, previous map[string]interface{}, secret func(key string) bool) map[string]interface{} {
+	out := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		prev, hadPrev := previous[k]
+
+		switch {
+		case secret(k):
+			out[k] = Redacted
+			if previous != nil && (!hadPrev || !reflect.DeepEqual(prev, v)) {
+				out[k] = RedactedChanged
+			}
+		case isObject(v):
+			prevObject, _ := prev.(map[string]interface{})
+			if previous != nil && prevObject == nil {
+				prevObject = map[string]interface{}{}
+			}
+			out[k] = redact(v.(map[string]interface{}), prevObject, secret)
+		default:
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+// isObject gets whether a generic JSON value is an object.
+func isObject(v interface{}) bool {
+	_, ok := v.(map[string]interface{})
+	return ok
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeAuditRecorder struct {
+	records []*model.AuditRecord
+}
+
+func (r *fakeAuditRecorder) Record(ctx context.Context, record *model.AuditRecord) error {
+	r.records = append(r.records, record)
+	return nil
+}
+
+type testInstance struct {
+	Name   string                 `json:"name"`
+	Config map[string]interface{} `json:"config"`
+}
+
+func diffOf(t *testing.T, cmd *RecordAudit) map[string]interface{} {
+	t.Helper()
+
+	var diff map[string]interface{}
+	if err := json.Unmarshal(cmd.Record.Diff, &diff); err != nil {
+		t.Fatal(err)
+	}
+
+	return diff
+}
+
+func TestRecordAuditUpdateRedactsSecrets(t *testing.T) {
+	before := &testInstance{Name: "Workday", Config: map[string]interface{}{"url": "https://a", "apiSecret": "s1", "password": "p1", "nested": map[string]interface{}{"token": "t1"}}}
+	after := &testInstance{Name: "Workday HR", Config: map[string]interface{}{"url": "https://a", "apiSecret": "s2", "password": "p1", "nested": map[string]interface{}{"token": "t1"}}}
+
+	cmd, err := NewRecordAudit("tenant", "john.doe", model.AuditUpdate, model.AuditConnectorInstance, "1", before, after, []string{"apiSecret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"name":   "Workday HR",
+		"config": map[string]interface{}{"apiSecret": RedactedChanged},
+	}
+	if diff := deep.Equal(diffOf(t, cmd), expected); diff != nil {
+		t.Error(diff)
+	}
+
+	recorder := &fakeAuditRecorder{}
+	if err := cmd.Handle(context.Background(), recorder); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.records) != 1 || recorder.records[0].Actor != "john.doe" || recorder.records[0].ID == "" {
+		t.Errorf("unexpected records: %+v", recorder.records)
+	}
+}
+
+func TestRecordAuditCreateAndDelete(t *testing.T) {
+	instance := &testInstance{Name: "Slack", Config: map[string]interface{}{"token": "xoxb"}}
+
+	create, err := NewRecordAudit("tenant", "john.doe", model.AuditCreate, model.AuditConnectorInstance, "1", nil, instance, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(diffOf(t, create), map[string]interface{}{"name": "Slack", "config": map[string]interface{}{"token": RedactedChanged}}); diff != nil {
+		t.Error(diff)
+	}
+
+	var none *testInstance
+	del, err := NewRecordAudit("tenant", "john.doe", model.AuditDelete, model.AuditConnectorInstance, "1", instance, none, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(diffOf(t, del), map[string]interface{}{"name": nil, "config": nil}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestNewRecordAuditValidation(t *testing.T) {
+	if _, err := NewRecordAudit("tenant", "", model.AuditCreate, model.AuditConnectorSpec, "1", nil, nil, nil); err == nil {
+		t.Error("expected actor to be required")
+	}
+	if _, err := NewRecordAudit("tenant", "john.doe", model.AuditCreate, model.AuditConnectorSpec, "1", nil, []string{"not an object"}, nil); err == nil {
+		t.Error("expected non-object resources to be rejected")
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sailpoint/atlas-go/atlas/crypto"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// ErrInvalidRuntimeKey is returned when a runtime key is malformed, unknown or doesn't match.
+var ErrInvalidRuntimeKey = errors.New("invalid runtime key")
+
+// MaxRuntimeResultSize is the maximum size of a single result line uploaded by a runtime.
+const MaxRuntimeResultSize = 1 << 20
+
+// runtimeClaimPollInterval is how often a long-poll checks for newly dispatched commands.
+const runtimeClaimPollInterval = 250 * time.Millisecond
+
+// RegisterRuntime is a command that registers a remote connector runtime for a set of connector groups.
+type RegisterRuntime struct {
+	TenantID        string
+	Pod             string
+	Org             string
+	Name            string   `json:"name"`
+	ConnectorGroups []string `json:"connectorGroups"`
+}
+
+// RegisterRuntimeResult is a newly registered runtime along with its key, which is only ever
+// returned here.
+type RegisterRuntimeResult struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	ConnectorGroups []string  `json:"connectorGroups"`
+	Created         time.Time `json:"created"`
+	Key             string    `json:"key"`
+}
+
+// NewRegisterRuntime constructs a new RegisterRuntime command from the body of a registration request.
+// The runtime acts within the tenant, pod and org of the registering request.
+func NewRegisterRuntime(tenantID string, pod string, org string, body []byte) (*RegisterRuntime, error) {
+	cmd := &RegisterRuntime{}
+	if err := json.Unmarshal(body, cmd); err != nil {
+		return nil, model.NewBadRequestError("parse runtime: %v", err)
+	}
+	cmd.TenantID = tenantID
+	cmd.Pod = pod
+	cmd.Org = org
+
+	if cmd.Name == "" {
+		return nil, model.NewBadRequestError("name is required")
+	}
+
+	if len(cmd.ConnectorGroups) == 0 {
+		return nil, model.NewBadRequestError("at least one connector group is required")
+	}
+
+	for i, g := range cmd.ConnectorGroups {
+		if g == "" {
+			return nil, model.NewBadRequestError("connectorGroups[%d]: group is required", i)
+		}
+	}
+
+	return cmd, nil
+}
+
+// Handle saves the runtime with a newly generated key.
+func (cmd *RegisterRuntime) Handle(ctx context.Context, store model.RuntimeStore) (*RegisterRuntimeResult, error) {
+	secret, err := crypto.GenerateHexSecret(32)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	runtime := &model.Runtime{
+		ID:              id,
+		TenantID:        cmd.TenantID,
+		Pod:             cmd.Pod,
+		Org:             cmd.Org,
+		Name:            cmd.Name,
+		ConnectorGroups: cmd.ConnectorGroups,
+		Created:         time.Now().UTC(),
+		KeyHash:         hashKeySecret(id, secret),
+	}
+
+	if err := store.SaveRuntime(ctx, runtime); err != nil {
+		return nil, err
+	}
+
+	return &RegisterRuntimeResult{
+		ID:              runtime.ID,
+		Name:            runtime.Name,
+		ConnectorGroups: runtime.ConnectorGroups,
+		Created:         runtime.Created,
+		Key:             runtime.ID + "." + secret,
+	}, nil
+}
+
+// AuthenticateRuntime gets the runtime identified by a runtime key, which has the form "<id>.<secret>".
+func AuthenticateRuntime(ctx context.Context, store model.RuntimeStore, key string) (*model.Runtime, error) {
+	i := strings.LastIndex(key, ".")
+	if i <= 0 || i == len(key)-1 {
+		return nil, ErrInvalidRuntimeKey
+	}
+
+	runtime, err := store.GetRuntime(ctx, key[:i])
+	if err != nil {
+		return nil, err
+	}
+	if runtime == nil {
+		return nil, ErrInvalidRuntimeKey
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashKeySecret(runtime.ID, key[i+1:])), []byte(runtime.KeyHash)) != 1 {
+		return nil, ErrInvalidRuntimeKey
+	}
+
+	return runtime, nil
+}
+
+// ClaimRuntimeCommand is a command that long-polls for the next command of a runtime's connector groups.
+type ClaimRuntimeCommand struct {
+	Runtime          *model.Runtime
+	Wait             time.Duration
+	HeartbeatTimeout time.Duration
+}
+
+// NewClaimRuntimeCommand constructs a new ClaimRuntimeCommand. The wait is capped at maxWait.
+func NewClaimRuntimeCommand(runtime *model.Runtime, wait time.Duration, maxWait time.Duration, heartbeatTimeout time.Duration) (*ClaimRuntimeCommand, error) {
+	if wait < 0 {
+		return nil, model.NewBadRequestError("wait must not be negative")
+	}
+
+	if wait > maxWait {
+		wait = maxWait
+	}
+
+	cmd := &ClaimRuntimeCommand{}
+	cmd.Runtime = runtime
+	cmd.Wait = wait
+	cmd.HeartbeatTimeout = heartbeatTimeout
+
+	return cmd, nil
+}
+
+// Handle waits up to cmd.Wait for a command to claim, returning nil if none was dispatched in time.
+// Claiming counts as a heartbeat, so that the claim isn't requeued before the runtime's next one.
+// Commands that expired while pending are completed as expired rather than returned, and commands of
+// invocations that finished while pending, eg. because they were cancelled, are dropped. The
+// invocation of the returned command is marked started.
+func (cmd *ClaimRuntimeCommand) Handle(ctx context.Context, store model.RuntimeStore, queue model.RuntimeCommandQueue, handler model.InvocationResultHandler) (*model.RuntimeCommand, error) {
+	if err := store.Heartbeat(ctx, cmd.Runtime, cmd.HeartbeatTimeout); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(cmd.Wait)
+	for {
+		claimed, err := queue.Claim(ctx, cmd.Runtime)
+		if err != nil {
+			return nil, err
+		}
+
+		if claimed != nil && claimed.Expired(time.Now()) {
+			if err := cmd.expire(ctx, queue, handler, claimed); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if claimed != nil {
+			started, err := handler.HandleStart(ctx, claimed)
+			if err != nil {
+				return nil, err
+			}
+			if !started {
+				if _, err := queue.Complete(ctx, cmd.Runtime, claimed.InvocationID); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		if claimed != nil || !time.Now().Before(deadline) {
+			return claimed, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(runtimeClaimPollInterval):
+		}
+	}
+}
+
+// expire completes a claimed command that expired before it could be handed to the runtime.
+func (cmd *ClaimRuntimeCommand) expire(ctx context.Context, queue model.RuntimeCommandQueue, handler model.InvocationResultHandler, claimed *model.RuntimeCommand) error {
+	held, err := queue.Complete(ctx, cmd.Runtime, claimed.InvocationID)
+	if err != nil || !held {
+		return err
+	}
+
+	failure := &model.InvocationFailure{Type: model.InvocationErrorTimeout, Message: "invocation expired before a runtime claimed it"}
+	return handler.HandleCompletion(ctx, claimed, model.InvocationExpired, failure)
+}
+
+// UploadRuntimeResults is a command that accepts a stream of results from a runtime, as newline
+// delimited JSON, for an invocation it has claimed.
+type UploadRuntimeResults struct {
+	Runtime      *model.Runtime
+	InvocationID string
+}
+
+// NewUploadRuntimeResults constructs a new UploadRuntimeResults command.
+func NewUploadRuntimeResults(runtime *model.Runtime, invocationID string) (*UploadRuntimeResults, error) {
+	if invocationID == "" {
+		return nil, model.NewBadRequestError("invocation id is required")
+	}
+
+	cmd := &UploadRuntimeResults{}
+	cmd.Runtime = runtime
+	cmd.InvocationID = invocationID
+
+	return cmd, nil
+}
+
+// Handle passes each result in the stream to the result handler as it's read, returning the number
+// of results accepted. Results that were accepted before an invalid line stay accepted.
+func (cmd *UploadRuntimeResults) Handle(ctx context.Context, queue model.RuntimeCommandQueue, handler model.InvocationResultHandler, results io.Reader) (int, error) {
+	claimed, err := queue.GetClaim(ctx, cmd.Runtime, cmd.InvocationID)
+	if err != nil {
+		return 0, err
+	}
+	if claimed == nil {
+		return 0, model.ErrNotClaimed
+	}
+
+	scanner := bufio.NewScanner(results)
+	scanner.Buffer(make([]byte, 64*1024), MaxRuntimeResultSize)
+
+	accepted := 0
+	for line := 1; scanner.Scan(); line++ {
+		output := bytes.TrimSpace(scanner.Bytes())
+		if len(output) == 0 {
+			continue
+		}
+
+		if !json.Valid(output) {
+			return accepted, model.NewBadRequestError("line %d: invalid JSON", line)
+		}
+
+		// The scanner reuses its buffer, so the handler gets a copy.
+		if err := handler.HandleResult(ctx, claimed, append(json.RawMessage(nil), output...)); err != nil {
+			return accepted, fmt.Errorf("line %d: %w", line, err)
+		}
+		accepted++
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return accepted, model.NewBadRequestError("results must be at most %d bytes each", MaxRuntimeResultSize)
+		}
+		return accepted, err
+	}
+
+	return accepted, nil
+}
+
+// CompleteRuntimeInvocation is a command that finishes an invocation claimed by a runtime.
+type CompleteRuntimeInvocation struct {
+	Runtime      *model.Runtime
+	InvocationID string
+	Error        *model.InvocationFailure `json:"error"`
+}
+
+// NewCompleteRuntimeInvocation constructs a new CompleteRuntimeInvocation command from the body of a
+// completion request. An invocation completes successfully unless the body has an error.
+func NewCompleteRuntimeInvocation(runtime *model.Runtime, invocationID string, body []byte) (*CompleteRuntimeInvocation, error) {
+	cmd := &CompleteRuntimeInvocation{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, cmd); err != nil {
+			return nil, model.NewBadRequestError("parse completion: %v", err)
+		}
+	}
+	cmd.Runtime = runtime
+	cmd.InvocationID = invocationID
+
+	if invocationID == "" {
+		return nil, model.NewBadRequestError("invocation id is required")
+	}
+
+	if cmd.Error != nil && cmd.Error.Type == "" {
+		cmd.Error.Type = model.InvocationErrorConnector
+	}
+
+	return cmd, nil
+}
+
+// Handle releases the runtime's claim and reports the outcome to the result handler.
+func (cmd *CompleteRuntimeInvocation) Handle(ctx context.Context, queue model.RuntimeCommandQueue, handler model.InvocationResultHandler) error {
+	claimed, err := queue.GetClaim(ctx, cmd.Runtime, cmd.InvocationID)
+	if err != nil {
+		return err
+	}
+	if claimed == nil {
+		return model.ErrNotClaimed
+	}
+
+	// The claim may have been requeued since it was read, in which case another runtime now owns it.
+	held, err := queue.Complete(ctx, cmd.Runtime, cmd.InvocationID)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return model.ErrNotClaimed
+	}
+
+	status := model.InvocationCompleted
+	if cmd.Error != nil {
+		status = model.InvocationFailed
+	}
+
+	return handler.HandleCompletion(ctx, claimed, status, cmd.Error)
+}
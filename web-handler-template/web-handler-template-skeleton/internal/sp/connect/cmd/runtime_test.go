@@ -0,0 +1,242 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeRuntimeStore struct {
+	runtimes   map[string]*model.Runtime
+	heartbeats int
+}
+
+func (s *fakeRuntimeStore) SaveRuntime(ctx context.Context, runtime *model.Runtime) error {
+	if s.runtimes == nil {
+		s.runtimes = map[string]*model.Runtime{}
+	}
+	s.runtimes[runtime.ID] = runtime
+	return nil
+}
+
+func (s *fakeRuntimeStore) GetRuntime(ctx context.Context, id string) (*model.Runtime, error) {
+	return s.runtimes[id], nil
+}
+
+func (s *fakeRuntimeStore) Heartbeat(ctx context.Context, runtime *model.Runtime, timeout time.Duration) error {
+	s.heartbeats++
+	return nil
+}
+
+type fakeRuntimeQueue struct {
+	pending []*model.RuntimeCommand
+	claims  map[string]*model.RuntimeCommand
+}
+
+func (q *fakeRuntimeQueue) Dispatch(ctx context.Context, cmd *model.RuntimeCommand) error {
+	q.pending = append(q.pending, cmd)
+	return nil
+}
+
+func (q *fakeRuntimeQueue) Claim(ctx context.Context, runtime *model.Runtime) (*model.RuntimeCommand, error) {
+	for i, cmd := range q.pending {
+		if runtime.Serves(cmd.ConnectorGroup) {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			if q.claims == nil {
+				q.claims = map[string]*model.RuntimeCommand{}
+			}
+			q.claims[cmd.InvocationID] = cmd
+			return cmd, nil
+		}
+	}
+	return nil, nil
+}
+
+func (q *fakeRuntimeQueue) GetClaim(ctx context.Context, runtime *model.Runtime, invocationID string) (*model.RuntimeCommand, error) {
+	return q.claims[invocationID], nil
+}
+
+func (q *fakeRuntimeQueue) Complete(ctx context.Context, runtime *model.Runtime, invocationID string) (bool, error) {
+	_, ok := q.claims[invocationID]
+	delete(q.claims, invocationID)
+	return ok, nil
+}
+
+func (q *fakeRuntimeQueue) Requeue(ctx context.Context, runtime *model.Runtime, invocationID string) (bool, error) {
+	cmd, ok := q.claims[invocationID]
+	if ok {
+		delete(q.claims, invocationID)
+		q.pending = append([]*model.RuntimeCommand{cmd}, q.pending...)
+	}
+	return ok, nil
+}
+
+func (q *fakeRuntimeQueue) RequeueAbandoned(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+type completion struct {
+	invocationID string
+	status       model.InvocationStatus
+	failure      *model.InvocationFailure
+}
+
+type fakeResultHandler struct {
+	started     []string
+	results     []string
+	completions []completion
+
+	// finished are the IDs of invocations that have already finished, whose commands mustn't start.
+	finished map[string]bool
+}
+
+func (h *fakeResultHandler) HandleStart(ctx context.Context, cmd *model.RuntimeCommand) (bool, error) {
+	if h.finished[cmd.InvocationID] {
+		return false, nil
+	}
+	h.started = append(h.started, cmd.InvocationID)
+	return true, nil
+}
+
+func (h *fakeResultHandler) HandleResult(ctx context.Context, cmd *model.RuntimeCommand, output json.RawMessage) error {
+	h.results = append(h.results, string(output))
+	return nil
+}
+
+func (h *fakeResultHandler) HandleCompletion(ctx context.Context, cmd *model.RuntimeCommand, status model.InvocationStatus, failure *model.InvocationFailure) error {
+	h.completions = append(h.completions, completion{cmd.InvocationID, status, failure})
+	return nil
+}
+
+func TestRegisterAndAuthenticateRuntime(t *testing.T) {
+	cmd, err := NewRegisterRuntime("acme", "pod", "org", []byte(`{"name":"agent","connectorGroups":["on-prem"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &fakeRuntimeStore{}
+	result, err := cmd.Handle(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runtime, err := AuthenticateRuntime(context.Background(), store, result.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.ID != result.ID || runtime.TenantID != "acme" || strings.Contains(result.Key, runtime.KeyHash) {
+		t.Errorf("unexpected runtime: %+v", runtime)
+	}
+	if secret := strings.TrimPrefix(result.Key, result.ID+"."); runtime.KeyHash != hashKeySecret(runtime.ID, secret) {
+		t.Error("expected the key hash to be keyed with the runtime ID")
+	}
+
+	for _, key := range []string{"", result.ID, result.ID + ".", result.ID + ".wrong", "unknown.secret"} {
+		if _, err := AuthenticateRuntime(context.Background(), store, key); !errors.Is(err, ErrInvalidRuntimeKey) {
+			t.Errorf("expected %q to be rejected, got %v", key, err)
+		}
+	}
+}
+
+func TestNewRegisterRuntimeValidation(t *testing.T) {
+	for _, body := range []string{`{"connectorGroups":["a"]}`, `{"name":"agent"}`, `{"name":"agent","connectorGroups":[""]}`} {
+		if _, err := NewRegisterRuntime("acme", "pod", "org", []byte(body)); err == nil {
+			t.Errorf("expected %s to be rejected", body)
+		}
+	}
+}
+
+func TestClaimRuntimeCommand(t *testing.T) {
+	runtime := &model.Runtime{ID: "r1", ConnectorGroups: []string{"on-prem"}}
+	queue := &fakeRuntimeQueue{}
+	_ = queue.Dispatch(context.Background(), &model.RuntimeCommand{InvocationID: "other", ConnectorGroup: "cloud"})
+	_ = queue.Dispatch(context.Background(), &model.RuntimeCommand{InvocationID: "expired", ConnectorGroup: "on-prem", Expiration: time.Now().Add(-time.Minute)})
+	_ = queue.Dispatch(context.Background(), &model.RuntimeCommand{InvocationID: "cancelled", ConnectorGroup: "on-prem"})
+	_ = queue.Dispatch(context.Background(), &model.RuntimeCommand{InvocationID: "1", ConnectorGroup: "on-prem"})
+
+	store := &fakeRuntimeStore{}
+	handler := &fakeResultHandler{finished: map[string]bool{"cancelled": true}}
+
+	cmd, _ := NewClaimRuntimeCommand(runtime, time.Second, time.Minute, time.Minute)
+	claimed, err := cmd.Handle(context.Background(), store, queue, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claimed == nil || claimed.InvocationID != "1" {
+		t.Fatalf("expected invocation 1, got %+v", claimed)
+	}
+	if store.heartbeats != 1 {
+		t.Errorf("expected claim to count as a heartbeat")
+	}
+	if len(handler.completions) != 1 || handler.completions[0].invocationID != "expired" || handler.completions[0].status != model.InvocationExpired {
+		t.Errorf("expected expired command to be completed, got %+v", handler.completions)
+	}
+	if len(handler.started) != 1 || handler.started[0] != "1" {
+		t.Errorf("expected only invocation 1 to start, got %v", handler.started)
+	}
+	if _, claimed := queue.claims["cancelled"]; claimed {
+		t.Error("expected the command of the cancelled invocation to be dropped")
+	}
+
+	cmd, _ = NewClaimRuntimeCommand(runtime, 0, time.Minute, time.Minute)
+	if claimed, err := cmd.Handle(context.Background(), store, queue, handler); err != nil || claimed != nil {
+		t.Errorf("expected no command, got %+v, %v", claimed, err)
+	}
+}
+
+func TestClaimRuntimeCommandWaitIsCapped(t *testing.T) {
+	cmd, err := NewClaimRuntimeCommand(&model.Runtime{}, time.Hour, 20*time.Second, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Wait != 20*time.Second {
+		t.Errorf("expected wait to be capped, got %v", cmd.Wait)
+	}
+}
+
+func TestUploadAndCompleteRuntimeInvocation(t *testing.T) {
+	runtime := &model.Runtime{ID: "r1", ConnectorGroups: []string{"on-prem"}}
+	queue := &fakeRuntimeQueue{}
+	_ = queue.Dispatch(context.Background(), &model.RuntimeCommand{InvocationID: "1", ConnectorGroup: "on-prem"})
+	_, _ = queue.Claim(context.Background(), runtime)
+
+	handler := &fakeResultHandler{}
+
+	upload, _ := NewUploadRuntimeResults(runtime, "1")
+	accepted, err := upload.Handle(context.Background(), queue, handler, strings.NewReader("{\"identity\":\"a\"}\n\n{\"identity\":\"b\"}\nnot json\n"))
+	var badRequest *model.BadRequestError
+	if !errors.As(err, &badRequest) || accepted != 2 {
+		t.Errorf("expected 2 results and a bad request, got %d, %v", accepted, err)
+	}
+	if len(handler.results) != 2 || handler.results[1] != `{"identity":"b"}` {
+		t.Errorf("unexpected results: %v", handler.results)
+	}
+
+	complete, err := NewCompleteRuntimeInvocation(runtime, "1", []byte(`{"error":{"message":"boom"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := complete.Handle(context.Background(), queue, handler); err != nil {
+		t.Fatal(err)
+	}
+
+	c := handler.completions[0]
+	if c.status != model.InvocationFailed || c.failure.Type != model.InvocationErrorConnector {
+		t.Errorf("unexpected completion: %+v", c)
+	}
+
+	// The claim is gone, so neither a second completion nor more results are accepted.
+	if err := complete.Handle(context.Background(), queue, handler); !errors.Is(err, model.ErrNotClaimed) {
+		t.Errorf("expected not claimed, got %v", err)
+	}
+	if _, err := upload.Handle(context.Background(), queue, handler, strings.NewReader("{}")); !errors.Is(err, model.ErrNotClaimed) {
+		t.Errorf("expected not claimed, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// aggregationCommands are the command types that can be triggered as an aggregation.
+var aggregationCommands = map[model.CommandType]bool{
+	model.CommandAccountList:     true,
+	model.CommandEntitlementList: true,
+}
+
+// TriggerAggregation is a command that starts an aggregation against a connector instance.
+type TriggerAggregation struct {
+	TenantID            string
+	ConnectorInstanceID string            `json:"connectorInstanceId"`
+	Type                model.CommandType `json:"type"`
+	Input               json.RawMessage   `json:"input"`
+}
+
+// NewTriggerAggregation constructs a new TriggerAggregation command from an internal event.
+func NewTriggerAggregation(tenantID string, content []byte) (*TriggerAggregation, error) {
+	cmd := &TriggerAggregation{}
+	if err := json.Unmarshal(content, cmd); err != nil {
+		return nil, fmt.Errorf("parse aggregation: %w", err)
+	}
+	cmd.TenantID = tenantID
+
+	if cmd.ConnectorInstanceID == "" {
+		return nil, fmt.Errorf("connector instance id is required")
+	}
+
+	if !aggregationCommands[cmd.Type] {
+		return nil, fmt.Errorf("%s is not an aggregation command", cmd.Type)
+	}
+
+	if len(cmd.Input) == 0 {
+		cmd.Input = json.RawMessage(`{}`)
+	}
+
+	return cmd, nil
+}
+
+// Handle invokes the aggregation command, unless the org is suspended.
+func (cmd *TriggerAggregation) Handle(ctx context.Context, store model.OrgStatusStore, invoker model.CommandInvoker) error {
+	suspended, err := store.IsSuspended(ctx, cmd.TenantID)
+	if err != nil {
+		return err
+	}
+
+	if suspended {
+		return model.ErrOrgSuspended
+	}
+
+	return invoker.Invoke(ctx, cmd.ConnectorInstanceID, cmd.Type, cmd.Input)
+}
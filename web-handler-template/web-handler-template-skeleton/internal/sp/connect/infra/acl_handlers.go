@@ -0,0 +1,255 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sailpoint/atlas-go/atlas/auth"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/atlas-go/atlas/web"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+	"go.uber.org/zap"
+)
+
+// aclVerbFunc gets the verb a request performs on the connector instance in its path.
+type aclVerbFunc func(r *http.Request) (model.ACLVerb, error)
+
+// aclVerb gets an aclVerbFunc for requests that always perform the verb.
+func aclVerb(verb model.ACLVerb) aclVerbFunc {
+	return func(r *http.Request) (model.ACLVerb, error) {
+		return verb, nil
+	}
+}
+
+// aclInvokeVerb gets the invoke verb of an invoke request's command type. The body is restored for
+// the handler.
+func aclInvokeVerb(r *http.Request) (model.ACLVerb, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var invoke struct {
+		Type model.CommandType `json:"type"`
+	}
+	if err := json.Unmarshal(body, &invoke); err != nil || invoke.Type == "" {
+		return "", model.NewBadRequestError("command type is required")
+	}
+
+	return model.ACLInvoke(invoke.Type), nil
+}
+
+// requireInstanceAccess is a middleware, applied after requireRight, that checks the ACL of the
+// connector instance in the path, and the scope of the API key the request was made with, if any.
+// Every decision is logged with the principal and the verb.
+func (s *ConnectService) requireInstanceAccess(verb aclVerbFunc, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		instanceID := mux.Vars(r)["id"]
+
+		v, err := verb(r)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		principal, err := s.requestPrincipal(ctx)
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		decision, err := s.instanceAccess(ctx, principal, instanceID, v)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		logCtx := log.WithFields(ctx,
+			zap.String("principal", principal.String()),
+			zap.String("connector_instance_id", instanceID),
+			zap.String("verb", string(v)),
+			zap.Bool("allowed", decision.Allowed),
+		)
+
+		if !decision.Allowed {
+			log.Warnf(logCtx, "instance access denied: %s", decision.Reason)
+			web.Forbidden(ctx, w)
+			return
+		}
+
+		log.Infof(logCtx, "instance access allowed: %s", decision.Reason)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// instanceAccess decides whether the principal may perform the verb on the connector instance, by its
+// ACL and by the scope of the API key the request was made with, if any.
+func (s *ConnectService) instanceAccess(ctx context.Context, principal *model.Principal, instanceID string, verb model.ACLVerb) (*model.AccessDecision, error) {
+	cmd, err := cmd.NewAuthorizeInstanceAccess(requestTenantID(ctx), instanceID, principal, verb)
+	if err != nil {
+		return nil, err
+	}
+
+	decision, err := cmd.Handle(ctx, s.aclStore)
+	if err != nil {
+		return nil, err
+	}
+
+	// API keys are further limited to their own scope.
+	if decision.Allowed {
+		allowed, err := s.apiKeyAllows(ctx, instanceID, verb)
+		if err != nil {
+			return nil, err
+		}
+
+		if !allowed {
+			decision = &model.AccessDecision{Allowed: false, Reason: "outside the scope of the api key"}
+		}
+	}
+
+	return decision, nil
+}
+
+// requestPrincipal gets the principal of the request's token. Its groups are the token's authorities
+// and the right sets of its access summary.
+func (s *ConnectService) requestPrincipal(ctx context.Context) (*model.Principal, error) {
+	token := auth.GetToken(ctx)
+	if token == nil {
+		return &model.Principal{}, nil
+	}
+
+	p := &model.Principal{}
+	p.IdentityID = string(token.IdentityID)
+	p.ClientID = token.ClientID
+
+	for _, a := range token.Authorities {
+		p.Groups = append(p.Groups, string(a))
+	}
+
+	summary, err := s.AccessSummarizer.Summarize(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rs := range summary.RightSets {
+		p.Groups = append(p.Groups, string(rs))
+	}
+
+	return p, nil
+}
+
+// getInstanceACL gets the ACL of a connector instance, or 404 if it has none.
+func (s *ConnectService) getInstanceACL() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		acl, err := s.aclStore.GetACL(ctx, requestTenantID(ctx), mux.Vars(r)["id"])
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		if acl == nil {
+			web.NotFound(ctx, w)
+			return
+		}
+
+		web.WriteJSON(ctx, w, acl)
+	}
+}
+
+// putInstanceACL creates or replaces the ACL of a connector instance, or 404 if the instance doesn't
+// exist.
+func (s *ConnectService) putInstanceACL() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		instanceID := mux.Vars(r)["id"]
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		cmd, err := cmd.NewSaveInstanceACL(requestTenantID(ctx), instanceID, body)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		instance, err := s.instanceStore.GetInstance(ctx, cmd.TenantID, instanceID)
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		if instance == nil {
+			web.NotFound(ctx, w)
+			return
+		}
+
+		before, err := s.aclStore.GetACL(ctx, cmd.TenantID, instanceID)
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		acl, err := cmd.Handle(ctx, s.aclStore)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		action := model.AuditUpdate
+		if before == nil {
+			action = model.AuditCreate
+		}
+
+		if err := s.recordAudit(ctx, action, model.AuditConnectorACL, instanceID, before, acl, nil); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, acl)
+	}
+}
+
+// deleteInstanceACL removes the ACL of a connector instance, leaving it governed only by rights.
+func (s *ConnectService) deleteInstanceACL() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		tenantID := requestTenantID(ctx)
+		instanceID := mux.Vars(r)["id"]
+
+		before, err := s.aclStore.GetACL(ctx, tenantID, instanceID)
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		if before == nil {
+			web.NotFound(ctx, w)
+			return
+		}
+
+		if err := s.aclStore.DeleteACL(ctx, tenantID, instanceID); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		if err := s.recordAudit(ctx, model.AuditDelete, model.AuditConnectorACL, instanceID, before, nil, nil); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		web.NoContent(w)
+	}
+}
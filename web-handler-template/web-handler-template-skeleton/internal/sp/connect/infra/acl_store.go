@@ -0,0 +1,73 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// redisACLStore is an ACLStore that keeps the ACLs of each tenant's instances in a Redis hash, keyed
+// by instance ID.
+type redisACLStore struct {
+	client redis.Cmdable
+}
+
+// newACLStore constructs a new redisACLStore.
+func newACLStore(client redis.Cmdable) *redisACLStore {
+	return &redisACLStore{client: client}
+}
+
+// GetACL gets the ACL of the connector instance, or nil if it has none.
+func (s *redisACLStore) GetACL(ctx context.Context, tenantID string, instanceID string) (*model.InstanceACL, error) {
+	defer observeOp(dynamoConnectorLatency, "acl_get", time.Now())
+
+	value, err := s.client.HGet(ctx, aclsKey(tenantID), instanceID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	acl := &model.InstanceACL{}
+	if err := json.Unmarshal([]byte(value), acl); err != nil {
+		return nil, err
+	}
+	acl.TenantID = tenantID
+
+	return acl, nil
+}
+
+// SaveACL creates or replaces the ACL of a connector instance. ACLs never expire.
+func (s *redisACLStore) SaveACL(ctx context.Context, acl *model.InstanceACL) error {
+	defer observeOp(dynamoConnectorLatency, "acl_save", time.Now())
+
+	value, err := json.Marshal(acl)
+	if err != nil {
+		return err
+	}
+
+	return s.client.HSet(ctx, aclsKey(acl.TenantID), acl.InstanceID, value).Err()
+}
+
+// DeleteACL removes the ACL of the connector instance.
+func (s *redisACLStore) DeleteACL(ctx context.Context, tenantID string, instanceID string) error {
+	defer observeOp(dynamoConnectorLatency, "acl_delete", time.Now())
+	return s.client.HDel(ctx, aclsKey(tenantID), instanceID).Err()
+}
+
+// PurgeOrg removes the ACLs of all of the tenant's instances.
+func (s *redisACLStore) PurgeOrg(ctx context.Context, tenantID string) error {
+	defer observeOp(dynamoConnectorLatency, "acl_purge", time.Now())
+	return s.client.Del(ctx, aclsKey(tenantID)).Err()
+}
+
+// aclsKey returns the key of the hash of the ACLs of a tenant's instances.
+func aclsKey(tenantID string) string {
+	return keyPrefix + "{" + tenantID + "}:acls"
+}
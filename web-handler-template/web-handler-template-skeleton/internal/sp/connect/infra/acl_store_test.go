@@ -0,0 +1,38 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/memory"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+func TestACLStorePurgeOrgRemovesOnlyTheTenantsACLs(t *testing.T) {
+	ctx := context.Background()
+	store := newACLStore(memory.NewRedis())
+
+	for _, acl := range []*model.InstanceACL{
+		{TenantID: "t1", InstanceID: "a"},
+		{TenantID: "t1", InstanceID: "b"},
+		{TenantID: "t2", InstanceID: "a"},
+	} {
+		if err := store.SaveACL(ctx, acl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.PurgeOrg(ctx, "t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		if acl, err := store.GetACL(ctx, "t1", id); err != nil || acl != nil {
+			t.Errorf("expected the ACL of t1/%s to be purged, got %+v (%v)", id, acl, err)
+		}
+	}
+	if acl, err := store.GetACL(ctx, "t2", "a"); err != nil || acl == nil || acl.TenantID != "t2" {
+		t.Errorf("expected the ACL of t2/a to remain, got %+v (%v)", acl, err)
+	}
+}
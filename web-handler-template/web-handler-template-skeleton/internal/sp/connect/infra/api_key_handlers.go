@@ -0,0 +1,241 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/atlas-go/atlas/auth"
+	"github.com/sailpoint/atlas-go/atlas/auth/access"
+	"github.com/sailpoint/atlas-go/atlas/config"
+	"github.com/sailpoint/atlas-go/atlas/web"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// apiKeyScheme is the Authorization scheme of API keys.
+const apiKeyScheme = "ApiKey "
+
+// apiKeyTokenPrefix marks the API keys passed from apiKeyTokenExtractor to apiKeyTokenValidator, so
+// that they can't be mistaken for JWTs.
+const apiKeyTokenPrefix = "sp-connect-api-key:"
+
+// apiKeyClientPrefix prefixes the client ID of the tokens of API keys.
+const apiKeyClientPrefix = "api-key:"
+
+// apiKeyRights are the only rights of API keys. What they may invoke is narrowed by their scope.
+var apiKeyRights = []access.Right{"sp:connector:invoke"}
+
+// apiKeyTokenExtractor is a TokenExtractor that accepts API keys ("ApiKey <key>") as well as bearer tokens.
+func apiKeyTokenExtractor(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, apiKeyScheme) {
+		return apiKeyTokenPrefix + strings.TrimPrefix(header, apiKeyScheme)
+	}
+
+	return web.GetBearerToken(r)
+}
+
+// apiKeyTokenValidator is a TokenValidator that authenticates API keys, and leaves other tokens to
+// its delegate.
+type apiKeyTokenValidator struct {
+	delegate auth.TokenValidator
+	store    model.APIKeyStore
+	timeout  time.Duration
+}
+
+// newAPIKeyTokenValidator constructs a new apiKeyTokenValidator.
+func newAPIKeyTokenValidator(delegate auth.TokenValidator, store model.APIKeyStore) *apiKeyTokenValidator {
+	v := &apiKeyTokenValidator{}
+	v.delegate = delegate
+	v.store = store
+	v.timeout = 5 * time.Second
+
+	return v
+}
+
+// Parse gets the token of an API key in the API key's tenant, or parses any other token with the delegate.
+func (v *apiKeyTokenValidator) Parse(encoded string) (*auth.Token, error) {
+	if !strings.HasPrefix(encoded, apiKeyTokenPrefix) {
+		return v.delegate.Parse(encoded)
+	}
+
+	// TokenValidator has no context, so the lookup gets its own.
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+
+	key, err := cmd.AuthenticateAPIKey(ctx, v.store, strings.TrimPrefix(encoded, apiKeyTokenPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	token := &auth.Token{}
+	token.TenantID = atlas.TenantID(key.TenantID)
+	token.Pod = atlas.Pod(key.Pod)
+	token.Org = atlas.Org(key.Org)
+	token.ClientID = apiKeyClientPrefix + key.ID
+	token.Expiration = key.Expires
+
+	return token, nil
+}
+
+// apiKeySummarizer is an access Summarizer that grants API keys apiKeyRights, and leaves other tokens
+// to its delegate.
+type apiKeySummarizer struct {
+	delegate access.Summarizer
+}
+
+// Summarize builds the access summary of the token.
+func (s *apiKeySummarizer) Summarize(ctx context.Context, t *auth.Token) (*access.Summary, error) {
+	if apiKeyID(t) != "" {
+		return &access.Summary{RightSets: []access.RightSetID{}, FlattenedRights: apiKeyRights}, nil
+	}
+
+	return s.delegate.Summarize(ctx, t)
+}
+
+// apiKeyID gets the ID of the API key a token was issued for, or "" if it's not an API key's token.
+func apiKeyID(t *auth.Token) string {
+	if t == nil || !strings.HasPrefix(t.ClientID, apiKeyClientPrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(t.ClientID, apiKeyClientPrefix)
+}
+
+// apiKeyAllows gets whether the request's API key, if it was made with one, may perform the verb on
+// the connector instance.
+func (s *ConnectService) apiKeyAllows(ctx context.Context, instanceID string, verb model.ACLVerb) (bool, error) {
+	id := apiKeyID(auth.GetToken(ctx))
+	if id == "" {
+		return true, nil
+	}
+
+	key, err := s.apiKeyStore.GetAPIKey(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	return key != nil && key.Allows(instanceID, verb), nil
+}
+
+// createAPIKey mints an API key for the caller's tenant. The response carries the key, which can't be
+// retrieved again.
+func (s *ConnectService) createAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		rc := atlas.GetRequestContext(ctx)
+		if rc == nil {
+			web.Unauthorized(ctx, w)
+			return
+		}
+
+		maxLifetime := config.GetDuration(s.Config, "API_KEY_MAX_LIFETIME", 90*24*time.Hour)
+
+		cmd, err := cmd.NewCreateAPIKey(string(rc.TenantID), string(rc.Pod), string(rc.Org), requestActor(ctx), body, maxLifetime)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		result, err := cmd.Handle(ctx, s.apiKeyStore)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		if err := s.recordAudit(ctx, model.AuditCreate, model.AuditAPIKey, result.ID, nil, result.APIKey, apiKeySecretKeys); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
+
+// rotateAPIKey replaces the secret of an API key. The response carries the new key.
+func (s *ConnectService) rotateAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		cmd, err := cmd.NewRotateAPIKey(requestTenantID(ctx), mux.Vars(r)["id"])
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		before, err := s.apiKeyStore.GetAPIKey(ctx, cmd.ID)
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		result, err := cmd.Handle(ctx, s.apiKeyStore)
+		if err != nil {
+			writeAPIKeyError(ctx, w, err)
+			return
+		}
+
+		if err := s.recordAudit(ctx, model.AuditUpdate, model.AuditAPIKey, result.ID, before, result.APIKey, apiKeySecretKeys); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, result)
+	}
+}
+
+// revokeAPIKey deletes an API key.
+func (s *ConnectService) revokeAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		cmd, err := cmd.NewRevokeAPIKey(requestTenantID(ctx), mux.Vars(r)["id"])
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		revoked, err := cmd.Handle(ctx, s.apiKeyStore)
+		if err != nil {
+			writeAPIKeyError(ctx, w, err)
+			return
+		}
+
+		if err := s.recordAudit(ctx, model.AuditDelete, model.AuditAPIKey, revoked.ID, revoked, nil, apiKeySecretKeys); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		web.NoContent(w)
+	}
+}
+
+// apiKeySecretKeys are the fields of API keys redacted from audit records.
+var apiKeySecretKeys = []string{"keyHash"}
+
+// writeAPIKeyError writes the error response for an API key request, which is 404 when the key
+// doesn't exist in the caller's tenant.
+func writeAPIKeyError(ctx context.Context, w http.ResponseWriter, err error) {
+	if errors.Is(err, cmd.ErrAPIKeyNotFound) {
+		web.NotFoundWithError(ctx, w, err)
+		return
+	}
+
+	WriteJSONWithError(ctx, w, err)
+}
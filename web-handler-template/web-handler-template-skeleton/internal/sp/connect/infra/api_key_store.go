@@ -0,0 +1,111 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// redisAPIKeyStore is an APIKeyStore that keeps each API key as JSON in Redis, until it expires.
+// Keys are looked up by ID alone, since a key's tenant is only known once it's found, so each tenant
+// also has a set of the IDs of its keys for purging them.
+type redisAPIKeyStore struct {
+	client redis.Cmdable
+}
+
+// newAPIKeyStore constructs a new redisAPIKeyStore.
+func newAPIKeyStore(client redis.Cmdable) *redisAPIKeyStore {
+	return &redisAPIKeyStore{client: client}
+}
+
+// SaveAPIKey creates or replaces an API key. The entry expires with the key.
+func (s *redisAPIKeyStore) SaveAPIKey(ctx context.Context, key *model.APIKey) error {
+	ttl := time.Until(key.Expires)
+	if ttl <= 0 {
+		return s.DeleteAPIKey(ctx, key.ID)
+	}
+
+	defer observeOp(redisKVSLatency, "api_key_save", time.Now())
+
+	value, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.SAdd(ctx, tenantAPIKeysKey(key.TenantID), key.ID).Err(); err != nil {
+		return err
+	}
+
+	return s.client.Set(ctx, apiKeyKey(key.ID), value, ttl).Err()
+}
+
+// GetAPIKey gets an API key by ID, or nil if it doesn't exist.
+func (s *redisAPIKeyStore) GetAPIKey(ctx context.Context, id string) (*model.APIKey, error) {
+	defer observeOp(redisKVSLatency, "api_key_get", time.Now())
+
+	value, err := s.client.Get(ctx, apiKeyKey(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &model.APIKey{}
+	if err := json.Unmarshal([]byte(value), key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// DeleteAPIKey removes an API key.
+func (s *redisAPIKeyStore) DeleteAPIKey(ctx context.Context, id string) error {
+	key, err := s.GetAPIKey(ctx, id)
+	if err != nil || key == nil {
+		return err
+	}
+
+	defer observeOp(redisKVSLatency, "api_key_delete", time.Now())
+
+	if err := s.client.Del(ctx, apiKeyKey(id)).Err(); err != nil {
+		return err
+	}
+
+	return s.client.SRem(ctx, tenantAPIKeysKey(key.TenantID), id).Err()
+}
+
+// PurgeOrg removes all of the tenant's API keys.
+func (s *redisAPIKeyStore) PurgeOrg(ctx context.Context, tenantID string) error {
+	defer observeOp(redisKVSLatency, "api_key_purge", time.Now())
+
+	ids, err := s.client.SMembers(ctx, tenantAPIKeysKey(tenantID)).Result()
+	if err != nil {
+		return err
+	}
+
+	// The keys aren't in the tenant's cluster slot, so they're deleted one by one.
+	for _, id := range ids {
+		if err := s.client.Del(ctx, apiKeyKey(id)).Err(); err != nil {
+			return err
+		}
+	}
+
+	return s.client.Del(ctx, tenantAPIKeysKey(tenantID)).Err()
+}
+
+// apiKeyKey returns the key of an API key.
+func apiKeyKey(id string) string {
+	return keyPrefix + "api-key:" + id
+}
+
+// tenantAPIKeysKey returns the key of the set of the IDs of a tenant's API keys. It may still hold
+// the IDs of keys that have expired.
+func tenantAPIKeysKey(tenantID string) string {
+	return keyPrefix + "{" + tenantID + "}:api-keys"
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/memory"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+func TestAPIKeyStorePurgeOrgRemovesOnlyTheTenantsKeys(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewRedis()
+	store := newAPIKeyStore(client)
+
+	expires := time.Now().Add(time.Hour)
+	for _, key := range []*model.APIKey{
+		{ID: "k1", TenantID: "t1", Expires: expires},
+		{ID: "k2", TenantID: "t1", Expires: expires},
+		{ID: "k3", TenantID: "t2", Expires: expires},
+	} {
+		if err := store.SaveAPIKey(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.PurgeOrg(ctx, "t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"k1", "k2"} {
+		if key, err := store.GetAPIKey(ctx, id); err != nil || key != nil {
+			t.Errorf("expected %s to be purged, got %+v (%v)", id, key, err)
+		}
+	}
+	if n := client.Exists(ctx, tenantAPIKeysKey("t1")).Val(); n != 0 {
+		t.Error("expected the tenant's key index to be purged")
+	}
+	if key, err := store.GetAPIKey(ctx, "k3"); err != nil || key == nil {
+		t.Errorf("expected the other tenant's key to remain, got %+v (%v)", key, err)
+	}
+}
+
+func TestAPIKeyStoreDeleteRemovesTheKeyFromItsTenant(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewRedis()
+	store := newAPIKeyStore(client)
+
+	if err := store.SaveAPIKey(ctx, &model.APIKey{ID: "k1", TenantID: "t1", Expires: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteAPIKey(ctx, "k1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := client.SMembers(ctx, tenantAPIKeysKey("t1")).Val(); len(ids) != 0 {
+		t.Errorf("expected the key to be removed from the tenant's index, got %v", ids)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/globalconnector"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/internalconnector"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// commandDispatcher sends runtime commands on their way, to the runtime queue or a Beacon runtime.
+type commandDispatcher interface {
+	Dispatch(ctx context.Context, org atlas.Org, cmd *model.RuntimeCommand) error
+}
+
+// commandExecutor executes commands against connector endpoints.
+type commandExecutor interface {
+	CheckEndpoint(ctx context.Context, endpoint string) error
+	Execute(ctx context.Context, org atlas.Org, endpoint string, cmd *model.RuntimeCommand) error
+}
+
+// internalExecutor answers the commands of connectors with the internal topology.
+type internalExecutor interface {
+	Execute(ctx context.Context, cmd *model.RuntimeCommand, response *internalconnector.Response) error
+}
+
+// commandInvoker is a CommandInvoker, InvocationStarter and InvocationCanceller that routes each command by the topology
+// of its instance's spec: runtime commands are dispatched to the instance's connector group, global
+// commands are executed against the spec's endpoint in the background, and internal commands are
+// answered in the background by the internal executor. Each invocation is persisted before its
+// command is sent, so that its results always have an invocation to go to.
+type commandInvoker struct {
+	instances   model.ConnectorInstanceStore
+	specs       model.ConnectorSpecStore
+	invocations model.InvocationStore
+	dispatcher  commandDispatcher
+	executor    commandExecutor
+	internal    internalExecutor
+	observer    model.InvocationObserver
+
+	// defaultTimeout is how long invocations run before they expire when neither the caller nor the
+	// spec set a timeout.
+	defaultTimeout time.Duration
+}
+
+// instanceRouting is the part of an instance's config that routes its commands.
+type instanceRouting struct {
+	ConnectorGroup string `json:"connectorGroup"`
+}
+
+// newCommandInvoker constructs a new commandInvoker.
+func newCommandInvoker(instances model.ConnectorInstanceStore, specs model.ConnectorSpecStore, invocations model.InvocationStore, dispatcher commandDispatcher, executor commandExecutor, internal internalExecutor, observer model.InvocationObserver, defaultTimeout time.Duration) *commandInvoker {
+	i := &commandInvoker{}
+	i.instances = instances
+	i.specs = specs
+	i.invocations = invocations
+	i.dispatcher = dispatcher
+	i.executor = executor
+	i.internal = internal
+	i.observer = observer
+	i.defaultTimeout = defaultTimeout
+
+	return i
+}
+
+// Invoke starts the command as a new invocation.
+func (i *commandInvoker) Invoke(ctx context.Context, instanceID string, commandType model.CommandType, input json.RawMessage) error {
+	_, err := i.StartInvocation(ctx, &model.InvocationRequest{
+		InvocationID:        uuid.New().String(),
+		ConnectorInstanceID: instanceID,
+		Type:                commandType,
+		Input:               input,
+	})
+	return err
+}
+
+// CancelInvocation finishes the invocation as cancelled and reports it to the observer. A command
+// that's already executing isn't interrupted, but its results are dropped from then on.
+func (i *commandInvoker) CancelInvocation(ctx context.Context, tenantID string, id string) (*model.Invocation, error) {
+	inv, err := i.invocations.FinishInvocation(ctx, tenantID, id, model.InvocationCancelled, nil)
+	if err != nil {
+		return nil, err
+	}
+	if inv != nil {
+		i.observer.InvocationFinished(inv)
+		return inv, nil
+	}
+
+	return i.invocations.GetInvocation(ctx, tenantID, id)
+}
+
+// StartInvocation starts the request's command against an instance of the request's tenant. It
+// fails with cmd.ErrConnectorInstanceNotFound or cmd.ErrConnectorSpecNotFound when either doesn't
+// exist, and with a bad request when the spec doesn't implement the command, the command can't be
+// routed, the spec's endpoint isn't allowed or the internal connector's response can't be parsed.
+// The invocation expires after the request's timeout, or the spec's or the default timeout if it's
+// zero, and keeps the request's context. An invocation whose command can't be dispatched is persisted
+// as failed.
+func (i *commandInvoker) StartInvocation(ctx context.Context, req *model.InvocationRequest) (*model.Invocation, error) {
+	tenantID := requestTenantID(ctx)
+
+	instance, err := i.instances.GetInstance(ctx, tenantID, req.ConnectorInstanceID)
+	if err != nil {
+		return nil, err
+	}
+	if instance == nil {
+		return nil, cmd.ErrConnectorInstanceNotFound
+	}
+
+	spec, err := i.specs.GetSpec(ctx, tenantID, instance.ConnectorSpecID)
+	if err != nil {
+		return nil, err
+	}
+	if spec == nil {
+		return nil, cmd.ErrConnectorSpecNotFound
+	}
+
+	if !implements(spec, req.Type) {
+		return nil, model.NewBadRequestError("connector spec %s doesn't implement %s", spec.ID, req.Type)
+	}
+
+	timeout := req.Timeout
+	if timeout == 0 {
+		if timeout, err = i.specTimeout(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	command := &model.RuntimeCommand{
+		InvocationID:        req.InvocationID,
+		TenantID:            tenantID,
+		ConnectorInstanceID: req.ConnectorInstanceID,
+		Type:                req.Type,
+		Input:               req.Input,
+		Created:             time.Now().UTC(),
+	}
+	command.Expiration = command.Created.Add(timeout)
+
+	var org atlas.Org
+	if rc := atlas.GetRequestContext(ctx); rc != nil {
+		org = rc.Org
+	}
+
+	var response *internalconnector.Response
+	switch spec.Topology {
+	case model.TopologyRuntime:
+		routing := instanceRouting{}
+		if len(instance.Config) > 0 {
+			if err := json.Unmarshal(instance.Config, &routing); err != nil {
+				return nil, model.NewBadRequestError("parse config of connector instance %s: %v", req.ConnectorInstanceID, err)
+			}
+		}
+		if routing.ConnectorGroup == "" {
+			return nil, model.NewBadRequestError("connector instance %s has no connectorGroup to dispatch to", req.ConnectorInstanceID)
+		}
+		command.ConnectorGroup = routing.ConnectorGroup
+	case model.TopologyGlobal:
+		if err := i.executor.CheckEndpoint(ctx, spec.Endpoint); err != nil {
+			if errors.Is(err, globalconnector.ErrEndpointNotAllowed) {
+				return nil, model.NewBadRequestError("connector spec %s: %v", spec.ID, err)
+			}
+			return nil, err
+		}
+	case model.TopologyInternal:
+		if response, err = internalconnector.ParseResponse(req.Response); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, model.NewBadRequestError("connector spec %s has the %s topology and can't be invoked", spec.ID, spec.Topology)
+	}
+
+	inv := &model.Invocation{
+		ID:                  req.InvocationID,
+		TenantID:            tenantID,
+		ConnectorInstanceID: req.ConnectorInstanceID,
+		Type:                req.Type,
+		Topology:            spec.Topology,
+		Status:              model.InvocationPending,
+		Context:             req.Context,
+		CreatedAt:           command.Created,
+		Expiration:          command.Expiration,
+	}
+	if err := i.invocations.CreateInvocation(ctx, inv); err != nil {
+		return nil, err
+	}
+
+	if spec.Topology == model.TopologyRuntime {
+		if err := i.dispatcher.Dispatch(ctx, org, command); err != nil {
+			failure := &model.InvocationFailure{Type: model.InvocationErrorTransport, Message: err.Error()}
+			if _, finishErr := i.invocations.FinishInvocation(ctx, tenantID, req.InvocationID, model.InvocationFailed, failure); finishErr != nil {
+				log.Warnf(ctx, "fail undispatched invocation %s: %v", req.InvocationID, finishErr)
+			}
+			return nil, err
+		}
+	} else {
+		// The execution outlives the invoking request, so it only keeps the request's span, to continue
+		// its trace, its log fields and its request context, which the events of the invocation's
+		// results are published for.
+		execCtx := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+		execCtx = log.WithFields(execCtx, zap.String("org", string(org)), zap.String("invocation_id", req.InvocationID))
+		if rc := atlas.GetRequestContext(ctx); rc != nil {
+			execCtx = atlas.WithRequestContext(execCtx, rc)
+		}
+		go func() {
+			if spec.Topology == model.TopologyInternal {
+				if err := i.internal.Execute(execCtx, command, response); err != nil {
+					log.Warnf(execCtx, "execute invocation on internal connector: %v", err)
+				}
+				return
+			}
+			if err := i.executor.Execute(execCtx, org, spec.Endpoint, command); err != nil {
+				log.Warnf(execCtx, "execute invocation on global connector: %v", err)
+			}
+		}()
+	}
+
+	i.observer.InvocationCreated(inv)
+
+	return inv, nil
+}
+
+// specTimeout gets how long invocations of the spec run before they expire by default.
+func (i *commandInvoker) specTimeout(spec *model.ConnectorSpec) (time.Duration, error) {
+	if spec.Timeout == "" {
+		return i.defaultTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(spec.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, model.NewBadRequestError("connector spec %s has an invalid timeout %q", spec.ID, spec.Timeout)
+	}
+
+	return timeout, nil
+}
+
+// implements gets whether the spec lists the command type.
+func implements(spec *model.ConnectorSpec, commandType model.CommandType) bool {
+	for _, t := range spec.Commands {
+		if t == commandType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// uninvocable gets whether err is why a command can't be invoked at all, rather than a failure that
+// may go away on retry.
+func uninvocable(err error) bool {
+	var badRequest *model.BadRequestError
+	return errors.Is(err, cmd.ErrConnectorInstanceNotFound) || errors.Is(err, cmd.ErrConnectorSpecNotFound) || errors.As(err, &badRequest)
+}
@@ -0,0 +1,299 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/globalconnector"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/internalconnector"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/memory"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeInstanceStore struct {
+	model.ConnectorInstanceStore
+	instances map[string]*model.ConnectorInstance
+}
+
+func (s *fakeInstanceStore) GetInstance(ctx context.Context, tenantID string, id string) (*model.ConnectorInstance, error) {
+	return s.instances[id], nil
+}
+
+type fakeSpecStore struct {
+	model.ConnectorSpecStore
+	specs map[string]*model.ConnectorSpec
+}
+
+func (s *fakeSpecStore) GetSpec(ctx context.Context, tenantID string, id string) (*model.ConnectorSpec, error) {
+	return s.specs[id], nil
+}
+
+type fakeCommandDispatcher struct {
+	dispatched []*model.RuntimeCommand
+	err        error
+}
+
+func (d *fakeCommandDispatcher) Dispatch(ctx context.Context, org atlas.Org, cmd *model.RuntimeCommand) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.dispatched = append(d.dispatched, cmd)
+	return nil
+}
+
+type fakeInternalExecutor struct {
+	responses chan *internalconnector.Response
+}
+
+func (e *fakeInternalExecutor) Execute(ctx context.Context, cmd *model.RuntimeCommand, response *internalconnector.Response) error {
+	e.responses <- response
+	return nil
+}
+
+type fakeCommandExecutor struct {
+	endpoints chan string
+	commands  chan *model.RuntimeCommand
+}
+
+func (e *fakeCommandExecutor) CheckEndpoint(ctx context.Context, endpoint string) error {
+	if !strings.HasPrefix(endpoint, "https://") {
+		return globalconnector.ErrEndpointNotAllowed
+	}
+	return nil
+}
+
+func (e *fakeCommandExecutor) Execute(ctx context.Context, org atlas.Org, endpoint string, cmd *model.RuntimeCommand) error {
+	e.endpoints <- endpoint
+	e.commands <- cmd
+	return nil
+}
+
+func newTestCommandInvoker() (*commandInvoker, *fakeCommandDispatcher, *fakeCommandExecutor, *redisInvocationStore) {
+	invoker, dispatcher, executor, _, invocations := newTestCommandInvokerWithInternal()
+	return invoker, dispatcher, executor, invocations
+}
+
+func newTestCommandInvokerWithInternal() (*commandInvoker, *fakeCommandDispatcher, *fakeCommandExecutor, *fakeInternalExecutor, *redisInvocationStore) {
+	instances := &fakeInstanceStore{instances: map[string]*model.ConnectorInstance{
+		"agent":     {ID: "agent", ConnectorSpecID: "runtime", Config: json.RawMessage(`{"connectorGroup":"on-prem"}`)},
+		"ungrouped": {ID: "ungrouped", ConnectorSpecID: "runtime", Config: json.RawMessage(`{}`)},
+		"cloud":     {ID: "cloud", ConnectorSpecID: "global"},
+		"slow":      {ID: "slow", ConnectorSpecID: "slow"},
+		"orphan":    {ID: "orphan", ConnectorSpecID: "deleted"},
+		"internal":  {ID: "internal", ConnectorSpecID: "insecure"},
+		"debug":     {ID: "debug", ConnectorSpecID: "internal"},
+	}}
+	specs := &fakeSpecStore{specs: map[string]*model.ConnectorSpec{
+		"runtime":  {ID: "runtime", Topology: model.TopologyRuntime, Commands: []model.CommandType{model.CommandAccountList}},
+		"global":   {ID: "global", Topology: model.TopologyGlobal, Endpoint: "https://connector.example.com/commands", Commands: []model.CommandType{model.CommandAccountList}},
+		"slow":     {ID: "slow", Topology: model.TopologyGlobal, Endpoint: "https://slow.example.com/commands", Timeout: "30m", Commands: []model.CommandType{model.CommandAccountList}},
+		"insecure": {ID: "insecure", Topology: model.TopologyGlobal, Endpoint: "http://169.254.169.254/latest", Commands: []model.CommandType{model.CommandAccountList}},
+		"internal": {ID: "internal", Topology: model.TopologyInternal, Commands: []model.CommandType{model.CommandAccountList}},
+	}}
+	dispatcher := &fakeCommandDispatcher{}
+	executor := &fakeCommandExecutor{endpoints: make(chan string, 1), commands: make(chan *model.RuntimeCommand, 1)}
+
+	internal := &fakeInternalExecutor{responses: make(chan *internalconnector.Response, 1)}
+	invocations := newRedisInvocationStore(memory.NewRedis(), time.Hour, &fakeResultEventBuilder{}, &fakeAuditPublisher{})
+
+	return newCommandInvoker(instances, specs, invocations, dispatcher, executor, internal, invocationObservers{}, time.Minute), dispatcher, executor, internal, invocations
+}
+
+func TestCommandInvokerDispatchesRuntimeCommandsToTheConnectorGroup(t *testing.T) {
+	invoker, dispatcher, _, invocations := newTestCommandInvoker()
+
+	if _, err := invoker.StartInvocation(context.Background(), &model.InvocationRequest{InvocationID: "i1", ConnectorInstanceID: "agent", Type: model.CommandAccountList, Input: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := invocations.GetInvocation(context.Background(), "", "i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv == nil || inv.Status != model.InvocationPending || inv.Topology != model.TopologyRuntime {
+		t.Errorf("expected a pending runtime invocation to be persisted, got %+v", inv)
+	}
+	if c := dispatcher.dispatched[0]; !c.Expiration.Equal(c.Created.Add(time.Minute)) || !inv.Expiration.Equal(c.Expiration) {
+		t.Errorf("expected the invocation to expire after the default timeout, got %s for %s", c.Expiration, c.Created)
+	}
+
+	if len(dispatcher.dispatched) != 1 {
+		t.Fatalf("expected 1 dispatched command, got %d", len(dispatcher.dispatched))
+	}
+	if c := dispatcher.dispatched[0]; c.InvocationID != "i1" || c.ConnectorGroup != "on-prem" || c.ConnectorInstanceID != "agent" {
+		t.Errorf("unexpected command: %+v", c)
+	}
+}
+
+func TestCommandInvokerExecutesGlobalCommandsAtTheEndpoint(t *testing.T) {
+	invoker, _, executor, _ := newTestCommandInvoker()
+
+	if err := invoker.Invoke(context.Background(), "cloud", model.CommandAccountList, json.RawMessage(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case endpoint := <-executor.endpoints:
+		if endpoint != "https://connector.example.com/commands" {
+			t.Errorf("unexpected endpoint %s", endpoint)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the command to be executed")
+	}
+}
+
+func TestCommandInvokerAnswersInternalCommandsWithTheirResponse(t *testing.T) {
+	invoker, _, _, internal, invocations := newTestCommandInvokerWithInternal()
+
+	inv, err := invoker.StartInvocation(context.Background(), &model.InvocationRequest{
+		InvocationID:        "i1",
+		ConnectorInstanceID: "debug",
+		Type:                model.CommandAccountList,
+		Input:               json.RawMessage(`{}`),
+		Response:            json.RawMessage(`{"output":[{"identity":"john.doe"}],"err":{"category":"ConnectorError","type":"notFound","message":"gone"}}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.ID != "i1" || inv.Topology != model.TopologyInternal || inv.Status != model.InvocationPending {
+		t.Errorf("unexpected invocation %+v", inv)
+	}
+	if persisted, _ := invocations.GetInvocation(context.Background(), "", "i1"); persisted == nil {
+		t.Error("expected the invocation to be persisted")
+	}
+
+	select {
+	case response := <-internal.responses:
+		if len(response.Output) != 1 || string(response.Output[0]) != `{"identity":"john.doe"}` || response.Err == nil || response.Err.Type != "notFound" {
+			t.Errorf("unexpected response %+v", response)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the command to be answered")
+	}
+
+	_, err = invoker.StartInvocation(context.Background(), &model.InvocationRequest{InvocationID: "i2", ConnectorInstanceID: "debug", Type: model.CommandAccountList, Response: json.RawMessage(`[]`)})
+	var badRequest *model.BadRequestError
+	if !errors.As(err, &badRequest) {
+		t.Errorf("expected a malformed response to be rejected, got %v", err)
+	}
+}
+
+func TestCommandInvokerRejectsCommandsThatCantBeInvoked(t *testing.T) {
+	invoker, dispatcher, _, invocations := newTestCommandInvoker()
+
+	tests := []struct {
+		instanceID  string
+		commandType model.CommandType
+		expected    func(error) bool
+	}{
+		{"missing", model.CommandAccountList, func(err error) bool { return errors.Is(err, cmd.ErrConnectorInstanceNotFound) }},
+		{"orphan", model.CommandAccountList, func(err error) bool { return errors.Is(err, cmd.ErrConnectorSpecNotFound) }},
+		{"agent", model.CommandEntitlementList, func(err error) bool { var e *model.BadRequestError; return errors.As(err, &e) }},
+		{"ungrouped", model.CommandAccountList, func(err error) bool { var e *model.BadRequestError; return errors.As(err, &e) }},
+		{"internal", model.CommandAccountList, func(err error) bool { var e *model.BadRequestError; return errors.As(err, &e) }},
+	}
+
+	for _, tt := range tests {
+		_, err := invoker.StartInvocation(context.Background(), &model.InvocationRequest{InvocationID: "i1", ConnectorInstanceID: tt.instanceID, Type: tt.commandType, Input: json.RawMessage(`{}`)})
+		if !tt.expected(err) || !uninvocable(err) {
+			t.Errorf("%s %s: unexpected error %v", tt.instanceID, tt.commandType, err)
+		}
+	}
+
+	if len(dispatcher.dispatched) != 0 {
+		t.Errorf("expected nothing to be dispatched, got %d commands", len(dispatcher.dispatched))
+	}
+	if inv, _ := invocations.GetInvocation(context.Background(), "", "i1"); inv != nil {
+		t.Errorf("expected no invocation to be persisted, got %+v", inv)
+	}
+}
+
+func TestCommandInvokerFailsInvocationsThatCantBeDispatched(t *testing.T) {
+	invoker, dispatcher, _, invocations := newTestCommandInvoker()
+	dispatcher.err = errors.New("queue unavailable")
+
+	if _, err := invoker.StartInvocation(context.Background(), &model.InvocationRequest{InvocationID: "i1", ConnectorInstanceID: "agent", Type: model.CommandAccountList, Input: json.RawMessage(`{}`)}); !errors.Is(err, dispatcher.err) {
+		t.Fatalf("expected the dispatch error, got %v", err)
+	}
+
+	inv, err := invocations.GetInvocation(context.Background(), "", "i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv == nil || inv.Status != model.InvocationFailed || inv.ErrorType != model.InvocationErrorTransport {
+		t.Errorf("expected the invocation to fail with a transport error, got %+v", inv)
+	}
+}
+
+func TestCommandInvokerSendsTheDeadlineToTheExecutor(t *testing.T) {
+	tests := []struct {
+		instanceID string
+		timeout    time.Duration
+		expected   time.Duration
+	}{
+		{"cloud", 10 * time.Second, 10 * time.Second},
+		{"slow", 0, 30 * time.Minute},
+		{"slow", 10 * time.Second, 10 * time.Second},
+		{"cloud", 0, time.Minute},
+	}
+
+	for _, tt := range tests {
+		invoker, _, executor, _ := newTestCommandInvoker()
+
+		if _, err := invoker.StartInvocation(context.Background(), &model.InvocationRequest{InvocationID: "i1", ConnectorInstanceID: tt.instanceID, Type: model.CommandAccountList, Input: json.RawMessage(`{}`), Timeout: tt.timeout}); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case c := <-executor.commands:
+			<-executor.endpoints
+			if timeout := c.Expiration.Sub(c.Created); timeout != tt.expected {
+				t.Errorf("%s with a timeout of %s: expected the command to expire after %s, got %s", tt.instanceID, tt.timeout, tt.expected, timeout)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the command to be executed")
+		}
+	}
+}
+
+func TestCommandInvokerCancelsInvocations(t *testing.T) {
+	invoker, _, _, _ := newTestCommandInvoker()
+	metrics := newInvocationMetrics()
+	invoker.observer = invocationObservers{metrics}
+	ctx := context.Background()
+
+	if _, err := invoker.StartInvocation(ctx, &model.InvocationRequest{InvocationID: "i1", ConnectorInstanceID: "agent", Type: model.CommandAccountList, Input: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	before := counterValue(t, invocationsCancelled, string(model.CommandAccountList), "runtime")
+
+	inv, err := invoker.CancelInvocation(ctx, "", "i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv == nil || inv.Status != model.InvocationCancelled || inv.FinishedAt.IsZero() {
+		t.Fatalf("expected a cancelled invocation, got %+v", inv)
+	}
+	if v := counterValue(t, invocationsCancelled, string(model.CommandAccountList), "runtime"); v != before+1 {
+		t.Errorf("expected the cancellation to be counted once, got %g", v-before)
+	}
+
+	// Cancelling again returns the invocation as it is, without counting it again.
+	if inv, err = invoker.CancelInvocation(ctx, "", "i1"); err != nil || inv == nil || inv.Status != model.InvocationCancelled {
+		t.Errorf("expected the cancelled invocation, got %+v, %v", inv, err)
+	}
+	if v := counterValue(t, invocationsCancelled, string(model.CommandAccountList), "runtime"); v != before+1 {
+		t.Errorf("expected the cancellation to be counted once, got %g", v-before)
+	}
+
+	if inv, err = invoker.CancelInvocation(ctx, "", "missing"); err != nil || inv != nil {
+		t.Errorf("expected no invocation, got %+v, %v", inv, err)
+	}
+}
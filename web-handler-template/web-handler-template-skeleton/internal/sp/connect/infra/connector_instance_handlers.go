@@ -0,0 +1,250 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/gorilla/mux"
+	"github.com/sailpoint/atlas-go/atlas/web"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/filter"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// instanceQueryableFields and instanceSortableFields are the V3 properties GET /connector-instances can
+// filter and sort by.
+var (
+	instanceQueryableFields = mapset.NewSet("id", "name", "connectorSpecId", "created", "modified")
+	instanceSortableFields  = mapset.NewSet("name", "connectorSpecId", "created", "modified")
+)
+
+// listConnectorInstances lists the tenant's connector instances that the caller may read, oldest first
+// by default. It supports V3 filters and sorters, offset and limit, and with count=true sets
+// X-Total-Count to the number of instances that matched.
+func (s *ConnectService) listConnectorInstances() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		options, err := web.GetQueryOptions(r, instanceSortableFields, filter.NewMemoryFilterBuilder(), instanceQueryableFields)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		instances, err := s.readableInstances(ctx)
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		records := make([]filter.Properties, len(instances))
+		for i, instance := range instances {
+			records[i] = filter.Properties{
+				"id":              instance.ID,
+				"name":            instance.Name,
+				"connectorSpecId": instance.ConnectorSpecID,
+				"created":         instance.Created,
+				"modified":        instance.Modified,
+			}
+		}
+
+		indexes, total, err := filter.Query(records, options)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		page := make([]*model.ConnectorInstance, len(indexes))
+		for i, index := range indexes {
+			page[i] = instances[index]
+		}
+
+		if web.IsCountHeaderRequested(r) {
+			w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		}
+		web.WriteJSON(ctx, w, page)
+	}
+}
+
+// readableInstances lists the tenant's connector instances that the request's principal may read, by
+// the same checks requireInstanceAccess makes of a single instance, so that the list doesn't give away
+// the config of instances the caller can't get.
+func (s *ConnectService) readableInstances(ctx context.Context) ([]*model.ConnectorInstance, error) {
+	instances, err := s.instanceStore.ListInstances(ctx, requestTenantID(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	principal, err := s.requestPrincipal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	readable := make([]*model.ConnectorInstance, 0, len(instances))
+	for _, instance := range instances {
+		decision, err := s.instanceAccess(ctx, principal, instance.ID, model.ACLRead)
+		if err != nil {
+			return nil, err
+		}
+
+		if decision.Allowed {
+			readable = append(readable, instance)
+		}
+	}
+
+	return readable, nil
+}
+
+// getConnectorInstance gets a connector instance of the tenant.
+func (s *ConnectService) getConnectorInstance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		instance, err := s.instanceStore.GetInstance(ctx, requestTenantID(ctx), mux.Vars(r)["id"])
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		if instance == nil {
+			web.NotFound(ctx, w)
+			return
+		}
+
+		web.WriteJSON(ctx, w, instance)
+	}
+}
+
+// createConnectorInstance creates a connector instance of a spec.
+func (s *ConnectService) createConnectorInstance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		cmd, err := cmd.NewCreateConnectorInstance(requestTenantID(ctx), body)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		instance, err := cmd.Handle(ctx, s.specStore, s.instanceStore)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		if err := s.recordInstanceAudit(ctx, model.AuditCreate, nil, instance); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, instance)
+	}
+}
+
+// updateConnectorInstance replaces the name, spec and config of a connector instance.
+func (s *ConnectService) updateConnectorInstance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		cmd, err := cmd.NewUpdateConnectorInstance(requestTenantID(ctx), mux.Vars(r)["id"], body)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		before, err := s.instanceStore.GetInstance(ctx, cmd.TenantID, cmd.ID)
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		instance, err := cmd.Handle(ctx, s.specStore, s.instanceStore)
+		if err != nil {
+			writeConnectorError(ctx, w, err)
+			return
+		}
+
+		if err := s.recordInstanceAudit(ctx, model.AuditUpdate, before, instance); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, instance)
+	}
+}
+
+// deleteConnectorInstance deletes a connector instance along with its ACL.
+func (s *ConnectService) deleteConnectorInstance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		cmd, err := cmd.NewDeleteConnectorInstance(requestTenantID(ctx), mux.Vars(r)["id"])
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		deleted, err := cmd.Handle(ctx, s.instanceStore, s.aclStore)
+		if err != nil {
+			writeConnectorError(ctx, w, err)
+			return
+		}
+
+		if err := s.recordInstanceAudit(ctx, model.AuditDelete, deleted, nil); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		web.NoContent(w)
+	}
+}
+
+// recordInstanceAudit records a change to a connector instance, redacting the config fields that
+// its spec marks as secrets.
+func (s *ConnectService) recordInstanceAudit(ctx context.Context, action model.AuditAction, before *model.ConnectorInstance, after *model.ConnectorInstance) error {
+	instance := after
+	if instance == nil {
+		instance = before
+	}
+
+	var secretKeys []string
+	for _, i := range []*model.ConnectorInstance{before, after} {
+		if i == nil {
+			continue
+		}
+
+		spec, err := s.specStore.GetSpec(ctx, i.TenantID, i.ConnectorSpecID)
+		if err != nil {
+			return err
+		}
+		if spec != nil {
+			secretKeys = append(secretKeys, spec.SecretKeys()...)
+		}
+	}
+
+	var b, a interface{}
+	if before != nil {
+		b = before
+	}
+	if after != nil {
+		a = after
+	}
+
+	return s.recordAudit(ctx, action, model.AuditConnectorInstance, instance.ID, b, a, secretKeys)
+}
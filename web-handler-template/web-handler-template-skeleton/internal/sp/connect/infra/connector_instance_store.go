@@ -0,0 +1,115 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// redisConnectorInstanceStore is a ConnectorInstanceStore that keeps each tenant's instances in a
+// Redis hash, keyed by ID.
+type redisConnectorInstanceStore struct {
+	client redis.Cmdable
+}
+
+// newConnectorInstanceStore constructs a new redisConnectorInstanceStore.
+func newConnectorInstanceStore(client redis.Cmdable) *redisConnectorInstanceStore {
+	return &redisConnectorInstanceStore{client: client}
+}
+
+// ListInstances lists the instances of the tenant, oldest first.
+func (s *redisConnectorInstanceStore) ListInstances(ctx context.Context, tenantID string) ([]*model.ConnectorInstance, error) {
+	defer observeOp(dynamoConnectorLatency, "instance_list", time.Now())
+
+	values, err := s.client.HGetAll(ctx, connectorInstancesKey(tenantID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]*model.ConnectorInstance, 0, len(values))
+	for id, value := range values {
+		instance, err := parseStoredInstance(tenantID, value)
+		if err != nil {
+			return nil, fmt.Errorf("parse connector instance %s: %w", id, err)
+		}
+		instances = append(instances, instance)
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		if !instances[i].Created.Equal(instances[j].Created) {
+			return instances[i].Created.Before(instances[j].Created)
+		}
+		return instances[i].ID < instances[j].ID
+	})
+
+	return instances, nil
+}
+
+// GetInstance gets an instance of the tenant, or nil if it doesn't exist.
+func (s *redisConnectorInstanceStore) GetInstance(ctx context.Context, tenantID string, id string) (*model.ConnectorInstance, error) {
+	defer observeOp(dynamoConnectorLatency, "instance_get", time.Now())
+
+	value, err := s.client.HGet(ctx, connectorInstancesKey(tenantID), id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := parseStoredInstance(tenantID, value)
+	if err != nil {
+		return nil, fmt.Errorf("parse connector instance %s: %w", id, err)
+	}
+
+	return instance, nil
+}
+
+// SaveInstance creates or replaces an instance.
+func (s *redisConnectorInstanceStore) SaveInstance(ctx context.Context, instance *model.ConnectorInstance) error {
+	defer observeOp(dynamoConnectorLatency, "instance_save", time.Now())
+
+	raw, err := json.Marshal(instance)
+	if err != nil {
+		return err
+	}
+
+	return s.client.HSet(ctx, connectorInstancesKey(instance.TenantID), instance.ID, raw).Err()
+}
+
+// DeleteInstance removes an instance of the tenant, returning whether it existed.
+func (s *redisConnectorInstanceStore) DeleteInstance(ctx context.Context, tenantID string, id string) (bool, error) {
+	defer observeOp(dynamoConnectorLatency, "instance_delete", time.Now())
+
+	n, err := s.client.HDel(ctx, connectorInstancesKey(tenantID), id).Result()
+	return n > 0, err
+}
+
+// PurgeOrg removes all of the tenant's instances.
+func (s *redisConnectorInstanceStore) PurgeOrg(ctx context.Context, tenantID string) error {
+	defer observeOp(dynamoConnectorLatency, "instance_purge", time.Now())
+	return s.client.Del(ctx, connectorInstancesKey(tenantID)).Err()
+}
+
+// connectorInstancesKey returns the key of the hash of a tenant's instances.
+func connectorInstancesKey(tenantID string) string {
+	return keyPrefix + "{" + tenantID + "}:connector-instances"
+}
+
+// parseStoredInstance parses an instance of the tenant as stored in Redis.
+func parseStoredInstance(tenantID string, value string) (*model.ConnectorInstance, error) {
+	instance := &model.ConnectorInstance{}
+	if err := json.Unmarshal([]byte(value), instance); err != nil {
+		return nil, err
+	}
+	instance.TenantID = tenantID
+
+	return instance, nil
+}
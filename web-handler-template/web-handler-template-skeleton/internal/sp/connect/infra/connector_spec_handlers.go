@@ -0,0 +1,227 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/gorilla/mux"
+	"github.com/sailpoint/atlas-go/atlas/web"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/filter"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// specQueryableFields and specSortableFields are the V3 properties GET /connector-specifications can
+// filter and sort by.
+var (
+	specQueryableFields = mapset.NewSet("id", "name", "topology", "visibility", "created", "modified")
+	specSortableFields  = mapset.NewSet("id", "name", "topology", "created", "modified")
+)
+
+// listConnectorSpecifications lists the built-in specs and the tenant's, by ID by default. It supports
+// V3 filters and sorters, offset and limit, and with count=true sets X-Total-Count to the number of
+// specs that matched.
+func (s *ConnectService) listConnectorSpecifications() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		options, err := web.GetQueryOptions(r, specSortableFields, filter.NewMemoryFilterBuilder(), specQueryableFields)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		specs, err := s.specStore.ListSpecs(ctx, requestTenantID(ctx))
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		records := make([]filter.Properties, len(specs))
+		for i, spec := range specs {
+			records[i] = filter.Properties{
+				"id":         spec.ID,
+				"name":       spec.Name,
+				"topology":   string(spec.Topology),
+				"visibility": spec.Visibility,
+				"created":    optionalTime(spec.Created),
+				"modified":   optionalTime(spec.Modified),
+			}
+		}
+
+		indexes, total, err := filter.Query(records, options)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		page := make([]*model.ConnectorSpec, len(indexes))
+		for i, index := range indexes {
+			page[i] = specs[index]
+		}
+
+		if web.IsCountHeaderRequested(r) {
+			w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		}
+		web.WriteJSON(ctx, w, page)
+	}
+}
+
+// getConnectorSpecification gets a built-in spec or one of the tenant's.
+func (s *ConnectService) getConnectorSpecification() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		spec, err := s.specStore.GetSpec(ctx, requestTenantID(ctx), mux.Vars(r)["id"])
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		if spec == nil {
+			web.NotFound(ctx, w)
+			return
+		}
+
+		web.WriteJSON(ctx, w, spec)
+	}
+}
+
+// validateConnectorSpecification validates a spec against the connector spec schema without saving
+// it, returning it as parsed.
+func (s *ConnectService) validateConnectorSpecification() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		cmd, err := cmd.NewValidateConnectorSpec(body)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		spec, err := cmd.Handle(ctx, s.schemaRegistry)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, spec)
+	}
+}
+
+// createConnectorSpecification creates a spec in the tenant.
+func (s *ConnectService) createConnectorSpecification() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		cmd, err := cmd.NewCreateConnectorSpec(requestTenantID(ctx), body)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		spec, err := cmd.Handle(ctx, s.schemaRegistry, s.specStore)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		if err := s.recordAudit(ctx, model.AuditCreate, model.AuditConnectorSpec, spec.ID, nil, spec, nil); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, spec)
+	}
+}
+
+// updateConnectorSpecification replaces a spec of the tenant.
+func (s *ConnectService) updateConnectorSpecification() http.HandlerFunc {
+	return s.saveConnectorSpecification(false)
+}
+
+// patchConnectorSpecification applies a JSON merge patch to a spec of the tenant.
+func (s *ConnectService) patchConnectorSpecification() http.HandlerFunc {
+	return s.saveConnectorSpecification(true)
+}
+
+// saveConnectorSpecification replaces or patches a spec of the tenant.
+func (s *ConnectService) saveConnectorSpecification(patch bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		cmd, err := cmd.NewUpdateConnectorSpec(requestTenantID(ctx), mux.Vars(r)["id"], body, patch)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		before, err := s.specStore.GetSpec(ctx, cmd.TenantID, cmd.ID)
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		spec, err := cmd.Handle(ctx, s.schemaRegistry, s.specStore)
+		if err != nil {
+			writeConnectorError(ctx, w, err)
+			return
+		}
+
+		action := model.AuditUpdate
+		if patch {
+			action = model.AuditPatch
+		}
+
+		if err := s.recordAudit(ctx, action, model.AuditConnectorSpec, spec.ID, before, spec, nil); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, spec)
+	}
+}
+
+// optionalTime gets a time as a filter property, which is missing if it's zero.
+func optionalTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t
+}
+
+// writeConnectorError writes the error response for a connector spec, instance or invocation
+// request, which is 404 when the spec, instance or invocation doesn't exist in the caller's tenant.
+func writeConnectorError(ctx context.Context, w http.ResponseWriter, err error) {
+	if errors.Is(err, cmd.ErrConnectorSpecNotFound) || errors.Is(err, cmd.ErrConnectorInstanceNotFound) || errors.Is(err, cmd.ErrInvocationNotFound) {
+		web.NotFoundWithError(ctx, w, err)
+		return
+	}
+
+	WriteJSONWithError(ctx, w, err)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// redisConnectorSpecStore is a ConnectorSpecStore that keeps each tenant's specs in a Redis hash,
+// keyed by ID, and the built-in specs in memory.
+type redisConnectorSpecStore struct {
+	client  redis.Cmdable
+	builtIn map[string]*model.ConnectorSpec
+}
+
+// newConnectorSpecStore constructs a new redisConnectorSpecStore, with the built-in specs in
+// dist/connectors.
+func newConnectorSpecStore(client redis.Cmdable, distDir string) (*redisConnectorSpecStore, error) {
+	builtIn, err := loadBuiltInSpecs(filepath.Join(distDir, "connectors"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisConnectorSpecStore{client: client, builtIn: builtIn}, nil
+}
+
+// ListSpecs lists the built-in specs and those of the tenant, by ID.
+func (s *redisConnectorSpecStore) ListSpecs(ctx context.Context, tenantID string) ([]*model.ConnectorSpec, error) {
+	defer observeOp(dynamoConnectorLatency, "spec_list", time.Now())
+
+	values, err := s.client.HGetAll(ctx, connectorSpecsKey(tenantID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]*model.ConnectorSpec, 0, len(s.builtIn)+len(values))
+	for _, spec := range s.builtIn {
+		specs = append(specs, spec)
+	}
+
+	for id, value := range values {
+		spec, err := parseStoredSpec(tenantID, value)
+		if err != nil {
+			return nil, fmt.Errorf("parse connector spec %s: %w", id, err)
+		}
+		specs = append(specs, spec)
+	}
+
+	sort.Slice(specs, func(i, j int) bool { return specs[i].ID < specs[j].ID })
+
+	return specs, nil
+}
+
+// GetSpec gets a built-in spec or one of the tenant's, or nil if it doesn't exist.
+func (s *redisConnectorSpecStore) GetSpec(ctx context.Context, tenantID string, id string) (*model.ConnectorSpec, error) {
+	if spec, ok := s.builtIn[id]; ok {
+		return spec, nil
+	}
+
+	defer observeOp(dynamoConnectorLatency, "spec_get", time.Now())
+
+	value, err := s.client.HGet(ctx, connectorSpecsKey(tenantID), id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := parseStoredSpec(tenantID, value)
+	if err != nil {
+		return nil, fmt.Errorf("parse connector spec %s: %w", id, err)
+	}
+
+	return spec, nil
+}
+
+// IsBuiltIn gets whether the spec with the ID is built in.
+func (s *redisConnectorSpecStore) IsBuiltIn(id string) bool {
+	_, ok := s.builtIn[id]
+	return ok
+}
+
+// SaveSpec creates or replaces a spec of the tenant.
+func (s *redisConnectorSpecStore) SaveSpec(ctx context.Context, spec *model.ConnectorSpec) error {
+	if s.IsBuiltIn(spec.ID) {
+		return fmt.Errorf("connector spec %s is built in", spec.ID)
+	}
+
+	defer observeOp(dynamoConnectorLatency, "spec_save", time.Now())
+
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	return s.client.HSet(ctx, connectorSpecsKey(spec.TenantID), spec.ID, raw).Err()
+}
+
+// PurgeOrg removes all of the tenant's specs.
+func (s *redisConnectorSpecStore) PurgeOrg(ctx context.Context, tenantID string) error {
+	defer observeOp(dynamoConnectorLatency, "spec_purge", time.Now())
+	return s.client.Del(ctx, connectorSpecsKey(tenantID)).Err()
+}
+
+// connectorSpecsKey returns the key of the hash of a tenant's specs.
+func connectorSpecsKey(tenantID string) string {
+	return keyPrefix + "{" + tenantID + "}:connector-specs"
+}
+
+// parseStoredSpec parses a spec of the tenant as stored in Redis.
+func parseStoredSpec(tenantID string, value string) (*model.ConnectorSpec, error) {
+	spec := &model.ConnectorSpec{}
+	if err := json.Unmarshal([]byte(value), spec); err != nil {
+		return nil, err
+	}
+	spec.TenantID = tenantID
+
+	return spec, nil
+}
+
+// loadBuiltInSpecs loads the specs in dir, keyed by ID.
+func loadBuiltInSpecs(dir string) (map[string]*model.ConnectorSpec, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make(map[string]*model.ConnectorSpec, len(files))
+	for _, f := range files {
+		raw, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f, err)
+		}
+
+		spec := &model.ConnectorSpec{}
+		if err := json.Unmarshal(raw, spec); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", f, err)
+		}
+		if spec.ID == "" {
+			return nil, fmt.Errorf("%s has no id", f)
+		}
+
+		specs[spec.ID] = spec
+	}
+
+	return specs, nil
+}
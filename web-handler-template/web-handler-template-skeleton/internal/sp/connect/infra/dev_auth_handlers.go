@@ -0,0 +1,87 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/application"
+	"github.com/sailpoint/atlas-go/atlas/config"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/atlas-go/atlas/web"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/devauth"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// devTokenPath is the path of the development token endpoint, which is served only with DEV_AUTH_ENABLED.
+const devTokenPath = "/dev/token"
+
+// devTokenResponse is the response of the development token endpoint, in the shape of an OAuth token response.
+type devTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// withDevAuth is an atlas option that, with DEV_AUTH_ENABLED, validates tokens issued by the service's
+// development token endpoint instead of ATLAS_JWT_KEY, and summarizes access from DEV_AUTH_RIGHTS_FILE
+// instead of AMS. It fails outside of development, so the service refuses to start.
+func (s *ConnectService) withDevAuth() application.ConfigurationOption {
+	return func(app *application.Application) error {
+		if app.Config == nil {
+			if err := application.WithDefaultConfig()(app); err != nil {
+				return err
+			}
+		}
+
+		enabled, err := devauth.Enabled(app.Config)
+		if err != nil || !enabled {
+			return err
+		}
+
+		// Without DEV_AUTH_KEY, a key is generated and tokens are only valid until restart.
+		s.devIssuer, err = devauth.NewIssuer(config.GetHex(app.Config, "DEV_AUTH_KEY", nil))
+		if err != nil {
+			return err
+		}
+		app.TokenValidator = s.devIssuer.Validator()
+
+		if path := config.GetString(app.Config, "DEV_AUTH_RIGHTS_FILE", ""); path != "" {
+			app.AccessSummarizer, err = devauth.LoadSummarizer(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Warnf(context.Background(), "development authentication is enabled; tokens are issued at POST %s", devTokenPath)
+		return nil
+	}
+}
+
+// issueDevToken issues a token with the requested tenant, identity and authorities. It isn't
+// authenticated, and is only served with DEV_AUTH_ENABLED.
+func (s *ConnectService) issueDevToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req devauth.TokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteJSONWithError(ctx, w, model.NewBadRequestError("invalid token request: %v", err))
+			return
+		}
+
+		token, err := s.devIssuer.Issue(req)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, devTokenResponse{
+			AccessToken: token.Encoded,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(time.Until(token.Expiration).Seconds()),
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package devauth issues tokens signed with a local key and summarizes their access from a file, so
+// that authentication and rights checks work offline, without the SSM-hosted signing key or AMS. It is
+// for development only: Enabled refuses it when ATLAS_PRODUCTION is set.
+package devauth
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sailpoint/atlas-go/atlas/auth"
+	"github.com/sailpoint/atlas-go/atlas/config"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// Token lifetimes. Tokens are issued for DefaultTTL unless the request asks for another lifetime;
+// longer lifetimes than MaxTTL are cut to it.
+const (
+	DefaultTTL = time.Hour
+	MaxTTL     = 24 * time.Hour
+)
+
+// DefaultPod is the pod of tokens whose request doesn't specify one.
+const DefaultPod = "dev"
+
+// ErrProduction is returned by Enabled when development authentication is enabled in production.
+var ErrProduction = errors.New("DEV_AUTH_ENABLED must not be set when ATLAS_PRODUCTION is true")
+
+// Enabled gets whether development authentication is enabled by DEV_AUTH_ENABLED. It fails with
+// ErrProduction if it's enabled and ATLAS_PRODUCTION isn't explicitly false.
+func Enabled(cfg config.Source) (bool, error) {
+	if !config.GetBool(cfg, "DEV_AUTH_ENABLED", false) {
+		return false, nil
+	}
+
+	// atlas treats an unset ATLAS_PRODUCTION as production, and so does this check.
+	if config.GetBool(cfg, "ATLAS_PRODUCTION", true) {
+		return false, ErrProduction
+	}
+
+	return true, nil
+}
+
+// TokenRequest is a request for a token with the chosen tenant, identity and authorities.
+type TokenRequest struct {
+	TenantID     string   `json:"tenantId"`
+	Pod          string   `json:"pod"`
+	Org          string   `json:"org"`
+	IdentityID   string   `json:"identityId"`
+	IdentityName string   `json:"identityName"`
+	ClientID     string   `json:"clientId"`
+	Authorities  []string `json:"authorities"`
+
+	// ExpiresIn is the lifetime of the token in seconds, or 0 for DefaultTTL. It's at most MaxTTL.
+	ExpiresIn int `json:"expiresIn"`
+}
+
+// Token is an issued token.
+type Token struct {
+	Encoded    string
+	Expiration time.Time
+}
+
+// Issuer issues tokens signed with its key, and validates them.
+type Issuer struct {
+	key []byte
+	now func() time.Time
+}
+
+// NewIssuer constructs a new Issuer that signs tokens with key. If key is empty, a random key is
+// generated, so tokens are only valid until the service restarts.
+func NewIssuer(key []byte) (*Issuer, error) {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("generate signing key: %w", err)
+		}
+	}
+
+	return &Issuer{key: key, now: time.Now}, nil
+}
+
+// Validator returns a TokenValidator that accepts the issuer's tokens.
+func (i *Issuer) Validator() auth.TokenValidator {
+	return auth.NewComposedTokenValidator(i.key, jwt.SigningMethodHS256)
+}
+
+// Issue issues a token for the request. The org and either an identity or a client are required.
+func (i *Issuer) Issue(req TokenRequest) (*Token, error) {
+	if req.Org == "" {
+		return nil, model.NewBadRequestError("org is required")
+	}
+	if req.IdentityID == "" && req.ClientID == "" {
+		return nil, model.NewBadRequestError("identityId or clientId is required")
+	}
+
+	ttl := DefaultTTL
+	if req.ExpiresIn < 0 {
+		return nil, model.NewBadRequestError("expiresIn must not be negative")
+	}
+	// The lifetime is clamped in seconds, so that a huge expiresIn can't overflow the duration.
+	if req.ExpiresIn > int(MaxTTL.Seconds()) {
+		ttl = MaxTTL
+	} else if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	pod := req.Pod
+	if pod == "" {
+		pod = DefaultPod
+	}
+
+	// Orgs are their own tenants unless the request says otherwise.
+	tenantID := req.TenantID
+	if tenantID == "" {
+		tenantID = req.Org
+	}
+
+	expiration := i.now().Add(ttl).Truncate(time.Second)
+	claims := jwt.MapClaims{
+		"tenant_id": tenantID,
+		"pod":       pod,
+		"org":       req.Org,
+		"exp":       expiration.Unix(),
+	}
+	if req.IdentityID != "" {
+		claims["identity_id"] = req.IdentityID
+		claims["user_name"] = req.IdentityName
+		if req.IdentityName == "" {
+			claims["user_name"] = req.IdentityID
+		}
+	}
+	if req.ClientID != "" {
+		claims["client_id"] = req.ClientID
+	}
+	if len(req.Authorities) > 0 {
+		claims["authorities"] = req.Authorities
+	}
+
+	encoded, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(i.key)
+	if err != nil {
+		return nil, fmt.Errorf("sign token: %w", err)
+	}
+
+	return &Token{Encoded: encoded, Expiration: expiration}, nil
+}
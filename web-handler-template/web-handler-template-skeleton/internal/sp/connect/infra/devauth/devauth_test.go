@@ -0,0 +1,158 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/atlas-go/atlas/auth"
+	"github.com/sailpoint/atlas-go/atlas/auth/access"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeConfig map[string]string
+
+func (c fakeConfig) GetString(key string) string {
+	return c[key]
+}
+
+func TestEnabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     fakeConfig
+		enabled bool
+		err     error
+	}{
+		{"disabled", fakeConfig{}, false, nil},
+		{"production by default", fakeConfig{"DEV_AUTH_ENABLED": "true"}, false, ErrProduction},
+		{"production", fakeConfig{"DEV_AUTH_ENABLED": "true", "ATLAS_PRODUCTION": "true"}, false, ErrProduction},
+		{"development", fakeConfig{"DEV_AUTH_ENABLED": "true", "ATLAS_PRODUCTION": "false"}, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enabled, err := Enabled(tt.cfg)
+			if enabled != tt.enabled || !errors.Is(err, tt.err) {
+				t.Errorf("expected (%v, %v), got (%v, %v)", tt.enabled, tt.err, enabled, err)
+			}
+		})
+	}
+}
+
+func TestIssue(t *testing.T) {
+	issuer, err := NewIssuer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := issuer.Issue(TokenRequest{
+		Org:         "acme-solar",
+		IdentityID:  "2c9180835d2e5168015d32f890ca1581",
+		Authorities: []string{"ORG_ADMIN"},
+		ExpiresIn:   600,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := issuer.Validator().Parse(token.Encoded)
+	if err != nil {
+		t.Fatalf("expected the issuer's token to be valid: %v", err)
+	}
+
+	if parsed.Org != "acme-solar" || parsed.TenantID != "acme-solar" || parsed.Pod != DefaultPod {
+		t.Errorf("unexpected org context %s/%s/%s", parsed.TenantID, parsed.Pod, parsed.Org)
+	}
+	if parsed.IdentityID != "2c9180835d2e5168015d32f890ca1581" || parsed.IdentityName != "2c9180835d2e5168015d32f890ca1581" {
+		t.Errorf("unexpected identity %s (%s)", parsed.IdentityID, parsed.IdentityName)
+	}
+	if !reflect.DeepEqual(parsed.Authorities, []auth.Authority{"ORG_ADMIN"}) {
+		t.Errorf("unexpected authorities %v", parsed.Authorities)
+	}
+	if !parsed.Expiration.Equal(token.Expiration) || time.Until(token.Expiration) > 10*time.Minute {
+		t.Errorf("unexpected expiration %v", parsed.Expiration)
+	}
+
+	other, _ := NewIssuer(nil)
+	if _, err := other.Validator().Parse(token.Encoded); err == nil {
+		t.Error("expected a token signed with another key to be rejected")
+	}
+}
+
+func TestIssueInvalid(t *testing.T) {
+	issuer, _ := NewIssuer([]byte("key"))
+
+	for _, req := range []TokenRequest{
+		{IdentityID: "alice"},
+		{Org: "acme-solar"},
+		{Org: "acme-solar", IdentityID: "alice", ExpiresIn: -1},
+	} {
+		var badRequest *model.BadRequestError
+		if _, err := issuer.Issue(req); !errors.As(err, &badRequest) {
+			t.Errorf("%+v: expected a bad request, got %v", req, err)
+		}
+	}
+}
+
+func TestIssueClampsTheLifetime(t *testing.T) {
+	issuer, _ := NewIssuer([]byte("key"))
+
+	for _, expiresIn := range []int{int(MaxTTL.Seconds()) + 1, math.MaxInt64 / 1000} {
+		token, err := issuer.Issue(TokenRequest{Org: "acme-solar", IdentityID: "alice", ExpiresIn: expiresIn})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ttl := time.Until(token.Expiration); ttl > MaxTTL+time.Second || ttl < MaxTTL-time.Minute {
+			t.Errorf("expiresIn %d: expected the token to expire in %v, got %v", expiresIn, MaxTTL, ttl)
+		}
+	}
+}
+
+func TestFileSummarizer(t *testing.T) {
+	s, err := NewSummarizer(RightsFile{
+		RightSets: map[access.RightSetID][]access.Right{
+			"sp:connector-admin": {"sp:connector:read", "sp:connector:create"},
+		},
+		Identities: map[string]Grant{
+			"alice":     {RightSets: []access.RightSetID{"sp:connector-admin"}, Rights: []access.Right{"sp:connector:read", "sp:connector:invoke"}},
+			"ci-client": {Rights: []access.Right{"sp:connector:invoke"}},
+		},
+		Default: &Grant{Rights: []access.Right{"sp:connector:read"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  *auth.Token
+		rights []access.Right
+	}{
+		{"identity", &auth.Token{IdentityID: "alice"}, []access.Right{"sp:connector:read", "sp:connector:create", "sp:connector:invoke"}},
+		{"identity name", &auth.Token{IdentityID: "2c91", IdentityName: atlas.IdentityName("alice")}, []access.Right{"sp:connector:read", "sp:connector:create", "sp:connector:invoke"}},
+		{"client", &auth.Token{ClientID: "ci-client"}, []access.Right{"sp:connector:invoke"}},
+		{"default", &auth.Token{IdentityID: "bob"}, []access.Right{"sp:connector:read"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := s.Summarize(context.Background(), tt.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(summary.FlattenedRights, tt.rights) {
+				t.Errorf("expected %v, got %v", tt.rights, summary.FlattenedRights)
+			}
+		})
+	}
+
+	if _, err := NewSummarizer(RightsFile{Identities: map[string]Grant{"alice": {RightSets: []access.RightSetID{"missing"}}}}); err == nil {
+		t.Error("expected an undefined right set to be rejected")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package devauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/sailpoint/atlas-go/atlas/auth"
+	"github.com/sailpoint/atlas-go/atlas/auth/access"
+)
+
+// RightsFile maps identities to rights, in place of AMS. For example:
+//
+//	{
+//	  "rightSets": {"sp:connector-admin": ["sp:connector:read", "sp:connector:create"]},
+//	  "identities": {"alice": {"rightSets": ["sp:connector-admin"], "rights": ["sp:connector:invoke"]}},
+//	  "default": {"rights": ["sp:connector:read"]}
+//	}
+type RightsFile struct {
+
+	// RightSets defines named sets of rights that identities can be granted together.
+	RightSets map[access.RightSetID][]access.Right `json:"rightSets"`
+
+	// Identities holds the access of each identity, keyed by its identity ID, identity name or client ID.
+	Identities map[string]Grant `json:"identities"`
+
+	// Default is the access of identities that aren't listed. If it's nil, they have no rights.
+	Default *Grant `json:"default,omitempty"`
+}
+
+// Grant is the access granted to an identity.
+type Grant struct {
+	RightSets []access.RightSetID `json:"rightSets"`
+	Rights    []access.Right      `json:"rights"`
+}
+
+// FileSummarizer is an access Summarizer that summarizes tokens' access from a RightsFile.
+type FileSummarizer struct {
+	file RightsFile
+}
+
+// NewSummarizer constructs a new FileSummarizer, failing if a grant refers to an undefined right set.
+func NewSummarizer(file RightsFile) (*FileSummarizer, error) {
+	grants := make(map[string]Grant, len(file.Identities)+1)
+	for id, g := range file.Identities {
+		grants[id] = g
+	}
+	if file.Default != nil {
+		grants["default"] = *file.Default
+	}
+
+	for id, g := range grants {
+		for _, rs := range g.RightSets {
+			if _, ok := file.RightSets[rs]; !ok {
+				return nil, fmt.Errorf("%s: undefined right set %q", id, rs)
+			}
+		}
+	}
+
+	return &FileSummarizer{file: file}, nil
+}
+
+// LoadSummarizer constructs a new FileSummarizer from the RightsFile at path.
+func LoadSummarizer(path string) (*FileSummarizer, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file RightsFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	s, err := NewSummarizer(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// Summarize builds the access summary of the token from the grant of its identity ID, identity name
+// or client ID, in that order, or the default grant.
+func (s *FileSummarizer) Summarize(ctx context.Context, t *auth.Token) (*access.Summary, error) {
+	summary := &access.Summary{RightSets: []access.RightSetID{}, FlattenedRights: []access.Right{}}
+
+	g, ok := s.grant(t)
+	if !ok {
+		return summary, nil
+	}
+
+	seen := map[access.Right]bool{}
+	add := func(rights []access.Right) {
+		for _, r := range rights {
+			if !seen[r] {
+				seen[r] = true
+				summary.FlattenedRights = append(summary.FlattenedRights, r)
+			}
+		}
+	}
+
+	for _, rs := range g.RightSets {
+		summary.RightSets = append(summary.RightSets, rs)
+		add(s.file.RightSets[rs])
+	}
+	add(g.Rights)
+
+	return summary, nil
+}
+
+// grant finds the grant of the token's identity.
+func (s *FileSummarizer) grant(t *auth.Token) (Grant, bool) {
+	for _, id := range []string{string(t.IdentityID), string(t.IdentityName), t.ClientID} {
+		if id == "" {
+			continue
+		}
+		if g, ok := s.file.Identities[id]; ok {
+			return g, true
+		}
+	}
+
+	if s.file.Default != nil {
+		return *s.file.Default, true
+	}
+
+	return Grant{}, false
+}
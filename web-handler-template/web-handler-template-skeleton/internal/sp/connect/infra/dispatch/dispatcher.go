@@ -0,0 +1,167 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package dispatch routes runtime commands to the runtimes that execute them. Commands normally go to
+// the shared queue that runtimes claim from, but in Beacon mode a developer can register a runtime
+// running on their machine for an org, and that org's commands are then sent straight to it.
+package dispatch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/atlas-go/atlas/beacon"
+	"github.com/sailpoint/atlas-go/atlas/client"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// The targets of a Route.
+const (
+	TargetQueue  = "queue"
+	TargetBeacon = "beacon"
+)
+
+// Executor sends a command to an HTTP endpoint and reports its results.
+type Executor interface {
+	Execute(ctx context.Context, org atlas.Org, endpoint string, cmd *model.RuntimeCommand) error
+}
+
+// Route describes where the commands of an org are sent.
+type Route struct {
+	Org    string `json:"org"`
+	Target string `json:"target"`
+
+	// URL is the endpoint commands are posted to, when the target is Beacon.
+	URL string `json:"url,omitempty"`
+
+	// The details of the Beacon registration, when the target is Beacon.
+	RegistrationID string    `json:"registrationId,omitempty"`
+	Hostname       string    `json:"hostname,omitempty"`
+	Created        time.Time `json:"created,omitempty"`
+}
+
+// Dispatcher sends runtime commands to the shared queue, or to a developer's runtime registered in
+// Beacon for the command's org.
+type Dispatcher struct {
+	queue     model.RuntimeCommandQueue
+	registrar beacon.Registrar
+	locator   client.ServiceLocator
+	executor  Executor
+	service   beacon.ServiceID
+}
+
+// unlocated is a ServiceLocator that doesn't locate any service, so that the Beacon locator that
+// wraps it only finds registered services.
+type unlocated struct{}
+
+// GetURL returns an empty URL.
+func (unlocated) GetURL(org atlas.Org, service string) string {
+	return ""
+}
+
+// NewDispatcher constructs a new Dispatcher. Local runtimes register in Beacon under the service ID;
+// with a nil registrar, every command goes to the queue.
+func NewDispatcher(queue model.RuntimeCommandQueue, registrar beacon.Registrar, executor Executor, service string) *Dispatcher {
+	d := &Dispatcher{}
+	d.queue = queue
+	d.registrar = registrar
+	d.executor = executor
+	d.service = beacon.ServiceID(service)
+
+	if registrar != nil {
+		d.locator = client.NewBeaconServiceLocator(unlocated{}, registrar)
+	}
+
+	return d
+}
+
+// BeaconEnabled gets whether commands can be routed to runtimes registered in Beacon.
+func (d *Dispatcher) BeaconEnabled() bool {
+	return d.locator != nil
+}
+
+// Dispatch sends the command of an org on its way. Commands routed to Beacon are executed in the
+// background, with failures reported to the result handler like those of any other execution.
+func (d *Dispatcher) Dispatch(ctx context.Context, org atlas.Org, cmd *model.RuntimeCommand) error {
+	endpoint := d.endpoint(org)
+	if endpoint == "" {
+		return d.queue.Dispatch(ctx, cmd)
+	}
+
+	log.Infof(ctx, "routing invocation %s to beacon runtime at %s", cmd.InvocationID, endpoint)
+
+	// The execution outlives the dispatching request, so it only keeps the request's span, to continue
+	// its trace, its log fields and its request context, which the events of the invocation's
+	// results are published for.
+	execCtx := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+	execCtx = log.WithFields(execCtx, zap.String("org", string(org)), zap.String("invocation_id", cmd.InvocationID))
+	if rc := atlas.GetRequestContext(ctx); rc != nil {
+		execCtx = atlas.WithRequestContext(execCtx, rc)
+	}
+	go func() {
+		if err := d.executor.Execute(execCtx, org, endpoint, cmd); err != nil {
+			log.Warnf(execCtx, "execute invocation on beacon runtime: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// Routes lists the active Beacon registrations of local runtimes and where each routes commands,
+// sorted by org.
+func (d *Dispatcher) Routes() ([]*Route, error) {
+	if d.registrar == nil {
+		return []*Route{}, nil
+	}
+
+	registrations, err := d.registrar.FindAllByService(d.service)
+	if err != nil {
+		return nil, fmt.Errorf("find beacon registrations: %w", err)
+	}
+
+	routes := make([]*Route, 0, len(registrations))
+	for _, r := range registrations {
+		routes = append(routes, &Route{
+			Org:            string(r.TenantID),
+			Target:         TargetBeacon,
+			URL:            d.endpoint(atlas.Org(r.TenantID)),
+			RegistrationID: string(r.ID),
+			Hostname:       r.Hostname,
+			Created:        r.Created,
+		})
+	}
+
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Org < routes[j].Org })
+
+	return routes, nil
+}
+
+// Route gets where the commands of an org are sent.
+func (d *Dispatcher) Route(org atlas.Org) *Route {
+	endpoint := d.endpoint(org)
+	if endpoint == "" {
+		return &Route{Org: string(org), Target: TargetQueue}
+	}
+
+	return &Route{Org: string(org), Target: TargetBeacon, URL: endpoint}
+}
+
+// endpoint gets the URL commands of the org are posted to, or "" if the org has no local runtime.
+func (d *Dispatcher) endpoint(org atlas.Org) string {
+	if d.locator == nil {
+		return ""
+	}
+
+	url := d.locator.GetURL(org, string(d.service))
+	if url == "" {
+		return ""
+	}
+
+	return strings.TrimSuffix(url, "/") + "/commands"
+}
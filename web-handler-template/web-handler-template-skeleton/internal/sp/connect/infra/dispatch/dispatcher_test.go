@@ -0,0 +1,151 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package dispatch
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/atlas-go/atlas/beacon"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/tracing"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fakeRegistrar struct {
+	registrations []*beacon.Registration
+}
+
+func (r *fakeRegistrar) Register(request beacon.RegistrationRequest) (*beacon.Registration, error) {
+	return nil, beacon.ErrNotImplemented
+}
+
+func (r *fakeRegistrar) Heartbeat(registrationID beacon.RegistrationID) (bool, error) {
+	return false, beacon.ErrNotImplemented
+}
+
+func (r *fakeRegistrar) Cancel(registrationID beacon.RegistrationID) error {
+	return beacon.ErrNotImplemented
+}
+
+func (r *fakeRegistrar) FindAllByService(serviceID beacon.ServiceID) ([]*beacon.Registration, error) {
+	var found []*beacon.Registration
+	for _, reg := range r.registrations {
+		if reg.ServiceID == serviceID {
+			found = append(found, reg)
+		}
+	}
+	return found, nil
+}
+
+func (r *fakeRegistrar) FindByTenantAndService(tenantID beacon.TenantID, serviceID beacon.ServiceID) (*beacon.Registration, error) {
+	for _, reg := range r.registrations {
+		if reg.TenantID == tenantID && reg.ServiceID == serviceID {
+			return reg, nil
+		}
+	}
+	return nil, nil
+}
+
+type fakeQueue struct {
+	model.RuntimeCommandQueue
+	dispatched []string
+}
+
+func (q *fakeQueue) Dispatch(ctx context.Context, cmd *model.RuntimeCommand) error {
+	q.dispatched = append(q.dispatched, cmd.InvocationID)
+	return nil
+}
+
+type execution struct {
+	org      atlas.Org
+	endpoint string
+	cmd      *model.RuntimeCommand
+	span     trace.SpanContext
+	err      error
+}
+
+type fakeExecutor chan execution
+
+func (e fakeExecutor) Execute(ctx context.Context, org atlas.Org, endpoint string, cmd *model.RuntimeCommand) error {
+	e <- execution{org, endpoint, cmd, trace.SpanContextFromContext(ctx), ctx.Err()}
+	return nil
+}
+
+var testRegistrar = &fakeRegistrar{registrations: []*beacon.Registration{
+	{ID: "reg-2", TenantID: "zeta", ServiceID: "sp-connect-runtime", Hostname: "laptop-2", Connection: "10.0.0.2:7100"},
+	{ID: "reg-1", TenantID: "acme", ServiceID: "sp-connect-runtime", Hostname: "laptop-1", Connection: "10.0.0.1:7100", Created: time.Unix(0, 0)},
+	{ID: "reg-3", TenantID: "acme", ServiceID: "sp-scheduler", Hostname: "laptop-1", Connection: "10.0.0.1:7200"},
+}}
+
+func TestDispatchRoutesToBeaconRuntime(t *testing.T) {
+	queue := &fakeQueue{}
+	executor := make(fakeExecutor, 1)
+	d := NewDispatcher(queue, testRegistrar, executor, "sp-connect-runtime")
+
+	// The execution continues the dispatching request's trace, but outlives the request.
+	ctx, span := tracing.NewProvider("test", tracing.NewWriterExporter(ioutil.Discard)).Tracer("test").Start(context.Background(), "invoke")
+	ctx, cancel := context.WithCancel(ctx)
+	err := d.Dispatch(ctx, "acme", &model.RuntimeCommand{InvocationID: "inv-1"})
+	cancel()
+	span.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-executor:
+		if e.org != "acme" || e.endpoint != "http://10.0.0.1:7100/commands" || e.cmd.InvocationID != "inv-1" {
+			t.Errorf("unexpected execution: %+v", e)
+		}
+		if !e.span.IsValid() || e.span.SpanID != span.SpanContext().SpanID || e.err != nil {
+			t.Errorf("expected the execution to continue the request's span without its cancellation, got %+v, %v", e.span, e.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("command wasn't sent to the beacon runtime")
+	}
+
+	if err := d.Dispatch(context.Background(), "other", &model.RuntimeCommand{InvocationID: "inv-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.dispatched) != 1 || queue.dispatched[0] != "inv-2" {
+		t.Errorf("expected inv-2 to be queued, got %v", queue.dispatched)
+	}
+}
+
+func TestDispatchWithoutBeacon(t *testing.T) {
+	queue := &fakeQueue{}
+	d := NewDispatcher(queue, nil, make(fakeExecutor), "sp-connect-runtime")
+
+	if err := d.Dispatch(context.Background(), "acme", &model.RuntimeCommand{InvocationID: "inv-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.dispatched) != 1 {
+		t.Errorf("expected the command to be queued, got %v", queue.dispatched)
+	}
+
+	routes, err := d.Routes()
+	if err != nil || len(routes) != 0 || d.BeaconEnabled() {
+		t.Errorf("unexpected routes: %v %v", routes, err)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	d := NewDispatcher(&fakeQueue{}, testRegistrar, make(fakeExecutor), "sp-connect-runtime")
+
+	routes, err := d.Routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 2 || routes[0].Org != "acme" || routes[0].RegistrationID != "reg-1" || routes[0].Hostname != "laptop-1" ||
+		routes[0].URL != "http://10.0.0.1:7100/commands" || routes[1].Org != "zeta" || routes[1].Target != TargetBeacon {
+		t.Errorf("unexpected routes: %+v %+v", routes[0], routes[1])
+	}
+
+	if r := d.Route("other"); r.Target != TargetQueue || r.URL != "" {
+		t.Errorf("unexpected route: %+v", r)
+	}
+}
@@ -0,0 +1,441 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	mapset "github.com/deckarep/golang-set"
+	"github.com/sailpoint/atlas-go/atlas/dynamoutil"
+	"github.com/sailpoint/atlas-go/atlas/event"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/atlas-go/atlas/web"
+	"github.com/sailpoint/saas-kafka-artifacts"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/filter"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// auditEventType is the type of the events published to the audit topic.
+const auditEventType = "sp_connect_audit"
+
+// auditSortKeyFormat is a fixed-width UTC timestamp format, so that sort keys and timestamps order
+// chronologically as strings.
+const auditSortKeyFormat = "2006-01-02T15:04:05.000000000Z"
+
+// auditQueryPageSize is the most items read by each query of a list.
+const auditQueryPageSize = 500
+
+// purgeQueryPageSize is the most keys read by each query of a purge.
+const purgeQueryPageSize = 500
+
+// dynamoBatchWriteSize is the most items Dynamo writes in one batch.
+const dynamoBatchWriteSize = 25
+
+// auditAttributes maps the queryable V3 properties of an audit record to their item attributes.
+var auditAttributes = map[string]string{
+	"id":           "id",
+	"actor":        "actor",
+	"action":       "action",
+	"resourceType": "resourceType",
+	"resourceId":   "resourceId",
+	"timestamp":    "timestamp",
+}
+
+// auditQueryableFields and auditSortableFields are the V3 properties GET /audit can filter and sort by.
+var (
+	auditQueryableFields = mapset.NewSet("id", "actor", "action", "resourceType", "resourceId", "timestamp")
+	auditSortableFields  = mapset.NewSet("actor", "action", "resourceType", "resourceId", "timestamp")
+)
+
+// dynamoAuditLog is an AuditRecorder that keeps audit records in Dynamo, partitioned by tenant and
+// sorted by time, and publishes each record to the AUDIT topic.
+//
+// When the outbox is configured the record and its event are written in one transaction, so that
+// a record is persisted if and only if it will eventually be published. Otherwise the record is
+// published directly after it is persisted. Without a table, records are only published.
+//
+// Records expire from the table after the retention period, through the TTL attribute "expiresAt".
+type dynamoAuditLog struct {
+	client    auditDynamoAPI
+	table     string
+	retention time.Duration
+	outbox    *dynamoOutbox
+	publisher event.Publisher
+}
+
+// auditDynamoAPI is the subset of the Dynamo API used by dynamoAuditLog; it's implemented by
+// *dynamodb.DynamoDB.
+type auditDynamoAPI interface {
+	PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error)
+	TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error)
+	QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error)
+	BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// newDynamoAuditLog constructs a new dynamoAuditLog. The table and outbox are optional.
+func newDynamoAuditLog(client auditDynamoAPI, table string, retention time.Duration, outbox *dynamoOutbox, publisher event.Publisher) *dynamoAuditLog {
+	l := &dynamoAuditLog{}
+	l.client = client
+	l.table = table
+	l.retention = retention
+	l.outbox = outbox
+	l.publisher = publisher
+
+	return l
+}
+
+// Record persists the audit record and publishes it to the AUDIT topic.
+func (l *dynamoAuditLog) Record(ctx context.Context, record *model.AuditRecord) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	e := event.NewEventJSON(auditEventType, string(content), eventHeaders(ctx, record.ResourceID))
+
+	timestamp := record.Timestamp.UTC().Format(auditSortKeyFormat)
+	item := map[string]*dynamodb.AttributeValue{
+		"tenantId":     dynamoutil.StringAttribute(record.TenantID),
+		"sortKey":      dynamoutil.StringAttribute(timestamp + "#" + record.ID),
+		"id":           dynamoutil.StringAttribute(record.ID),
+		"actor":        dynamoutil.StringAttribute(record.Actor),
+		"action":       dynamoutil.StringAttribute(string(record.Action)),
+		"resourceType": dynamoutil.StringAttribute(string(record.ResourceType)),
+		"resourceId":   dynamoutil.StringAttribute(record.ResourceID),
+		"timestamp":    dynamoutil.StringAttribute(timestamp),
+		"diff":         dynamoutil.StringAttribute(string(record.Diff)),
+		"expiresAt":    dynamoutil.EpochTimeAttribute(record.Timestamp.Add(l.retention)),
+	}
+
+	defer observeOp(dynamoConnectorLatency, "audit_record", time.Now())
+
+	if l.table != "" && l.outbox != nil {
+		entry, err := l.outbox.Put(ctx, topics.IdnTopic.AUDIT, e)
+		if err != nil {
+			return err
+		}
+
+		_, err = l.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: []*dynamodb.TransactWriteItem{
+				{Put: &dynamodb.Put{TableName: aws.String(l.table), Item: item}},
+				entry,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("record audit %s: %w", record.ID, err)
+		}
+
+		return nil
+	}
+
+	if l.table != "" {
+		if _, err := l.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{TableName: aws.String(l.table), Item: item}); err != nil {
+			return fmt.Errorf("record audit %s: %w", record.ID, err)
+		}
+	}
+
+	start := time.Now()
+	err = l.publisher.Publish(ctx, topics.IdnTopic.AUDIT, e)
+	observe(publishKafkaLatency, start)
+	if err != nil {
+		return fmt.Errorf("publish audit %s: %w", record.ID, err)
+	}
+
+	return nil
+}
+
+// Persisted gets whether records are persisted, and can therefore be listed.
+func (l *dynamoAuditLog) Persisted() bool {
+	return l.table != ""
+}
+
+// List returns the page of a tenant's audit records selected by the query options, along with the
+// total number of records that matched the filters if count is set, or -1 otherwise. The filters
+// must come from the builder returned by auditFilterBuilder; they're applied by Dynamo.
+//
+// Records sorted by timestamp, the default, are read in sort key order and only until the page is
+// full. Any other sort needs every matching record, which is sorted and paged in memory.
+func (l *dynamoAuditLog) List(ctx context.Context, tenantID string, options *web.QueryOptions, count bool) ([]*model.AuditRecord, int, error) {
+	defer observeOp(dynamoConnectorLatency, "audit_list", time.Now())
+
+	input, err := l.queryInput(tenantID, options)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ascending, inOrder := auditTimestampOrder(options.Sorters)
+	if !inOrder {
+		return l.listSorted(ctx, input, options)
+	}
+
+	input.ScanIndexForward = aws.Bool(ascending)
+
+	records := make([]*model.AuditRecord, 0, options.Limit)
+	skip := options.Offset
+	err = l.query(ctx, input, func(record *model.AuditRecord) bool {
+		if skip > 0 {
+			skip--
+			return true
+		}
+
+		records = append(records, record)
+		return len(records) < options.Limit
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := -1
+	if count {
+		if total, err = l.count(ctx, input); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return records, total, nil
+}
+
+// listSorted reads every matching record, then sorts and pages them in memory.
+func (l *dynamoAuditLog) listSorted(ctx context.Context, input *dynamodb.QueryInput, options *web.QueryOptions) ([]*model.AuditRecord, int, error) {
+	var records []*model.AuditRecord
+	var properties []filter.Properties
+
+	err := l.query(ctx, input, func(record *model.AuditRecord) bool {
+		records = append(records, record)
+		properties = append(properties, filter.Properties{
+			"actor":        record.Actor,
+			"action":       string(record.Action),
+			"resourceType": string(record.ResourceType),
+			"resourceId":   record.ResourceID,
+			"timestamp":    record.Timestamp,
+		})
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page := *options
+	page.Filters = nil
+
+	indexes, total, err := filter.Query(properties, &page)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]*model.AuditRecord, 0, len(indexes))
+	for _, i := range indexes {
+		result = append(result, records[i])
+	}
+
+	return result, total, nil
+}
+
+// queryInput builds the query of a tenant's records that match the filters of the options.
+func (l *dynamoAuditLog) queryInput(tenantID string, options *web.QueryOptions) (*dynamodb.QueryInput, error) {
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(l.table),
+		KeyConditionExpression:    aws.String("#tenantId = :tenantId"),
+		ExpressionAttributeNames:  map[string]*string{"#tenantId": aws.String("tenantId")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":tenantId": dynamoutil.StringAttribute(tenantID)},
+		Limit:                     aws.Int64(auditQueryPageSize),
+	}
+
+	if f, ok := options.Filters.(*filter.DynamoFilter); ok && f != nil {
+		expression, err := f.Expression()
+		if err != nil {
+			return nil, err
+		}
+
+		input.FilterExpression = expression.FilterExpression
+		for k, v := range expression.ExpressionAttributeNames {
+			input.ExpressionAttributeNames[k] = v
+		}
+		for k, v := range expression.ExpressionAttributeValues {
+			input.ExpressionAttributeValues[k] = v
+		}
+	} else if options.Filters != nil {
+		return nil, fmt.Errorf("unexpected filter type: %T", options.Filters)
+	}
+
+	return input, nil
+}
+
+// query pages through the results of the query, passing each record to fn until it returns false.
+// Records that can't be parsed are skipped.
+func (l *dynamoAuditLog) query(ctx context.Context, input *dynamodb.QueryInput, fn func(record *model.AuditRecord) bool) error {
+	page := *input
+
+	for {
+		out, err := l.client.QueryWithContext(ctx, &page)
+		if err != nil {
+			return fmt.Errorf("query audit records: %w", err)
+		}
+
+		for _, item := range out.Items {
+			record, err := parseAuditRecord(item)
+			if err != nil {
+				log.Warnf(ctx, "skip audit record: %v", err)
+				continue
+			}
+
+			if !fn(record) {
+				return nil
+			}
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		page.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// count counts the records that match the query without reading them.
+func (l *dynamoAuditLog) count(ctx context.Context, input *dynamodb.QueryInput) (int, error) {
+	page := *input
+	page.Select = aws.String(dynamodb.SelectCount)
+	page.Limit = nil
+
+	total := 0
+	for {
+		out, err := l.client.QueryWithContext(ctx, &page)
+		if err != nil {
+			return 0, fmt.Errorf("count audit records: %w", err)
+		}
+		total += int(aws.Int64Value(out.Count))
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return total, nil
+		}
+		page.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// PurgeOrg removes all of the tenant's audit records from the table. Records already published to
+// the AUDIT topic aren't affected.
+func (l *dynamoAuditLog) PurgeOrg(ctx context.Context, tenantID string) error {
+	if l.table == "" {
+		return nil
+	}
+
+	defer observeOp(dynamoConnectorLatency, "audit_purge", time.Now())
+
+	if err := purgeTenantItems(ctx, l.client, l.table, tenantID); err != nil {
+		return fmt.Errorf("purge audit records: %w", err)
+	}
+
+	return nil
+}
+
+// tenantItemsDynamoAPI is the subset of the Dynamo API used by purgeTenantItems.
+type tenantItemsDynamoAPI interface {
+	QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error)
+	BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// purgeTenantItems deletes all of the tenant's items from a table partitioned by "tenantId" and
+// sorted by "sortKey", a page at a time.
+func purgeTenantItems(ctx context.Context, client tenantItemsDynamoAPI, table string, tenantID string) error {
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(table),
+		KeyConditionExpression:    aws.String("#tenantId = :tenantId"),
+		ProjectionExpression:      aws.String("#tenantId, sortKey"),
+		ExpressionAttributeNames:  map[string]*string{"#tenantId": aws.String("tenantId")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":tenantId": dynamoutil.StringAttribute(tenantID)},
+		Limit:                     aws.Int64(purgeQueryPageSize),
+	}
+
+	for {
+		out, err := client.QueryWithContext(ctx, input)
+		if err != nil {
+			return fmt.Errorf("query items of %s: %w", tenantID, err)
+		}
+
+		for start := 0; start < len(out.Items); start += dynamoBatchWriteSize {
+			end := start + dynamoBatchWriteSize
+			if end > len(out.Items) {
+				end = len(out.Items)
+			}
+
+			if err := deleteItems(ctx, client, table, out.Items[start:end]); err != nil {
+				return fmt.Errorf("delete items of %s: %w", tenantID, err)
+			}
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// deleteItems deletes a batch of items by key, retrying those that Dynamo leaves unprocessed.
+func deleteItems(ctx context.Context, client tenantItemsDynamoAPI, table string, keys []map[string]*dynamodb.AttributeValue) error {
+	requests := make([]*dynamodb.WriteRequest, 0, len(keys))
+	for _, key := range keys {
+		requests = append(requests, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: key}})
+	}
+
+	items := map[string][]*dynamodb.WriteRequest{table: requests}
+	for backoff := 50 * time.Millisecond; len(items) > 0; backoff *= 2 {
+		out, err := client.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{RequestItems: items})
+		if err != nil {
+			return err
+		}
+
+		items = out.UnprocessedItems
+		if len(items) > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+	}
+
+	return nil
+}
+
+// auditTimestampOrder gets whether the sorters order records by timestamp alone, the order of the
+// sort key, and if so whether it's ascending. No sorters means newest first.
+func auditTimestampOrder(sorters []web.ListSorter) (ascending bool, inOrder bool) {
+	switch {
+	case len(sorters) == 0:
+		return false, true
+	case len(sorters) == 1 && sorters[0].Property == "timestamp":
+		return sorters[0].IsAscending, true
+	}
+
+	return false, false
+}
+
+// auditFilterBuilder builds the V3 filters accepted by List. Timestamps are stored in the
+// fixed-width auditSortKeyFormat, so they're compared in it.
+func auditFilterBuilder() web.FilterBuilder {
+	return filter.NewDynamoFilterBuilder(auditAttributes).WithTimeLayout(auditSortKeyFormat)
+}
+
+// parseAuditRecord parses an audit record from a Dynamo item.
+func parseAuditRecord(item map[string]*dynamodb.AttributeValue) (*model.AuditRecord, error) {
+	record := &model.AuditRecord{}
+	record.ID = dynamoutil.GetString(item["id"])
+	record.TenantID = dynamoutil.GetString(item["tenantId"])
+	record.Actor = dynamoutil.GetString(item["actor"])
+	record.Action = model.AuditAction(dynamoutil.GetString(item["action"]))
+	record.ResourceType = model.AuditResourceType(dynamoutil.GetString(item["resourceType"]))
+	record.ResourceID = dynamoutil.GetString(item["resourceId"])
+	record.Diff = json.RawMessage(dynamoutil.GetString(item["diff"]))
+
+	timestamp, err := time.Parse(auditSortKeyFormat, dynamoutil.GetString(item["timestamp"]))
+	if err != nil {
+		return nil, fmt.Errorf("parse audit record %s: %w", record.ID, err)
+	}
+	record.Timestamp = timestamp
+
+	return record, nil
+}
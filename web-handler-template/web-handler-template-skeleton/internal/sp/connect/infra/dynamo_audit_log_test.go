@@ -0,0 +1,246 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/sailpoint/atlas-go/atlas/dynamoutil"
+	"github.com/sailpoint/atlas-go/atlas/event"
+	"github.com/sailpoint/atlas-go/atlas/web"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// fakeAuditTable is an auditDynamoAPI that keeps the items of an audit table in memory, ordered by
+// sort key. It ignores filter expressions.
+type fakeAuditTable struct {
+	items   []map[string]*dynamodb.AttributeValue
+	queries int
+}
+
+func (t *fakeAuditTable) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	t.items = append(t.items, input.Item)
+	sort.Slice(t.items, func(i, j int) bool {
+		return dynamoutil.GetString(t.items[i]["sortKey"]) < dynamoutil.GetString(t.items[j]["sortKey"])
+	})
+
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (t *fakeAuditTable) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	return nil, fmt.Errorf("unexpected transaction")
+}
+
+func (t *fakeAuditTable) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	t.queries++
+
+	tenantID := dynamoutil.GetString(input.ExpressionAttributeValues[":tenantId"])
+	var items []map[string]*dynamodb.AttributeValue
+	for _, item := range t.items {
+		if dynamoutil.GetString(item["tenantId"]) == tenantID {
+			items = append(items, item)
+		}
+	}
+
+	if !aws.BoolValue(input.ScanIndexForward) && input.ScanIndexForward != nil {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	if input.ExclusiveStartKey != nil {
+		start := dynamoutil.GetString(input.ExclusiveStartKey["sortKey"])
+		for i, item := range items {
+			if dynamoutil.GetString(item["sortKey"]) == start {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+
+	out := &dynamodb.QueryOutput{}
+	if limit := int(aws.Int64Value(input.Limit)); limit > 0 && len(items) > limit {
+		items = items[:limit]
+		out.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{
+			"tenantId": dynamoutil.StringAttribute(tenantID),
+			"sortKey":  items[limit-1]["sortKey"],
+		}
+	}
+
+	out.Count = aws.Int64(int64(len(items)))
+	if aws.StringValue(input.Select) != dynamodb.SelectCount {
+		out.Items = items
+	}
+
+	return out, nil
+}
+
+func (t *fakeAuditTable) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	for _, r := range input.RequestItems["audit"] {
+		key := r.DeleteRequest.Key
+		for i, item := range t.items {
+			if dynamoutil.GetString(item["tenantId"]) == dynamoutil.GetString(key["tenantId"]) && dynamoutil.GetString(item["sortKey"]) == dynamoutil.GetString(key["sortKey"]) {
+				t.items = append(t.items[:i], t.items[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+// fakeAuditPublisher is an event.Publisher that counts the events it's asked to publish.
+type fakeAuditPublisher struct {
+	event.Publisher
+	published int
+}
+
+func (p *fakeAuditPublisher) Publish(ctx context.Context, td event.TopicDescriptor, e *event.Event) error {
+	p.published++
+	return nil
+}
+
+// recordAuditRecords records n records for the tenant, a minute apart, with IDs "0" to "n-1".
+func recordAuditRecords(t *testing.T, l *dynamoAuditLog, tenantID string, start time.Time, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		record := &model.AuditRecord{
+			ID:           fmt.Sprint(i),
+			TenantID:     tenantID,
+			Actor:        "admin",
+			Action:       model.AuditUpdate,
+			ResourceType: model.AuditConnectorInstance,
+			ResourceID:   "instance",
+			Timestamp:    start.Add(time.Duration(i) * time.Minute),
+			Diff:         []byte(`[]`),
+		}
+		if err := l.Record(context.Background(), record); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAuditRecordIsStoredWithFixedWidthTimestampAndTTL(t *testing.T) {
+	table := &fakeAuditTable{}
+	publisher := &fakeAuditPublisher{}
+	l := newDynamoAuditLog(table, "audit", 24*time.Hour, nil, publisher)
+
+	timestamp := time.Date(2022, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	recordAuditRecords(t, l, "t1", timestamp, 1)
+
+	item := table.items[0]
+	if v := dynamoutil.GetString(item["timestamp"]); v != "2022-05-01T10:00:00.000000000Z" {
+		t.Errorf("expected a fixed-width UTC timestamp, got %s", v)
+	}
+	if v, _ := dynamoutil.GetNumber(item["expiresAt"]); v != timestamp.Add(24*time.Hour).Unix() {
+		t.Errorf("expected the record to expire after the retention, got %d", v)
+	}
+	if publisher.published != 1 {
+		t.Errorf("expected the record to be published, got %d", publisher.published)
+	}
+
+	records, _, err := l.List(context.Background(), "t1", &web.QueryOptions{Limit: 10}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !records[0].Timestamp.Equal(timestamp) {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
+
+func TestAuditListReadsInSortKeyOrderUntilThePageIsFull(t *testing.T) {
+	table := &fakeAuditTable{}
+	l := newDynamoAuditLog(table, "audit", time.Hour, nil, &fakeAuditPublisher{})
+
+	start := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	recordAuditRecords(t, l, "t1", start, auditQueryPageSize+10)
+	recordAuditRecords(t, l, "t2", start, 1)
+
+	tests := []struct {
+		options  *web.QueryOptions
+		expected []string
+		queries  int
+	}{
+		// Newest first by default.
+		{&web.QueryOptions{Limit: 3}, []string{"509", "508", "507"}, 1},
+		{&web.QueryOptions{Offset: 2, Limit: 2, Sorters: []web.ListSorter{{Property: "timestamp", IsAscending: true}}}, []string{"2", "3"}, 1},
+		// The page spans two queries.
+		{&web.QueryOptions{Offset: auditQueryPageSize - 1, Limit: 2, Sorters: []web.ListSorter{{Property: "timestamp", IsAscending: true}}}, []string{"499", "500"}, 2},
+	}
+
+	for _, tt := range tests {
+		table.queries = 0
+
+		records, total, err := l.List(context.Background(), "t1", tt.options, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, r := range records {
+			ids = append(ids, r.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.expected) {
+			t.Errorf("%+v: expected %v, got %v", tt.options, tt.expected, ids)
+		}
+		if total != -1 {
+			t.Errorf("expected no total without count, got %d", total)
+		}
+		if table.queries != tt.queries {
+			t.Errorf("%+v: expected %d queries, got %d", tt.options, tt.queries, table.queries)
+		}
+	}
+
+	_, total, err := l.List(context.Background(), "t1", &web.QueryOptions{Limit: 1}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != auditQueryPageSize+10 {
+		t.Errorf("expected a total of %d, got %d", auditQueryPageSize+10, total)
+	}
+}
+
+func TestAuditListSortsOtherPropertiesInMemory(t *testing.T) {
+	table := &fakeAuditTable{}
+	l := newDynamoAuditLog(table, "audit", time.Hour, nil, &fakeAuditPublisher{})
+	recordAuditRecords(t, l, "t1", time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC), 3)
+
+	options := &web.QueryOptions{Limit: 2, Sorters: []web.ListSorter{{Property: "actor", IsAscending: true}, {Property: "timestamp", IsAscending: false}}}
+	records, total, err := l.List(context.Background(), "t1", options, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records[0].ID != "2" || records[1].ID != "1" || total != 3 {
+		t.Errorf("unexpected records: %+v (total %d)", records, total)
+	}
+}
+
+func TestAuditPurgeOrgDeletesOnlyTheTenantsRecords(t *testing.T) {
+	table := &fakeAuditTable{}
+	l := newDynamoAuditLog(table, "audit", time.Hour, nil, &fakeAuditPublisher{})
+
+	start := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	recordAuditRecords(t, l, "t1", start, auditQueryPageSize+10)
+	recordAuditRecords(t, l, "t2", start, 2)
+
+	if err := l.PurgeOrg(context.Background(), "t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(table.items) != 2 {
+		t.Fatalf("expected only the other tenant's 2 records to remain, got %d", len(table.items))
+	}
+	for _, item := range table.items {
+		if tenantID := dynamoutil.GetString(item["tenantId"]); tenantID != "t2" {
+			t.Errorf("expected the records of t1 to be purged, found one of %s", tenantID)
+		}
+	}
+}
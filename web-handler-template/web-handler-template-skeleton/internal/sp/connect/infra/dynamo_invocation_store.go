@@ -0,0 +1,469 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/sailpoint/atlas-go/atlas/dynamoutil"
+	"github.com/sailpoint/atlas-go/atlas/event"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// invocationUpdateAttempts is how many times a change to an invocation is attempted when another
+// change to it gets in first.
+const invocationUpdateAttempts = 3
+
+// dynamoInvocationStore is an InvocationStore that keeps invocations in Dynamo, partitioned by
+// tenant, with each result stored as an item sorted after its invocation.
+//
+// When the outbox is configured the events of each change are written in the same transaction as
+// the change, so that a change is persisted if and only if its events will eventually be published.
+// Otherwise they're published directly after the change is persisted.
+//
+// Changes are conditional on the invocation being as it was read, so that a finished invocation
+// never changes and results are numbered without gaps. Items expire from the table after the
+// retention period, through the TTL attribute "expiresAt".
+type dynamoInvocationStore struct {
+	client    invocationDynamoAPI
+	table     string
+	retention time.Duration
+	outbox    *dynamoOutbox
+	builder   resultEventBuilder
+	publisher event.Publisher
+}
+
+// invocationDynamoAPI is the subset of the Dynamo API used by dynamoInvocationStore; it's implemented
+// by *dynamodb.DynamoDB.
+type invocationDynamoAPI interface {
+	GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error)
+	TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error)
+	QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error)
+	BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// newDynamoInvocationStore constructs a new dynamoInvocationStore. The outbox is optional.
+func newDynamoInvocationStore(client invocationDynamoAPI, table string, retention time.Duration, outbox *dynamoOutbox, builder resultEventBuilder, publisher event.Publisher) *dynamoInvocationStore {
+	s := &dynamoInvocationStore{}
+	s.client = client
+	s.table = table
+	s.retention = retention
+	s.outbox = outbox
+	s.builder = builder
+	s.publisher = publisher
+
+	return s
+}
+
+// CreateInvocation persists a new invocation along with its state event.
+func (s *dynamoInvocationStore) CreateInvocation(ctx context.Context, inv *model.Invocation) error {
+	defer observeOp(dynamoInvocationLatency, "invocation_create", time.Now())
+
+	item := map[string]*dynamodb.AttributeValue{
+		"tenantId":            dynamoutil.StringAttribute(inv.TenantID),
+		"sortKey":             dynamoutil.StringAttribute(inv.ID),
+		"id":                  dynamoutil.StringAttribute(inv.ID),
+		"connectorInstanceId": dynamoutil.StringAttribute(inv.ConnectorInstanceID),
+		"type":                dynamoutil.StringAttribute(string(inv.Type)),
+		"topology":            dynamoutil.StringAttribute(string(inv.Topology)),
+		"status":              dynamoutil.StringAttribute(string(inv.Status)),
+		"resultCount":         dynamoutil.NumberAttribute(int64(inv.ResultCount)),
+		"resultsRead":         dynamoutil.NumberAttribute(int64(inv.ResultsRead)),
+		"created":             dynamoutil.TimeAttribute(inv.CreatedAt),
+		"expiration":          dynamoutil.TimeAttribute(inv.Expiration),
+		"expiresAt":           dynamoutil.EpochTimeAttribute(inv.CreatedAt.Add(s.retention)),
+	}
+	if len(inv.Context) > 0 {
+		item["context"] = dynamoutil.StringAttribute(string(inv.Context))
+	}
+
+	state, err := invocationStateEvent(ctx, inv)
+	if err != nil {
+		return err
+	}
+
+	write := &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName:           aws.String(s.table),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(sortKey)"),
+		},
+	}
+	if err := s.write(ctx, []*dynamodb.TransactWriteItem{write}, []topicEvent{state}); err != nil {
+		return fmt.Errorf("create invocation %s: %w", inv.ID, err)
+	}
+
+	return nil
+}
+
+// GetInvocation gets an invocation of the tenant, or nil if it doesn't exist.
+func (s *dynamoInvocationStore) GetInvocation(ctx context.Context, tenantID string, id string) (*model.Invocation, error) {
+	defer observeOp(dynamoInvocationLatency, "invocation_get", time.Now())
+
+	return s.get(ctx, tenantID, id)
+}
+
+// MarkStarted moves a pending invocation to running, along with its state event.
+func (s *dynamoInvocationStore) MarkStarted(ctx context.Context, tenantID string, id string) (*model.Invocation, error) {
+	defer observeOp(dynamoInvocationLatency, "invocation_start", time.Now())
+
+	return s.update(ctx, tenantID, id, func(inv *model.Invocation) ([]*dynamodb.TransactWriteItem, []topicEvent, error) {
+		if inv.Status != model.InvocationPending {
+			return nil, nil, nil
+		}
+
+		readStatus := inv.Status
+		inv.Status = model.InvocationRunning
+		inv.StartedAt = time.Now()
+
+		update := "SET #status = :status, started = :started"
+		values := map[string]*dynamodb.AttributeValue{
+			":status":  dynamoutil.StringAttribute(string(inv.Status)),
+			":started": dynamoutil.TimeAttribute(inv.StartedAt),
+		}
+
+		state, err := invocationStateEvent(ctx, inv)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return []*dynamodb.TransactWriteItem{s.updateWrite(inv, readStatus, inv.ResultCount, update, values)}, []topicEvent{state}, nil
+	})
+}
+
+// AddResult persists a result of the invocation of the command, along with the events it's
+// announced by.
+func (s *dynamoInvocationStore) AddResult(ctx context.Context, cmd *model.RuntimeCommand, output json.RawMessage) (*model.Invocation, error) {
+	defer observeOp(dynamoInvocationLatency, "invocation_result", time.Now())
+
+	return s.update(ctx, cmd.TenantID, cmd.InvocationID, func(inv *model.Invocation) ([]*dynamodb.TransactWriteItem, []topicEvent, error) {
+		readStatus, readCount := inv.Status, inv.ResultCount
+		inv.Status = model.InvocationRunning
+		inv.ResultCount++
+
+		update := "SET #status = :status, #resultCount = :resultCount"
+		values := map[string]*dynamodb.AttributeValue{
+			":status":      dynamoutil.StringAttribute(string(inv.Status)),
+			":resultCount": dynamoutil.NumberAttribute(int64(inv.ResultCount)),
+		}
+		if inv.ResultCount == 1 {
+			inv.FirstResultAt = time.Now()
+			update += ", firstResult = :firstResult"
+			values[":firstResult"] = dynamoutil.TimeAttribute(inv.FirstResultAt)
+		}
+
+		result := &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				TableName: aws.String(s.table),
+				Item: map[string]*dynamodb.AttributeValue{
+					"tenantId":  dynamoutil.StringAttribute(inv.TenantID),
+					"sortKey":   dynamoutil.StringAttribute(invocationResultSortKey(inv.ID, inv.ResultCount)),
+					"output":    dynamoutil.StringAttribute(string(output)),
+					"expiresAt": dynamoutil.EpochTimeAttribute(inv.CreatedAt.Add(s.retention)),
+				},
+				ConditionExpression: aws.String("attribute_not_exists(sortKey)"),
+			},
+		}
+
+		events, err := resultEvents(ctx, s.builder, cmd, output, inv)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return []*dynamodb.TransactWriteItem{result, s.updateWrite(inv, readStatus, readCount, update, values)}, events, nil
+	})
+}
+
+// NextResults reads the invocation's unread results and moves its read cursor past them, conditional
+// on no other read having moved it in between.
+func (s *dynamoInvocationStore) NextResults(ctx context.Context, tenantID string, id string, limit int) (*model.Invocation, []json.RawMessage, error) {
+	defer observeOp(dynamoInvocationLatency, "invocation_read", time.Now())
+
+	for attempt := 1; ; attempt++ {
+		inv, err := s.get(ctx, tenantID, id)
+		if err != nil || inv == nil {
+			return nil, nil, err
+		}
+
+		last := inv.ResultsRead + limit
+		if last > inv.ResultCount {
+			last = inv.ResultCount
+		}
+		if last <= inv.ResultsRead {
+			return inv, []json.RawMessage{}, nil
+		}
+
+		results, err := s.queryResults(ctx, inv, inv.ResultsRead+1, last)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		readResults := inv.ResultsRead
+		inv.ResultsRead += len(results)
+
+		cursor := &dynamodb.TransactWriteItem{
+			Update: &dynamodb.Update{
+				TableName:           aws.String(s.table),
+				Key:                 invocationItemKey(tenantID, id),
+				UpdateExpression:    aws.String("SET resultsRead = :resultsRead"),
+				ConditionExpression: aws.String("resultsRead = :readResults"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":resultsRead": dynamoutil.NumberAttribute(int64(inv.ResultsRead)),
+					":readResults": dynamoutil.NumberAttribute(int64(readResults)),
+				},
+			},
+		}
+
+		err = s.write(ctx, []*dynamodb.TransactWriteItem{cursor}, nil)
+		if err == nil {
+			return inv, results, nil
+		}
+		if !conditionFailed(err) || attempt == invocationUpdateAttempts {
+			return nil, nil, fmt.Errorf("read results of invocation %s: %w", id, err)
+		}
+	}
+}
+
+// FinishInvocation moves the invocation to a final status, along with its state event.
+func (s *dynamoInvocationStore) FinishInvocation(ctx context.Context, tenantID string, id string, status model.InvocationStatus, failure *model.InvocationFailure) (*model.Invocation, error) {
+	defer observeOp(dynamoInvocationLatency, "invocation_finish", time.Now())
+
+	return s.update(ctx, tenantID, id, func(inv *model.Invocation) ([]*dynamodb.TransactWriteItem, []topicEvent, error) {
+		readStatus := inv.Status
+		inv.Status = status
+		inv.FinishedAt = time.Now()
+
+		update := "SET #status = :status, finished = :finished"
+		values := map[string]*dynamodb.AttributeValue{
+			":status":   dynamoutil.StringAttribute(string(inv.Status)),
+			":finished": dynamoutil.TimeAttribute(inv.FinishedAt),
+		}
+		if failure != nil {
+			inv.ErrorType = failure.Type
+			inv.Failure = failure
+
+			failureAttribute, err := dynamoutil.JSONAttribute(failure)
+			if err != nil {
+				return nil, nil, err
+			}
+			update += ", errorType = :errorType, failure = :failure"
+			values[":errorType"] = dynamoutil.StringAttribute(string(failure.Type))
+			values[":failure"] = failureAttribute
+		}
+
+		state, err := invocationStateEvent(ctx, inv)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return []*dynamodb.TransactWriteItem{s.updateWrite(inv, readStatus, inv.ResultCount, update, values)}, []topicEvent{state}, nil
+	})
+}
+
+// PurgeOrg removes the tenant's invocations and their results from the table. Events already
+// written to the outbox aren't affected.
+func (s *dynamoInvocationStore) PurgeOrg(ctx context.Context, tenantID string) error {
+	defer observeOp(dynamoInvocationLatency, "invocation_purge", time.Now())
+
+	if err := purgeTenantItems(ctx, s.client, s.table, tenantID); err != nil {
+		return fmt.Errorf("purge invocations: %w", err)
+	}
+
+	return nil
+}
+
+// update reads a pending or running invocation and applies the change built by fn, which modifies
+// the invocation and returns the writes and events of the change, or no writes if it doesn't apply.
+// The change is retried if the invocation changes in between. It returns the updated invocation, or
+// nil if it doesn't exist, has already finished or the change doesn't apply.
+func (s *dynamoInvocationStore) update(ctx context.Context, tenantID string, id string, fn func(inv *model.Invocation) ([]*dynamodb.TransactWriteItem, []topicEvent, error)) (*model.Invocation, error) {
+	for attempt := 1; ; attempt++ {
+		inv, err := s.get(ctx, tenantID, id)
+		if err != nil || inv == nil || inv.Status.Final() {
+			return nil, err
+		}
+
+		writes, events, err := fn(inv)
+		if err != nil || writes == nil {
+			return nil, err
+		}
+
+		err = s.write(ctx, writes, events)
+		if err == nil {
+			return inv, nil
+		}
+		if !conditionFailed(err) || attempt == invocationUpdateAttempts {
+			return nil, fmt.Errorf("update invocation %s: %w", id, err)
+		}
+	}
+}
+
+// updateWrite builds the write that applies the update expression to the invocation, conditional on
+// it still having the status and number of results it had when it was read.
+func (s *dynamoInvocationStore) updateWrite(inv *model.Invocation, readStatus model.InvocationStatus, readCount int, update string, values map[string]*dynamodb.AttributeValue) *dynamodb.TransactWriteItem {
+	values[":readStatus"] = dynamoutil.StringAttribute(string(readStatus))
+	values[":readCount"] = dynamoutil.NumberAttribute(int64(readCount))
+
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName:                 aws.String(s.table),
+			Key:                       invocationItemKey(inv.TenantID, inv.ID),
+			UpdateExpression:          aws.String(update),
+			ConditionExpression:       aws.String("#status = :readStatus AND #resultCount = :readCount"),
+			ExpressionAttributeNames:  map[string]*string{"#status": aws.String("status"), "#resultCount": aws.String("resultCount")},
+			ExpressionAttributeValues: values,
+		},
+	}
+}
+
+// write persists the writes of a change in one transaction, along with its events if the outbox is
+// configured. Otherwise the events are published once the writes are persisted.
+func (s *dynamoInvocationStore) write(ctx context.Context, writes []*dynamodb.TransactWriteItem, events []topicEvent) error {
+	if s.outbox != nil {
+		for _, e := range events {
+			entry, err := s.outbox.Put(ctx, e.topic, e.event)
+			if err != nil {
+				return err
+			}
+			writes = append(writes, entry)
+		}
+	}
+
+	if _, err := s.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes}); err != nil {
+		return err
+	}
+
+	if s.outbox != nil {
+		return nil
+	}
+
+	return publishEvents(ctx, s.publisher, events)
+}
+
+// get reads an invocation consistently, returning nil if it doesn't exist.
+func (s *dynamoInvocationStore) get(ctx context.Context, tenantID string, id string) (*model.Invocation, error) {
+	out, err := s.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            invocationItemKey(tenantID, id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get invocation %s: %w", id, err)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+
+	return parseInvocationItem(out.Item)
+}
+
+// queryResults reads the results of the invocation from the first to the last, counting from 1.
+func (s *dynamoInvocationStore) queryResults(ctx context.Context, inv *model.Invocation, first int, last int) ([]json.RawMessage, error) {
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(s.table),
+		KeyConditionExpression:   aws.String("#tenantId = :tenantId AND sortKey BETWEEN :first AND :last"),
+		ProjectionExpression:     aws.String("#output"),
+		ExpressionAttributeNames: map[string]*string{"#tenantId": aws.String("tenantId"), "#output": aws.String("output")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":tenantId": dynamoutil.StringAttribute(inv.TenantID),
+			":first":    dynamoutil.StringAttribute(invocationResultSortKey(inv.ID, first)),
+			":last":     dynamoutil.StringAttribute(invocationResultSortKey(inv.ID, last)),
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	results := make([]json.RawMessage, 0, last-first+1)
+	for {
+		out, err := s.client.QueryWithContext(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query results of invocation %s: %w", inv.ID, err)
+		}
+
+		for _, item := range out.Items {
+			results = append(results, json.RawMessage(dynamoutil.GetString(item["output"])))
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return results, nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// parseInvocationItem parses an invocation from a Dynamo item.
+func parseInvocationItem(item map[string]*dynamodb.AttributeValue) (*model.Invocation, error) {
+	inv := &model.Invocation{}
+	inv.ID = dynamoutil.GetString(item["id"])
+	inv.TenantID = dynamoutil.GetString(item["tenantId"])
+	inv.ConnectorInstanceID = dynamoutil.GetString(item["connectorInstanceId"])
+	inv.Type = model.CommandType(dynamoutil.GetString(item["type"]))
+	inv.Topology = model.Topology(dynamoutil.GetString(item["topology"]))
+	inv.Status = model.InvocationStatus(dynamoutil.GetString(item["status"]))
+	inv.ErrorType = model.InvocationErrorType(dynamoutil.GetString(item["errorType"]))
+	if raw := dynamoutil.GetString(item["context"]); raw != "" {
+		inv.Context = json.RawMessage(raw)
+	}
+
+	resultCount, err := dynamoutil.GetNumber(item["resultCount"])
+	if err != nil {
+		return nil, fmt.Errorf("parse invocation %s: %w", inv.ID, err)
+	}
+	inv.ResultCount = int(resultCount)
+
+	resultsRead, err := dynamoutil.GetNumber(item["resultsRead"])
+	if err != nil {
+		return nil, fmt.Errorf("parse invocation %s: %w", inv.ID, err)
+	}
+	inv.ResultsRead = int(resultsRead)
+
+	for attribute, t := range map[string]*time.Time{"created": &inv.CreatedAt, "expiration": &inv.Expiration, "started": &inv.StartedAt, "firstResult": &inv.FirstResultAt, "finished": &inv.FinishedAt} {
+		if *t, err = dynamoutil.GetTime(item[attribute]); err != nil {
+			return nil, fmt.Errorf("parse invocation %s: %w", inv.ID, err)
+		}
+	}
+
+	if item["failure"] != nil {
+		inv.Failure = &model.InvocationFailure{}
+		if err := dynamoutil.GetJSON(item["failure"], inv.Failure); err != nil {
+			return nil, fmt.Errorf("parse invocation %s: %w", inv.ID, err)
+		}
+	}
+
+	return inv, nil
+}
+
+// invocationItemKey gets the key of the item of an invocation.
+func invocationItemKey(tenantID string, id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"tenantId": dynamoutil.StringAttribute(tenantID),
+		"sortKey":  dynamoutil.StringAttribute(id),
+	}
+}
+
+// invocationResultSortKey gets the sort key of the nth result of an invocation, counting from 1.
+// It's zero-padded so that results sort in order after their invocation.
+func invocationResultSortKey(id string, n int) string {
+	return fmt.Sprintf("%s#result#%010d", id, n)
+}
+
+// conditionFailed gets whether a write failed because one of its conditions wasn't met.
+func conditionFailed(err error) bool {
+	var canceled *dynamodb.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		for _, reason := range canceled.CancellationReasons {
+			if aws.StringValue(reason.Code) == "ConditionalCheckFailed" {
+				return true
+			}
+		}
+	}
+
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
@@ -0,0 +1,330 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/atlas-go/atlas/dynamoutil"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// fakeInvocationTable is an invocationDynamoAPI that keeps the items of the invocation table in
+// memory and records each transaction. It understands just the expressions dynamoInvocationStore
+// uses. Writes to other tables, the outbox's, are only recorded.
+type fakeInvocationTable struct {
+	items        map[string]map[string]*dynamodb.AttributeValue
+	transactions [][]*dynamodb.TransactWriteItem
+
+	// conflicts is the number of transactions that another writer gets ahead of, by adding a result.
+	conflicts int
+}
+
+func newFakeInvocationTable() *fakeInvocationTable {
+	return &fakeInvocationTable{items: make(map[string]map[string]*dynamodb.AttributeValue)}
+}
+
+func (t *fakeInvocationTable) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: t.items[fakeItemKey(input.Key)]}, nil
+}
+
+func (t *fakeInvocationTable) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	t.transactions = append(t.transactions, input.TransactItems)
+
+	for key, item := range t.items {
+		if t.conflicts > 0 && item["resultCount"] != nil {
+			n, _ := dynamoutil.GetNumber(item["resultCount"])
+			t.items[key]["resultCount"] = dynamoutil.NumberAttribute(n + 1)
+		}
+	}
+	if t.conflicts > 0 {
+		t.conflicts--
+	}
+
+	canceled := &dynamodb.TransactionCanceledException{}
+	for _, write := range input.TransactItems {
+		reason := &dynamodb.CancellationReason{Code: aws.String("None")}
+		switch {
+		case write.Put != nil && aws.StringValue(write.Put.TableName) == "invocations":
+			if t.items[fakeItemKey(write.Put.Item)] != nil {
+				reason.Code = aws.String("ConditionalCheckFailed")
+			}
+		case write.Update != nil:
+			item := t.items[fakeItemKey(write.Update.Key)]
+			values := write.Update.ExpressionAttributeValues
+			switch {
+			case item == nil:
+				reason.Code = aws.String("ConditionalCheckFailed")
+			case values[":readResults"] != nil:
+				if aws.StringValue(item["resultsRead"].N) != aws.StringValue(values[":readResults"].N) {
+					reason.Code = aws.String("ConditionalCheckFailed")
+				}
+			case dynamoutil.GetString(item["status"]) != dynamoutil.GetString(values[":readStatus"]) || aws.StringValue(item["resultCount"].N) != aws.StringValue(values[":readCount"].N):
+				reason.Code = aws.String("ConditionalCheckFailed")
+			}
+		}
+		canceled.CancellationReasons = append(canceled.CancellationReasons, reason)
+	}
+	for _, reason := range canceled.CancellationReasons {
+		if aws.StringValue(reason.Code) != "None" {
+			return nil, canceled
+		}
+	}
+
+	for _, write := range input.TransactItems {
+		switch {
+		case write.Put != nil && aws.StringValue(write.Put.TableName) == "invocations":
+			t.items[fakeItemKey(write.Put.Item)] = write.Put.Item
+		case write.Update != nil:
+			item := t.items[fakeItemKey(write.Update.Key)]
+			for _, assignment := range strings.Split(strings.TrimPrefix(aws.StringValue(write.Update.UpdateExpression), "SET "), ", ") {
+				parts := strings.SplitN(assignment, " = ", 2)
+				name := parts[0]
+				if alias, ok := write.Update.ExpressionAttributeNames[name]; ok {
+					name = aws.StringValue(alias)
+				}
+				item[name] = write.Update.ExpressionAttributeValues[parts[1]]
+			}
+		}
+	}
+
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (t *fakeInvocationTable) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	tenantID := dynamoutil.GetString(input.ExpressionAttributeValues[":tenantId"])
+	first, last := input.ExpressionAttributeValues[":first"], input.ExpressionAttributeValues[":last"]
+
+	out := &dynamodb.QueryOutput{}
+	for _, item := range t.items {
+		if dynamoutil.GetString(item["tenantId"]) != tenantID {
+			continue
+		}
+
+		// Results are queried by the range of their sort keys, and the rest of the tenant's items by key.
+		sortKey := dynamoutil.GetString(item["sortKey"])
+		if first == nil {
+			out.Items = append(out.Items, map[string]*dynamodb.AttributeValue{"tenantId": item["tenantId"], "sortKey": item["sortKey"]})
+		} else if sortKey >= dynamoutil.GetString(first) && sortKey <= dynamoutil.GetString(last) {
+			out.Items = append(out.Items, item)
+		}
+	}
+	sort.Slice(out.Items, func(i, j int) bool {
+		return dynamoutil.GetString(out.Items[i]["sortKey"]) < dynamoutil.GetString(out.Items[j]["sortKey"])
+	})
+
+	return out, nil
+}
+
+func (t *fakeInvocationTable) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	for _, write := range input.RequestItems["invocations"] {
+		delete(t.items, fakeItemKey(write.DeleteRequest.Key))
+	}
+
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+// fakeItemKey gets the key of an item of the fake table from its key attributes.
+func fakeItemKey(item map[string]*dynamodb.AttributeValue) string {
+	return dynamoutil.GetString(item["tenantId"]) + "/" + dynamoutil.GetString(item["sortKey"])
+}
+
+// transactionTables gets the tables written by each item of a transaction, in order.
+func transactionTables(writes []*dynamodb.TransactWriteItem) string {
+	var tables []string
+	for _, write := range writes {
+		switch {
+		case write.Put != nil:
+			tables = append(tables, "put:"+aws.StringValue(write.Put.TableName))
+		case write.Update != nil:
+			tables = append(tables, "update:"+aws.StringValue(write.Update.TableName))
+		}
+	}
+
+	return fmt.Sprint(tables)
+}
+
+func testInvocationContext() context.Context {
+	return atlas.WithRequestContext(context.Background(), &atlas.RequestContext{TenantID: "t1", Pod: "dev", Org: "acme"})
+}
+
+func TestDynamoInvocationStoreWritesEventsToTheOutboxInTheSameTransaction(t *testing.T) {
+	ctx := testInvocationContext()
+	table := newFakeInvocationTable()
+	publisher := &fakeAuditPublisher{}
+	store := newDynamoInvocationStore(table, "invocations", time.Hour, newDynamoOutbox(nil, "outbox", 1), &fakeResultEventBuilder{}, publisher)
+
+	cmd := newTestInvocation(t, ctx, store, "t1", "i1")
+	inv, err := store.MarkStarted(ctx, "t1", "i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv == nil || inv.Status != model.InvocationRunning || inv.StartedAt.IsZero() {
+		t.Fatalf("expected a started invocation, got %+v", inv)
+	}
+	if inv, err = store.MarkStarted(ctx, "t1", "i1"); err != nil || inv != nil {
+		t.Fatalf("expected a running invocation not to start again, got %+v, %v", inv, err)
+	}
+
+	if inv, err = store.AddResult(ctx, cmd, json.RawMessage(`{"id":"a1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if inv == nil || inv.Status != model.InvocationRunning || inv.ResultCount != 1 || inv.FirstResultAt.IsZero() {
+		t.Fatalf("expected a running invocation with its first result, got %+v", inv)
+	}
+	if _, err := store.AddResult(ctx, cmd, json.RawMessage(`{"id":"a2"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.FinishInvocation(ctx, "t1", "i1", model.InvocationCompleted, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		// The invocation and its created state.
+		"[put:invocations put:outbox]",
+		// The start and the running state.
+		"[update:invocations put:outbox]",
+		// The first result, its standard event and the running state.
+		"[put:invocations update:invocations put:outbox put:outbox]",
+		// The second result and its standard event.
+		"[put:invocations update:invocations put:outbox]",
+		// The completion and the completed state.
+		"[update:invocations put:outbox]",
+	}
+	if len(table.transactions) != len(expected) {
+		t.Fatalf("expected %d transactions, got %d", len(expected), len(table.transactions))
+	}
+	for i, writes := range table.transactions {
+		if tables := transactionTables(writes); tables != expected[i] {
+			t.Errorf("transaction %d: expected %s, got %s", i, expected[i], tables)
+		}
+	}
+	if publisher.published != 0 {
+		t.Errorf("expected events to be left to the outbox relay, got %d published", publisher.published)
+	}
+
+	got, err := store.GetInvocation(ctx, "t1", "i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != model.InvocationCompleted || got.ResultCount != 2 || got.StartedAt.IsZero() || got.FinishedAt.IsZero() {
+		t.Errorf("unexpected stored invocation %+v", got)
+	}
+	if table.items["t1/"+invocationResultSortKey("i1", 2)] == nil {
+		t.Error("expected the second result to be stored")
+	}
+}
+
+func TestDynamoInvocationStorePublishesEventsWithoutAnOutbox(t *testing.T) {
+	ctx := testInvocationContext()
+	publisher := &fakeAuditPublisher{}
+	store := newDynamoInvocationStore(newFakeInvocationTable(), "invocations", time.Hour, nil, &fakeResultEventBuilder{}, publisher)
+
+	cmd := newTestInvocation(t, ctx, store, "t1", "i1")
+	if _, err := store.AddResult(ctx, cmd, json.RawMessage(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if publisher.published != 3 {
+		t.Errorf("expected the created state, the standard event and the running state, got %d events", publisher.published)
+	}
+}
+
+func TestDynamoInvocationStoreRetriesChangesThatLoseARace(t *testing.T) {
+	ctx := testInvocationContext()
+	table := newFakeInvocationTable()
+	store := newDynamoInvocationStore(table, "invocations", time.Hour, nil, &fakeResultEventBuilder{}, &fakeAuditPublisher{})
+
+	cmd := newTestInvocation(t, ctx, store, "t1", "i1")
+	table.conflicts = 1
+
+	inv, err := store.AddResult(ctx, cmd, json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv == nil || inv.ResultCount != 2 {
+		t.Fatalf("expected the result to follow the other writer's, got %+v", inv)
+	}
+	if table.items["t1/"+invocationResultSortKey("i1", 2)] == nil {
+		t.Error("expected the result to be stored as the second")
+	}
+
+	table.conflicts = invocationUpdateAttempts
+	if _, err := store.AddResult(ctx, cmd, json.RawMessage(`{}`)); !conditionFailed(err) {
+		t.Errorf("expected the result to fail once its attempts are exhausted, got %v", err)
+	}
+}
+
+func TestDynamoInvocationStoreIgnoresChangesToFinishedInvocations(t *testing.T) {
+	ctx := testInvocationContext()
+	table := newFakeInvocationTable()
+	store := newDynamoInvocationStore(table, "invocations", time.Hour, nil, &fakeResultEventBuilder{}, &fakeAuditPublisher{})
+
+	cmd := newTestInvocation(t, ctx, store, "t1", "i1")
+	failure := &model.InvocationFailure{Type: model.InvocationErrorTimeout, Message: "no response"}
+	if _, err := store.FinishInvocation(ctx, "t1", "i1", model.InvocationFailed, failure); err != nil {
+		t.Fatal(err)
+	}
+	transactions := len(table.transactions)
+
+	if inv, err := store.AddResult(ctx, cmd, json.RawMessage(`{}`)); err != nil || inv != nil {
+		t.Errorf("expected a result of a finished invocation to be dropped, got %+v, %v", inv, err)
+	}
+	if inv, err := store.FinishInvocation(ctx, "t1", "i1", model.InvocationCancelled, nil); err != nil || inv != nil {
+		t.Errorf("expected a finished invocation not to finish again, got %+v, %v", inv, err)
+	}
+	if inv, err := store.MarkStarted(ctx, "t1", "i1"); err != nil || inv != nil {
+		t.Errorf("expected a finished invocation not to start, got %+v, %v", inv, err)
+	}
+	if len(table.transactions) != transactions {
+		t.Errorf("expected no writes, got %d", len(table.transactions)-transactions)
+	}
+
+	inv, err := store.GetInvocation(ctx, "t1", "i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Status != model.InvocationFailed || inv.Failure == nil || *inv.Failure != *failure {
+		t.Errorf("expected the invocation to stay failed, got %+v", inv)
+	}
+}
+
+func TestDynamoInvocationStoreReadsResultsInPages(t *testing.T) {
+	table := newFakeInvocationTable()
+	testNextResults(t, newDynamoInvocationStore(table, "invocations", time.Hour, nil, &fakeResultEventBuilder{}, &fakeAuditPublisher{}))
+}
+
+func TestDynamoInvocationStorePurgeOrgRemovesOnlyTheTenantsItems(t *testing.T) {
+	ctx := testInvocationContext()
+	table := newFakeInvocationTable()
+	store := newDynamoInvocationStore(table, "invocations", time.Hour, nil, &fakeResultEventBuilder{}, &fakeAuditPublisher{})
+
+	for _, tenantID := range []string{"t1", "t2"} {
+		cmd := newTestInvocation(t, ctx, store, tenantID, "i1")
+		if _, err := store.AddResult(ctx, cmd, json.RawMessage(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.PurgeOrg(ctx, "t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for key := range table.items {
+		if strings.HasPrefix(key, "t1/") {
+			t.Errorf("expected the items of t1 to be purged, found %s", key)
+		}
+	}
+	if len(table.items) != 2 {
+		t.Errorf("expected the invocation and result of t2 to remain, got %d items", len(table.items))
+	}
+}
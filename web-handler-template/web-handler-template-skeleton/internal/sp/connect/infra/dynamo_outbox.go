@@ -0,0 +1,276 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/google/uuid"
+	"github.com/sailpoint/atlas-go/atlas/dynamoutil"
+	"github.com/sailpoint/atlas-go/atlas/event"
+)
+
+// headerKeyIdempotencyKey is the event header that carries the outbox entry ID. An entry may be
+// delivered more than once, so consumers should use the key to ignore redeliveries.
+const headerKeyIdempotencyKey = "idempotencyKey"
+
+// outboxEntry is an event waiting to be relayed to Kafka.
+type outboxEntry struct {
+	Shard    string
+	ID       string
+	TopicID  event.TopicID
+	Event    *event.Event
+	Attempts int64
+}
+
+// outbox is the store of events waiting to be relayed, as seen by the relay.
+type outbox interface {
+
+	// Claim leases up to limit entries that are due for delivery.
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*outboxEntry, error)
+
+	// Delete removes a delivered entry.
+	Delete(ctx context.Context, entry *outboxEntry) error
+
+	// Retry releases the lease on an undelivered entry and schedules its next attempt.
+	Retry(ctx context.Context, entry *outboxEntry, nextAttempt time.Time, cause error) error
+}
+
+// outboxDynamoAPI is the subset of the Dynamo API used by dynamoOutbox; it's implemented by
+// *dynamodb.DynamoDB.
+type outboxDynamoAPI interface {
+	QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error)
+	UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error)
+	DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error)
+}
+
+// dynamoOutbox is a transactional outbox kept in Dynamo next to the invocation table. Entries are
+// written in the same TransactWriteItems call as the invocation change they announce, so a change
+// is persisted if and only if its events will eventually be published.
+//
+// Entries are spread over a fixed number of shards (the partition key), and sorted within a shard
+// by creation time so that the relay publishes them roughly in order.
+type dynamoOutbox struct {
+	client outboxDynamoAPI
+	table  string
+	shards int
+}
+
+// newDynamoOutbox constructs a new dynamoOutbox.
+func newDynamoOutbox(client outboxDynamoAPI, table string, shards int) *dynamoOutbox {
+	o := &dynamoOutbox{}
+	o.client = client
+	o.table = table
+	o.shards = shards
+
+	return o
+}
+
+// Put returns the write that adds an event to the outbox. The caller must include it in the
+// transaction that persists the state change the event announces. The entry ID becomes the event's
+// ID and idempotency key.
+func (o *dynamoOutbox) Put(ctx context.Context, td event.TopicDescriptor, e *event.Event) (*dynamodb.TransactWriteItem, error) {
+	topic, err := event.NewTopic(ctx, td)
+	if err != nil {
+		return nil, err
+	}
+
+	id := fmt.Sprintf("%020d#%s", time.Now().UnixNano(), uuid.New().String())
+	e.ID = id
+	if e.Headers == nil {
+		e.Headers = make(event.Headers)
+	}
+	e.Headers[headerKeyIdempotencyKey] = id
+
+	eventAttribute, err := dynamoutil.JSONAttribute(e)
+	if err != nil {
+		return nil, err
+	}
+
+	item := map[string]*dynamodb.AttributeValue{
+		"shard":       dynamoutil.StringAttribute(o.shard(e.Headers[event.HeaderKeyPartitionKey])),
+		"id":          dynamoutil.StringAttribute(id),
+		"topicId":     dynamoutil.StringAttribute(string(topic.ID())),
+		"event":       eventAttribute,
+		"attempts":    dynamoutil.NumberAttribute(0),
+		"nextAttempt": dynamoutil.EpochTimeAttribute(time.Unix(0, 0)),
+	}
+
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName: aws.String(o.table),
+			Item:      item,
+		},
+	}, nil
+}
+
+// Claim leases up to limit entries that are due for delivery, so that other relays skip them until
+// the lease expires. Entries whose lease is lost to another relay are left out of the result.
+//
+// Dynamo applies the query's Limit before its filter, so a page may hold fewer due entries than it
+// read, or none at all; each shard is paged through until the batch is full or the shard is exhausted.
+func (o *dynamoOutbox) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*outboxEntry, error) {
+	defer observeOp(dynamoInvocationLatency, "outbox_claim", time.Now())
+
+	var claimed []*outboxEntry
+
+	for i := 0; i < o.shards && len(claimed) < limit; i++ {
+		input := &dynamodb.QueryInput{
+			TableName:                aws.String(o.table),
+			KeyConditionExpression:   aws.String("#shard = :shard"),
+			FilterExpression:         aws.String("#nextAttempt <= :now AND (attribute_not_exists(#leaseUntil) OR #leaseUntil <= :now)"),
+			ExpressionAttributeNames: outboxAttributeNames("#shard", "#nextAttempt", "#leaseUntil"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":shard": dynamoutil.StringAttribute(strconv.Itoa(i)),
+				":now":   dynamoutil.EpochTimeAttribute(now),
+			},
+			Limit: aws.Int64(int64(limit)),
+		}
+
+		for len(claimed) < limit {
+			out, err := o.client.QueryWithContext(ctx, input)
+			if err != nil {
+				return claimed, fmt.Errorf("query outbox shard %d: %w", i, err)
+			}
+
+			for _, item := range out.Items {
+				if len(claimed) == limit {
+					break
+				}
+
+				entry, err := parseOutboxEntry(item)
+				if err != nil {
+					return claimed, err
+				}
+
+				ok, err := o.lease(ctx, entry, now, lease)
+				if err != nil {
+					return claimed, err
+				}
+				if ok {
+					claimed = append(claimed, entry)
+				}
+			}
+
+			if len(out.LastEvaluatedKey) == 0 {
+				break
+			}
+			input.ExclusiveStartKey = out.LastEvaluatedKey
+		}
+	}
+
+	return claimed, nil
+}
+
+// Delete removes a delivered entry from the outbox.
+func (o *dynamoOutbox) Delete(ctx context.Context, entry *outboxEntry) error {
+	defer observeOp(dynamoInvocationLatency, "outbox_delete", time.Now())
+
+	_, err := o.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(o.table),
+		Key:       entryKey(entry),
+	})
+
+	return err
+}
+
+// Retry releases the lease on an undelivered entry and schedules its next attempt.
+func (o *dynamoOutbox) Retry(ctx context.Context, entry *outboxEntry, nextAttempt time.Time, cause error) error {
+	defer observeOp(dynamoInvocationLatency, "outbox_retry", time.Now())
+
+	_, err := o.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(o.table),
+		Key:                      entryKey(entry),
+		UpdateExpression:         aws.String("SET #attempts = #attempts + :one, #nextAttempt = :next, #lastError = :error REMOVE #leaseUntil"),
+		ExpressionAttributeNames: outboxAttributeNames("#attempts", "#nextAttempt", "#lastError", "#leaseUntil"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":one":   dynamoutil.NumberAttribute(1),
+			":next":  dynamoutil.EpochTimeAttribute(nextAttempt),
+			":error": dynamoutil.StringAttribute(cause.Error()),
+		},
+	})
+
+	return err
+}
+
+// lease conditionally sets the lease on an entry, returning false if another relay holds it.
+func (o *dynamoOutbox) lease(ctx context.Context, entry *outboxEntry, now time.Time, lease time.Duration) (bool, error) {
+	defer observeOp(dynamoInvocationLatency, "outbox_lease", time.Now())
+
+	_, err := o.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(o.table),
+		Key:                      entryKey(entry),
+		UpdateExpression:         aws.String("SET #leaseUntil = :until"),
+		ConditionExpression:      aws.String("attribute_exists(#id) AND (attribute_not_exists(#leaseUntil) OR #leaseUntil <= :now)"),
+		ExpressionAttributeNames: outboxAttributeNames("#id", "#leaseUntil"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":until": dynamoutil.EpochTimeAttribute(now.Add(lease)),
+			":now":   dynamoutil.EpochTimeAttribute(now),
+		},
+	})
+
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("lease outbox entry %s: %w", entry.ID, err)
+	}
+
+	return true, nil
+}
+
+// shard maps a partition key to a shard, so that events for the same key stay in order.
+func (o *dynamoOutbox) shard(partitionKey string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(partitionKey))
+
+	return strconv.Itoa(int(h.Sum32() % uint32(o.shards)))
+}
+
+// outboxAttributeNames builds the expression attribute names for placeholders of the form "#attribute".
+// Every attribute is referenced by placeholder, since some (eg. "shard") are Dynamo reserved words.
+func outboxAttributeNames(placeholders ...string) map[string]*string {
+	names := make(map[string]*string, len(placeholders))
+	for _, p := range placeholders {
+		names[p] = aws.String(p[1:])
+	}
+
+	return names
+}
+
+// entryKey builds the primary key of an entry.
+func entryKey(entry *outboxEntry) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"shard": dynamoutil.StringAttribute(entry.Shard),
+		"id":    dynamoutil.StringAttribute(entry.ID),
+	}
+}
+
+// parseOutboxEntry parses an entry from a Dynamo item.
+func parseOutboxEntry(item map[string]*dynamodb.AttributeValue) (*outboxEntry, error) {
+	entry := &outboxEntry{}
+	entry.Shard = dynamoutil.GetString(item["shard"])
+	entry.ID = dynamoutil.GetString(item["id"])
+	entry.TopicID = event.TopicID(dynamoutil.GetString(item["topicId"]))
+
+	if err := dynamoutil.GetJSON(item["event"], &entry.Event); err != nil {
+		return nil, fmt.Errorf("parse outbox entry %s: %w", entry.ID, err)
+	}
+
+	attempts, err := dynamoutil.GetNumber(item["attempts"])
+	if err != nil {
+		return nil, fmt.Errorf("parse outbox entry %s: %w", entry.ID, err)
+	}
+	entry.Attempts = attempts
+
+	return entry, nil
+}
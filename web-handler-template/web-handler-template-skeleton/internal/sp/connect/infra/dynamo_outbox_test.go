@@ -0,0 +1,220 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/sailpoint/atlas-go/atlas/dynamoutil"
+)
+
+// fakeOutboxTable is an outboxDynamoAPI that keeps the items of an outbox table in memory. It
+// evaluates the outbox's query filter and updates natively rather than parsing their expressions,
+// and like Dynamo, applies a query's Limit before its filter.
+type fakeOutboxTable struct {
+	items   map[string]map[string]*dynamodb.AttributeValue
+	queries int
+}
+
+func newFakeOutboxTable() *fakeOutboxTable {
+	return &fakeOutboxTable{items: map[string]map[string]*dynamodb.AttributeValue{}}
+}
+
+// add adds an entry with the attempt and lease times.
+func (t *fakeOutboxTable) add(shard int, id string, nextAttempt time.Time, leaseUntil time.Time) {
+	item := map[string]*dynamodb.AttributeValue{
+		"shard":       dynamoutil.StringAttribute(strconv.Itoa(shard)),
+		"id":          dynamoutil.StringAttribute(id),
+		"topicId":     dynamoutil.StringAttribute("AUDIT"),
+		"event":       {S: aws.String(fmt.Sprintf(`{"id":%q}`, id))},
+		"attempts":    dynamoutil.NumberAttribute(0),
+		"nextAttempt": dynamoutil.EpochTimeAttribute(nextAttempt),
+	}
+	if !leaseUntil.IsZero() {
+		item["leaseUntil"] = dynamoutil.EpochTimeAttribute(leaseUntil)
+	}
+
+	t.items[strconv.Itoa(shard)+"/"+id] = item
+}
+
+func (t *fakeOutboxTable) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	t.queries++
+
+	shard := aws.StringValue(input.ExpressionAttributeValues[":shard"].S)
+	now, _ := dynamoutil.GetNumber(input.ExpressionAttributeValues[":now"])
+
+	var ids []string
+	for _, item := range t.items {
+		if dynamoutil.GetString(item["shard"]) == shard {
+			ids = append(ids, dynamoutil.GetString(item["id"]))
+		}
+	}
+	sort.Strings(ids)
+
+	if input.ExclusiveStartKey != nil {
+		start := dynamoutil.GetString(input.ExclusiveStartKey["id"])
+		ids = ids[sort.SearchStrings(ids, start+"\x00"):]
+	}
+
+	out := &dynamodb.QueryOutput{}
+	if limit := int(aws.Int64Value(input.Limit)); limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+		out.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{
+			"shard": dynamoutil.StringAttribute(shard),
+			"id":    dynamoutil.StringAttribute(ids[limit-1]),
+		}
+	}
+
+	for _, id := range ids {
+		item := t.items[shard+"/"+id]
+		nextAttempt, _ := dynamoutil.GetNumber(item["nextAttempt"])
+		leaseUntil, _ := dynamoutil.GetNumber(item["leaseUntil"])
+		if nextAttempt <= now && (item["leaseUntil"] == nil || leaseUntil <= now) {
+			out.Items = append(out.Items, item)
+		}
+	}
+
+	return out, nil
+}
+
+func (t *fakeOutboxTable) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	key := dynamoutil.GetString(input.Key["shard"]) + "/" + dynamoutil.GetString(input.Key["id"])
+	item, ok := t.items[key]
+	values := input.ExpressionAttributeValues
+
+	// A lease is the only conditional update.
+	if input.ConditionExpression != nil {
+		now, _ := dynamoutil.GetNumber(values[":now"])
+		leaseUntil, _ := dynamoutil.GetNumber(item["leaseUntil"])
+		if !ok || (item["leaseUntil"] != nil && leaseUntil > now) {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "the conditional request failed", nil)
+		}
+
+		item["leaseUntil"] = values[":until"]
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+
+	if !ok {
+		return nil, errors.New("no such item")
+	}
+
+	attempts, _ := dynamoutil.GetNumber(item["attempts"])
+	item["attempts"] = dynamoutil.NumberAttribute(attempts + 1)
+	item["nextAttempt"] = values[":next"]
+	item["lastError"] = values[":error"]
+	delete(item, "leaseUntil")
+
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (t *fakeOutboxTable) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	delete(t.items, dynamoutil.GetString(input.Key["shard"])+"/"+dynamoutil.GetString(input.Key["id"]))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func entryIDs(entries []*outboxEntry) []string {
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestOutboxClaimPagesPastEntriesThatAreNotDue(t *testing.T) {
+	now := time.Unix(1000, 0)
+	table := newFakeOutboxTable()
+
+	// The first page of shard 0 holds only entries that aren't due; the due ones are behind it.
+	table.add(0, "a", now.Add(time.Minute), time.Time{})
+	table.add(0, "b", now.Add(-time.Minute), now.Add(time.Minute))
+	table.add(0, "c", now, time.Time{})
+	table.add(0, "d", now.Add(-time.Minute), time.Time{})
+	table.add(1, "e", now.Add(-time.Minute), time.Time{})
+
+	outbox := newDynamoOutbox(table, "outbox", 2)
+
+	claimed, err := outbox.Claim(context.Background(), now, time.Minute, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := fmt.Sprint(entryIDs(claimed)); ids != "[c d]" {
+		t.Errorf("expected the due entries of shard 0, got %s", ids)
+	}
+
+	claimed, err = outbox.Claim(context.Background(), now, time.Minute, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := fmt.Sprint(entryIDs(claimed)); ids != "[e]" {
+		t.Errorf("expected leased entries to be skipped, got %s", ids)
+	}
+}
+
+func TestOutboxLeaseExpires(t *testing.T) {
+	now := time.Unix(1000, 0)
+	table := newFakeOutboxTable()
+	table.add(0, "a", now, time.Time{})
+
+	outbox := newDynamoOutbox(table, "outbox", 1)
+
+	if claimed, _ := outbox.Claim(context.Background(), now, time.Minute, 10); len(claimed) != 1 {
+		t.Fatalf("expected the entry to be claimed, got %v", entryIDs(claimed))
+	}
+
+	if claimed, _ := outbox.Claim(context.Background(), now.Add(30*time.Second), time.Minute, 10); len(claimed) != 0 {
+		t.Errorf("expected the leased entry to be skipped, got %v", entryIDs(claimed))
+	}
+
+	if claimed, _ := outbox.Claim(context.Background(), now.Add(time.Minute), time.Minute, 10); len(claimed) != 1 {
+		t.Errorf("expected the entry to be claimed once its lease expired, got %v", entryIDs(claimed))
+	}
+}
+
+func TestOutboxRetryReleasesLease(t *testing.T) {
+	now := time.Unix(1000, 0)
+	table := newFakeOutboxTable()
+	table.add(0, "a", now, time.Time{})
+
+	outbox := newDynamoOutbox(table, "outbox", 1)
+
+	claimed, _ := outbox.Claim(context.Background(), now, time.Hour, 10)
+	if len(claimed) != 1 {
+		t.Fatalf("expected the entry to be claimed, got %v", entryIDs(claimed))
+	}
+
+	if err := outbox.Retry(context.Background(), claimed[0], now.Add(time.Second), errors.New("broker down")); err != nil {
+		t.Fatal(err)
+	}
+
+	item := table.items["0/a"]
+	if item["leaseUntil"] != nil || aws.StringValue(item["lastError"].S) != "broker down" {
+		t.Errorf("expected the lease to be released with the error, got %v", item)
+	}
+
+	if claimed, _ := outbox.Claim(context.Background(), now, time.Hour, 10); len(claimed) != 0 {
+		t.Errorf("expected the entry to wait for its next attempt, got %v", entryIDs(claimed))
+	}
+
+	claimed, _ = outbox.Claim(context.Background(), now.Add(time.Second), time.Hour, 10)
+	if len(claimed) != 1 || claimed[0].Attempts != 1 {
+		t.Fatalf("expected the entry to be claimed after its backoff with 1 attempt, got %+v", claimed)
+	}
+
+	if err := outbox.Delete(context.Background(), claimed[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(table.items) != 0 {
+		t.Errorf("expected the entry to be deleted, got %v", table.items)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sailpoint/atlas-go/atlas/event"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/saas-kafka-artifacts"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// internalTopic is the pod-scoped topic that the service uses to schedule its own work.
+var internalTopic = event.NewSimpleTopicDescriptor(event.TopicScopePod, "sp_connect_internal")
+
+const (
+	eventTypeOrgDeleted         = "ORG_DELETED"
+	eventTypeOrgSuspended       = "ORG_SUSPENDED"
+	eventTypeOrgResumed         = "ORG_RESUMED"
+	eventTypeTriggerAggregation = "TRIGGER_AGGREGATION"
+)
+
+// bindEventHandlers configures all of the Kafka event handlers for the service.
+func (s *ConnectService) bindEventHandlers() *event.Router {
+	r := event.NewRouterWithDefaultMiddleware()
+	r.Use(traceEvents())
+
+	r.OnTopicAndEventType(topics.IdnTopic.ORG_LIFECYCLE, eventTypeOrgDeleted, event.HandlerFunc(s.purgeOrg))
+	r.OnTopicAndEventType(topics.IdnTopic.ORG_LIFECYCLE, eventTypeOrgSuspended, event.HandlerFunc(s.suspendOrg(true)))
+	r.OnTopicAndEventType(topics.IdnTopic.ORG_LIFECYCLE, eventTypeOrgResumed, event.HandlerFunc(s.suspendOrg(false)))
+
+	r.OnTopicAndEventType(internalTopic, eventTypeTriggerAggregation, event.HandlerFunc(s.triggerAggregation))
+
+	return r
+}
+
+// purgeOrg removes a deleted org's data from each of the stores in orgPurgers.
+func (s *ConnectService) purgeOrg(ctx context.Context, topic event.Topic, e *event.Event) error {
+	cmd, err := cmd.NewPurgeOrg(requestTenantID(ctx))
+	if err != nil {
+		log.Errorf(ctx, "discarding %s event: %v", e.Type, err)
+		return nil
+	}
+
+	return cmd.Handle(ctx, s.orgPurgers)
+}
+
+// suspendOrg returns a handler that pauses or resumes connector activity for an org.
+func (s *ConnectService) suspendOrg(suspended bool) event.HandlerFunc {
+	return func(ctx context.Context, topic event.Topic, e *event.Event) error {
+		cmd, err := cmd.NewSuspendOrg(requestTenantID(ctx), suspended)
+		if err != nil {
+			log.Errorf(ctx, "discarding %s event: %v", e.Type, err)
+			return nil
+		}
+
+		return cmd.Handle(ctx, s.orgStatusStore)
+	}
+}
+
+// triggerAggregation invokes the aggregation command described by an internal event. Malformed
+// events, aggregations for suspended orgs and those of instances that are gone or can't be invoked
+// are dropped rather than retried.
+func (s *ConnectService) triggerAggregation(ctx context.Context, topic event.Topic, e *event.Event) error {
+	cmd, err := cmd.NewTriggerAggregation(requestTenantID(ctx), []byte(e.ContentJSON))
+	if err != nil {
+		log.Errorf(ctx, "discarding %s event: %v", e.Type, err)
+		return nil
+	}
+
+	err = cmd.Handle(ctx, s.orgStatusStore, s.commandInvoker)
+	if errors.Is(err, model.ErrOrgSuspended) {
+		log.Infof(ctx, "skipping aggregation of %s: %v", cmd.ConnectorInstanceID, err)
+		return nil
+	}
+
+	if uninvocable(err) {
+		log.Errorf(ctx, "discarding %s event: %v", e.Type, err)
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,314 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/sailpoint/atlas-go/atlas/dynamoutil"
+	"github.com/sailpoint/atlas-go/atlas/web"
+)
+
+// DynamoFilter is a filter that renders to a Dynamo filter expression.
+type DynamoFilter struct {
+	root       *expr
+	attributes map[string]string
+	timeLayout string
+}
+
+// DynamoExpression is the rendered form of a DynamoFilter, ready to be set on a Scan or Query input.
+type DynamoExpression struct {
+	FilterExpression          *string
+	ExpressionAttributeNames  map[string]*string
+	ExpressionAttributeValues map[string]*dynamodb.AttributeValue
+}
+
+// DynamoFilterBuilder is a web.FilterBuilder that builds DynamoFilters. Dynamo has no
+// case-insensitive comparison, so IgnoreCase is rejected. Dynamo also can't order the
+// results of a scan; repositories should sort with the same Properties used by Query.
+type DynamoFilterBuilder struct {
+	attributes map[string]string
+	timeLayout string
+}
+
+// NewDynamoFilterBuilder constructs a new DynamoFilterBuilder, where attributes maps each
+// queryable V3 property name to its item attribute name.
+func NewDynamoFilterBuilder(attributes map[string]string) *DynamoFilterBuilder {
+	return &DynamoFilterBuilder{attributes: attributes}
+}
+
+// WithTimeLayout makes the builder's filters compare times as UTC strings in the layout, for items
+// that store times in a fixed-width layout rather than as dynamoutil's RFC3339, whose strings don't
+// order chronologically.
+func (b *DynamoFilterBuilder) WithTimeLayout(layout string) *DynamoFilterBuilder {
+	b.timeLayout = layout
+	return b
+}
+
+// And builds a filter that matches when all of the specified filters match.
+func (b *DynamoFilterBuilder) And(filters []web.Filter) (web.Filter, error) {
+	children, err := dynamoChildren(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newFilter(&expr{kind: exprAnd, children: children}), nil
+}
+
+// Or builds a filter that matches when any of the specified filters match.
+func (b *DynamoFilterBuilder) Or(filters []web.Filter) (web.Filter, error) {
+	children, err := dynamoChildren(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newFilter(&expr{kind: exprOr, children: children}), nil
+}
+
+// Not builds a filter that negates the specified filter.
+func (b *DynamoFilterBuilder) Not(filter web.Filter) (web.Filter, error) {
+	children, err := dynamoChildren([]web.Filter{filter})
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newFilter(&expr{kind: exprNot, children: children}), nil
+}
+
+// NewFilter builds a filter that compares an attribute with a single value.
+func (b *DynamoFilterBuilder) NewFilter(op web.LogicalOperation, property string, valueObject interface{}) (web.Filter, error) {
+	return b.NewFilterWithMatchMode(op, property, valueObject, web.Anywhere)
+}
+
+// NewFilterWithMatchMode builds a filter that compares an attribute with a single value, where
+// LIKE operations are matched using the specified mode.
+func (b *DynamoFilterBuilder) NewFilterWithMatchMode(op web.LogicalOperation, property string, valueObject interface{}, mode web.MatchMode) (web.Filter, error) {
+	if err := checkOperation(op, false); err != nil {
+		return nil, err
+	}
+
+	if _, ok := b.attributes[property]; !ok {
+		return nil, fmt.Errorf("invalid filter property: %s", property)
+	}
+
+	e := newCondition(op, property, valueObject, mode)
+	if _, err := toAttributeValue(e.value); err != nil {
+		return nil, err
+	}
+
+	return b.newFilter(e), nil
+}
+
+// IgnoreCase is not supported by Dynamo and always returns an error.
+func (b *DynamoFilterBuilder) IgnoreCase(filter web.Filter) (web.Filter, error) {
+	return nil, fmt.Errorf("case-insensitive filters are not supported")
+}
+
+// NewFilterWithValueList builds a filter that compares an attribute with a list of values.
+func (b *DynamoFilterBuilder) NewFilterWithValueList(op web.LogicalOperation, property string, valueList []interface{}) (web.Filter, error) {
+	if err := checkOperation(op, true); err != nil {
+		return nil, err
+	}
+
+	if _, ok := b.attributes[property]; !ok {
+		return nil, fmt.Errorf("invalid filter property: %s", property)
+	}
+
+	e := newListCondition(op, property, valueList)
+	for _, v := range e.values {
+		if _, err := toAttributeValue(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.newFilter(e), nil
+}
+
+// newFilter wraps an expression in a DynamoFilter bound to this builder's attributes.
+func (b *DynamoFilterBuilder) newFilter(root *expr) *DynamoFilter {
+	return &DynamoFilter{root: root, attributes: b.attributes, timeLayout: b.timeLayout}
+}
+
+// dynamoChildren converts a slice of generic filters to expressions, ensuring each was built by a DynamoFilterBuilder.
+func dynamoChildren(filters []web.Filter) ([]*expr, error) {
+	children := make([]*expr, 0, len(filters))
+	for _, f := range filters {
+		df, ok := f.(*DynamoFilter)
+		if !ok {
+			return nil, fmt.Errorf("unexpected filter type: %T", f)
+		}
+		children = append(children, df.root)
+	}
+
+	return children, nil
+}
+
+// Expression renders the filter as a Dynamo filter expression along with its attribute names and values.
+func (f *DynamoFilter) Expression() (*DynamoExpression, error) {
+	w := &dynamoWriter{
+		attributes: f.attributes,
+		timeLayout: f.timeLayout,
+		names:      make(map[string]*string),
+		values:     make(map[string]*dynamodb.AttributeValue),
+	}
+
+	s, err := w.write(f.root)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DynamoExpression{
+		FilterExpression:          aws.String(s),
+		ExpressionAttributeNames:  w.names,
+		ExpressionAttributeValues: w.values,
+	}, nil
+}
+
+// dynamoWriter accumulates expression attribute names and values while rendering an expression tree.
+type dynamoWriter struct {
+	attributes map[string]string
+	timeLayout string
+	names      map[string]*string
+	values     map[string]*dynamodb.AttributeValue
+}
+
+// name returns the placeholder for a property's attribute name.
+func (w *dynamoWriter) name(property string) string {
+	attribute := w.attributes[property]
+	for k, v := range w.names {
+		if *v == attribute {
+			return k
+		}
+	}
+
+	k := "#n" + strconv.Itoa(len(w.names))
+	w.names[k] = aws.String(attribute)
+	return k
+}
+
+// value returns the placeholder for a bound value.
+func (w *dynamoWriter) value(v interface{}) (string, error) {
+	if t, ok := v.(time.Time); ok && w.timeLayout != "" {
+		v = t.UTC().Format(w.timeLayout)
+	}
+
+	av, err := toAttributeValue(v)
+	if err != nil {
+		return "", err
+	}
+
+	k := ":v" + strconv.Itoa(len(w.values))
+	w.values[k] = av
+	return k, nil
+}
+
+// write renders an expression.
+func (w *dynamoWriter) write(e *expr) (string, error) {
+	switch e.kind {
+	case exprAnd, exprOr:
+		joiner := " AND "
+		if e.kind == exprOr {
+			joiner = " OR "
+		}
+
+		terms := make([]string, 0, len(e.children))
+		for _, c := range e.children {
+			s, err := w.write(c)
+			if err != nil {
+				return "", err
+			}
+			terms = append(terms, s)
+		}
+		return "(" + strings.Join(terms, joiner) + ")", nil
+	case exprNot:
+		s, err := w.write(e.children[0])
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + s + ")", nil
+	}
+
+	name := w.name(e.property)
+
+	switch e.op {
+	case web.NotNull:
+		return "attribute_exists(" + name + ")", nil
+	case web.Eq, web.Ne, web.Gt, web.Lt, web.Ge, web.Le:
+		if e.value == nil && e.op == web.Eq {
+			return "attribute_not_exists(" + name + ")", nil
+		}
+		if e.value == nil && e.op == web.Ne {
+			return "attribute_exists(" + name + ")", nil
+		}
+
+		v, err := w.value(e.value)
+		if err != nil {
+			return "", err
+		}
+		return name + " " + dynamoComparators[e.op] + " " + v, nil
+	case web.Like:
+		v, err := w.value(e.value)
+		if err != nil {
+			return "", err
+		}
+		if e.mode == web.Start {
+			return "begins_with(" + name + ", " + v + ")", nil
+		}
+		return "contains(" + name + ", " + v + ")", nil
+	case web.In:
+		placeholders := make([]string, 0, len(e.values))
+		for _, value := range e.values {
+			v, err := w.value(value)
+			if err != nil {
+				return "", err
+			}
+			placeholders = append(placeholders, v)
+		}
+		return name + " IN (" + strings.Join(placeholders, ", ") + ")", nil
+	case web.ContainsAll:
+		terms := make([]string, 0, len(e.values))
+		for _, value := range e.values {
+			v, err := w.value(value)
+			if err != nil {
+				return "", err
+			}
+			terms = append(terms, "contains("+name+", "+v+")")
+		}
+		return "(" + strings.Join(terms, " AND ") + ")", nil
+	}
+
+	return "", fmt.Errorf("unsupported filter operation: %s", e.op)
+}
+
+// dynamoComparators maps comparison operations to their Dynamo comparator.
+var dynamoComparators = map[web.LogicalOperation]string{
+	web.Eq: "=",
+	web.Ne: "<>",
+	web.Gt: ">",
+	web.Lt: "<",
+	web.Ge: ">=",
+	web.Le: "<=",
+}
+
+// toAttributeValue converts a normalized literal to a Dynamo attribute value, using the same
+// encodings as dynamoutil so that values compare correctly with stored items.
+func toAttributeValue(v interface{}) (*dynamodb.AttributeValue, error) {
+	switch n := v.(type) {
+	case nil:
+		return &dynamodb.AttributeValue{NULL: aws.Bool(true)}, nil
+	case string:
+		return dynamoutil.StringAttribute(n), nil
+	case bool:
+		return dynamoutil.BoolAttribute(n), nil
+	case float64:
+		return &dynamodb.AttributeValue{N: aws.String(strconv.FormatFloat(n, 'f', -1, 64))}, nil
+	case time.Time:
+		return dynamoutil.TimeAttribute(n), nil
+	}
+
+	return nil, fmt.Errorf("unsupported filter value: %v", v)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package filter contains web.FilterBuilder implementations that translate V3 query
+// filters (as parsed by web.GetQueryOptions) into the native form of each repository
+// backend: in-memory predicates, Postgres WHERE clauses and Dynamo filter expressions.
+package filter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/atlas-go/atlas/web"
+)
+
+// exprKind is an enumeration for the type of node in a filter expression tree.
+type exprKind int
+
+const (
+	exprCondition exprKind = iota
+	exprAnd
+	exprOr
+	exprNot
+)
+
+// expr is a backend agnostic node in a filter expression tree. Each FilterBuilder
+// builds the same tree and renders it in its own dialect.
+type expr struct {
+	kind     exprKind
+	children []*expr
+
+	op         web.LogicalOperation
+	property   string
+	value      interface{}
+	values     []interface{}
+	mode       web.MatchMode
+	ignoreCase bool
+}
+
+// newCondition constructs a leaf expression comparing a property with a single value.
+func newCondition(op web.LogicalOperation, property string, value interface{}, mode web.MatchMode) *expr {
+	return &expr{
+		kind:     exprCondition,
+		op:       op,
+		property: property,
+		value:    normalize(value),
+		mode:     mode,
+	}
+}
+
+// newListCondition constructs a leaf expression comparing a property with a list of values.
+func newListCondition(op web.LogicalOperation, property string, values []interface{}) *expr {
+	e := &expr{
+		kind:     exprCondition,
+		op:       op,
+		property: property,
+	}
+
+	for _, v := range values {
+		e.values = append(e.values, normalize(v))
+	}
+
+	return e
+}
+
+// withIgnoreCase returns a copy of a leaf expression that compares strings case-insensitively.
+func (e *expr) withIgnoreCase() (*expr, error) {
+	if e.kind != exprCondition {
+		return nil, fmt.Errorf("ignore case can only be applied to a single condition")
+	}
+
+	c := *e
+	c.ignoreCase = true
+
+	return &c, nil
+}
+
+// checkOperation returns an error if the operation cannot be built from the parameters supplied.
+func checkOperation(op web.LogicalOperation, isList bool) error {
+	switch op {
+	case web.In, web.ContainsAll:
+		if !isList {
+			return fmt.Errorf("operation %s requires a list of values", op)
+		}
+	case web.Eq, web.Ne, web.Gt, web.Lt, web.Ge, web.Le, web.Like, web.NotNull:
+		if isList {
+			return fmt.Errorf("operation %s does not accept a list of values", op)
+		}
+	default:
+		return fmt.Errorf("unsupported filter operation: %s", op)
+	}
+
+	return nil
+}
+
+// normalize converts literal values to a canonical type so that they can be compared
+// and serialized consistently: all numbers become float64 and atlas times become time.Time.
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	case atlas.Time:
+		return time.Time(n)
+	case *atlas.Time:
+		if n == nil {
+			return nil
+		}
+		return time.Time(*n)
+	}
+
+	return v
+}
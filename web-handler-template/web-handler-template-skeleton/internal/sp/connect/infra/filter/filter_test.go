@@ -0,0 +1,203 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package filter
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/go-test/deep"
+	"github.com/sailpoint/atlas-go/atlas/web"
+)
+
+var testQueryableFields = mapset.NewSet("id", "name", "connectorSpecId", "created", "tags")
+var testSortableFields = mapset.NewSet("name", "created")
+
+func parseQueryOptions(t *testing.T, fb web.FilterBuilder, filters string, sorters string) *web.QueryOptions {
+	t.Helper()
+
+	q := url.Values{}
+	if filters != "" {
+		q.Set("filters", filters)
+	}
+	if sorters != "" {
+		q.Set("sorters", sorters)
+	}
+
+	r := httptest.NewRequest("GET", "/connector-instances?"+q.Encode(), nil)
+	options, err := web.GetQueryOptions(r, testSortableFields, fb, testQueryableFields)
+	if err != nil {
+		t.Fatalf("parse query options: %v", err)
+	}
+
+	return options
+}
+
+func testRecords() []Properties {
+	day := func(d int) time.Time {
+		return time.Date(2022, 5, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	return []Properties{
+		{"id": "1", "name": "Workday", "connectorSpecId": "internal", "created": day(3), "tags": []string{"hr", "prod"}},
+		{"id": "2", "name": "Slack", "connectorSpecId": "slack", "created": day(1), "tags": []string{"chat"}},
+		{"id": "3", "name": "Debug", "connectorSpecId": "internal", "created": day(2), "tags": []string{"prod"}},
+		{"id": "4", "name": "Zendesk", "connectorSpecId": "zendesk", "created": day(4)},
+	}
+}
+
+func queryIDs(t *testing.T, filters string, sorters string) []string {
+	t.Helper()
+
+	records := testRecords()
+	indexes, _, err := Query(records, parseQueryOptions(t, NewMemoryFilterBuilder(), filters, sorters))
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+
+	ids := []string{}
+	for _, i := range indexes {
+		ids = append(ids, records[i]["id"].(string))
+	}
+
+	return ids
+}
+
+func TestMemoryFilter(t *testing.T) {
+	tests := []struct {
+		filters  string
+		sorters  string
+		expected []string
+	}{
+		{``, ``, []string{"1", "2", "3", "4"}},
+		{`connectorSpecId eq "internal"`, ``, []string{"1", "3"}},
+		{`connectorSpecId ne "internal"`, `-created`, []string{"4", "2"}},
+		{`connectorSpecId eq "internal" or name sw "Z"`, `name`, []string{"3", "1", "4"}},
+		{`name co "e" and not connectorSpecId eq "zendesk"`, `created`, []string{"3"}},
+		{`created gt 2022-05-02T00:00:00Z`, `-created`, []string{"4", "1"}},
+		{`id in ("2", "4")`, ``, []string{"2", "4"}},
+		{`tags ca ("prod", "hr")`, ``, []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		if diff := deep.Equal(queryIDs(t, tt.filters, tt.sorters), tt.expected); diff != nil {
+			t.Errorf("filters %q sorters %q: %v", tt.filters, tt.sorters, diff)
+		}
+	}
+}
+
+func TestMemoryQueryPaging(t *testing.T) {
+	records := testRecords()
+	options := parseQueryOptions(t, NewMemoryFilterBuilder(), "", "name")
+	options.Offset = 1
+	options.Limit = 2
+
+	indexes, total, err := Query(records, options)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+
+	if total != 4 {
+		t.Errorf("expected total of 4, got %d", total)
+	}
+
+	if diff := deep.Equal(indexes, []int{1, 0}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestMemoryIgnoreCase(t *testing.T) {
+	b := NewMemoryFilterBuilder()
+	f, _ := b.NewFilter(web.Eq, "name", "workday")
+	f, err := b.IgnoreCase(f)
+	if err != nil {
+		t.Fatalf("ignore case: %v", err)
+	}
+
+	if !f.(*MemoryFilter).Matches(testRecords()[0]) {
+		t.Error("expected case-insensitive match")
+	}
+}
+
+func TestPostgresFilter(t *testing.T) {
+	b := NewPostgresFilterBuilder(map[string]string{
+		"name":            "name",
+		"connectorSpecId": "connector_spec_id",
+		"created":         "created",
+		"id":              "id",
+		"tags":            "tags",
+	})
+
+	options := parseQueryOptions(t, b, `connectorSpecId eq "internal" and name sw "a_b" or id in ("1", "2")`, "-created,name")
+	where, args := options.Filters.(*PostgresFilter).Where([]interface{}{"acme"})
+
+	if diff := deep.Equal(where, `((connector_spec_id = $2 AND name LIKE $3) OR id IN ($4, $5))`); diff != nil {
+		t.Error(diff)
+	}
+
+	if diff := deep.Equal(args, []interface{}{"acme", "internal", `a\_b%`, "1", "2"}); diff != nil {
+		t.Error(diff)
+	}
+
+	orderBy, err := b.OrderBy(options.Sorters)
+	if err != nil {
+		t.Fatalf("order by: %v", err)
+	}
+
+	if diff := deep.Equal(orderBy, "created DESC, name ASC"); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := b.NewFilter(web.Eq, "config", "x"); err == nil {
+		t.Error("expected error for unmapped column")
+	}
+}
+
+func TestDynamoFilter(t *testing.T) {
+	b := NewDynamoFilterBuilder(map[string]string{
+		"connectorSpecId": "connector_spec_id",
+		"name":            "name",
+		"created":         "created",
+		"id":              "id",
+		"tags":            "tags",
+	})
+
+	options := parseQueryOptions(t, b, `connectorSpecId eq "internal" and not name sw "Deb"`, "")
+	e, err := options.Filters.(*DynamoFilter).Expression()
+	if err != nil {
+		t.Fatalf("expression: %v", err)
+	}
+
+	if diff := deep.Equal(*e.FilterExpression, `(#n0 = :v0 AND NOT (begins_with(#n1, :v1)))`); diff != nil {
+		t.Error(diff)
+	}
+
+	if *e.ExpressionAttributeNames["#n0"] != "connector_spec_id" || *e.ExpressionAttributeNames["#n1"] != "name" {
+		t.Errorf("unexpected attribute names: %v", e.ExpressionAttributeNames)
+	}
+
+	if *e.ExpressionAttributeValues[":v0"].S != "internal" || *e.ExpressionAttributeValues[":v1"].S != "Deb" {
+		t.Errorf("unexpected attribute values: %v", e.ExpressionAttributeValues)
+	}
+
+	f, _ := b.NewFilter(web.Eq, "name", "x")
+	if _, err := b.IgnoreCase(f); err == nil {
+		t.Error("expected ignore case to be rejected")
+	}
+}
+
+func TestDynamoFilterTimeLayout(t *testing.T) {
+	b := NewDynamoFilterBuilder(map[string]string{"created": "created"}).WithTimeLayout("2006-01-02T15:04:05.000Z")
+
+	options := parseQueryOptions(t, b, `created gt 2022-05-02T01:00:00+01:00`, "")
+	e, err := options.Filters.(*DynamoFilter).Expression()
+	if err != nil {
+		t.Fatalf("expression: %v", err)
+	}
+
+	if v := *e.ExpressionAttributeValues[":v0"].S; v != "2022-05-02T00:00:00.000Z" {
+		t.Errorf("expected the time in UTC and the fixed-width layout, got %s", v)
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package filter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/web"
+)
+
+// Properties is the queryable view of a record held by an in-memory repository,
+// keyed by the V3 property name (eg. "connectorSpecId").
+type Properties map[string]interface{}
+
+// MemoryFilter is a filter that is evaluated against in-memory records.
+type MemoryFilter struct {
+	root *expr
+}
+
+// MemoryFilterBuilder is a web.FilterBuilder that builds MemoryFilters.
+type MemoryFilterBuilder struct{}
+
+// NewMemoryFilterBuilder constructs a new MemoryFilterBuilder.
+func NewMemoryFilterBuilder() *MemoryFilterBuilder {
+	return &MemoryFilterBuilder{}
+}
+
+// And builds a filter that matches when all of the specified filters match.
+func (b *MemoryFilterBuilder) And(filters []web.Filter) (web.Filter, error) {
+	children, err := memoryChildren(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryFilter{&expr{kind: exprAnd, children: children}}, nil
+}
+
+// Or builds a filter that matches when any of the specified filters match.
+func (b *MemoryFilterBuilder) Or(filters []web.Filter) (web.Filter, error) {
+	children, err := memoryChildren(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryFilter{&expr{kind: exprOr, children: children}}, nil
+}
+
+// Not builds a filter that negates the specified filter.
+func (b *MemoryFilterBuilder) Not(filter web.Filter) (web.Filter, error) {
+	children, err := memoryChildren([]web.Filter{filter})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryFilter{&expr{kind: exprNot, children: children}}, nil
+}
+
+// NewFilter builds a filter that compares a property with a single value.
+func (b *MemoryFilterBuilder) NewFilter(op web.LogicalOperation, property string, valueObject interface{}) (web.Filter, error) {
+	return b.NewFilterWithMatchMode(op, property, valueObject, web.Anywhere)
+}
+
+// NewFilterWithMatchMode builds a filter that compares a property with a single value, where
+// LIKE operations are matched using the specified mode.
+func (b *MemoryFilterBuilder) NewFilterWithMatchMode(op web.LogicalOperation, property string, valueObject interface{}, mode web.MatchMode) (web.Filter, error) {
+	if err := checkOperation(op, false); err != nil {
+		return nil, err
+	}
+
+	return &MemoryFilter{newCondition(op, property, valueObject, mode)}, nil
+}
+
+// IgnoreCase builds a copy of the specified filter that compares strings case-insensitively.
+func (b *MemoryFilterBuilder) IgnoreCase(filter web.Filter) (web.Filter, error) {
+	f, ok := filter.(*MemoryFilter)
+	if !ok {
+		return nil, fmt.Errorf("unexpected filter type: %T", filter)
+	}
+
+	root, err := f.root.withIgnoreCase()
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryFilter{root}, nil
+}
+
+// NewFilterWithValueList builds a filter that compares a property with a list of values.
+func (b *MemoryFilterBuilder) NewFilterWithValueList(op web.LogicalOperation, property string, valueList []interface{}) (web.Filter, error) {
+	if err := checkOperation(op, true); err != nil {
+		return nil, err
+	}
+
+	return &MemoryFilter{newListCondition(op, property, valueList)}, nil
+}
+
+// memoryChildren converts a slice of generic filters to expressions, ensuring each was built by a MemoryFilterBuilder.
+func memoryChildren(filters []web.Filter) ([]*expr, error) {
+	children := make([]*expr, 0, len(filters))
+	for _, f := range filters {
+		mf, ok := f.(*MemoryFilter)
+		if !ok {
+			return nil, fmt.Errorf("unexpected filter type: %T", f)
+		}
+		children = append(children, mf.root)
+	}
+
+	return children, nil
+}
+
+// Matches gets whether or not the specified record satisfies the filter. A nil filter matches everything.
+func (f *MemoryFilter) Matches(p Properties) bool {
+	if f == nil || f.root == nil {
+		return true
+	}
+
+	return matches(f.root, p)
+}
+
+// Query applies the filters, sorters, offset and limit of the query options to a set of records. It returns the
+// indexes of the records in the requested page, in sorted order, along with the total number of records that
+// matched the filters (suitable for the X-Total-Count header).
+func Query(records []Properties, options *web.QueryOptions) ([]int, int, error) {
+	var filter *MemoryFilter
+	if options.Filters != nil {
+		f, ok := options.Filters.(*MemoryFilter)
+		if !ok {
+			return nil, 0, fmt.Errorf("unexpected filter type: %T", options.Filters)
+		}
+		filter = f
+	}
+
+	indexes := make([]int, 0, len(records))
+	for i, r := range records {
+		if filter.Matches(r) {
+			indexes = append(indexes, i)
+		}
+	}
+
+	sort.SliceStable(indexes, func(i, j int) bool {
+		a, b := records[indexes[i]], records[indexes[j]]
+		for _, s := range options.Sorters {
+			c := compareForSort(a[s.Property], b[s.Property])
+			if c == 0 {
+				continue
+			}
+			if s.IsAscending {
+				return c < 0
+			}
+			return c > 0
+		}
+		return false
+	})
+
+	total := len(indexes)
+
+	start := options.Offset
+	if start > total {
+		start = total
+	}
+
+	end := total
+	if options.Limit > 0 && start+options.Limit < end {
+		end = start + options.Limit
+	}
+
+	return indexes[start:end], total, nil
+}
+
+// matches evaluates an expression against a record.
+func matches(e *expr, p Properties) bool {
+	switch e.kind {
+	case exprAnd:
+		for _, c := range e.children {
+			if !matches(c, p) {
+				return false
+			}
+		}
+		return true
+	case exprOr:
+		for _, c := range e.children {
+			if matches(c, p) {
+				return true
+			}
+		}
+		return false
+	case exprNot:
+		return !matches(e.children[0], p)
+	}
+
+	actual := normalize(p[e.property])
+
+	switch e.op {
+	case web.NotNull:
+		return actual != nil
+	case web.Eq:
+		return equal(actual, e.value, e.ignoreCase)
+	case web.Ne:
+		return !equal(actual, e.value, e.ignoreCase)
+	case web.Gt, web.Lt, web.Ge, web.Le:
+		c, ok := compare(actual, e.value, e.ignoreCase)
+		if !ok {
+			return false
+		}
+		switch e.op {
+		case web.Gt:
+			return c > 0
+		case web.Lt:
+			return c < 0
+		case web.Ge:
+			return c >= 0
+		default:
+			return c <= 0
+		}
+	case web.Like:
+		s, ok := actual.(string)
+		v, vok := e.value.(string)
+		if !ok || !vok {
+			return false
+		}
+		if e.ignoreCase {
+			s, v = strings.ToLower(s), strings.ToLower(v)
+		}
+		if e.mode == web.Start {
+			return strings.HasPrefix(s, v)
+		}
+		return strings.Contains(s, v)
+	case web.In:
+		for _, v := range e.values {
+			if equal(actual, v, e.ignoreCase) {
+				return true
+			}
+		}
+		return false
+	case web.ContainsAll:
+		items := toSlice(actual)
+		for _, v := range e.values {
+			found := false
+			for _, item := range items {
+				if equal(normalize(item), v, e.ignoreCase) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// equal gets whether or not two normalized values are equal.
+func equal(a interface{}, b interface{}, ignoreCase bool) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	if c, ok := compare(a, b, ignoreCase); ok {
+		return c == 0
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// compare compares two normalized values of the same type, returning false if they can't be ordered.
+func compare(a interface{}, b interface{}, ignoreCase bool) (int, bool) {
+	switch av := a.(type) {
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			// Timestamps may be stored as strings in records.
+			if bt, ok := b.(time.Time); ok {
+				if at, err := time.Parse(time.RFC3339Nano, av); err == nil {
+					return compareTimes(at, bt), true
+				}
+			}
+			return 0, false
+		}
+		if ignoreCase {
+			av, bv = strings.ToLower(av), strings.ToLower(bv)
+		}
+		return strings.Compare(av, bv), true
+	case float64:
+		bv, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case av < bv:
+			return -1, true
+		case av > bv:
+			return 1, true
+		}
+		return 0, true
+	case time.Time:
+		bv, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		return compareTimes(av, bv), true
+	case bool:
+		bv, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case av == bv:
+			return 0, true
+		case !av:
+			return -1, true
+		}
+		return 1, true
+	}
+
+	return 0, false
+}
+
+// compareTimes compares two timestamps.
+func compareTimes(a time.Time, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// compareForSort orders two record values, placing missing values first.
+func compareForSort(a interface{}, b interface{}) int {
+	a, b = normalize(a), normalize(b)
+
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	c, _ := compare(a, b, false)
+	return c
+}
+
+// toSlice converts a slice of any element type into a slice of interfaces.
+func toSlice(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+
+	items := make([]interface{}, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+
+	return items
+}
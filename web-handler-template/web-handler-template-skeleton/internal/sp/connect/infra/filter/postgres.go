@@ -0,0 +1,246 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sailpoint/atlas-go/atlas/web"
+)
+
+// PostgresFilter is a filter that renders to a parameterised Postgres boolean expression.
+type PostgresFilter struct {
+	root    *expr
+	columns map[string]string
+}
+
+// PostgresFilterBuilder is a web.FilterBuilder that builds PostgresFilters. Properties are
+// mapped to columns through an explicit allow-list so that no client input is ever
+// interpolated into the rendered SQL.
+type PostgresFilterBuilder struct {
+	columns map[string]string
+}
+
+// NewPostgresFilterBuilder constructs a new PostgresFilterBuilder, where columns maps each
+// queryable or sortable V3 property name to its column name.
+func NewPostgresFilterBuilder(columns map[string]string) *PostgresFilterBuilder {
+	return &PostgresFilterBuilder{columns: columns}
+}
+
+// And builds a filter that matches when all of the specified filters match.
+func (b *PostgresFilterBuilder) And(filters []web.Filter) (web.Filter, error) {
+	children, err := postgresChildren(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newFilter(&expr{kind: exprAnd, children: children}), nil
+}
+
+// Or builds a filter that matches when any of the specified filters match.
+func (b *PostgresFilterBuilder) Or(filters []web.Filter) (web.Filter, error) {
+	children, err := postgresChildren(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newFilter(&expr{kind: exprOr, children: children}), nil
+}
+
+// Not builds a filter that negates the specified filter.
+func (b *PostgresFilterBuilder) Not(filter web.Filter) (web.Filter, error) {
+	children, err := postgresChildren([]web.Filter{filter})
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newFilter(&expr{kind: exprNot, children: children}), nil
+}
+
+// NewFilter builds a filter that compares a column with a single value.
+func (b *PostgresFilterBuilder) NewFilter(op web.LogicalOperation, property string, valueObject interface{}) (web.Filter, error) {
+	return b.NewFilterWithMatchMode(op, property, valueObject, web.Anywhere)
+}
+
+// NewFilterWithMatchMode builds a filter that compares a column with a single value, where
+// LIKE operations are matched using the specified mode.
+func (b *PostgresFilterBuilder) NewFilterWithMatchMode(op web.LogicalOperation, property string, valueObject interface{}, mode web.MatchMode) (web.Filter, error) {
+	if err := checkOperation(op, false); err != nil {
+		return nil, err
+	}
+
+	if _, ok := b.columns[property]; !ok {
+		return nil, fmt.Errorf("invalid filter property: %s", property)
+	}
+
+	return b.newFilter(newCondition(op, property, valueObject, mode)), nil
+}
+
+// IgnoreCase builds a copy of the specified filter that compares strings case-insensitively.
+func (b *PostgresFilterBuilder) IgnoreCase(filter web.Filter) (web.Filter, error) {
+	f, ok := filter.(*PostgresFilter)
+	if !ok {
+		return nil, fmt.Errorf("unexpected filter type: %T", filter)
+	}
+
+	root, err := f.root.withIgnoreCase()
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newFilter(root), nil
+}
+
+// NewFilterWithValueList builds a filter that compares a column with a list of values.
+func (b *PostgresFilterBuilder) NewFilterWithValueList(op web.LogicalOperation, property string, valueList []interface{}) (web.Filter, error) {
+	if err := checkOperation(op, true); err != nil {
+		return nil, err
+	}
+
+	if _, ok := b.columns[property]; !ok {
+		return nil, fmt.Errorf("invalid filter property: %s", property)
+	}
+
+	return b.newFilter(newListCondition(op, property, valueList)), nil
+}
+
+// OrderBy renders the sorters as the body of an ORDER BY clause. An empty string is
+// returned if there are no sorters.
+func (b *PostgresFilterBuilder) OrderBy(sorters []web.ListSorter) (string, error) {
+	terms := make([]string, 0, len(sorters))
+	for _, s := range sorters {
+		column, ok := b.columns[s.Property]
+		if !ok {
+			return "", fmt.Errorf("invalid sort property: %s", s.Property)
+		}
+
+		if s.IsAscending {
+			terms = append(terms, column+" ASC")
+		} else {
+			terms = append(terms, column+" DESC")
+		}
+	}
+
+	return strings.Join(terms, ", "), nil
+}
+
+// newFilter wraps an expression in a PostgresFilter bound to this builder's columns.
+func (b *PostgresFilterBuilder) newFilter(root *expr) *PostgresFilter {
+	return &PostgresFilter{root: root, columns: b.columns}
+}
+
+// postgresChildren converts a slice of generic filters to expressions, ensuring each was built by a PostgresFilterBuilder.
+func postgresChildren(filters []web.Filter) ([]*expr, error) {
+	children := make([]*expr, 0, len(filters))
+	for _, f := range filters {
+		pf, ok := f.(*PostgresFilter)
+		if !ok {
+			return nil, fmt.Errorf("unexpected filter type: %T", f)
+		}
+		children = append(children, pf.root)
+	}
+
+	return children, nil
+}
+
+// Where renders the filter as a boolean expression suitable for a WHERE clause. Placeholders
+// are numbered following any arguments already bound to the statement, and the returned
+// slice contains those arguments followed by the filter's own.
+func (f *PostgresFilter) Where(args []interface{}) (string, []interface{}) {
+	w := &sqlWriter{args: args, columns: f.columns}
+	return w.write(f.root), w.args
+}
+
+// sqlWriter accumulates bind arguments while rendering an expression tree.
+type sqlWriter struct {
+	args    []interface{}
+	columns map[string]string
+}
+
+// bind appends an argument and returns its placeholder.
+func (w *sqlWriter) bind(v interface{}) string {
+	w.args = append(w.args, v)
+	return fmt.Sprintf("$%d", len(w.args))
+}
+
+// write renders an expression.
+func (w *sqlWriter) write(e *expr) string {
+	switch e.kind {
+	case exprAnd, exprOr:
+		joiner := " AND "
+		if e.kind == exprOr {
+			joiner = " OR "
+		}
+
+		terms := make([]string, 0, len(e.children))
+		for _, c := range e.children {
+			terms = append(terms, w.write(c))
+		}
+		return "(" + strings.Join(terms, joiner) + ")"
+	case exprNot:
+		return "NOT (" + w.write(e.children[0]) + ")"
+	}
+
+	column := w.columns[e.property]
+	if e.ignoreCase {
+		column = "LOWER(" + column + ")"
+	}
+
+	value := func(v interface{}) string {
+		if s, ok := v.(string); ok && e.ignoreCase {
+			return "LOWER(" + w.bind(s) + ")"
+		}
+		return w.bind(v)
+	}
+
+	switch e.op {
+	case web.NotNull:
+		return column + " IS NOT NULL"
+	case web.Eq:
+		if e.value == nil {
+			return column + " IS NULL"
+		}
+		return column + " = " + value(e.value)
+	case web.Ne:
+		if e.value == nil {
+			return column + " IS NOT NULL"
+		}
+		return column + " IS DISTINCT FROM " + value(e.value)
+	case web.Gt:
+		return column + " > " + value(e.value)
+	case web.Lt:
+		return column + " < " + value(e.value)
+	case web.Ge:
+		return column + " >= " + value(e.value)
+	case web.Le:
+		return column + " <= " + value(e.value)
+	case web.Like:
+		pattern := escapeLike(fmt.Sprint(e.value)) + "%"
+		if e.mode != web.Start {
+			pattern = "%" + pattern
+		}
+		if e.ignoreCase {
+			return w.columns[e.property] + " ILIKE " + w.bind(pattern)
+		}
+		return column + " LIKE " + w.bind(pattern)
+	case web.In:
+		placeholders := make([]string, 0, len(e.values))
+		for _, v := range e.values {
+			placeholders = append(placeholders, value(v))
+		}
+		return column + " IN (" + strings.Join(placeholders, ", ") + ")"
+	case web.ContainsAll:
+		placeholders := make([]string, 0, len(e.values))
+		for _, v := range e.values {
+			placeholders = append(placeholders, w.bind(v))
+		}
+		return w.columns[e.property] + " @> ARRAY[" + strings.Join(placeholders, ", ") + "]"
+	}
+
+	return "FALSE"
+}
+
+// escapeLike escapes the LIKE wildcard characters in a literal.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package globalconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ErrEndpointNotAllowed is returned for endpoints that commands mustn't be sent to.
+var ErrEndpointNotAllowed = errors.New("endpoint not allowed")
+
+// internalNetworks are the address ranges that endpoints mustn't resolve to, beyond the loopback,
+// link-local, multicast and unspecified addresses: private, shared (carrier-grade NAT) and
+// unique local addresses, which are those of internal services rather than connectors.
+var internalNetworks = parseNetworks("0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+// EndpointPolicy restricts the endpoints that commands, and with them service tokens, are sent to.
+// Endpoints must use https, have one of the allowed hosts and only resolve to public addresses.
+type EndpointPolicy struct {
+
+	// AllowedHosts are the hosts that endpoints may have: a host name, or "*." and a domain for any
+	// of its subdomains.
+	AllowedHosts []string
+
+	// LookupIP resolves the host of an endpoint. It's net.DefaultResolver.LookupIP if nil.
+	LookupIP func(ctx context.Context, network string, host string) ([]net.IP, error)
+}
+
+// Check returns an error wrapping ErrEndpointNotAllowed if the endpoint isn't allowed by the policy,
+// or an error resolving its host.
+func (p *EndpointPolicy) Check(ctx context.Context, endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEndpointNotAllowed, err)
+	}
+
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: %s isn't https", ErrEndpointNotAllowed, endpoint)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if !p.allowsHost(host) {
+		return fmt.Errorf("%w: %s isn't an allowed host", ErrEndpointNotAllowed, host)
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		lookupIP := p.LookupIP
+		if lookupIP == nil {
+			lookupIP = net.DefaultResolver.LookupIP
+		}
+
+		ips, err = lookupIP(ctx, "ip", host)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", host, err)
+		}
+	}
+
+	for _, ip := range ips {
+		if internal(ip) {
+			return fmt.Errorf("%w: %s resolves to the internal address %s", ErrEndpointNotAllowed, host, ip)
+		}
+	}
+
+	return nil
+}
+
+// allowsHost gets whether the host is one of the allowed hosts.
+func (p *EndpointPolicy) allowsHost(host string) bool {
+	for _, allowed := range p.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// internal gets whether the address isn't a public unicast address.
+func internal(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	for _, n := range internalNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseNetworks parses CIDR notation networks.
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, n)
+	}
+
+	return networks
+}
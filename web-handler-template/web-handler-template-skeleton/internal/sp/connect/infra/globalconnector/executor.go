@@ -0,0 +1,269 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package globalconnector executes the commands of connectors with the global topology, which are
+// hosted as services that sp-connect calls directly at the endpoint configured on their spec.
+package globalconnector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/atlas-go/atlas/client"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/tracing"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// maxErrorBodySize is how much of an error response is read to describe the error.
+const maxErrorBodySize = 64 * 1024
+
+// Config is the configuration of an Executor.
+type Config struct {
+
+	// DefaultTimeout bounds the calls of invocations that have no expiration.
+	DefaultTimeout time.Duration
+
+	// MaxResultSize is the size limit of a single streamed result, in bytes.
+	MaxResultSize int
+
+	// Endpoints restricts the endpoints that commands are sent to. It's nil for trusted endpoints,
+	// such as those of runtimes registered in Beacon.
+	Endpoints *EndpointPolicy
+}
+
+// Executor sends commands to connector endpoints over HTTP, authenticated with service tokens.
+type Executor struct {
+	clients client.InternalClientProvider
+	handler model.InvocationResultHandler
+	config  Config
+}
+
+// request is the body of a command sent to a connector endpoint.
+type request struct {
+	InvocationID string            `json:"invocationId"`
+	Type         model.CommandType `json:"type"`
+	Input        json.RawMessage   `json:"input"`
+	Expiration   time.Time         `json:"expiration"`
+}
+
+// errorResponse is the body of a failed response. Connectors describe errors with a type and
+// message; responses of atlas services (eg. a gateway in front of the connector) use a detail code
+// and messages instead.
+type errorResponse struct {
+	Type       string `json:"type"`
+	Message    string `json:"message"`
+	DetailCode string `json:"detailCode"`
+	Messages   []struct {
+		Text string `json:"text"`
+	} `json:"messages"`
+}
+
+// NewExecutor constructs a new Executor that reports results and completions to the handler.
+func NewExecutor(clients client.InternalClientProvider, handler model.InvocationResultHandler, config Config) *Executor {
+	e := &Executor{}
+	e.clients = clients
+	e.handler = handler
+	e.config = config
+
+	return e
+}
+
+// Execute reports the start of the invocation, sends the command to the connector endpoint, hands
+// each result streamed back to the result handler and then reports the invocation's completion. The
+// command isn't sent if its invocation has already finished, eg. because it was cancelled. The call is cancelled when the
+// invocation expires. The returned error is the *model.ConnectorError the invocation failed with, or
+// a failure of the result handler.
+func (e *Executor) Execute(ctx context.Context, org atlas.Org, endpoint string, cmd *model.RuntimeCommand) error {
+	started, err := e.handler.HandleStart(ctx, cmd)
+	if err != nil || !started {
+		return err
+	}
+
+	callErr := e.call(ctx, org, endpoint, cmd)
+
+	status := model.InvocationCompleted
+	var failure *model.InvocationFailure
+	if callErr != nil {
+		status = model.InvocationFailed
+
+		var connectorErr *model.ConnectorError
+		if errors.As(callErr, &connectorErr) {
+			failure = connectorErr.Failure()
+		} else {
+			failure = &model.InvocationFailure{Type: model.InvocationErrorInternal, Message: callErr.Error()}
+		}
+	}
+
+	if err := e.handler.HandleCompletion(ctx, cmd, status, failure); err != nil {
+		return err
+	}
+
+	return callErr
+}
+
+// CheckEndpoint returns an error wrapping ErrEndpointNotAllowed if commands mustn't be sent to the
+// endpoint.
+func (e *Executor) CheckEndpoint(ctx context.Context, endpoint string) error {
+	if e.config.Endpoints == nil {
+		return nil
+	}
+
+	return e.config.Endpoints.Check(ctx, endpoint)
+}
+
+// call sends the command and streams its results to the handler. The endpoint is checked right
+// before the service token is attached, and redirects aren't followed, so that the token is only
+// ever sent to an allowed endpoint.
+func (e *Executor) call(ctx context.Context, org atlas.Org, endpoint string, cmd *model.RuntimeCommand) error {
+	deadline := cmd.Expiration
+	if deadline.IsZero() {
+		deadline = time.Now().Add(e.config.DefaultTimeout)
+	}
+	if !time.Now().Before(deadline) {
+		return &model.ConnectorError{Category: model.ConnectorErrorTimeout, Type: "Expired", Message: "invocation expired before it was sent"}
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	body, err := json.Marshal(&request{InvocationID: cmd.InvocationID, Type: cmd.Type, Input: cmd.Input, Expiration: deadline})
+	if err != nil {
+		return err
+	}
+
+	if err := e.CheckEndpoint(ctx, endpoint); err != nil {
+		return &model.ConnectorError{Category: model.ConnectorErrorClient, Type: "EndpointNotAllowed", Message: err.Error()}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return &model.ConnectorError{Category: model.ConnectorErrorClient, Type: "InvalidEndpoint", Message: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/x-ndjson")
+	tracing.InjectHTTP(req)
+
+	client := *e.clients.GetInternalClient(atlas.TenantID(cmd.TenantID), org)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return transportError(ctx, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return responseError(res)
+	}
+
+	return e.stream(ctx, cmd, res.Body)
+}
+
+// stream hands each newline delimited result of the response body to the handler.
+func (e *Executor) stream(ctx context.Context, cmd *model.RuntimeCommand, body io.Reader) error {
+	// The scanner allows tokens up to the larger of the buffer's capacity and the limit.
+	size := 64 * 1024
+	if size > e.config.MaxResultSize {
+		size = e.config.MaxResultSize
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, size), e.config.MaxResultSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		output := bytes.TrimSpace(scanner.Bytes())
+		if len(output) == 0 {
+			continue
+		}
+
+		if !json.Valid(output) {
+			return &model.ConnectorError{Category: model.ConnectorErrorProtocol, Type: "InvalidResult", Message: fmt.Sprintf("result on line %d isn't valid JSON", line)}
+		}
+
+		if err := e.handler.HandleResult(ctx, cmd, json.RawMessage(append([]byte(nil), output...))); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return &model.ConnectorError{Category: model.ConnectorErrorProtocol, Type: "ResultTooLarge", Message: fmt.Sprintf("result on line %d exceeds %d bytes", line+1, e.config.MaxResultSize)}
+		}
+		return transportError(ctx, err)
+	}
+
+	return nil
+}
+
+// transportError classifies a failed request or response stream, which is a timeout if the
+// invocation expired in the meantime.
+func transportError(ctx context.Context, err error) *model.ConnectorError {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &model.ConnectorError{Category: model.ConnectorErrorTimeout, Type: "Expired", Message: "connector didn't finish before the invocation expired"}
+	}
+
+	return &model.ConnectorError{Category: model.ConnectorErrorTransport, Type: "Unreachable", Message: err.Error()}
+}
+
+// responseError builds the error of a response with a non-2xx status.
+func responseError(res *http.Response) *model.ConnectorError {
+	e := &model.ConnectorError{StatusCode: res.StatusCode}
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		e.Category = model.ConnectorErrorAuth
+	case res.StatusCode == http.StatusRequestTimeout:
+		e.Category = model.ConnectorErrorTimeout
+	case res.StatusCode == http.StatusTooManyRequests:
+		e.Category = model.ConnectorErrorThrottled
+	case res.StatusCode >= 400 && res.StatusCode <= 499:
+		e.Category = model.ConnectorErrorClient
+	case res.StatusCode >= 500 && res.StatusCode <= 599:
+		e.Category = model.ConnectorErrorServer
+	default:
+		e.Category = model.ConnectorErrorProtocol
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+
+	er := &errorResponse{}
+	if json.Unmarshal(body, er) == nil {
+		e.Type = er.Type
+		if e.Type == "" {
+			e.Type = er.DetailCode
+		}
+
+		e.Message = er.Message
+		if e.Message == "" && len(er.Messages) > 0 {
+			e.Message = er.Messages[0].Text
+		}
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+
+	if e.Type == "" {
+		e.Type = strings.ReplaceAll(http.StatusText(res.StatusCode), " ", "")
+	}
+	if e.Type == "" {
+		e.Type = fmt.Sprintf("HTTP%d", res.StatusCode)
+	}
+	if e.Message == "" {
+		e.Message = res.Status
+	}
+
+	return e
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package globalconnector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeClientProvider struct {
+	client *http.Client
+}
+
+func (p *fakeClientProvider) GetInternalClient(tenantID atlas.TenantID, org atlas.Org) *http.Client {
+	return p.client
+}
+
+type fakeResultHandler struct {
+	started bool
+	results []string
+	status  model.InvocationStatus
+	failure *model.InvocationFailure
+
+	// finished makes the invocation one that has already finished, whose command mustn't be sent.
+	finished bool
+}
+
+func (h *fakeResultHandler) HandleStart(ctx context.Context, cmd *model.RuntimeCommand) (bool, error) {
+	h.started = !h.finished
+	return h.started, nil
+}
+
+func (h *fakeResultHandler) HandleResult(ctx context.Context, cmd *model.RuntimeCommand, output json.RawMessage) error {
+	h.results = append(h.results, string(output))
+	return nil
+}
+
+func (h *fakeResultHandler) HandleCompletion(ctx context.Context, cmd *model.RuntimeCommand, status model.InvocationStatus, failure *model.InvocationFailure) error {
+	h.status = status
+	h.failure = failure
+	return nil
+}
+
+var testConfig = Config{DefaultTimeout: time.Second, MaxResultSize: 1024}
+
+// execute runs a command against a connector served by the handler.
+func execute(t *testing.T, handler http.HandlerFunc, expiration time.Time) (*fakeResultHandler, error) {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	results := &fakeResultHandler{}
+	e := NewExecutor(&fakeClientProvider{ts.Client()}, results, testConfig)
+
+	err := e.Execute(context.Background(), "acme", ts.URL+"/commands", &model.RuntimeCommand{
+		InvocationID: "inv-1",
+		TenantID:     "acme-id",
+		Type:         "std:account:list",
+		Input:        json.RawMessage(`{}`),
+		Expiration:   expiration,
+	})
+
+	return results, err
+}
+
+func TestExecuteStreamsResults(t *testing.T) {
+	expiration := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	results, err := execute(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := &request{}
+		if err := json.Unmarshal(body, req); err != nil || req.InvocationID != "inv-1" || req.Type != "std:account:list" || !req.Expiration.Equal(expiration) {
+			t.Errorf("unexpected request: %s", body)
+		}
+		if deadline, ok := r.Context().Deadline(); ok && deadline.After(expiration) {
+			t.Errorf("expected the call to end by the expiration, got a deadline of %s", deadline)
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = w.Write([]byte("{\"identity\":\"a\"}\n\n{\"identity\":\"b\"}"))
+	}, expiration)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(results.results, ",") != `{"identity":"a"},{"identity":"b"}` {
+		t.Errorf("unexpected results: %v", results.results)
+	}
+	if results.status != model.InvocationCompleted || results.failure != nil {
+		t.Errorf("unexpected completion: %s %+v", results.status, results.failure)
+	}
+	if !results.started {
+		t.Error("expected the invocation to be started")
+	}
+}
+
+func TestExecuteSkipsFinishedInvocations(t *testing.T) {
+	called := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer ts.Close()
+
+	results := &fakeResultHandler{finished: true}
+	e := NewExecutor(&fakeClientProvider{ts.Client()}, results, testConfig)
+
+	if err := e.Execute(context.Background(), "acme", ts.URL+"/commands", &model.RuntimeCommand{InvocationID: "inv-1", TenantID: "acme-id"}); err != nil {
+		t.Fatal(err)
+	}
+	if called || results.status != "" {
+		t.Errorf("expected a finished invocation's command not to be sent or completed, got called %v and status %q", called, results.status)
+	}
+}
+
+func TestExecuteMapsFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		expiration  time.Time
+		category    model.ConnectorErrorCategory
+		errorType   string
+		failureType model.InvocationErrorType
+	}{
+		{
+			name: "connector error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"type":"InvalidConfigurationError","message":"missing host"}`))
+			},
+			category:    model.ConnectorErrorClient,
+			errorType:   "InvalidConfigurationError",
+			failureType: model.InvocationErrorConnector,
+		},
+		{
+			name: "atlas error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"detailCode":"403 Forbidden","messages":[{"text":"insufficient rights"}]}`))
+			},
+			category:    model.ConnectorErrorAuth,
+			errorType:   "403 Forbidden",
+			failureType: model.InvocationErrorConnector,
+		},
+		{
+			name: "plain error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "down", http.StatusServiceUnavailable)
+			},
+			category:    model.ConnectorErrorServer,
+			errorType:   "ServiceUnavailable",
+			failureType: model.InvocationErrorConnector,
+		},
+		{
+			name: "throttled",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			category:    model.ConnectorErrorThrottled,
+			errorType:   "TooManyRequests",
+			failureType: model.InvocationErrorConnector,
+		},
+		{
+			name: "invalid result",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("{\"identity\":\"a\"}\nnot json\n"))
+			},
+			category:    model.ConnectorErrorProtocol,
+			errorType:   "InvalidResult",
+			failureType: model.InvocationErrorInvalidOutput,
+		},
+		{
+			name: "oversized result",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"identity":"` + strings.Repeat("a", 2048) + `"}`))
+			},
+			category:    model.ConnectorErrorProtocol,
+			errorType:   "ResultTooLarge",
+			failureType: model.InvocationErrorInvalidOutput,
+		},
+		{
+			name: "redirect",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/commands" {
+					t.Error("redirects shouldn't be followed")
+					return
+				}
+				http.Redirect(w, r, "/elsewhere", http.StatusFound)
+			},
+			category:    model.ConnectorErrorProtocol,
+			errorType:   "Found",
+			failureType: model.InvocationErrorInvalidOutput,
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// The server only notices the client going away once the body has been read.
+				_, _ = ioutil.ReadAll(r.Body)
+				<-r.Context().Done()
+			},
+			expiration:  time.Now().Add(50 * time.Millisecond),
+			category:    model.ConnectorErrorTimeout,
+			errorType:   "Expired",
+			failureType: model.InvocationErrorTimeout,
+		},
+		{
+			name: "expired",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				t.Error("an expired invocation shouldn't be sent")
+			},
+			expiration:  time.Now().Add(-time.Second),
+			category:    model.ConnectorErrorTimeout,
+			errorType:   "Expired",
+			failureType: model.InvocationErrorTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := execute(t, tt.handler, tt.expiration)
+
+			var connectorErr *model.ConnectorError
+			if !errors.As(err, &connectorErr) {
+				t.Fatalf("expected a connector error, got %v", err)
+			}
+			if connectorErr.Category != tt.category || connectorErr.Type != tt.errorType {
+				t.Errorf("unexpected error: %+v", connectorErr)
+			}
+			if results.status != model.InvocationFailed || results.failure == nil || results.failure.Type != tt.failureType {
+				t.Errorf("unexpected completion: %s %+v", results.status, results.failure)
+			}
+		})
+	}
+}
+
+func TestEndpointPolicy(t *testing.T) {
+	policy := &EndpointPolicy{
+		AllowedHosts: []string{"connector.example.com", "*.connectors.example.com", "10.0.0.1"},
+		LookupIP: func(ctx context.Context, network string, host string) ([]net.IP, error) {
+			if host == "internal.connectors.example.com" {
+				return []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("169.254.169.254")}, nil
+			}
+			return []net.IP{net.ParseIP("93.184.216.34")}, nil
+		},
+	}
+
+	tests := []struct {
+		endpoint string
+		allowed  bool
+	}{
+		{"https://connector.example.com/commands", true},
+		{"https://CONNECTOR.example.com:8443/commands", true},
+		{"https://acme.connectors.example.com/commands", true},
+		{"http://connector.example.com/commands", false},
+		{"https://connector.example.com.evil.com/commands", false},
+		{"https://connectors.example.com/commands", false},
+		{"https://internal.connectors.example.com/commands", false},
+		{"https://10.0.0.1/commands", false},
+		{"https://127.0.0.1/commands", false},
+	}
+
+	for _, tt := range tests {
+		err := policy.Check(context.Background(), tt.endpoint)
+		if tt.allowed && err != nil {
+			t.Errorf("%s: expected the endpoint to be allowed, got %v", tt.endpoint, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrEndpointNotAllowed) {
+			t.Errorf("%s: expected the endpoint not to be allowed, got %v", tt.endpoint, err)
+		}
+	}
+}
+
+func TestExecuteChecksTheEndpointBeforeCalling(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a disallowed endpoint shouldn't be called")
+	}))
+	defer ts.Close()
+
+	config := testConfig
+	config.Endpoints = &EndpointPolicy{AllowedHosts: []string{"127.0.0.1"}}
+
+	results := &fakeResultHandler{}
+	err := NewExecutor(&fakeClientProvider{ts.Client()}, results, config).Execute(context.Background(), "acme", ts.URL+"/commands", &model.RuntimeCommand{InvocationID: "inv-1", TenantID: "acme-id"})
+
+	var connectorErr *model.ConnectorError
+	if !errors.As(err, &connectorErr) || connectorErr.Type != "EndpointNotAllowed" {
+		t.Errorf("expected the endpoint not to be allowed, got %v", err)
+	}
+	if results.status != model.InvocationFailed {
+		t.Errorf("expected the invocation to fail, got %s", results.status)
+	}
+}
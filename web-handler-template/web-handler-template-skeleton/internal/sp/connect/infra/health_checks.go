@@ -0,0 +1,52 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/sailpoint/atlas-go/atlas/config"
+	"github.com/sailpoint/atlas-go/atlas/health"
+	"github.com/sailpoint/atlas-go/atlas/queue"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/healthcheck"
+)
+
+// queueURLKeys are the config keys of the SQS queues the service uses.
+var queueURLKeys = []string{"INTERNAL_COMMAND_QUEUE_URL", "RUNTIME_COMMAND_QUEUE_URL", "RESPONSE_QUEUE_URL"}
+
+// tableNameKeys are the config keys of the DynamoDB tables the service uses.
+var tableNameKeys = []string{"CONNECTOR_INVOCATION_TABLE_NAME", "CONNECTOR_OUTBOX_TABLE_NAME", "CONNECTOR_AUDIT_TABLE_NAME"}
+
+// registerHealthChecks registers a health check for each configured backend. atlas caches each result
+// for 5s, so backends aren't probed on every request.
+func (s *ConnectService) registerHealthChecks() {
+	latency := healthcheck.LatencyThresholds(
+		config.GetDuration(s.Config, "HEALTH_LATENCY_WARN", 250*time.Millisecond),
+		config.GetDuration(s.Config, "HEALTH_LATENCY_ERROR", 2*time.Second))
+
+	health.RegisterCheck("redis", healthcheck.Redis(s.RedisClient, latency))
+
+	// Without configured brokers, atlas falls back to localhost, which isn't worth failing readiness over.
+	if servers := config.GetString(s.Config, "ATLAS_KAFKA_SERVERS", ""); servers != "" {
+		health.RegisterCheck("kafka", healthcheck.Kafka(servers, 2*time.Second))
+	}
+
+	for _, key := range tableNameKeys {
+		if table := config.GetString(s.Config, key, ""); table != "" {
+			health.RegisterCheck("dynamo:"+table, healthcheck.DynamoTable(s.dynamoClient, table, latency))
+		}
+	}
+
+	depth := config.GetInt(s.Config, "HEALTH_QUEUE_DEPTH_WARN", 1000)
+	for _, key := range queueURLKeys {
+		if url := config.GetString(s.Config, key, ""); url != "" {
+			health.RegisterCheck("sqs:"+path.Base(url), healthcheck.QueueDepth(s.queueService, queue.ID(url), depth))
+		}
+	}
+}
+
+// newDynamoClient constructs the DynamoDB client shared by the service's tables.
+func newDynamoClient() *dynamodb.DynamoDB {
+	return dynamodb.New(config.GlobalAwsSession())
+}
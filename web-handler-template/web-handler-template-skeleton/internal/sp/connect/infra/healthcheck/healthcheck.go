@@ -0,0 +1,189 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package healthcheck provides atlas health checks for the service's backends, and liveness and
+// readiness handlers. Each check reports WARN or ERROR against configurable thresholds so that a slow
+// or backed up dependency can be told apart from an unreachable one.
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/go-redis/redis/v8"
+	"github.com/sailpoint/atlas-go/atlas/health"
+	"github.com/sailpoint/atlas-go/atlas/queue"
+	"github.com/sailpoint/atlas-go/atlas/web"
+)
+
+// Thresholds are the values at which a check reports WARN and ERROR.
+type Thresholds struct {
+	Warn  float64
+	Error float64
+}
+
+// LatencyThresholds constructs Thresholds in milliseconds from durations.
+func LatencyThresholds(warn time.Duration, err time.Duration) Thresholds {
+	return Thresholds{Warn: millis(warn), Error: millis(err)}
+}
+
+// status gets the status of a value against the thresholds.
+func (t Thresholds) status(value float64) health.Status {
+	switch {
+	case value >= t.Error:
+		return health.StatusError
+	case value >= t.Warn:
+		return health.StatusWarn
+	}
+
+	return health.StatusOK
+}
+
+// Probe performs a round trip to a backend.
+type Probe func(ctx context.Context) error
+
+// Latency is a check that runs a probe, reporting ERROR if it fails and otherwise rating how long it took.
+func Latency(probe Probe, thresholds Thresholds) health.Check {
+	return health.CheckFunc(func(ctx context.Context) (*health.CheckResult, error) {
+		start := time.Now()
+		err := probe(ctx)
+		latency := millis(time.Since(start))
+
+		if err != nil {
+			return health.CheckResultError().AddError(err).Add("latencyMs", latency), nil
+		}
+
+		return health.NewCheckResult(thresholds.status(latency)).Add("latencyMs", latency), nil
+	})
+}
+
+// Redis checks that redis responds to a ping.
+func Redis(client redis.Cmdable, thresholds Thresholds) health.Check {
+	return Latency(func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}, thresholds)
+}
+
+// TableDescriber describes DynamoDB tables; it's implemented by *dynamodb.DynamoDB.
+type TableDescriber interface {
+	DescribeTableWithContext(ctx aws.Context, input *dynamodb.DescribeTableInput, opts ...request.Option) (*dynamodb.DescribeTableOutput, error)
+}
+
+// DynamoTable checks that a table can be described and is active. A table that's being updated is
+// still usable, so it's a warning.
+func DynamoTable(client TableDescriber, table string, thresholds Thresholds) health.Check {
+	return Latency(func(ctx context.Context) error {
+		out, err := client.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+		if err != nil {
+			return err
+		}
+
+		switch status := aws.StringValue(out.Table.TableStatus); status {
+		case dynamodb.TableStatusActive, dynamodb.TableStatusUpdating:
+			return nil
+		default:
+			return fmt.Errorf("table %s is %s", table, status)
+		}
+	}, thresholds)
+}
+
+// QueueDepth checks the number of messages waiting in a queue, warning once the pending count reaches
+// warn. A backlog isn't cleared by taking pods out of service, so the check never reports ERROR, even
+// when the counts can't be read.
+func QueueDepth(service queue.Service, id queue.ID, warn int) health.Check {
+	return health.CheckFunc(func(ctx context.Context) (*health.CheckResult, error) {
+		counts, err := service.MessageCounts(ctx, id)
+		if err != nil {
+			return health.CheckResultWarn().AddError(err), nil
+		}
+
+		status := health.StatusOK
+		if counts.Pending >= warn {
+			status = health.StatusWarn
+		}
+
+		return health.NewCheckResult(status).
+			Add("pending", counts.Pending).
+			Add("inFlight", counts.InFlight), nil
+	})
+}
+
+// Kafka checks that the bootstrap servers (a comma separated list of host:port) accept connections.
+// The producer keeps its own connections, so an unreachable broker is a warning as long as another
+// one is reachable.
+func Kafka(servers string, timeout time.Duration) health.Check {
+	return health.CheckFunc(func(ctx context.Context) (*health.CheckResult, error) {
+		var reachable, unreachable []string
+		dialer := net.Dialer{Timeout: timeout}
+
+		for _, server := range strings.Split(servers, ",") {
+			server = strings.TrimSpace(server)
+			if server == "" {
+				continue
+			}
+
+			conn, err := dialer.DialContext(ctx, "tcp", server)
+			if err != nil {
+				unreachable = append(unreachable, server)
+				continue
+			}
+			conn.Close()
+			reachable = append(reachable, server)
+		}
+
+		status := health.StatusOK
+		switch {
+		case len(reachable) == 0:
+			status = health.StatusError
+		case len(unreachable) > 0:
+			status = health.StatusWarn
+		}
+
+		return health.NewCheckResult(status).
+			Add("reachable", reachable).
+			Add("unreachable", unreachable), nil
+	})
+}
+
+// LivenessHandler reports whether the process is alive. It doesn't check any backend, so that pods
+// aren't restarted because a dependency is degraded.
+func LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		result := health.NewAggregateCheckResult()
+		result.AddCheck(ctx, "go-runtime", health.CheckFunc(health.RuntimeCheck))
+
+		writeResult(ctx, w, result)
+	}
+}
+
+// ReadinessHandler reports whether the service can serve traffic, responding 503 if any registered
+// check is in ERROR. Warnings don't take the pod out of service.
+func ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		writeResult(ctx, w, health.CheckAll(ctx))
+	}
+}
+
+// writeResult writes an aggregate result, with a 503 status if it's in ERROR.
+func writeResult(ctx context.Context, w http.ResponseWriter, result *health.AggregateCheckResult) {
+	if result.Status == health.StatusError {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	web.WriteJSON(ctx, w, result)
+}
+
+// millis converts a duration to fractional milliseconds.
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/sailpoint/atlas-go/atlas/health"
+	"github.com/sailpoint/atlas-go/atlas/queue"
+)
+
+func TestLatency(t *testing.T) {
+	thresholds := LatencyThresholds(10*time.Millisecond, time.Hour)
+
+	tests := []struct {
+		probe    Probe
+		expected health.Status
+	}{
+		{func(ctx context.Context) error { return nil }, health.StatusOK},
+		{func(ctx context.Context) error { time.Sleep(15 * time.Millisecond); return nil }, health.StatusWarn},
+		{func(ctx context.Context) error { return errors.New("connection refused") }, health.StatusError},
+	}
+
+	for i, tt := range tests {
+		result, err := Latency(tt.probe, thresholds).CheckHealth(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != tt.expected {
+			t.Errorf("%d: expected %s, got %s (%v)", i, tt.expected, result.Status, result.Details)
+		}
+	}
+}
+
+type fakeTableDescriber struct {
+	status string
+}
+
+func (d *fakeTableDescriber) DescribeTableWithContext(ctx aws.Context, input *dynamodb.DescribeTableInput, opts ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	return &dynamodb.DescribeTableOutput{Table: &dynamodb.TableDescription{TableName: input.TableName, TableStatus: aws.String(d.status)}}, nil
+}
+
+func TestDynamoTable(t *testing.T) {
+	thresholds := LatencyThresholds(time.Hour, time.Hour)
+
+	for status, expected := range map[string]health.Status{
+		dynamodb.TableStatusActive:   health.StatusOK,
+		dynamodb.TableStatusUpdating: health.StatusOK,
+		dynamodb.TableStatusDeleting: health.StatusError,
+	} {
+		result, _ := DynamoTable(&fakeTableDescriber{status: status}, "invocations", thresholds).CheckHealth(context.Background())
+		if result.Status != expected {
+			t.Errorf("%s: expected %s, got %s", status, expected, result.Status)
+		}
+	}
+}
+
+type fakeQueueService struct {
+	queue.Service
+	pending int
+}
+
+func (s *fakeQueueService) MessageCounts(ctx context.Context, id queue.ID) (*queue.MessageCounts, error) {
+	if s.pending < 0 {
+		return nil, errors.New("access denied")
+	}
+
+	return &queue.MessageCounts{Pending: s.pending, InFlight: 3}, nil
+}
+
+func TestQueueDepth(t *testing.T) {
+	for pending, expected := range map[int]health.Status{10: health.StatusOK, 100: health.StatusWarn, 50000: health.StatusWarn} {
+		result, err := QueueDepth(&fakeQueueService{pending: pending}, "q", 100).CheckHealth(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != expected || result.Details["pending"] != pending {
+			t.Errorf("%d: expected %s, got %s (%v)", pending, expected, result.Status, result.Details)
+		}
+	}
+
+	result, err := QueueDepth(&fakeQueueService{pending: -1}, "q", 100).CheckHealth(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != health.StatusWarn {
+		t.Errorf("expected unreadable counts to warn, got %s", result.Status)
+	}
+}
+
+func TestKafka(t *testing.T) {
+	up, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer up.Close()
+
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down.Close()
+
+	tests := []struct {
+		servers  string
+		expected health.Status
+	}{
+		{up.Addr().String(), health.StatusOK},
+		{up.Addr().String() + "," + down.Addr().String(), health.StatusWarn},
+		{down.Addr().String(), health.StatusError},
+	}
+
+	for _, tt := range tests {
+		result, _ := Kafka(tt.servers, time.Second).CheckHealth(context.Background())
+		if result.Status != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.servers, tt.expected, result.Status)
+		}
+	}
+}
+
+func TestLivenessAndReadiness(t *testing.T) {
+	health.RegisterCheck("test-backend", health.CheckFunc(func(ctx context.Context) (*health.CheckResult, error) {
+		return nil, errors.New("unreachable")
+	}))
+
+	live := httptest.NewRecorder()
+	LivenessHandler()(live, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if live.Code != http.StatusOK {
+		t.Errorf("expected liveness to ignore backends, got %d", live.Code)
+	}
+
+	ready := httptest.NewRecorder()
+	ReadinessHandler()(ready, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if ready.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected readiness to fail, got %d: %s", ready.Code, ready.Body)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/queue"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentedQueueService is a queue.Service that records the latency of every operation of the
+// underlying service in sp_connect_queue_latency_ms, and of publishing in
+// sp_connect_publish_sqs_response_latency_ms too. It propagates trace context through message
+// attributes (see startMessageSpan).
+type instrumentedQueueService struct {
+	service queue.Service
+}
+
+// newInstrumentedQueueService wraps a queue.Service.
+func newInstrumentedQueueService(service queue.Service) *instrumentedQueueService {
+	return &instrumentedQueueService{service: service}
+}
+
+// CreateQueue creates a new queue with the specified name and options.
+func (s *instrumentedQueueService) CreateQueue(ctx context.Context, name string, options queue.CreateQueueOptions) (queue.ID, error) {
+	defer observeOp(queueLatency, "create_queue", time.Now())
+	return s.service.CreateQueue(ctx, name, options)
+}
+
+// DeleteQueue deletes the queue with the specified ID.
+func (s *instrumentedQueueService) DeleteQueue(ctx context.Context, id queue.ID) error {
+	defer observeOp(queueLatency, "delete_queue", time.Now())
+	return s.service.DeleteQueue(ctx, id)
+}
+
+// Publish sends a message to the queue within a producer span, whose context is added to the message attributes.
+func (s *instrumentedQueueService) Publish(ctx context.Context, id queue.ID, v interface{}, options queue.PublishOptions) (err error) {
+	defer observeOp(queueLatency, "publish", time.Now())
+	defer observe(publishSQSLatency, time.Now())
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "send "+string(id),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(label.String("messaging.system", "sqs"), label.String("messaging.destination", string(id))))
+	defer func() { endSpan(span, err) }()
+
+	attributes := make(map[string]string, len(options.MessageAttributes)+2)
+	for k, v := range options.MessageAttributes {
+		attributes[k] = v
+	}
+	tracing.Inject(ctx, attributes)
+	options.MessageAttributes = attributes
+
+	return s.service.Publish(ctx, id, v, options)
+}
+
+// DeleteMessage removes a message from the queue.
+func (s *instrumentedQueueService) DeleteMessage(ctx context.Context, id queue.ID, receiptHandle queue.ReceiptHandle) error {
+	defer observeOp(queueLatency, "delete_message", time.Now())
+	return s.service.DeleteMessage(ctx, id, receiptHandle)
+}
+
+// SetVisibilityTimeout sets the duration of time before the message is made available to other consumers.
+func (s *instrumentedQueueService) SetVisibilityTimeout(ctx context.Context, id queue.ID, receiptHandle queue.ReceiptHandle, timeout time.Duration) error {
+	defer observeOp(queueLatency, "set_visibility_timeout", time.Now())
+	return s.service.SetVisibilityTimeout(ctx, id, receiptHandle, timeout)
+}
+
+// Poll reads messages from the queue, requesting the trace context attributes along with any others.
+func (s *instrumentedQueueService) Poll(ctx context.Context, id queue.ID, timeout time.Duration, options queue.PollOptions) ([]queue.Message, error) {
+	defer observeOp(queueLatency, "poll", time.Now())
+
+	if !containsString(options.AttributeNames, "All") {
+		options.AttributeNames = append(append([]string{}, options.AttributeNames...), tracing.Fields()...)
+	}
+
+	return s.service.Poll(ctx, id, timeout, options)
+}
+
+// containsString gets whether the slice contains the string.
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MessageCounts returns the count of pending and in-flight messages in the queue.
+func (s *instrumentedQueueService) MessageCounts(ctx context.Context, id queue.ID) (*queue.MessageCounts, error) {
+	defer observeOp(queueLatency, "message_counts", time.Now())
+	return s.service.MessageCounts(ctx, id)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package internalconnector executes the commands of connectors with the internal topology, which
+// sp-connect answers itself rather than sending them anywhere. Each command is answered with the
+// response given in its invoke request, or its standard output example, so that invocations can be
+// exercised end to end without a connector.
+package internalconnector
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/schema"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// Response is what the internal connector answers a command with: its results, in order, and the
+// error it then fails with, if any.
+type Response struct {
+	Output []json.RawMessage     `json:"output"`
+	Err    *model.ConnectorError `json:"err"`
+}
+
+// ParseResponse parses the response of an invoke request. It's nil if raw is empty.
+func ParseResponse(raw json.RawMessage) (*Response, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	r := &Response{}
+	if err := json.Unmarshal(raw, r); err != nil {
+		return nil, model.NewBadRequestError("parse response: %v", err)
+	}
+
+	return r, nil
+}
+
+// Executor answers commands with their responses.
+type Executor struct {
+	registry *schema.Registry
+	handler  model.InvocationResultHandler
+}
+
+// NewExecutor constructs a new Executor that reports results and completions to the handler. The
+// registry supplies the output examples of commands invoked without a response.
+func NewExecutor(registry *schema.Registry, handler model.InvocationResultHandler) *Executor {
+	e := &Executor{}
+	e.registry = registry
+	e.handler = handler
+
+	return e
+}
+
+// Execute reports the start of the invocation, hands each result of the response to the result
+// handler and then reports the invocation's completion, as failed if the response has an error.
+// Without a response, the command is answered with its standard output example, if it has one. The
+// command isn't answered if its invocation has already finished, eg. because it was cancelled.
+func (e *Executor) Execute(ctx context.Context, cmd *model.RuntimeCommand, response *Response) error {
+	started, err := e.handler.HandleStart(ctx, cmd)
+	if err != nil || !started {
+		return err
+	}
+
+	if response == nil {
+		response = &Response{}
+		if c := e.registry.Command(cmd.Type); c != nil && len(c.OutputExample) > 0 {
+			response.Output = []json.RawMessage{c.OutputExample}
+		}
+	}
+
+	for _, output := range response.Output {
+		if err := e.handler.HandleResult(ctx, cmd, output); err != nil {
+			return err
+		}
+	}
+
+	if response.Err != nil {
+		return e.handler.HandleCompletion(ctx, cmd, model.InvocationFailed, response.Err.Failure())
+	}
+
+	return e.handler.HandleCompletion(ctx, cmd, model.InvocationCompleted, nil)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package internalconnector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/schema"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+const testDistDir = "../../../../../dist"
+
+type fakeResultHandler struct {
+	started bool
+	results []string
+	status  model.InvocationStatus
+	failure *model.InvocationFailure
+
+	// finished makes the invocation one that has already finished, whose command mustn't be answered.
+	finished bool
+}
+
+func (h *fakeResultHandler) HandleStart(ctx context.Context, cmd *model.RuntimeCommand) (bool, error) {
+	h.started = !h.finished
+	return h.started, nil
+}
+
+func (h *fakeResultHandler) HandleResult(ctx context.Context, cmd *model.RuntimeCommand, output json.RawMessage) error {
+	h.results = append(h.results, string(output))
+	return nil
+}
+
+func (h *fakeResultHandler) HandleCompletion(ctx context.Context, cmd *model.RuntimeCommand, status model.InvocationStatus, failure *model.InvocationFailure) error {
+	h.status = status
+	h.failure = failure
+	return nil
+}
+
+func newTestExecutor(t *testing.T, handler *fakeResultHandler) *Executor {
+	t.Helper()
+
+	registry, err := schema.NewRegistry(testDistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewExecutor(registry, handler)
+}
+
+func TestExecuteAnswersWithTheResponse(t *testing.T) {
+	handler := &fakeResultHandler{}
+	response, err := ParseResponse(json.RawMessage(`{"output":[{"identity":"a"},{"identity":"b"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newTestExecutor(t, handler).Execute(context.Background(), &model.RuntimeCommand{Type: model.CommandAccountList}, response); err != nil {
+		t.Fatal(err)
+	}
+	if !handler.started || len(handler.results) != 2 || handler.results[1] != `{"identity":"b"}` || handler.status != model.InvocationCompleted {
+		t.Errorf("unexpected execution %+v", handler)
+	}
+}
+
+func TestExecuteFailsWithTheResponseError(t *testing.T) {
+	handler := &fakeResultHandler{}
+	response, err := ParseResponse(json.RawMessage(`{"output":[],"err":{"category":"ConnectorError","type":"notFound","message":"Account john.doe does not exist"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newTestExecutor(t, handler).Execute(context.Background(), &model.RuntimeCommand{Type: model.CommandAccountRead}, response); err != nil {
+		t.Fatal(err)
+	}
+	if handler.status != model.InvocationFailed || handler.failure == nil || handler.failure.Connector == nil || handler.failure.Connector.Type != "notFound" {
+		t.Errorf("unexpected failure %+v", handler.failure)
+	}
+}
+
+func TestExecuteWithoutResponseAnswersWithTheOutputExample(t *testing.T) {
+	handler := &fakeResultHandler{}
+
+	if err := newTestExecutor(t, handler).Execute(context.Background(), &model.RuntimeCommand{Type: model.CommandAccountList}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(handler.results) != 1 || handler.status != model.InvocationCompleted {
+		t.Errorf("expected the output example, got %+v", handler)
+	}
+}
+
+func TestExecuteSkipsFinishedInvocations(t *testing.T) {
+	handler := &fakeResultHandler{finished: true}
+
+	if err := newTestExecutor(t, handler).Execute(context.Background(), &model.RuntimeCommand{Type: model.CommandAccountList}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(handler.results) != 0 || handler.status != "" {
+		t.Errorf("expected the command not to be answered, got %+v", handler)
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	if r, err := ParseResponse(nil); r != nil || err != nil {
+		t.Errorf("expected no response, got %+v, %v", r, err)
+	}
+
+	var badRequest *model.BadRequestError
+	if _, err := ParseResponse(json.RawMessage(`{"output":{}}`)); !errors.As(err, &badRequest) {
+		t.Errorf("expected a bad request, got %v", err)
+	}
+}
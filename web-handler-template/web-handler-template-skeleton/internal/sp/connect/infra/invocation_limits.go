@@ -0,0 +1,108 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/config"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/ratelimit"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// newInvocationLimiter constructs the invocation limiter from config. A limit of zero disables it.
+func (s *ConnectService) newInvocationLimiter() (*ratelimit.Limiter, error) {
+	tenantRate, err := strconv.ParseFloat(config.GetString(s.Config, "INVOCATION_TENANT_RATE", "10"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid INVOCATION_TENANT_RATE: %w", err)
+	}
+
+	instanceRate, err := strconv.ParseFloat(config.GetString(s.Config, "INVOCATION_INSTANCE_RATE", "2"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid INVOCATION_INSTANCE_RATE: %w", err)
+	}
+
+	cfg := ratelimit.Config{
+		Tenant: ratelimit.Limits{
+			Rate:        tenantRate,
+			Burst:       config.GetInt(s.Config, "INVOCATION_TENANT_BURST", 50),
+			Concurrency: config.GetInt(s.Config, "INVOCATION_TENANT_CONCURRENCY", 100),
+		},
+		Instance: ratelimit.Limits{
+			Rate:        instanceRate,
+			Burst:       config.GetInt(s.Config, "INVOCATION_INSTANCE_BURST", 20),
+			Concurrency: config.GetInt(s.Config, "INVOCATION_INSTANCE_CONCURRENCY", 20),
+		},
+		Lease:                 config.GetDuration(s.Config, "INVOCATION_SLOT_LEASE", 15*time.Minute),
+		ConcurrencyRetryAfter: config.GetDuration(s.Config, "INVOCATION_CONCURRENCY_RETRY_AFTER", 5*time.Second),
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid invocation limits: %w", err)
+	}
+
+	return ratelimit.NewLimiter(s.RedisClient, cfg, s.FeatureStore), nil
+}
+
+// invocationObservers is an InvocationObserver that notifies each of its observers in turn.
+type invocationObservers []model.InvocationObserver
+
+// InvocationCreated notifies each observer that the invocation was created.
+func (o invocationObservers) InvocationCreated(inv *model.Invocation) {
+	for _, observer := range o {
+		observer.InvocationCreated(inv)
+	}
+}
+
+// InvocationStarted notifies each observer that the invocation was started.
+func (o invocationObservers) InvocationStarted(inv *model.Invocation) {
+	for _, observer := range o {
+		observer.InvocationStarted(inv)
+	}
+}
+
+// InvocationFirstResult notifies each observer that the invocation received its first result.
+func (o invocationObservers) InvocationFirstResult(inv *model.Invocation) {
+	for _, observer := range o {
+		observer.InvocationFirstResult(inv)
+	}
+}
+
+// InvocationFinished notifies each observer that the invocation finished.
+func (o invocationObservers) InvocationFinished(inv *model.Invocation) {
+	for _, observer := range o {
+		observer.InvocationFinished(inv)
+	}
+}
+
+// invocationSlotReleaser is an InvocationObserver that frees the concurrency slot of each invocation
+// once it finishes, so that the slot doesn't stay taken until its lease expires.
+type invocationSlotReleaser struct {
+	limiter model.InvocationLimiter
+}
+
+// newInvocationSlotReleaser constructs a new invocationSlotReleaser.
+func newInvocationSlotReleaser(limiter model.InvocationLimiter) *invocationSlotReleaser {
+	return &invocationSlotReleaser{limiter: limiter}
+}
+
+// InvocationCreated does nothing; the slot was taken when the invocation was admitted.
+func (r *invocationSlotReleaser) InvocationCreated(inv *model.Invocation) {}
+
+// InvocationStarted does nothing.
+func (r *invocationSlotReleaser) InvocationStarted(inv *model.Invocation) {}
+
+// InvocationFirstResult does nothing.
+func (r *invocationSlotReleaser) InvocationFirstResult(inv *model.Invocation) {}
+
+// InvocationFinished releases the invocation's slot.
+func (r *invocationSlotReleaser) InvocationFinished(inv *model.Invocation) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := r.limiter.Release(ctx, inv.TenantID, inv.ConnectorInstanceID, inv.ID); err != nil {
+		log.Warnf(ctx, "release slot of invocation %s: %v", inv.ID, err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// invocationBuckets are the histogram buckets, in milliseconds, of the invocation metrics. Invocations
+// can run for much longer than storage operations, so they reach up to an hour.
+var invocationBuckets = []float64{10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 300000, 900000, 3600000}
+
+// invocationLabels are the labels of every invocation metric: the command type and the spec topology.
+var invocationLabels = []string{"type", "topology"}
+
+var (
+	invocationsCreated   = newInvocationCounter("sp_connect_invocations_created_total", "Invocations created", invocationLabels...)
+	invocationsCompleted = newInvocationCounter("sp_connect_invocations_completed_total", "Invocations that completed successfully", invocationLabels...)
+	invocationsFailed    = newInvocationCounter("sp_connect_invocations_failed_total", "Invocations that failed, by error type", append(invocationLabels, "errorType")...)
+	invocationsCancelled = newInvocationCounter("sp_connect_invocations_cancelled_total", "Invocations cancelled before they finished", invocationLabels...)
+	invocationsExpired   = newInvocationCounter("sp_connect_invocations_expired_total", "Invocations that expired before they finished", invocationLabels...)
+
+	invocationQueueWait   = newInvocationHistogram("sp_connect_invocation_queue_wait_ms", "Time from an invocation being created to it being picked up for execution")
+	invocationExecution   = newInvocationHistogram("sp_connect_invocation_execution_ms", "Time from an invocation being picked up for execution to it finishing")
+	invocationFirstResult = newInvocationHistogram("sp_connect_invocation_first_result_ms", "Time from an invocation being created to its first result")
+)
+
+// newInvocationCounter registers an invocation counter.
+func newInvocationCounter(name string, help string, labels ...string) *prometheus.CounterVec {
+	return promauto.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+}
+
+// newInvocationHistogram registers an invocation histogram.
+func newInvocationHistogram(name string, help string) *prometheus.HistogramVec {
+	return promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help,
+		Buckets: invocationBuckets,
+	}, invocationLabels)
+}
+
+// knownErrorTypes bounds the values of the errorType label. Anything else is recorded as "other".
+var knownErrorTypes = map[model.InvocationErrorType]bool{
+	model.InvocationErrorConnector:     true,
+	model.InvocationErrorTimeout:       true,
+	model.InvocationErrorTransport:     true,
+	model.InvocationErrorInvalidOutput: true,
+	model.InvocationErrorInternal:      true,
+}
+
+// invocationMetrics is an InvocationObserver that records invocation lifecycle metrics.
+type invocationMetrics struct{}
+
+// newInvocationMetrics constructs a new invocationMetrics.
+func newInvocationMetrics() *invocationMetrics {
+	return &invocationMetrics{}
+}
+
+// InvocationCreated counts the created invocation.
+func (m *invocationMetrics) InvocationCreated(inv *model.Invocation) {
+	invocationsCreated.WithLabelValues(invocationLabelValues(inv)...).Inc()
+}
+
+// InvocationStarted records how long the invocation waited to be picked up.
+func (m *invocationMetrics) InvocationStarted(inv *model.Invocation) {
+	observeBetween(invocationQueueWait, inv, inv.CreatedAt, inv.StartedAt)
+}
+
+// InvocationFirstResult records how long the invocation took to produce its first result.
+func (m *invocationMetrics) InvocationFirstResult(inv *model.Invocation) {
+	observeBetween(invocationFirstResult, inv, inv.CreatedAt, inv.FirstResultAt)
+}
+
+// InvocationFinished counts the invocation by its final status and records how long it executed for.
+func (m *invocationMetrics) InvocationFinished(inv *model.Invocation) {
+	labels := invocationLabelValues(inv)
+
+	switch inv.Status {
+	case model.InvocationCompleted:
+		invocationsCompleted.WithLabelValues(labels...).Inc()
+	case model.InvocationFailed:
+		errorType := inv.ErrorType
+		if !knownErrorTypes[errorType] {
+			errorType = "other"
+		}
+		invocationsFailed.WithLabelValues(append(labels, string(errorType))...).Inc()
+	case model.InvocationCancelled:
+		invocationsCancelled.WithLabelValues(labels...).Inc()
+	case model.InvocationExpired:
+		invocationsExpired.WithLabelValues(labels...).Inc()
+	}
+
+	// Invocations that were cancelled or expired while still queued never executed.
+	if !inv.StartedAt.IsZero() {
+		observeBetween(invocationExecution, inv, inv.StartedAt, inv.FinishedAt)
+	}
+}
+
+// invocationLabelValues returns the values of invocationLabels for an invocation.
+func invocationLabelValues(inv *model.Invocation) []string {
+	return []string{string(inv.Type), string(inv.Topology)}
+}
+
+// observeBetween records the time between two lifecycle timestamps, skipping unset ones.
+func observeBetween(h *prometheus.HistogramVec, inv *model.Invocation, from time.Time, to time.Time) {
+	if from.IsZero() || to.IsZero() {
+		return
+	}
+
+	h.WithLabelValues(invocationLabelValues(inv)...).Observe(float64(to.Sub(from)) / float64(time.Millisecond))
+}
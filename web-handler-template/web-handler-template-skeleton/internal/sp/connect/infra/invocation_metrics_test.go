@@ -0,0 +1,183 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/memory"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// The metrics are registered globally, so each test uses its own command type to keep its series apart.
+
+func counterValue(t *testing.T, c *prometheus.CounterVec, labels ...string) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := c.WithLabelValues(labels...).Write(m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m.GetCounter().GetValue()
+}
+
+func histogramSample(t *testing.T, h *prometheus.HistogramVec, labels ...string) (uint64, float64) {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := h.WithLabelValues(labels...).(prometheus.Metric).Write(m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestInvocationMetricsLifecycle(t *testing.T) {
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	inv := &model.Invocation{ID: "i1", Type: "test:lifecycle", Topology: model.TopologyRuntime, Status: model.InvocationPending, CreatedAt: created}
+	labels := []string{"test:lifecycle", "runtime"}
+	m := newInvocationMetrics()
+
+	m.InvocationCreated(inv)
+	if v := counterValue(t, invocationsCreated, labels...); v != 1 {
+		t.Errorf("expected 1 created, got %g", v)
+	}
+
+	inv.Status = model.InvocationRunning
+	inv.StartedAt = created.Add(2 * time.Second)
+	m.InvocationStarted(inv)
+	if count, sum := histogramSample(t, invocationQueueWait, labels...); count != 1 || sum != 2000 {
+		t.Errorf("expected a 2000ms queue wait, got %d samples summing to %g", count, sum)
+	}
+
+	inv.FirstResultAt = created.Add(5 * time.Second)
+	m.InvocationFirstResult(inv)
+	if count, sum := histogramSample(t, invocationFirstResult, labels...); count != 1 || sum != 5000 {
+		t.Errorf("expected a 5000ms first result, got %d samples summing to %g", count, sum)
+	}
+
+	inv.Status = model.InvocationCompleted
+	inv.FinishedAt = created.Add(9 * time.Second)
+	m.InvocationFinished(inv)
+	if v := counterValue(t, invocationsCompleted, labels...); v != 1 {
+		t.Errorf("expected 1 completed, got %g", v)
+	}
+	if count, sum := histogramSample(t, invocationExecution, labels...); count != 1 || sum != 7000 {
+		t.Errorf("expected a 7000ms execution, got %d samples summing to %g", count, sum)
+	}
+}
+
+func TestInvocationMetricsFinalStatuses(t *testing.T) {
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	labels := []string{"test:final", "global"}
+	m := newInvocationMetrics()
+
+	for _, inv := range []*model.Invocation{
+		{Status: model.InvocationFailed, ErrorType: model.InvocationErrorTimeout},
+		{Status: model.InvocationFailed, ErrorType: "unheard_of"},
+		{Status: model.InvocationCancelled},
+		{Status: model.InvocationExpired},
+	} {
+		inv.Type = "test:final"
+		inv.Topology = model.TopologyGlobal
+		inv.CreatedAt = created
+		inv.FinishedAt = created.Add(time.Minute)
+		m.InvocationFinished(inv)
+	}
+
+	if v := counterValue(t, invocationsFailed, append(labels, "timeout")...); v != 1 {
+		t.Errorf("expected 1 timeout failure, got %g", v)
+	}
+	if v := counterValue(t, invocationsFailed, append(labels, "other")...); v != 1 {
+		t.Errorf("expected an unknown error type to be counted as other, got %g", v)
+	}
+	if v := counterValue(t, invocationsCancelled, labels...); v != 1 {
+		t.Errorf("expected 1 cancelled, got %g", v)
+	}
+	if v := counterValue(t, invocationsExpired, labels...); v != 1 {
+		t.Errorf("expected 1 expired, got %g", v)
+	}
+
+	// None of them started, so none executed.
+	if count, _ := histogramSample(t, invocationExecution, labels...); count != 0 {
+		t.Errorf("expected no execution time, got %d samples", count)
+	}
+}
+
+func TestInvocationMetricsSkipUnsetTimestamps(t *testing.T) {
+	inv := &model.Invocation{Type: "test:unset", Topology: model.TopologyRuntime, StartedAt: time.Now()}
+	m := newInvocationMetrics()
+
+	m.InvocationStarted(inv)
+	m.InvocationFirstResult(inv)
+
+	if count, _ := histogramSample(t, invocationQueueWait, "test:unset", "runtime"); count != 0 {
+		t.Errorf("expected no queue wait without a creation time, got %d samples", count)
+	}
+	if count, _ := histogramSample(t, invocationFirstResult, "test:unset", "runtime"); count != 0 {
+		t.Errorf("expected no first result without a first result time, got %d samples", count)
+	}
+}
+
+func TestInvocationResultHandlerReportsCompletion(t *testing.T) {
+	invocations := newRedisInvocationStore(memory.NewRedis(), time.Hour, &fakeResultEventBuilder{}, &fakeAuditPublisher{})
+	h := newInvocationResultHandler(invocations, invocationObservers{newInvocationMetrics()})
+	cmd := &model.RuntimeCommand{InvocationID: "i1", TenantID: "t1", Type: "test:handler", Created: time.Now().Add(-time.Second)}
+
+	inv := &model.Invocation{ID: "i1", TenantID: "t1", Type: "test:handler", Topology: model.TopologyRuntime, Status: model.InvocationPending, CreatedAt: cmd.Created}
+	if err := invocations.CreateInvocation(context.Background(), inv); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := &model.InvocationFailure{Type: model.InvocationErrorConnector, Message: "boom"}
+	if err := h.HandleCompletion(context.Background(), cmd, model.InvocationFailed, failure); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := counterValue(t, invocationsFailed, "test:handler", "runtime", "connector"); v != 1 {
+		t.Errorf("expected the failure to be counted, got %g", v)
+	}
+}
+
+func TestInvocationResultHandlerReportsStartAndFirstResult(t *testing.T) {
+	ctx := context.Background()
+	invocations := newRedisInvocationStore(memory.NewRedis(), time.Hour, &fakeResultEventBuilder{}, &fakeAuditPublisher{})
+	h := newInvocationResultHandler(invocations, invocationObservers{newInvocationMetrics()})
+	cmd := &model.RuntimeCommand{InvocationID: "i1", TenantID: "t1", Type: "test:start"}
+
+	inv := &model.Invocation{ID: "i1", TenantID: "t1", Type: "test:start", Topology: model.TopologyGlobal, Status: model.InvocationPending, CreatedAt: time.Now().Add(-time.Second)}
+	if err := invocations.CreateInvocation(ctx, inv); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second start is of a command claimed again, which doesn't start the invocation again.
+	for i := 0; i < 2; i++ {
+		if started, err := h.HandleStart(ctx, cmd); err != nil || !started {
+			t.Fatalf("expected the command to start, got %v, %v", started, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := h.HandleResult(ctx, cmd, json.RawMessage(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count, _ := histogramSample(t, invocationQueueWait, "test:start", "global"); count != 1 {
+		t.Errorf("expected the start to be observed once, got %d samples", count)
+	}
+	if count, _ := histogramSample(t, invocationFirstResult, "test:start", "global"); count != 1 {
+		t.Errorf("expected the first result to be observed once, got %d samples", count)
+	}
+
+	if _, err := h.invocations.FinishInvocation(ctx, "t1", "i1", model.InvocationCancelled, nil); err != nil {
+		t.Fatal(err)
+	}
+	if started, err := h.HandleStart(ctx, cmd); err != nil || started {
+		t.Errorf("expected the command of a cancelled invocation not to start, got %v, %v", started, err)
+	}
+}
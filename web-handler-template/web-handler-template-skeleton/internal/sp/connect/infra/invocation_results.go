@@ -0,0 +1,96 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// invocationResultHandler is an InvocationResultHandler that persists each result and completion
+// in the invocation store, which writes the events that announce them, and reports each step of the
+// invocation's lifecycle to the invocation observer. Every response it receives, whether over HTTP or a runtime
+// socket, is timed in sp_connect_response_gateway_latency_recv_ms.
+type invocationResultHandler struct {
+	invocations model.InvocationStore
+	observer    model.InvocationObserver
+}
+
+// newInvocationResultHandler constructs a new invocationResultHandler.
+func newInvocationResultHandler(invocations model.InvocationStore, observer model.InvocationObserver) *invocationResultHandler {
+	h := &invocationResultHandler{}
+	h.invocations = invocations
+	h.observer = observer
+
+	return h
+}
+
+// HandleStart moves a pending invocation to running and reports it to the observer. An invocation
+// that's already running, eg. because its command was claimed again after its claim expired, is
+// left as it is. It returns false if the invocation doesn't exist or has already finished.
+func (h *invocationResultHandler) HandleStart(ctx context.Context, cmd *model.RuntimeCommand) (bool, error) {
+	defer observeOp(responseGatewayLatency, "start", time.Now())
+
+	inv, err := h.invocations.MarkStarted(ctx, cmd.TenantID, cmd.InvocationID)
+	if err != nil {
+		return false, err
+	}
+	if inv != nil {
+		h.observer.InvocationStarted(inv)
+		return true, nil
+	}
+
+	if inv, err = h.invocations.GetInvocation(ctx, cmd.TenantID, cmd.InvocationID); err != nil {
+		return false, err
+	}
+	if inv == nil || inv.Status.Final() {
+		log.Warnf(ctx, "skip command of invocation %s: it doesn't exist or has finished", cmd.InvocationID)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// HandleResult persists the result along with the standard event that corresponds to it, if any,
+// and reports the first result to the observer. Results of invocations that don't exist or have
+// already finished are dropped.
+func (h *invocationResultHandler) HandleResult(ctx context.Context, cmd *model.RuntimeCommand, output json.RawMessage) error {
+	defer observeOp(responseGatewayLatency, "result", time.Now())
+
+	inv, err := h.invocations.AddResult(ctx, cmd, output)
+	if err != nil {
+		return err
+	}
+	if inv == nil {
+		log.Warnf(ctx, "drop result of invocation %s: it doesn't exist or has finished", cmd.InvocationID)
+		return nil
+	}
+
+	if inv.ResultCount == 1 {
+		h.observer.InvocationFirstResult(inv)
+	}
+
+	return nil
+}
+
+// HandleCompletion moves the invocation to its final status and reports it to the observer. The
+// completion of an invocation that doesn't exist or has already finished is ignored.
+func (h *invocationResultHandler) HandleCompletion(ctx context.Context, cmd *model.RuntimeCommand, status model.InvocationStatus, failure *model.InvocationFailure) error {
+	defer observeOp(responseGatewayLatency, "completion", time.Now())
+
+	inv, err := h.invocations.FinishInvocation(ctx, cmd.TenantID, cmd.InvocationID, status, failure)
+	if err != nil {
+		return err
+	}
+	if inv == nil {
+		log.Warnf(ctx, "ignore completion of invocation %s: it doesn't exist or has finished", cmd.InvocationID)
+		return nil
+	}
+
+	h.observer.InvocationFinished(inv)
+
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/config"
+	"github.com/sailpoint/atlas-go/atlas/event"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// invocationEventTopic is the org-scoped topic that changes to the state of invocations are
+// published to.
+var invocationEventTopic = event.NewSimpleTopicDescriptor(event.TopicScopeOrg, "sp_connect_invocation")
+
+// invocationStateEventType is the type of the events published to invocationEventTopic.
+const invocationStateEventType = "sp_connect_invocation_state"
+
+// invocationState is an invocation as it's served and published in invocation state events, as of
+// each change.
+type invocationState struct {
+	ID                  string                   `json:"id"`
+	ConnectorInstanceID string                   `json:"connectorInstanceId"`
+	Type                model.CommandType        `json:"type"`
+	Topology            model.Topology           `json:"topology"`
+	Status              model.InvocationStatus   `json:"status"`
+	Error               *model.InvocationFailure `json:"error,omitempty"`
+	ResultCount         int                      `json:"resultCount"`
+	Created             time.Time                `json:"created"`
+	Expiration          time.Time                `json:"expiration"`
+	Started             *time.Time               `json:"started,omitempty"`
+	FirstResult         *time.Time               `json:"firstResult,omitempty"`
+	Finished            *time.Time               `json:"finished,omitempty"`
+}
+
+// topicEvent is an event along with the topic it's for.
+type topicEvent struct {
+	topic event.TopicDescriptor
+	event *event.Event
+}
+
+// resultEventBuilder builds the standard events of command results; it's implemented by
+// *kafkaStandardEventPublisher.
+type resultEventBuilder interface {
+	CommandResultEvent(ctx context.Context, result model.CommandResult) (*event.Event, error)
+}
+
+// purgeableInvocationStore is an InvocationStore whose invocations are purged along with their org.
+type purgeableInvocationStore interface {
+	model.InvocationStore
+	model.OrgPurger
+}
+
+// newInvocationStore constructs the invocation store from config. Without an invocation table,
+// invocations are kept in Redis and their events are published directly.
+func (s *ConnectService) newInvocationStore(builder resultEventBuilder) purgeableInvocationStore {
+	retention := config.GetDuration(s.Config, "INVOCATION_RETENTION", 7*24*time.Hour)
+
+	if table := config.GetString(s.Config, "CONNECTOR_INVOCATION_TABLE_NAME", ""); table != "" {
+		return newDynamoInvocationStore(s.dynamoClient, table, retention, s.outbox, builder, s.EventPublisher)
+	}
+
+	return newRedisInvocationStore(s.RedisClient, retention, builder, s.EventPublisher)
+}
+
+// newInvocationState gets the state of an invocation, as it's published and served.
+func newInvocationState(inv *model.Invocation) *invocationState {
+	return &invocationState{
+		ID:                  inv.ID,
+		ConnectorInstanceID: inv.ConnectorInstanceID,
+		Type:                inv.Type,
+		Topology:            inv.Topology,
+		Status:              inv.Status,
+		Error:               inv.Failure,
+		ResultCount:         inv.ResultCount,
+		Created:             inv.CreatedAt,
+		Expiration:          inv.Expiration,
+		Started:             timePointer(inv.StartedAt),
+		FirstResult:         timePointer(inv.FirstResultAt),
+		Finished:            timePointer(inv.FinishedAt),
+	}
+}
+
+// invocationStateEvent builds the event that announces the state of an invocation.
+func invocationStateEvent(ctx context.Context, inv *model.Invocation) (topicEvent, error) {
+	content, err := json.Marshal(newInvocationState(inv))
+	if err != nil {
+		return topicEvent{}, err
+	}
+
+	e := event.NewEventJSON(invocationStateEventType, string(content), eventHeaders(ctx, inv.ConnectorInstanceID))
+	return topicEvent{topic: invocationEventTopic, event: e}, nil
+}
+
+// resultEvents builds the events written along with a result: the standard event it corresponds to,
+// if any, and the state of the invocation if it's the first result.
+func resultEvents(ctx context.Context, builder resultEventBuilder, cmd *model.RuntimeCommand, output json.RawMessage, inv *model.Invocation) ([]topicEvent, error) {
+	var events []topicEvent
+
+	e, err := builder.CommandResultEvent(ctx, model.CommandResult{
+		ConnectorInstanceID: cmd.ConnectorInstanceID,
+		Type:                cmd.Type,
+		Input:               cmd.Input,
+		Output:              output,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if e != nil {
+		events = append(events, topicEvent{topic: standardEventTopic, event: e})
+	}
+
+	if inv.ResultCount == 1 {
+		state, err := invocationStateEvent(ctx, inv)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, state)
+	}
+
+	return events, nil
+}
+
+// publishEvents publishes the events of a change directly, once it's persisted, for stores that
+// can't write them to the outbox in the same transaction. An event may be lost if the service
+// stops in between.
+func publishEvents(ctx context.Context, publisher event.Publisher, events []topicEvent) error {
+	for _, e := range events {
+		start := time.Now()
+		err := publisher.Publish(ctx, e.topic, e.event)
+		observe(publishKafkaLatency, start)
+
+		if err != nil {
+			return fmt.Errorf("publish %s: %w", e.event.Type, err)
+		}
+	}
+
+	return nil
+}
+
+// timePointer gets a pointer to t, or nil if it's zero, for JSON fields that are omitted when unset.
+func timePointer(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
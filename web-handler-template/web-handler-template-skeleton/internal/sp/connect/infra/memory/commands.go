@@ -0,0 +1,744 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// status is a status reply, such as OK.
+type status string
+
+// errWrongType is the error of a command run against a key of another type.
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// command runs a command against a Redis whose mu is held. Its args exclude the command name. Replies
+// are nil, int64, string, status or []interface{} of replies.
+type command struct {
+	minArgs int
+	run     func(r *Redis, args []string) (interface{}, error)
+}
+
+// commands are the commands Redis implements, by lowercase name. The methods of Redis and the scripts
+// it runs both go through them.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ping":    {0, func(r *Redis, args []string) (interface{}, error) { return status("PONG"), nil }},
+		"publish": {2, func(r *Redis, args []string) (interface{}, error) { return int64(0), nil }},
+
+		"get":    {1, (*Redis).get},
+		"set":    {2, (*Redis).set},
+		"setnx":  {2, (*Redis).setNX},
+		"del":    {1, (*Redis).del},
+		"exists": {1, (*Redis).existsCmd},
+		"pexpire": {2, func(r *Redis, args []string) (interface{}, error) {
+			return r.expireCmd(args[0], args[1], time.Millisecond)
+		}},
+		"expire": {2, func(r *Redis, args []string) (interface{}, error) {
+			return r.expireCmd(args[0], args[1], time.Second)
+		}},
+		"pttl": {1, (*Redis).pttl},
+
+		"lpush":  {2, func(r *Redis, args []string) (interface{}, error) { return r.push(args, true) }},
+		"rpush":  {2, func(r *Redis, args []string) (interface{}, error) { return r.push(args, false) }},
+		"lpop":   {1, func(r *Redis, args []string) (interface{}, error) { return r.pop(args[0], true) }},
+		"rpop":   {1, func(r *Redis, args []string) (interface{}, error) { return r.pop(args[0], false) }},
+		"llen":   {1, (*Redis).llen},
+		"lrange": {3, (*Redis).lrange},
+
+		"hget":    {2, (*Redis).hget},
+		"hmget":   {2, (*Redis).hmget},
+		"hset":    {3, (*Redis).hset},
+		"hdel":    {2, (*Redis).hdel},
+		"hkeys":   {1, (*Redis).hkeys},
+		"hgetall": {1, (*Redis).hgetall},
+		"hlen":    {1, (*Redis).hlen},
+
+		"sadd":      {2, (*Redis).sadd},
+		"srem":      {2, (*Redis).srem},
+		"smembers":  {1, (*Redis).smembers},
+		"sismember": {2, (*Redis).sismember},
+		"scard":     {1, (*Redis).scard},
+
+		"zadd":             {3, (*Redis).zadd},
+		"zrem":             {2, (*Redis).zrem},
+		"zremrangebyscore": {3, (*Redis).zremrangebyscore},
+		"zrange":           {3, (*Redis).zrange},
+		"zcard":            {1, (*Redis).zcard},
+		"zscore":           {2, (*Redis).zscore},
+	}
+}
+
+// call runs a command. The caller holds mu.
+func (r *Redis) call(args []string) (interface{}, error) {
+	name := strings.ToLower(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, name)
+	}
+	if len(args)-1 < cmd.minArgs {
+		return nil, fmt.Errorf("ERR wrong number of arguments for '%s' command", name)
+	}
+
+	return cmd.run(r, args[1:])
+}
+
+// commandKeys gets the keys a command accesses: every argument of DEL and EXISTS, none of PING and
+// PUBLISH, and the first argument of the rest.
+func commandKeys(args []string) []string {
+	switch strings.ToLower(args[0]) {
+	case "ping", "publish":
+		return nil
+	case "del", "exists":
+		return args[1:]
+	}
+	if len(args) < 2 {
+		return nil
+	}
+
+	return args[1:2]
+}
+
+// typeOf gets the type of the value under key, or "none", once it's expired if it's due. The caller
+// holds mu.
+func (r *Redis) typeOf(key string) string {
+	r.expire(key)
+
+	if _, ok := r.strings[key]; ok {
+		return "string"
+	}
+	if _, ok := r.lists[key]; ok {
+		return "list"
+	}
+	if _, ok := r.hashes[key]; ok {
+		return "hash"
+	}
+	if _, ok := r.sets[key]; ok {
+		return "set"
+	}
+	if _, ok := r.zsets[key]; ok {
+		return "zset"
+	}
+
+	return "none"
+}
+
+// checkType fails with errWrongType unless key holds a value of the type or doesn't exist.
+func (r *Redis) checkType(key string, typ string) error {
+	if t := r.typeOf(key); t != typ && t != "none" {
+		return errWrongType
+	}
+
+	return nil
+}
+
+func (r *Redis) get(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "string"); err != nil {
+		return nil, err
+	}
+	if v, ok := r.strings[args[0]]; ok {
+		return v, nil
+	}
+
+	return nil, nil
+}
+
+// set implements SET with the EX, PX, NX, XX and KEEPTTL options.
+func (r *Redis) set(args []string) (interface{}, error) {
+	key, value := args[0], args[1]
+	var expiration time.Duration
+	var nx, xx, keepTTL bool
+
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "keepttl":
+			keepTTL = true
+		case "ex", "px":
+			if i+1 == len(args) {
+				return nil, errors.New("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return nil, errors.New("ERR invalid expire time in set")
+			}
+			unit := time.Millisecond
+			if opt == "ex" {
+				unit = time.Second
+			}
+			expiration = time.Duration(n) * unit
+			i++
+		default:
+			return nil, errors.New("ERR syntax error")
+		}
+	}
+
+	exists := r.typeOf(key) != "none"
+	if (nx && exists) || (xx && !exists) {
+		return nil, nil
+	}
+
+	expires, hadExpiration := r.expires[key]
+	r.delete(key)
+	r.strings[key] = value
+	if keepTTL && hadExpiration {
+		r.expires[key] = expires
+	} else {
+		r.setExpiration(key, expiration)
+	}
+
+	return status("OK"), nil
+}
+
+func (r *Redis) setNX(args []string) (interface{}, error) {
+	reply, err := r.set([]string{args[0], args[1], "nx"})
+	if err != nil {
+		return nil, err
+	}
+
+	return boolReply(reply != nil), nil
+}
+
+func (r *Redis) del(args []string) (interface{}, error) {
+	var n int64
+	for _, key := range args {
+		if r.typeOf(key) != "none" {
+			n++
+		}
+		r.delete(key)
+	}
+
+	return n, nil
+}
+
+func (r *Redis) existsCmd(args []string) (interface{}, error) {
+	var n int64
+	for _, key := range args {
+		if r.typeOf(key) != "none" {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// expireCmd expires key after a number of units, returning whether it exists.
+func (r *Redis) expireCmd(key string, value string, unit time.Duration) (interface{}, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, errors.New("ERR value is not an integer or out of range")
+	}
+	if r.typeOf(key) == "none" {
+		return int64(0), nil
+	}
+
+	if n <= 0 {
+		r.delete(key)
+	} else {
+		r.setExpiration(key, time.Duration(n)*unit)
+	}
+
+	return int64(1), nil
+}
+
+// pttl gets the milliseconds left before key expires, -1 if it doesn't, or -2 if it doesn't exist.
+func (r *Redis) pttl(args []string) (interface{}, error) {
+	if r.typeOf(args[0]) == "none" {
+		return int64(-2), nil
+	}
+
+	at, ok := r.expires[args[0]]
+	if !ok {
+		return int64(-1), nil
+	}
+
+	return int64(at.Sub(r.now()) / time.Millisecond), nil
+}
+
+// push prepends or appends values to a list, returning its length.
+func (r *Redis) push(args []string, left bool) (interface{}, error) {
+	key := args[0]
+	if err := r.checkType(key, "list"); err != nil {
+		return nil, err
+	}
+
+	list := r.lists[key]
+	for _, v := range args[1:] {
+		if left {
+			list = append([]string{v}, list...)
+		} else {
+			list = append(list, v)
+		}
+	}
+	r.lists[key] = list
+
+	return int64(len(list)), nil
+}
+
+// pop removes and returns the first or last element of a list.
+func (r *Redis) pop(key string, left bool) (interface{}, error) {
+	if err := r.checkType(key, "list"); err != nil {
+		return nil, err
+	}
+
+	list := r.lists[key]
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	var v string
+	if left {
+		v, list = list[0], list[1:]
+	} else {
+		v, list = list[len(list)-1], list[:len(list)-1]
+	}
+	r.lists[key] = list
+	r.removeIfEmpty(key)
+
+	return v, nil
+}
+
+func (r *Redis) llen(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "list"); err != nil {
+		return nil, err
+	}
+
+	return int64(len(r.lists[args[0]])), nil
+}
+
+func (r *Redis) lrange(args []string) (interface{}, error) {
+	key := args[0]
+	if err := r.checkType(key, "list"); err != nil {
+		return nil, err
+	}
+
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return nil, errors.New("ERR value is not an integer or out of range")
+	}
+
+	list := r.lists[key]
+	start, stop = rangeIndexes(start, stop, len(list))
+	if start > stop {
+		return []interface{}{}, nil
+	}
+
+	return stringsReply(list[start : stop+1]), nil
+}
+
+func (r *Redis) hget(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "hash"); err != nil {
+		return nil, err
+	}
+	if v, ok := r.hashes[args[0]][args[1]]; ok {
+		return v, nil
+	}
+
+	return nil, nil
+}
+
+func (r *Redis) hmget(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "hash"); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(args)-1)
+	for i, field := range args[1:] {
+		if v, ok := r.hashes[args[0]][field]; ok {
+			values[i] = v
+		}
+	}
+
+	return values, nil
+}
+
+// hset sets field-value pairs of a hash, returning how many fields were added.
+func (r *Redis) hset(args []string) (interface{}, error) {
+	key := args[0]
+	if len(args)%2 != 1 {
+		return nil, errors.New("ERR wrong number of arguments for 'hset' command")
+	}
+	if err := r.checkType(key, "hash"); err != nil {
+		return nil, err
+	}
+
+	hash, ok := r.hashes[key]
+	if !ok {
+		hash = map[string]string{}
+		r.hashes[key] = hash
+	}
+
+	var n int64
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := hash[args[i]]; !ok {
+			n++
+		}
+		hash[args[i]] = args[i+1]
+	}
+
+	return n, nil
+}
+
+func (r *Redis) hdel(args []string) (interface{}, error) {
+	key := args[0]
+	if err := r.checkType(key, "hash"); err != nil {
+		return nil, err
+	}
+
+	var n int64
+	for _, field := range args[1:] {
+		if _, ok := r.hashes[key][field]; ok {
+			delete(r.hashes[key], field)
+			n++
+		}
+	}
+	r.removeIfEmpty(key)
+
+	return n, nil
+}
+
+// hkeys gets the fields of a hash, sorted.
+func (r *Redis) hkeys(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "hash"); err != nil {
+		return nil, err
+	}
+
+	return stringsReply(sortedKeys(r.hashes[args[0]])), nil
+}
+
+// hgetall gets the fields and values of a hash, alternating, sorted by field.
+func (r *Redis) hgetall(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "hash"); err != nil {
+		return nil, err
+	}
+
+	hash := r.hashes[args[0]]
+	values := make([]interface{}, 0, 2*len(hash))
+	for _, field := range sortedKeys(hash) {
+		values = append(values, field, hash[field])
+	}
+
+	return values, nil
+}
+
+func (r *Redis) hlen(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "hash"); err != nil {
+		return nil, err
+	}
+
+	return int64(len(r.hashes[args[0]])), nil
+}
+
+func (r *Redis) sadd(args []string) (interface{}, error) {
+	key := args[0]
+	if err := r.checkType(key, "set"); err != nil {
+		return nil, err
+	}
+
+	set, ok := r.sets[key]
+	if !ok {
+		set = map[string]struct{}{}
+		r.sets[key] = set
+	}
+
+	var n int64
+	for _, member := range args[1:] {
+		if _, ok := set[member]; !ok {
+			set[member] = struct{}{}
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (r *Redis) srem(args []string) (interface{}, error) {
+	key := args[0]
+	if err := r.checkType(key, "set"); err != nil {
+		return nil, err
+	}
+
+	var n int64
+	for _, member := range args[1:] {
+		if _, ok := r.sets[key][member]; ok {
+			delete(r.sets[key], member)
+			n++
+		}
+	}
+	r.removeIfEmpty(key)
+
+	return n, nil
+}
+
+// smembers gets the members of a set, sorted.
+func (r *Redis) smembers(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "set"); err != nil {
+		return nil, err
+	}
+
+	members := make([]string, 0, len(r.sets[args[0]]))
+	for member := range r.sets[args[0]] {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	return stringsReply(members), nil
+}
+
+func (r *Redis) sismember(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "set"); err != nil {
+		return nil, err
+	}
+
+	_, ok := r.sets[args[0]][args[1]]
+	return boolReply(ok), nil
+}
+
+func (r *Redis) scard(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "set"); err != nil {
+		return nil, err
+	}
+
+	return int64(len(r.sets[args[0]])), nil
+}
+
+// zadd adds or updates score-member pairs of a sorted set, returning how many members were added.
+func (r *Redis) zadd(args []string) (interface{}, error) {
+	key := args[0]
+	if len(args)%2 != 1 {
+		return nil, errors.New("ERR syntax error")
+	}
+	if err := r.checkType(key, "zset"); err != nil {
+		return nil, err
+	}
+
+	scores := make([]float64, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil || math.IsNaN(score) {
+			return nil, errors.New("ERR value is not a valid float")
+		}
+		scores = append(scores, score)
+	}
+
+	zset, ok := r.zsets[key]
+	if !ok {
+		zset = map[string]float64{}
+		r.zsets[key] = zset
+	}
+
+	var n int64
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := zset[args[i+1]]; !ok {
+			n++
+		}
+		zset[args[i+1]] = scores[i/2]
+	}
+
+	return n, nil
+}
+
+func (r *Redis) zrem(args []string) (interface{}, error) {
+	key := args[0]
+	if err := r.checkType(key, "zset"); err != nil {
+		return nil, err
+	}
+
+	var n int64
+	for _, member := range args[1:] {
+		if _, ok := r.zsets[key][member]; ok {
+			delete(r.zsets[key], member)
+			n++
+		}
+	}
+	r.removeIfEmpty(key)
+
+	return n, nil
+}
+
+// zremrangebyscore removes the members of a sorted set scored between min and max, which can be
+// exclusive ("(1") or infinite ("-inf"), returning how many were removed.
+func (r *Redis) zremrangebyscore(args []string) (interface{}, error) {
+	key := args[0]
+	if err := r.checkType(key, "zset"); err != nil {
+		return nil, err
+	}
+
+	min, minExclusive, err := parseScoreBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, maxExclusive, err := parseScoreBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var n int64
+	for member, score := range r.zsets[key] {
+		if (score > min || (!minExclusive && score == min)) && (score < max || (!maxExclusive && score == max)) {
+			delete(r.zsets[key], member)
+			n++
+		}
+	}
+	r.removeIfEmpty(key)
+
+	return n, nil
+}
+
+// zrange returns the members of a sorted set from index start to stop, inclusive, in order of score
+// and then member. Negative indexes count from the end.
+func (r *Redis) zrange(args []string) (interface{}, error) {
+	key := args[0]
+	if err := r.checkType(key, "zset"); err != nil {
+		return nil, err
+	}
+	if len(args) > 3 {
+		return nil, fmt.Errorf("%w: zrange options", ErrUnsupported)
+	}
+
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return nil, errors.New("ERR value is not an integer or out of range")
+	}
+
+	zset := r.zsets[key]
+	members := make([]string, 0, len(zset))
+	for member := range zset {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if zset[members[i]] != zset[members[j]] {
+			return zset[members[i]] < zset[members[j]]
+		}
+		return members[i] < members[j]
+	})
+
+	start, stop = rangeIndexes(start, stop, len(members))
+	if start > stop {
+		return []interface{}{}, nil
+	}
+
+	return stringsReply(members[start : stop+1]), nil
+}
+
+func (r *Redis) zcard(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "zset"); err != nil {
+		return nil, err
+	}
+
+	return int64(len(r.zsets[args[0]])), nil
+}
+
+func (r *Redis) zscore(args []string) (interface{}, error) {
+	if err := r.checkType(args[0], "zset"); err != nil {
+		return nil, err
+	}
+
+	score, ok := r.zsets[args[0]][args[1]]
+	if !ok {
+		return nil, nil
+	}
+
+	return strconv.FormatFloat(score, 'g', 17, 64), nil
+}
+
+// parseScoreBound parses a score range bound, returning whether it's exclusive.
+func parseScoreBound(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+
+	switch strings.ToLower(s) {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, errors.New("ERR min or max is not a float")
+	}
+
+	return score, exclusive, nil
+}
+
+// removeIfEmpty removes key if it holds an empty collection, as Redis does. The caller holds mu.
+func (r *Redis) removeIfEmpty(key string) {
+	empty := false
+	switch r.typeOf(key) {
+	case "list":
+		empty = len(r.lists[key]) == 0
+	case "hash":
+		empty = len(r.hashes[key]) == 0
+	case "set":
+		empty = len(r.sets[key]) == 0
+	case "zset":
+		empty = len(r.zsets[key]) == 0
+	}
+
+	if empty {
+		r.delete(key)
+	}
+}
+
+// sortedKeys gets the keys of a hash, sorted.
+func sortedKeys(hash map[string]string) []string {
+	keys := make([]string, 0, len(hash))
+	for k := range hash {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// stringsReply converts strings to an array reply.
+func stringsReply(values []string) []interface{} {
+	reply := make([]interface{}, len(values))
+	for i, v := range values {
+		reply[i] = v
+	}
+
+	return reply
+}
+
+// rangeIndexes resolves the inclusive range of indexes from start to stop of a sequence of length n,
+// where negative indexes count from the end, clamping them to the sequence. The range is empty if
+// start ends up after stop.
+func rangeIndexes(start int, stop int, n int) (int, int) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+
+	return start, stop
+}
+
+// boolReply converts a bool to an integer reply.
+func boolReply(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,1844 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// This file is an interpreter for the subset of Lua 5.1 that the service's Redis scripts are written
+// in: locals and globals, if, while, numeric and generic for, break and return, the arithmetic,
+// comparison, logical, concatenation and length operators, and table constructors. Scripts can't
+// define functions, but can call the built-ins the Redis scripting environment provides (see
+// newLuaGlobals). Values are nil, bool, float64, string, *luaTable and luaFunction.
+
+// luaFunction is a built-in function.
+type luaFunction func(args []interface{}) ([]interface{}, error)
+
+// luaTable is a Lua table. Integral number keys are stored as float64, like every other number.
+type luaTable struct {
+	fields map[interface{}]interface{}
+}
+
+// newLuaTable constructs a table whose array part holds values, from index 1.
+func newLuaTable(values ...interface{}) *luaTable {
+	t := &luaTable{fields: map[interface{}]interface{}{}}
+	for i, v := range values {
+		t.set(float64(i+1), v)
+	}
+
+	return t
+}
+
+// get gets the value of a key, or nil.
+func (t *luaTable) get(key interface{}) interface{} {
+	return t.fields[key]
+}
+
+// set sets the value of a key, removing it if the value is nil.
+func (t *luaTable) set(key interface{}, value interface{}) {
+	if value == nil {
+		delete(t.fields, key)
+		return
+	}
+	t.fields[key] = value
+}
+
+// length gets the border of the table: the last index of its array part.
+func (t *luaTable) length() int {
+	n := 0
+	for t.get(float64(n+1)) != nil {
+		n++
+	}
+
+	return n
+}
+
+// keys gets the keys of the table: its numbers in order, then its strings in order, then anything else.
+func (t *luaTable) keys() []interface{} {
+	keys := make([]interface{}, 0, len(t.fields))
+	for k := range t.fields {
+		keys = append(keys, k)
+	}
+
+	rank := func(k interface{}) int {
+		switch k.(type) {
+		case float64:
+			return 0
+		case string:
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		ri, rj := rank(keys[i]), rank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		switch k := keys[i].(type) {
+		case float64:
+			return k < keys[j].(float64)
+		case string:
+			return k < keys[j].(string)
+		}
+		return false
+	})
+
+	return keys
+}
+
+// luaError is a runtime error raised by a script, with the line it was raised on and the error of the
+// function that raised it, if any.
+type luaError struct {
+	line int
+	msg  string
+	err  error
+}
+
+func (e *luaError) Error() string {
+	return fmt.Sprintf("user_script:%d: %s", e.line, e.msg)
+}
+
+func (e *luaError) Unwrap() error {
+	return e.err
+}
+
+// Tokens.
+
+type luaTokenKind int
+
+const (
+	tokEOF luaTokenKind = iota
+	tokName
+	tokNumber
+	tokString
+	tokSymbol
+)
+
+type luaToken struct {
+	kind luaTokenKind
+	text string
+	num  float64
+	line int
+}
+
+// luaKeywords can't be used as names.
+var luaKeywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true, "false": true,
+	"for": true, "function": true, "if": true, "in": true, "local": true, "nil": true, "not": true,
+	"or": true, "repeat": true, "return": true, "then": true, "true": true, "until": true, "while": true,
+}
+
+// luaSymbols are the operators and punctuation, longest first.
+var luaSymbols = []string{
+	"...", "..", "==", "~=", "<=", ">=",
+	"+", "-", "*", "/", "%", "^", "#", "<", ">", "=", "(", ")", "{", "}", "[", "]", ";", ":", ",", ".",
+}
+
+// lexLua splits a script into tokens.
+func lexLua(src string) ([]luaToken, error) {
+	var tokens []luaToken
+	line := 1
+
+	for i := 0; i < len(src); {
+		c := src[i]
+
+		switch {
+		case c == '\n':
+			line++
+			i++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+
+		case strings.HasPrefix(src[i:], "--"):
+			i += 2
+			if level := longBracketLevel(src[i:]); level >= 0 {
+				end, _, err := readLongBracket(src[i:], level)
+				if err != nil {
+					return nil, fmt.Errorf("user_script:%d: %v", line, err)
+				}
+				line += strings.Count(src[i:i+end], "\n")
+				i += end
+				continue
+			}
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+
+		case isLuaNameStart(c):
+			start := i
+			for i < len(src) && (isLuaNameStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, luaToken{kind: tokName, text: src[start:i], line: line})
+
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			start := i
+			if strings.HasPrefix(src[i:], "0x") || strings.HasPrefix(src[i:], "0X") {
+				i += 2
+				for i < len(src) && isHexDigit(src[i]) {
+					i++
+				}
+				n, err := strconv.ParseUint(src[start+2:i], 16, 64)
+				if err != nil {
+					return nil, fmt.Errorf("user_script:%d: malformed number near '%s'", line, src[start:i])
+				}
+				tokens = append(tokens, luaToken{kind: tokNumber, num: float64(n), line: line})
+				continue
+			}
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("user_script:%d: malformed number near '%s'", line, src[start:i])
+			}
+			tokens = append(tokens, luaToken{kind: tokNumber, num: n, line: line})
+
+		case c == '"' || c == '\'':
+			s, n, err := readLuaString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("user_script:%d: %v", line, err)
+			}
+			tokens = append(tokens, luaToken{kind: tokString, text: s, line: line})
+			i += n
+
+		case c == '[' && longBracketLevel(src[i:]) >= 0:
+			end, s, err := readLongBracket(src[i:], longBracketLevel(src[i:]))
+			if err != nil {
+				return nil, fmt.Errorf("user_script:%d: %v", line, err)
+			}
+			tokens = append(tokens, luaToken{kind: tokString, text: s, line: line})
+			line += strings.Count(src[i:i+end], "\n")
+			i += end
+
+		default:
+			matched := false
+			for _, sym := range luaSymbols {
+				if strings.HasPrefix(src[i:], sym) {
+					tokens = append(tokens, luaToken{kind: tokSymbol, text: sym, line: line})
+					i += len(sym)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("user_script:%d: unexpected symbol near '%c'", line, c)
+			}
+		}
+	}
+
+	return append(tokens, luaToken{kind: tokEOF, line: line}), nil
+}
+
+func isLuaNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// longBracketLevel gets the level of the long bracket that src opens (eg. 0 for "[[" and 1 for
+// "[=["), or -1 if it doesn't open one.
+func longBracketLevel(src string) int {
+	if !strings.HasPrefix(src, "[") {
+		return -1
+	}
+	level := 1
+	for level < len(src) && src[level] == '=' {
+		level++
+	}
+	if level < len(src) && src[level] == '[' {
+		return level - 1
+	}
+
+	return -1
+}
+
+// readLongBracket reads a long bracket of a level from the start of src, returning its length and its
+// contents, without a leading newline.
+func readLongBracket(src string, level int) (int, string, error) {
+	open := level + 2
+	closing := "]" + strings.Repeat("=", level) + "]"
+
+	end := strings.Index(src[open:], closing)
+	if end < 0 {
+		return 0, "", fmt.Errorf("unfinished long string")
+	}
+
+	s := src[open : open+end]
+	if strings.HasPrefix(s, "\n") {
+		s = s[1:]
+	}
+
+	return open + end + len(closing), s, nil
+}
+
+// readLuaString reads a quoted string from the start of src, returning its value and length.
+func readLuaString(src string) (string, int, error) {
+	quote := src[0]
+	var b strings.Builder
+
+	for i := 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\n':
+			return "", 0, fmt.Errorf("unfinished string")
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch e := src[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'a':
+				b.WriteByte('\a')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'v':
+				b.WriteByte('\v')
+			case '\n':
+				b.WriteByte('\n')
+			default:
+				if isDigit(e) {
+					j := i
+					for j < len(src) && j < i+3 && isDigit(src[j]) {
+						j++
+					}
+					n, _ := strconv.Atoi(src[i:j])
+					if n > 255 {
+						return "", 0, fmt.Errorf("escape sequence too large")
+					}
+					b.WriteByte(byte(n))
+					i = j - 1
+				} else {
+					b.WriteByte(e)
+				}
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", 0, fmt.Errorf("unfinished string")
+}
+
+// Syntax tree.
+
+type luaExpr interface{}
+
+type (
+	luaConst struct{ value interface{} }
+	luaName  struct {
+		name string
+		line int
+	}
+	luaIndex struct {
+		object luaExpr
+		key    luaExpr
+		line   int
+	}
+	luaCall struct {
+		fn   luaExpr
+		args []luaExpr
+		line int
+	}
+	luaTableItem struct {
+		key   luaExpr // nil for positional items
+		value luaExpr
+	}
+	luaTableConstructor struct{ items []luaTableItem }
+	luaBinary           struct {
+		op   string
+		l, r luaExpr
+		line int
+	}
+	luaUnary struct {
+		op   string
+		e    luaExpr
+		line int
+	}
+)
+
+type luaStmt interface{}
+
+type (
+	luaLocal struct {
+		names []string
+		exprs []luaExpr
+	}
+	luaAssign struct {
+		targets []luaExpr
+		exprs   []luaExpr
+		line    int
+	}
+	luaCallStmt struct{ call *luaCall }
+	luaIf       struct {
+		conds  []luaExpr
+		blocks [][]luaStmt
+		orElse []luaStmt
+	}
+	luaWhile struct {
+		cond luaExpr
+		body []luaStmt
+	}
+	luaNumericFor struct {
+		name               string
+		start, limit, step luaExpr
+		body               []luaStmt
+		line               int
+	}
+	luaGenericFor struct {
+		names []string
+		exprs []luaExpr
+		body  []luaStmt
+		line  int
+	}
+	luaDo     struct{ body []luaStmt }
+	luaReturn struct{ exprs []luaExpr }
+	luaBreak  struct{}
+)
+
+// luaChunk is a parsed script.
+type luaChunk struct {
+	body []luaStmt
+}
+
+// Parser.
+
+type luaParser struct {
+	tokens []luaToken
+	pos    int
+}
+
+// parseLua parses a script.
+func parseLua(src string) (*luaChunk, error) {
+	tokens, err := lexLua(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &luaParser{tokens: tokens}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf("'<eof>' expected near '%s'", tok.text)
+	}
+
+	return &luaChunk{body: body}, nil
+}
+
+func (p *luaParser) peek() luaToken {
+	return p.tokens[p.pos]
+}
+
+func (p *luaParser) next() luaToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+
+	return tok
+}
+
+// is gets whether the next token is the keyword or symbol.
+func (p *luaParser) is(text string) bool {
+	tok := p.peek()
+	return (tok.kind == tokSymbol || tok.kind == tokName) && tok.text == text
+}
+
+// accept consumes the next token if it's the keyword or symbol.
+func (p *luaParser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+
+	return false
+}
+
+// expect consumes the keyword or symbol, or fails.
+func (p *luaParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("'%s' expected near '%s'", text, p.peek().text)
+	}
+
+	return nil
+}
+
+// name consumes a name, or fails.
+func (p *luaParser) name() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokName || luaKeywords[tok.text] {
+		return "", p.errorf("<name> expected near '%s'", tok.text)
+	}
+	p.next()
+
+	return tok.text, nil
+}
+
+func (p *luaParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("user_script:%d: %s", p.peek().line, fmt.Sprintf(format, args...))
+}
+
+// block parses statements up to the end of a block.
+func (p *luaParser) block() ([]luaStmt, error) {
+	var stmts []luaStmt
+	for {
+		switch tok := p.peek(); {
+		case tok.kind == tokEOF, p.is("end"), p.is("else"), p.is("elseif"), p.is("until"):
+			return stmts, nil
+		case p.accept(";"):
+			continue
+		}
+
+		stmt, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+
+		if _, ok := stmt.(*luaReturn); ok {
+			p.accept(";")
+			return stmts, nil
+		}
+	}
+}
+
+// statement parses a single statement.
+func (p *luaParser) statement() (luaStmt, error) {
+	line := p.peek().line
+
+	switch {
+	case p.accept("if"):
+		stmt := &luaIf{}
+		for {
+			cond, err := p.expr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("then"); err != nil {
+				return nil, err
+			}
+			body, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			stmt.conds = append(stmt.conds, cond)
+			stmt.blocks = append(stmt.blocks, body)
+
+			if p.accept("elseif") {
+				continue
+			}
+			if p.accept("else") {
+				if stmt.orElse, err = p.block(); err != nil {
+					return nil, err
+				}
+			}
+			return stmt, p.expect("end")
+		}
+
+	case p.accept("while"):
+		cond, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		return &luaWhile{cond: cond, body: body}, p.expect("end")
+
+	case p.accept("do"):
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		return &luaDo{body: body}, p.expect("end")
+
+	case p.accept("for"):
+		return p.forStatement(line)
+
+	case p.accept("local"):
+		if p.is("function") {
+			return nil, p.errorf("functions are not supported")
+		}
+		stmt := &luaLocal{}
+		for {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			stmt.names = append(stmt.names, name)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if p.accept("=") {
+			exprs, err := p.exprList()
+			if err != nil {
+				return nil, err
+			}
+			stmt.exprs = exprs
+		}
+		return stmt, nil
+
+	case p.accept("return"):
+		stmt := &luaReturn{}
+		if tok := p.peek(); tok.kind == tokEOF || p.is("end") || p.is("else") || p.is("elseif") || p.is("until") || p.is(";") {
+			return stmt, nil
+		}
+		exprs, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.exprs = exprs
+		return stmt, nil
+
+	case p.accept("break"):
+		return &luaBreak{}, nil
+
+	case p.is("function"), p.is("repeat"), p.is("goto"):
+		return nil, p.errorf("'%s' is not supported", p.peek().text)
+	}
+
+	target, err := p.suffixedExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.is("=") || p.is(",") {
+		stmt := &luaAssign{targets: []luaExpr{target}, line: line}
+		for p.accept(",") {
+			t, err := p.suffixedExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.targets = append(stmt.targets, t)
+		}
+		for _, t := range stmt.targets {
+			switch t.(type) {
+			case *luaName, *luaIndex:
+			default:
+				return nil, p.errorf("syntax error near '='")
+			}
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		if stmt.exprs, err = p.exprList(); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+
+	call, ok := target.(*luaCall)
+	if !ok {
+		return nil, p.errorf("syntax error near '%s'", p.peek().text)
+	}
+
+	return &luaCallStmt{call: call}, nil
+}
+
+// forStatement parses the rest of a numeric or generic for statement.
+func (p *luaParser) forStatement(line int) (luaStmt, error) {
+	first, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept("=") {
+		stmt := &luaNumericFor{name: first, line: line}
+		if stmt.start, err = p.expr(0); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if stmt.limit, err = p.expr(0); err != nil {
+			return nil, err
+		}
+		if p.accept(",") {
+			if stmt.step, err = p.expr(0); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		if stmt.body, err = p.block(); err != nil {
+			return nil, err
+		}
+		return stmt, p.expect("end")
+	}
+
+	stmt := &luaGenericFor{names: []string{first}, line: line}
+	for p.accept(",") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		stmt.names = append(stmt.names, name)
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	if stmt.exprs, err = p.exprList(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	if stmt.body, err = p.block(); err != nil {
+		return nil, err
+	}
+
+	return stmt, p.expect("end")
+}
+
+// exprList parses a comma-separated list of expressions.
+func (p *luaParser) exprList() ([]luaExpr, error) {
+	var exprs []luaExpr
+	for {
+		e, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if !p.accept(",") {
+			return exprs, nil
+		}
+	}
+}
+
+// luaBinaryPriority are the left and right priorities of the binary operators, as in the reference
+// implementation: .. and ^ are right associative.
+var luaBinaryPriority = map[string][2]int{
+	"or": {1, 1}, "and": {2, 2},
+	"<": {3, 3}, ">": {3, 3}, "<=": {3, 3}, ">=": {3, 3}, "~=": {3, 3}, "==": {3, 3},
+	"..": {5, 4}, "+": {6, 6}, "-": {6, 6}, "*": {7, 7}, "/": {7, 7}, "%": {7, 7}, "^": {10, 9},
+}
+
+// luaUnaryPriority is the priority of the unary operators.
+const luaUnaryPriority = 8
+
+// expr parses an expression whose binary operators bind tighter than limit.
+func (p *luaParser) expr(limit int) (luaExpr, error) {
+	var left luaExpr
+	var err error
+
+	if tok := p.peek(); p.is("not") || p.is("-") || p.is("#") {
+		p.next()
+		operand, err := p.expr(luaUnaryPriority)
+		if err != nil {
+			return nil, err
+		}
+		left = &luaUnary{op: tok.text, e: operand, line: tok.line}
+	} else if left, err = p.simpleExpr(); err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		if tok.kind != tokSymbol && tok.kind != tokName {
+			return left, nil
+		}
+		priority, ok := luaBinaryPriority[tok.text]
+		if !ok || priority[0] <= limit {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.expr(priority[1])
+		if err != nil {
+			return nil, err
+		}
+		left = &luaBinary{op: tok.text, l: left, r: right, line: tok.line}
+	}
+}
+
+// simpleExpr parses a constant, a table constructor or a suffixed expression.
+func (p *luaParser) simpleExpr() (luaExpr, error) {
+	tok := p.peek()
+
+	switch {
+	case tok.kind == tokNumber:
+		p.next()
+		return &luaConst{value: tok.num}, nil
+	case tok.kind == tokString:
+		p.next()
+		return &luaConst{value: tok.text}, nil
+	case p.accept("nil"):
+		return &luaConst{}, nil
+	case p.accept("true"):
+		return &luaConst{value: true}, nil
+	case p.accept("false"):
+		return &luaConst{value: false}, nil
+	case p.is("{"):
+		return p.tableConstructor()
+	case p.is("function"), p.is("..."):
+		return nil, p.errorf("'%s' is not supported", tok.text)
+	}
+
+	return p.suffixedExpr()
+}
+
+// suffixedExpr parses a name or parenthesized expression followed by any indexes and calls.
+func (p *luaParser) suffixedExpr() (luaExpr, error) {
+	var e luaExpr
+	tok := p.peek()
+
+	if p.accept("(") {
+		inner, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		// Parentheses truncate a call to its first result.
+		e = &luaBinary{op: "()", l: inner, line: tok.line}
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		e = &luaName{name: name, line: tok.line}
+	}
+
+	for {
+		tok := p.peek()
+		switch {
+		case p.accept("."):
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			e = &luaIndex{object: e, key: &luaConst{value: name}, line: tok.line}
+
+		case p.accept("["):
+			key, err := p.expr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = &luaIndex{object: e, key: key, line: tok.line}
+
+		case p.accept("("):
+			call := &luaCall{fn: e, line: tok.line}
+			if !p.accept(")") {
+				args, err := p.exprList()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(")"); err != nil {
+					return nil, err
+				}
+				call.args = args
+			}
+			e = call
+
+		case tok.kind == tokString:
+			p.next()
+			e = &luaCall{fn: e, args: []luaExpr{&luaConst{value: tok.text}}, line: tok.line}
+
+		case p.is("{"):
+			table, err := p.tableConstructor()
+			if err != nil {
+				return nil, err
+			}
+			e = &luaCall{fn: e, args: []luaExpr{table}, line: tok.line}
+
+		case p.is(":"):
+			return nil, p.errorf("method calls are not supported")
+
+		default:
+			return e, nil
+		}
+	}
+}
+
+// tableConstructor parses a table constructor.
+func (p *luaParser) tableConstructor() (luaExpr, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	t := &luaTableConstructor{}
+	for !p.accept("}") {
+		var item luaTableItem
+		var err error
+
+		switch {
+		case p.accept("["):
+			if item.key, err = p.expr(0); err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+		case p.peek().kind == tokName && !luaKeywords[p.peek().text] && p.tokens[p.pos+1].kind == tokSymbol && p.tokens[p.pos+1].text == "=":
+			item.key = &luaConst{value: p.next().text}
+			p.next()
+		}
+
+		if item.value, err = p.expr(0); err != nil {
+			return nil, err
+		}
+		t.items = append(t.items, item)
+
+		if !p.accept(",") && !p.accept(";") {
+			if err := p.expect("}"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	return t, nil
+}
+
+// Interpreter.
+
+// luaScope is a block's local variables.
+type luaScope struct {
+	vars   map[string]interface{}
+	parent *luaScope
+}
+
+// lookup finds the scope that declares a name, or nil.
+func (s *luaScope) lookup(name string) *luaScope {
+	for scope := s; scope != nil; scope = scope.parent {
+		if _, ok := scope.vars[name]; ok {
+			return scope
+		}
+	}
+
+	return nil
+}
+
+// luaSignal is how a block finished.
+type luaSignal int
+
+const (
+	luaNormal luaSignal = iota
+	luaBroke
+	luaReturned
+)
+
+// luaState runs a chunk.
+type luaState struct {
+	globals *luaTable
+}
+
+// run runs the chunk, returning the values it returned.
+func (l *luaState) run(chunk *luaChunk) ([]interface{}, error) {
+	_, values, err := l.block(chunk.body, &luaScope{vars: map[string]interface{}{}})
+	return values, err
+}
+
+// block runs statements in a new scope.
+func (l *luaState) block(stmts []luaStmt, parent *luaScope) (luaSignal, []interface{}, error) {
+	scope := &luaScope{vars: map[string]interface{}{}, parent: parent}
+
+	for _, stmt := range stmts {
+		signal, values, err := l.statement(stmt, scope)
+		if err != nil || signal != luaNormal {
+			return signal, values, err
+		}
+	}
+
+	return luaNormal, nil, nil
+}
+
+// statement runs a single statement.
+func (l *luaState) statement(stmt luaStmt, scope *luaScope) (luaSignal, []interface{}, error) {
+	switch s := stmt.(type) {
+	case *luaLocal:
+		values, err := l.exprList(s.exprs, scope)
+		if err != nil {
+			return 0, nil, err
+		}
+		for i, name := range s.names {
+			scope.vars[name] = nth(values, i)
+		}
+
+	case *luaAssign:
+		values, err := l.exprList(s.exprs, scope)
+		if err != nil {
+			return 0, nil, err
+		}
+		for i, target := range s.targets {
+			if err := l.assign(target, nth(values, i), scope); err != nil {
+				return 0, nil, err
+			}
+		}
+
+	case *luaCallStmt:
+		if _, err := l.call(s.call, scope); err != nil {
+			return 0, nil, err
+		}
+
+	case *luaIf:
+		for i, cond := range s.conds {
+			v, err := l.expr(cond, scope)
+			if err != nil {
+				return 0, nil, err
+			}
+			if luaTruthy(v) {
+				return l.block(s.blocks[i], scope)
+			}
+		}
+		if s.orElse != nil {
+			return l.block(s.orElse, scope)
+		}
+
+	case *luaWhile:
+		for {
+			v, err := l.expr(s.cond, scope)
+			if err != nil {
+				return 0, nil, err
+			}
+			if !luaTruthy(v) {
+				break
+			}
+			signal, values, err := l.block(s.body, scope)
+			if err != nil || signal == luaReturned {
+				return signal, values, err
+			}
+			if signal == luaBroke {
+				break
+			}
+		}
+
+	case *luaNumericFor:
+		return l.numericFor(s, scope)
+
+	case *luaGenericFor:
+		return l.genericFor(s, scope)
+
+	case *luaDo:
+		return l.block(s.body, scope)
+
+	case *luaReturn:
+		values, err := l.exprList(s.exprs, scope)
+		return luaReturned, values, err
+
+	case *luaBreak:
+		return luaBroke, nil, nil
+	}
+
+	return luaNormal, nil, nil
+}
+
+// numericFor runs a numeric for loop.
+func (l *luaState) numericFor(s *luaNumericFor, scope *luaScope) (luaSignal, []interface{}, error) {
+	var bounds [3]float64
+	exprs := []luaExpr{s.start, s.limit, s.step}
+	names := []string{"initial value", "limit", "step"}
+
+	for i, e := range exprs {
+		if e == nil {
+			bounds[i] = 1
+			continue
+		}
+		v, err := l.expr(e, scope)
+		if err != nil {
+			return 0, nil, err
+		}
+		n, ok := luaToNumber(v)
+		if !ok {
+			return 0, nil, &luaError{line: s.line, msg: fmt.Sprintf("'for' %s must be a number", names[i])}
+		}
+		bounds[i] = n
+	}
+
+	for i := bounds[0]; (bounds[2] > 0 && i <= bounds[1]) || (bounds[2] <= 0 && i >= bounds[1]); i += bounds[2] {
+		body := &luaScope{vars: map[string]interface{}{s.name: i}, parent: scope}
+		signal, values, err := l.block(s.body, body)
+		if err != nil || signal == luaReturned {
+			return signal, values, err
+		}
+		if signal == luaBroke {
+			break
+		}
+	}
+
+	return luaNormal, nil, nil
+}
+
+// genericFor runs a generic for loop, calling its iterator function until it returns nil.
+func (l *luaState) genericFor(s *luaGenericFor, scope *luaScope) (luaSignal, []interface{}, error) {
+	values, err := l.exprList(s.exprs, scope)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	iterator, ok := nth(values, 0).(luaFunction)
+	if !ok {
+		return 0, nil, &luaError{line: s.line, msg: fmt.Sprintf("attempt to call a %s value", luaType(nth(values, 0)))}
+	}
+	state, control := nth(values, 1), nth(values, 2)
+
+	for {
+		results, err := iterator([]interface{}{state, control})
+		if err != nil {
+			return 0, nil, &luaError{line: s.line, msg: err.Error(), err: err}
+		}
+		if nth(results, 0) == nil {
+			break
+		}
+		control = results[0]
+
+		body := &luaScope{vars: map[string]interface{}{}, parent: scope}
+		for i, name := range s.names {
+			body.vars[name] = nth(results, i)
+		}
+		signal, values, err := l.block(s.body, body)
+		if err != nil || signal == luaReturned {
+			return signal, values, err
+		}
+		if signal == luaBroke {
+			break
+		}
+	}
+
+	return luaNormal, nil, nil
+}
+
+// assign sets a variable or a table field. Globals can't be created, as in Redis.
+func (l *luaState) assign(target luaExpr, value interface{}, scope *luaScope) error {
+	switch t := target.(type) {
+	case *luaName:
+		if s := scope.lookup(t.name); s != nil {
+			s.vars[t.name] = value
+			return nil
+		}
+		if l.globals.get(t.name) != nil {
+			l.globals.set(t.name, value)
+			return nil
+		}
+		return &luaError{line: t.line, msg: fmt.Sprintf("Script attempted to create global variable '%s'", t.name)}
+
+	case *luaIndex:
+		object, err := l.expr(t.object, scope)
+		if err != nil {
+			return err
+		}
+		table, ok := object.(*luaTable)
+		if !ok {
+			return &luaError{line: t.line, msg: fmt.Sprintf("attempt to index a %s value", luaType(object))}
+		}
+		key, err := l.expr(t.key, scope)
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			return &luaError{line: t.line, msg: "table index is nil"}
+		}
+		table.set(key, value)
+	}
+
+	return nil
+}
+
+// exprList evaluates expressions, expanding the results of a call in the last position.
+func (l *luaState) exprList(exprs []luaExpr, scope *luaScope) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(exprs))
+	for i, e := range exprs {
+		if call, ok := e.(*luaCall); ok && i == len(exprs)-1 {
+			results, err := l.call(call, scope)
+			if err != nil {
+				return nil, err
+			}
+			return append(values, results...), nil
+		}
+
+		v, err := l.expr(e, scope)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// expr evaluates an expression to a single value.
+func (l *luaState) expr(e luaExpr, scope *luaScope) (interface{}, error) {
+	switch e := e.(type) {
+	case *luaConst:
+		return e.value, nil
+
+	case *luaName:
+		if s := scope.lookup(e.name); s != nil {
+			return s.vars[e.name], nil
+		}
+		return l.globals.get(e.name), nil
+
+	case *luaIndex:
+		object, err := l.expr(e.object, scope)
+		if err != nil {
+			return nil, err
+		}
+		table, ok := object.(*luaTable)
+		if !ok {
+			return nil, &luaError{line: e.line, msg: fmt.Sprintf("attempt to index a %s value", luaType(object))}
+		}
+		key, err := l.expr(e.key, scope)
+		if err != nil {
+			return nil, err
+		}
+		return table.get(key), nil
+
+	case *luaCall:
+		results, err := l.call(e, scope)
+		return nth(results, 0), err
+
+	case *luaTableConstructor:
+		table := newLuaTable()
+		n := 0
+		for i, item := range e.items {
+			if item.key == nil {
+				if call, ok := item.value.(*luaCall); ok && i == len(e.items)-1 {
+					results, err := l.call(call, scope)
+					if err != nil {
+						return nil, err
+					}
+					for _, v := range results {
+						n++
+						table.set(float64(n), v)
+					}
+					continue
+				}
+			}
+
+			value, err := l.expr(item.value, scope)
+			if err != nil {
+				return nil, err
+			}
+			if item.key == nil {
+				n++
+				table.set(float64(n), value)
+				continue
+			}
+			key, err := l.expr(item.key, scope)
+			if err != nil {
+				return nil, err
+			}
+			table.set(key, value)
+		}
+		return table, nil
+
+	case *luaUnary:
+		v, err := l.expr(e.e, scope)
+		if err != nil {
+			return nil, err
+		}
+		return luaUnaryOp(e.op, v, e.line)
+
+	case *luaBinary:
+		return l.binary(e, scope)
+	}
+
+	return nil, fmt.Errorf("unexpected expression %T", e)
+}
+
+// binary evaluates a binary operator, short-circuiting and and or.
+func (l *luaState) binary(e *luaBinary, scope *luaScope) (interface{}, error) {
+	left, err := l.expr(e.l, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "()":
+		return left, nil
+	case "and":
+		if !luaTruthy(left) {
+			return left, nil
+		}
+		return l.expr(e.r, scope)
+	case "or":
+		if luaTruthy(left) {
+			return left, nil
+		}
+		return l.expr(e.r, scope)
+	}
+
+	right, err := l.expr(e.r, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return luaEqual(left, right), nil
+	case "~=":
+		return !luaEqual(left, right), nil
+	case "<", "<=", ">", ">=":
+		return luaCompare(e.op, left, right, e.line)
+	case "..":
+		ls, lok := luaConcatString(left)
+		rs, rok := luaConcatString(right)
+		if !lok || !rok {
+			bad := left
+			if lok {
+				bad = right
+			}
+			return nil, &luaError{line: e.line, msg: fmt.Sprintf("attempt to concatenate a %s value", luaType(bad))}
+		}
+		return ls + rs, nil
+	}
+
+	ln, lok := luaToNumber(left)
+	rn, rok := luaToNumber(right)
+	if !lok || !rok {
+		bad := left
+		if lok {
+			bad = right
+		}
+		return nil, &luaError{line: e.line, msg: fmt.Sprintf("attempt to perform arithmetic on a %s value", luaType(bad))}
+	}
+
+	switch e.op {
+	case "+":
+		return ln + rn, nil
+	case "-":
+		return ln - rn, nil
+	case "*":
+		return ln * rn, nil
+	case "/":
+		return ln / rn, nil
+	case "%":
+		return ln - math.Floor(ln/rn)*rn, nil
+	case "^":
+		return math.Pow(ln, rn), nil
+	}
+
+	return nil, &luaError{line: e.line, msg: fmt.Sprintf("unexpected operator %s", e.op)}
+}
+
+// call calls a function, returning all of its results.
+func (l *luaState) call(c *luaCall, scope *luaScope) ([]interface{}, error) {
+	fn, err := l.expr(c.fn, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := fn.(luaFunction)
+	if !ok {
+		return nil, &luaError{line: c.line, msg: fmt.Sprintf("attempt to call a %s value", luaType(fn))}
+	}
+
+	args, err := l.exprList(c.args, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := f(args)
+	if err != nil {
+		if _, ok := err.(*luaError); ok {
+			return nil, err
+		}
+		return nil, &luaError{line: c.line, msg: err.Error(), err: err}
+	}
+
+	return results, nil
+}
+
+// luaUnaryOp evaluates a unary operator.
+func luaUnaryOp(op string, v interface{}, line int) (interface{}, error) {
+	switch op {
+	case "not":
+		return !luaTruthy(v), nil
+	case "-":
+		n, ok := luaToNumber(v)
+		if !ok {
+			return nil, &luaError{line: line, msg: fmt.Sprintf("attempt to perform arithmetic on a %s value", luaType(v))}
+		}
+		return -n, nil
+	default:
+		switch v := v.(type) {
+		case string:
+			return float64(len(v)), nil
+		case *luaTable:
+			return float64(v.length()), nil
+		}
+		return nil, &luaError{line: line, msg: fmt.Sprintf("attempt to get length of a %s value", luaType(v))}
+	}
+}
+
+// luaCompare evaluates an order comparison of two numbers or two strings.
+func luaCompare(op string, left interface{}, right interface{}, line int) (interface{}, error) {
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, &luaError{line: line, msg: fmt.Sprintf("attempt to compare %s with %s", luaType(left), luaType(right))}
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		case l != r:
+			return false, nil // NaN
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, &luaError{line: line, msg: fmt.Sprintf("attempt to compare %s with %s", luaType(left), luaType(right))}
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return nil, &luaError{line: line, msg: fmt.Sprintf("attempt to compare two %s values", luaType(left))}
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+// luaEqual compares values by value, except tables and functions, which are compared by identity.
+func luaEqual(a interface{}, b interface{}) bool {
+	switch a.(type) {
+	case luaFunction:
+		return false
+	}
+
+	return a == b
+}
+
+// luaTruthy gets whether a value is neither nil nor false.
+func luaTruthy(v interface{}) bool {
+	return v != nil && v != false
+}
+
+// luaType gets the name of a value's type.
+func luaType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *luaTable:
+		return "table"
+	case luaFunction:
+		return "function"
+	}
+
+	return "userdata"
+}
+
+// luaToNumber converts a number or numeric string to a number, as arithmetic and tonumber do.
+func luaToNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		s := strings.TrimSpace(v)
+		if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+			n, err := strconv.ParseUint(s[2:], 16, 64)
+			return float64(n), err == nil
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil || strings.EqualFold(s, "nan") || strings.Contains(strings.ToLower(s), "inf") {
+			return 0, false
+		}
+		return n, true
+	}
+
+	return 0, false
+}
+
+// luaNumberString formats a number as Lua does, with 14 significant digits.
+func luaNumberString(n float64) string {
+	return strconv.FormatFloat(n, 'g', 14, 64)
+}
+
+// luaConcatString converts a string or number to the string that concatenation uses.
+func luaConcatString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return luaNumberString(v), true
+	}
+
+	return "", false
+}
+
+// luaToString converts a value to a string, as tostring does.
+func luaToString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return luaNumberString(v)
+	case string:
+		return v
+	}
+
+	return fmt.Sprintf("%s: %p", luaType(v), v)
+}
+
+// nth gets the ith value, or nil.
+func nth(values []interface{}, i int) interface{} {
+	if i < len(values) {
+		return values[i]
+	}
+
+	return nil
+}
+
+// Built-ins.
+
+// newLuaGlobals constructs the globals of a script: KEYS and ARGV, redis.call and redis.pcall (which
+// run commands with call), and the parts of the standard library and cjson that scripts use.
+func newLuaGlobals(keys []string, args []string, call func(args []string) (interface{}, error)) *luaTable {
+	strs := func(values []string) *luaTable {
+		t := newLuaTable()
+		for i, v := range values {
+			t.set(float64(i+1), v)
+		}
+		return t
+	}
+
+	redisCall := func(protected bool) luaFunction {
+		return func(values []interface{}) ([]interface{}, error) {
+			if len(values) == 0 {
+				return nil, fmt.Errorf("Please specify at least one argument for redis.call()")
+			}
+
+			cmd := make([]string, len(values))
+			for i, v := range values {
+				switch v := v.(type) {
+				case string:
+					cmd[i] = v
+				case float64:
+					cmd[i] = luaNumberString(v)
+				default:
+					return nil, fmt.Errorf("Lua redis() command arguments must be strings or integers")
+				}
+			}
+
+			reply, err := call(cmd)
+			if err != nil {
+				if protected {
+					t := newLuaTable()
+					t.set("err", err.Error())
+					return []interface{}{t}, nil
+				}
+				return nil, err
+			}
+
+			return []interface{}{replyToLua(reply)}, nil
+		}
+	}
+
+	number := func(name string, f func(args []float64) float64) luaFunction {
+		return func(values []interface{}) ([]interface{}, error) {
+			if len(values) == 0 {
+				return nil, fmt.Errorf("bad argument #1 to '%s' (number expected, got no value)", name)
+			}
+			args := make([]float64, len(values))
+			for i, v := range values {
+				n, ok := luaToNumber(v)
+				if !ok {
+					return nil, fmt.Errorf("bad argument #%d to '%s' (number expected, got %s)", i+1, name, luaType(v))
+				}
+				args[i] = n
+			}
+			return []interface{}{f(args)}, nil
+		}
+	}
+
+	ipairs := luaFunction(func(values []interface{}) ([]interface{}, error) {
+		t, ok := nth(values, 0).(*luaTable)
+		if !ok {
+			return nil, fmt.Errorf("bad argument #1 to 'ipairs' (table expected, got %s)", luaType(nth(values, 0)))
+		}
+		next := luaFunction(func(state []interface{}) ([]interface{}, error) {
+			i := nth(state, 1).(float64) + 1
+			v := t.get(i)
+			if v == nil {
+				return []interface{}{nil}, nil
+			}
+			return []interface{}{i, v}, nil
+		})
+		return []interface{}{next, t, float64(0)}, nil
+	})
+
+	pairs := luaFunction(func(values []interface{}) ([]interface{}, error) {
+		t, ok := nth(values, 0).(*luaTable)
+		if !ok {
+			return nil, fmt.Errorf("bad argument #1 to 'pairs' (table expected, got %s)", luaType(nth(values, 0)))
+		}
+		keys := t.keys()
+		i := 0
+		next := luaFunction(func(state []interface{}) ([]interface{}, error) {
+			for ; i < len(keys); i++ {
+				if v := t.get(keys[i]); v != nil {
+					i++
+					return []interface{}{keys[i-1], v}, nil
+				}
+			}
+			return []interface{}{nil}, nil
+		})
+		return []interface{}{next, t, nil}, nil
+	})
+
+	globals := newLuaTable()
+	globals.set("KEYS", strs(keys))
+	globals.set("ARGV", strs(args))
+
+	redisTable := newLuaTable()
+	redisTable.set("call", redisCall(false))
+	redisTable.set("pcall", redisCall(true))
+	globals.set("redis", redisTable)
+
+	globals.set("tonumber", luaFunction(func(values []interface{}) ([]interface{}, error) {
+		if n, ok := luaToNumber(nth(values, 0)); ok {
+			return []interface{}{n}, nil
+		}
+		return []interface{}{nil}, nil
+	}))
+	globals.set("tostring", luaFunction(func(values []interface{}) ([]interface{}, error) {
+		return []interface{}{luaToString(nth(values, 0))}, nil
+	}))
+	globals.set("type", luaFunction(func(values []interface{}) ([]interface{}, error) {
+		return []interface{}{luaType(nth(values, 0))}, nil
+	}))
+	globals.set("ipairs", ipairs)
+	globals.set("pairs", pairs)
+	globals.set("unpack", luaFunction(func(values []interface{}) ([]interface{}, error) {
+		t, ok := nth(values, 0).(*luaTable)
+		if !ok {
+			return nil, fmt.Errorf("bad argument #1 to 'unpack' (table expected, got %s)", luaType(nth(values, 0)))
+		}
+		first, last := 1, t.length()
+		if n, ok := luaToNumber(nth(values, 1)); ok {
+			first = int(n)
+		}
+		if n, ok := luaToNumber(nth(values, 2)); ok {
+			last = int(n)
+		}
+		var results []interface{}
+		for i := first; i <= last; i++ {
+			results = append(results, t.get(float64(i)))
+		}
+		return results, nil
+	}))
+
+	mathTable := newLuaTable()
+	mathTable.set("huge", math.Inf(1))
+	mathTable.set("floor", number("floor", func(args []float64) float64 { return math.Floor(args[0]) }))
+	mathTable.set("ceil", number("ceil", func(args []float64) float64 { return math.Ceil(args[0]) }))
+	mathTable.set("abs", number("abs", func(args []float64) float64 { return math.Abs(args[0]) }))
+	mathTable.set("min", number("min", func(args []float64) float64 {
+		m := args[0]
+		for _, n := range args[1:] {
+			m = math.Min(m, n)
+		}
+		return m
+	}))
+	mathTable.set("max", number("max", func(args []float64) float64 {
+		m := args[0]
+		for _, n := range args[1:] {
+			m = math.Max(m, n)
+		}
+		return m
+	}))
+	globals.set("math", mathTable)
+
+	tableTable := newLuaTable()
+	tableTable.set("insert", luaFunction(func(values []interface{}) ([]interface{}, error) {
+		t, ok := nth(values, 0).(*luaTable)
+		if !ok || len(values) != 2 {
+			return nil, fmt.Errorf("wrong number of arguments to 'insert'")
+		}
+		t.set(float64(t.length()+1), values[1])
+		return nil, nil
+	}))
+	globals.set("table", tableTable)
+
+	cjson := newLuaTable()
+	cjson.set("decode", luaFunction(func(values []interface{}) ([]interface{}, error) {
+		s, ok := nth(values, 0).(string)
+		if !ok {
+			return nil, fmt.Errorf("bad argument #1 to 'decode' (string expected, got %s)", luaType(nth(values, 0)))
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return nil, fmt.Errorf("Expected value but found invalid token: %v", err)
+		}
+		return []interface{}{jsonToLua(v)}, nil
+	}))
+	cjson.set("encode", luaFunction(func(values []interface{}) ([]interface{}, error) {
+		raw, err := json.Marshal(luaToJSON(nth(values, 0)))
+		if err != nil {
+			return nil, fmt.Errorf("Cannot serialise: %v", err)
+		}
+		return []interface{}{string(raw)}, nil
+	}))
+	globals.set("cjson", cjson)
+
+	return globals
+}
+
+// jsonToLua converts a decoded JSON value to Lua. JSON null becomes nil, rather than cjson.null.
+func jsonToLua(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		t := newLuaTable()
+		for k, e := range v {
+			t.set(k, jsonToLua(e))
+		}
+		return t
+	case []interface{}:
+		t := newLuaTable()
+		for i, e := range v {
+			t.set(float64(i+1), jsonToLua(e))
+		}
+		return t
+	}
+
+	return v
+}
+
+// luaToJSON converts a Lua value to one that encodes as cjson would: tables with an array part are
+// arrays, and others objects.
+func luaToJSON(v interface{}) interface{} {
+	t, ok := v.(*luaTable)
+	if !ok {
+		return v
+	}
+
+	if n := t.length(); n > 0 {
+		values := make([]interface{}, n)
+		for i := range values {
+			values[i] = luaToJSON(t.get(float64(i + 1)))
+		}
+		return values
+	}
+
+	object := map[string]interface{}{}
+	for _, k := range t.keys() {
+		key, _ := luaConcatString(k)
+		object[key] = luaToJSON(t.get(k))
+	}
+
+	return object
+}
+
+// replyToLua converts a command reply to Lua, as Redis does: integers become numbers, nil becomes
+// false, statuses become tables with an ok field and arrays become tables.
+func replyToLua(reply interface{}) interface{} {
+	switch r := reply.(type) {
+	case nil:
+		return false
+	case int64:
+		return float64(r)
+	case string:
+		return r
+	case status:
+		t := newLuaTable()
+		t.set("ok", string(r))
+		return t
+	case []interface{}:
+		t := newLuaTable()
+		for i, e := range r {
+			t.set(float64(i+1), replyToLua(e))
+		}
+		return t
+	}
+
+	return reply
+}
+
+// luaToReply converts a value returned by a script to a reply, as Redis does: numbers are truncated
+// to integers, true becomes 1, false and nil become nil, tables with an err or ok field become errors
+// or statuses, and other tables become arrays of their array part.
+func luaToReply(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case float64:
+		return int64(v), nil
+	case string:
+		return v, nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return nil, nil
+	case *luaTable:
+		if msg, ok := v.get("err").(string); ok {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		if msg, ok := v.get("ok").(string); ok {
+			return status(msg), nil
+		}
+		n := v.length()
+		values := make([]interface{}, n)
+		for i := range values {
+			value, err := luaToReply(v.get(float64(i + 1)))
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+
+	return nil, nil
+}
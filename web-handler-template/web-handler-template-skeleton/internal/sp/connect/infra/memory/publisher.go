@@ -0,0 +1,65 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sailpoint/atlas-go/atlas/event"
+)
+
+// PublishedEvent is an event recorded by an EventPublisher, with the topic it was published to.
+type PublishedEvent struct {
+	Topic event.Topic
+	Event *event.Event
+}
+
+// EventPublisher is an event.Publisher that records events in memory instead of sending them to Kafka.
+type EventPublisher struct {
+	mu     sync.Mutex
+	events []PublishedEvent
+}
+
+// NewEventPublisher constructs a new EventPublisher.
+func NewEventPublisher() *EventPublisher {
+	return &EventPublisher{}
+}
+
+// BulkPublish records each of the events.
+func (p *EventPublisher) BulkPublish(ctx context.Context, events []event.EventAndTopic) ([]*event.FailedEventAndTopic, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range events {
+		p.events = append(p.events, PublishedEvent{Topic: e.Topic, Event: e.Event})
+	}
+
+	return nil, nil
+}
+
+// Publish records the event on the topic described by td, scoped by the request context.
+func (p *EventPublisher) Publish(ctx context.Context, td event.TopicDescriptor, e *event.Event) error {
+	topic, err := event.NewTopic(ctx, td)
+	if err != nil {
+		return err
+	}
+
+	return p.PublishToTopic(ctx, topic, e)
+}
+
+// PublishToTopic records the event on topic.
+func (p *EventPublisher) PublishToTopic(ctx context.Context, topic event.Topic, e *event.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, PublishedEvent{Topic: topic, Event: e})
+	return nil
+}
+
+// Events returns the events published so far, in order.
+func (p *EventPublisher) Events() []PublishedEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]PublishedEvent(nil), p.events...)
+}
@@ -0,0 +1,433 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package memory provides in-memory stand-ins for the service's backends, so that it can run
+// in-process without Redis or Kafka, as in the hermetic api-test suite and local development.
+package memory
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrUnsupported is returned by the commands the in-memory Redis doesn't implement, such as pipelines.
+var ErrUnsupported = errors.New("unsupported by in-memory redis")
+
+// unsupported is the client that Redis falls back to for the commands it doesn't implement. It never
+// connects, so each of its commands fails with ErrUnsupported. It's shared because go-redis keeps
+// redialing a client whose dials fail in the background, for as long as the process runs.
+var unsupported redis.Cmdable = redis.NewClient(&redis.Options{
+	Dialer: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		return nil, ErrUnsupported
+	},
+	MaxRetries: -1,
+})
+
+// Redis is an in-memory redis.Cmdable that implements the string, list, hash, set, sorted set and
+// publish commands used by the service's stores, and runs scripts written in the subset of Lua that
+// the service's scripts use (see lua.go). Any other command, including pipelines, fails with
+// ErrUnsupported.
+type Redis struct {
+	redis.Cmdable
+
+	mu      sync.Mutex
+	now     func() time.Time
+	strings map[string]string
+	lists   map[string][]string
+	hashes  map[string]map[string]string
+	sets    map[string]map[string]struct{}
+	zsets   map[string]map[string]float64
+	expires map[string]time.Time
+	scripts map[string]*luaChunk
+}
+
+var _ redis.Cmdable = (*Redis)(nil)
+
+// NewRedis constructs a new, empty Redis.
+func NewRedis() *Redis {
+	return &Redis{
+		Cmdable: unsupported,
+		now:     time.Now,
+		strings: map[string]string{},
+		lists:   map[string][]string{},
+		hashes:  map[string]map[string]string{},
+		sets:    map[string]map[string]struct{}{},
+		zsets:   map[string]map[string]float64{},
+		expires: map[string]time.Time{},
+		scripts: map[string]*luaChunk{},
+	}
+}
+
+// do runs a command, formatting its arguments the way go-redis writes them to the connection.
+func (r *Redis) do(args ...interface{}) (interface{}, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = toString(arg)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.call(strs)
+}
+
+// Ping always succeeds.
+func (r *Redis) Ping(ctx context.Context) *redis.StatusCmd {
+	return redis.NewStatusResult("PONG", nil)
+}
+
+// Get returns the string stored under key, or redis.Nil.
+func (r *Redis) Get(ctx context.Context, key string) *redis.StringCmd {
+	return stringResult(r.do("get", key))
+}
+
+// Set stores value under key, expiring after expiration if it's positive.
+func (r *Redis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	reply, err := r.do(append([]interface{}{"set", key, value}, expirationArgs(expiration)...)...)
+	s, _ := reply.(status)
+
+	return redis.NewStatusResult(string(s), err)
+}
+
+// SetNX stores value under key only if the key doesn't exist.
+func (r *Redis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	reply, err := r.do(append([]interface{}{"set", key, value, "nx"}, expirationArgs(expiration)...)...)
+
+	return redis.NewBoolResult(reply != nil, err)
+}
+
+// Del removes keys, returning how many existed.
+func (r *Redis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	return intResult(r.do(append([]interface{}{"del"}, stringArgs(keys)...)...))
+}
+
+// Exists returns how many of keys exist.
+func (r *Redis) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	return intResult(r.do(append([]interface{}{"exists"}, stringArgs(keys)...)...))
+}
+
+// LPush prepends values to the list under key, returning its length.
+func (r *Redis) LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	return intResult(r.do(append([]interface{}{"lpush", key}, values...)...))
+}
+
+// RPush appends values to the list under key, returning its length.
+func (r *Redis) RPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	return intResult(r.do(append([]interface{}{"rpush", key}, values...)...))
+}
+
+// LRange returns the elements of the list under key from index start to stop.
+func (r *Redis) LRange(ctx context.Context, key string, start int64, stop int64) *redis.StringSliceCmd {
+	return stringSliceResult(r.do("lrange", key, start, stop))
+}
+
+// HGet returns a field of the hash under key, or redis.Nil.
+func (r *Redis) HGet(ctx context.Context, key string, field string) *redis.StringCmd {
+	return stringResult(r.do("hget", key, field))
+}
+
+// HSet sets field-value pairs of the hash under key, returning how many fields were added.
+func (r *Redis) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	if len(values)%2 != 0 {
+		return redis.NewIntResult(0, fmt.Errorf("hset: odd number of field-value arguments"))
+	}
+
+	return intResult(r.do(append([]interface{}{"hset", key}, values...)...))
+}
+
+// HDel removes fields of the hash under key, returning how many existed.
+func (r *Redis) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	return intResult(r.do(append([]interface{}{"hdel", key}, stringArgs(fields)...)...))
+}
+
+// HKeys returns the fields of the hash under key, sorted.
+func (r *Redis) HKeys(ctx context.Context, key string) *redis.StringSliceCmd {
+	return stringSliceResult(r.do("hkeys", key))
+}
+
+// HGetAll returns the fields and values of the hash under key.
+func (r *Redis) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	reply, err := r.do("hgetall", key)
+	values, _ := reply.([]interface{})
+
+	hash := make(map[string]string, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		hash[values[i].(string)] = values[i+1].(string)
+	}
+
+	return redis.NewStringStringMapResult(hash, err)
+}
+
+// SAdd adds members to the set under key, returning how many were added.
+func (r *Redis) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	return intResult(r.do(append([]interface{}{"sadd", key}, members...)...))
+}
+
+// SRem removes members from the set under key, returning how many existed.
+func (r *Redis) SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	return intResult(r.do(append([]interface{}{"srem", key}, members...)...))
+}
+
+// SMembers returns the members of the set under key, sorted.
+func (r *Redis) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
+	return stringSliceResult(r.do("smembers", key))
+}
+
+// ZRem removes members from the sorted set under key, returning how many existed.
+func (r *Redis) ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	return intResult(r.do(append([]interface{}{"zrem", key}, members...)...))
+}
+
+// ZRange returns the members of the sorted set under key from index start to stop, in order of score.
+func (r *Redis) ZRange(ctx context.Context, key string, start int64, stop int64) *redis.StringSliceCmd {
+	return stringSliceResult(r.do("zrange", key, start, stop))
+}
+
+// ZCard returns the number of members of the sorted set under key.
+func (r *Redis) ZCard(ctx context.Context, key string) *redis.IntCmd {
+	return intResult(r.do("zcard", key))
+}
+
+// PTTL returns how long key has left to live, -1ms if it doesn't expire or -2ms if it doesn't exist.
+func (r *Redis) PTTL(ctx context.Context, key string) *redis.DurationCmd {
+	reply, err := r.do("pttl", key)
+	ms, _ := reply.(int64)
+	if ms > 0 {
+		return redis.NewDurationResult(time.Duration(ms)*time.Millisecond, err)
+	}
+
+	return redis.NewDurationResult(time.Duration(ms), err)
+}
+
+// Publish drops the message, since there are no subscribers; connected runtimes fall back to polling.
+func (r *Redis) Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd {
+	return redis.NewIntResult(0, nil)
+}
+
+// Eval runs a script, caching it for EvalSha.
+func (r *Redis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sha, err := r.load(script)
+	if err != nil {
+		return redis.NewCmdResult(nil, err)
+	}
+
+	return r.run(sha, keys, args)
+}
+
+// EvalSha runs a script cached by Eval or ScriptLoad, or fails with a NOSCRIPT error, as Redis does, so
+// that redis.Script.Run falls back to Eval.
+func (r *Redis) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.scripts[strings.ToLower(sha1)]; !ok {
+		return redis.NewCmdResult(nil, errors.New("NOSCRIPT No matching script. Please use EVAL."))
+	}
+
+	return r.run(strings.ToLower(sha1), keys, args)
+}
+
+// ScriptLoad caches a script for EvalSha, returning its SHA1.
+func (r *Redis) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sha, err := r.load(script)
+	return redis.NewStringResult(sha, err)
+}
+
+// ScriptExists returns whether each of the scripts is cached.
+func (r *Redis) ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exists := make([]bool, len(hashes))
+	for i, sha := range hashes {
+		_, exists[i] = r.scripts[strings.ToLower(sha)]
+	}
+
+	return redis.NewBoolSliceResult(exists, nil)
+}
+
+// ScriptFlush empties the script cache.
+func (r *Redis) ScriptFlush(ctx context.Context) *redis.StatusCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.scripts = map[string]*luaChunk{}
+
+	return redis.NewStatusResult("OK", nil)
+}
+
+// load parses and caches a script, returning its SHA1. The caller holds mu.
+func (r *Redis) load(script string) (string, error) {
+	sum := sha1.Sum([]byte(script))
+	sha := hex.EncodeToString(sum[:])
+
+	if _, ok := r.scripts[sha]; !ok {
+		chunk, err := parseLua(script)
+		if err != nil {
+			return "", fmt.Errorf("ERR Error compiling script (new function): %v", err)
+		}
+		r.scripts[sha] = chunk
+	}
+
+	return sha, nil
+}
+
+// run runs a cached script, holding mu throughout so that it's atomic, as in Redis. Errors, including
+// those of the commands it calls, fail the script. Scripts may only access the keys they're passed,
+// as in a Redis cluster, where other keys may be in another node's slots. The caller holds mu.
+func (r *Redis) run(sha string, keys []string, args []interface{}) *redis.Cmd {
+	argv := make([]string, len(args))
+	for i, arg := range args {
+		argv[i] = toString(arg)
+	}
+
+	declared := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		declared[key] = true
+	}
+	call := func(args []string) (interface{}, error) {
+		for _, key := range commandKeys(args) {
+			if !declared[key] {
+				return nil, fmt.Errorf("ERR Script attempted to access key %s that wasn't passed in KEYS", key)
+			}
+		}
+		return r.call(args)
+	}
+
+	state := &luaState{globals: newLuaGlobals(keys, argv, call)}
+	values, err := state.run(r.scripts[sha])
+	if err != nil {
+		return redis.NewCmdResult(nil, fmt.Errorf("ERR Error running script (call to f_%s): @%w", sha, err))
+	}
+
+	reply, err := luaToReply(nth(values, 0))
+	if err != nil {
+		return redis.NewCmdResult(nil, err)
+	}
+	if reply == nil {
+		return redis.NewCmdResult(nil, redis.Nil)
+	}
+	if s, ok := reply.(status); ok {
+		return redis.NewCmdResult(string(s), nil)
+	}
+
+	return redis.NewCmdResult(reply, nil)
+}
+
+// expire removes key if its expiration has passed. The caller holds mu.
+func (r *Redis) expire(key string) {
+	if at, ok := r.expires[key]; ok && !r.now().Before(at) {
+		r.delete(key)
+	}
+}
+
+// setExpiration expires key after expiration, or never if it isn't positive. The caller holds mu.
+func (r *Redis) setExpiration(key string, expiration time.Duration) {
+	if expiration > 0 {
+		r.expires[key] = r.now().Add(expiration)
+	} else {
+		delete(r.expires, key)
+	}
+}
+
+// delete removes key of any type. The caller holds mu.
+func (r *Redis) delete(key string) {
+	delete(r.strings, key)
+	delete(r.lists, key)
+	delete(r.hashes, key)
+	delete(r.sets, key)
+	delete(r.zsets, key)
+	delete(r.expires, key)
+}
+
+// expirationArgs gets the SET arguments that expire a key, as go-redis sends them.
+func expirationArgs(expiration time.Duration) []interface{} {
+	if expiration <= 0 {
+		return nil
+	}
+	if expiration < time.Second || expiration%time.Second != 0 {
+		return []interface{}{"px", int64(expiration / time.Millisecond)}
+	}
+
+	return []interface{}{"ex", int64(expiration / time.Second)}
+}
+
+// stringArgs converts strings to command arguments.
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+
+	return args
+}
+
+// stringResult converts a reply to a StringCmd, whose error is redis.Nil if the reply is nil.
+func stringResult(reply interface{}, err error) *redis.StringCmd {
+	if err == nil && reply == nil {
+		err = redis.Nil
+	}
+	s, _ := reply.(string)
+
+	return redis.NewStringResult(s, err)
+}
+
+// intResult converts a reply to an IntCmd.
+func intResult(reply interface{}, err error) *redis.IntCmd {
+	n, _ := reply.(int64)
+	return redis.NewIntResult(n, err)
+}
+
+// stringSliceResult converts an array reply to a StringSliceCmd.
+func stringSliceResult(reply interface{}, err error) *redis.StringSliceCmd {
+	values, _ := reply.([]interface{})
+
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i], _ = v.(string)
+	}
+
+	return redis.NewStringSliceResult(strs, err)
+}
+
+// toString formats a command argument the way go-redis writes it to the connection.
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return strconv.FormatInt(int64(v), 10)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
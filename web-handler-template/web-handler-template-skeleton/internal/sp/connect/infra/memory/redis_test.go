@@ -0,0 +1,151 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package memory
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestRedisStrings(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewRedis()
+	r.now = func() time.Time { return now }
+
+	if err := r.Get(ctx, "k").Err(); !errors.Is(err, redis.Nil) {
+		t.Fatalf("get missing key: expected redis.Nil, got %v", err)
+	}
+
+	r.Set(ctx, "k", []byte(`{"a":1}`), time.Minute)
+	if v := r.Get(ctx, "k").Val(); v != `{"a":1}` {
+		t.Errorf("expected bytes to be stored as a string, got %q", v)
+	}
+
+	if ok := r.SetNX(ctx, "k", "other", 0).Val(); ok {
+		t.Error("expected SetNX of an existing key to fail")
+	}
+
+	now = now.Add(time.Minute)
+	if n := r.Exists(ctx, "k").Val(); n != 0 {
+		t.Errorf("expected key to expire, got %d", n)
+	}
+	if ok := r.SetNX(ctx, "k", "other", 0).Val(); !ok {
+		t.Error("expected SetNX of an expired key to succeed")
+	}
+
+	if n := r.Del(ctx, "k", "missing").Val(); n != 1 {
+		t.Errorf("expected 1 key deleted, got %d", n)
+	}
+}
+
+func TestRedisCollections(t *testing.T) {
+	ctx := context.Background()
+	r := NewRedis()
+
+	r.LPush(ctx, "list", "a")
+	r.LPush(ctx, "list", "b")
+	if n := r.RPush(ctx, "list", "c").Val(); n != 3 {
+		t.Errorf("expected list length 3, got %d", n)
+	}
+	if !reflect.DeepEqual(r.lists["list"], []string{"b", "a", "c"}) {
+		t.Errorf("unexpected list %v", r.lists["list"])
+	}
+	if values := r.LRange(ctx, "list", 1, -1).Val(); !reflect.DeepEqual(values, []string{"a", "c"}) {
+		t.Errorf("unexpected range %v", values)
+	}
+	if values := r.LRange(ctx, "list", 3, 5).Val(); len(values) != 0 {
+		t.Errorf("expected a range past the end to be empty, got %v", values)
+	}
+
+	r.HSet(ctx, "hash", "f2", "v2", "f1", "v1")
+	if keys := r.HKeys(ctx, "hash").Val(); !reflect.DeepEqual(keys, []string{"f1", "f2"}) {
+		t.Errorf("unexpected hash keys %v", keys)
+	}
+	if v := r.HGet(ctx, "hash", "f1").Val(); v != "v1" {
+		t.Errorf("expected v1, got %q", v)
+	}
+	r.HDel(ctx, "hash", "f1", "f2")
+	if n := r.Exists(ctx, "hash").Val(); n != 0 {
+		t.Error("expected empty hash to be removed")
+	}
+
+	r.SAdd(ctx, "set", "b", "a", "a")
+	if members := r.SMembers(ctx, "set").Val(); !reflect.DeepEqual(members, []string{"a", "b"}) {
+		t.Errorf("unexpected set members %v", members)
+	}
+	if n := r.SRem(ctx, "set", "a", "c").Val(); n != 1 {
+		t.Errorf("expected 1 member removed, got %d", n)
+	}
+}
+
+func TestRedisScripts(t *testing.T) {
+	ctx := context.Background()
+	r := NewRedis()
+
+	script := redis.NewScript(`
+local n = redis.call('incrby', KEYS[1], 0)
+redis.call('hset', KEYS[2], ARGV[1], ARGV[2])
+local fields = redis.call('hkeys', KEYS[2])
+return {#fields, redis.call('hget', KEYS[2], ARGV[1]), tonumber(ARGV[2]) * 2}
+`)
+	if err := script.Run(ctx, r, []string{"n", "hash"}, "f", 21).Err(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected unknown commands to fail the script, got %v", err)
+	}
+
+	script = redis.NewScript(`
+redis.call('hset', KEYS[1], ARGV[1], ARGV[2])
+local fields = redis.call('hkeys', KEYS[1])
+return {#fields, redis.call('hget', KEYS[1], ARGV[1]), tonumber(ARGV[2]) * 2, redis.call('get', KEYS[2])}
+`)
+	if err := r.EvalSha(ctx, script.Hash(), []string{"hash", "missing"}, "f", 21).Err(); err == nil || !strings.HasPrefix(err.Error(), "NOSCRIPT ") {
+		t.Errorf("expected EvalSha of an unloaded script to fail with NOSCRIPT, got %v", err)
+	}
+
+	reply, err := script.Run(ctx, r, []string{"hash", "missing"}, "f", 21).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reply, []interface{}{int64(1), "21", int64(42), nil}) {
+		t.Errorf("unexpected reply %#v", reply)
+	}
+	if reply, err := r.Eval(ctx, "return {redis.call('hgetall', KEYS[1]), {}}", []string{"hash"}).Result(); err != nil || !reflect.DeepEqual(reply, []interface{}{[]interface{}{"f", "21"}, []interface{}{}}) {
+		t.Errorf("expected nested tables to be nested arrays, got %#v, %v", reply, err)
+	}
+	if exists := r.ScriptExists(ctx, script.Hash()).Val(); !reflect.DeepEqual(exists, []bool{true}) {
+		t.Errorf("expected Run to cache the script, got %v", exists)
+	}
+
+	if err := r.Eval(ctx, "return redis.call('get', KEYS[1])", []string{"missing"}).Err(); !errors.Is(err, redis.Nil) {
+		t.Errorf("expected a nil reply to be redis.Nil, got %v", err)
+	}
+	if err := r.Eval(ctx, "return {err = 'boom'}", nil).Err(); err == nil || err.Error() != "boom" {
+		t.Errorf("expected an error reply, got %v", err)
+	}
+	if err := r.Eval(ctx, "return redis.call('get', 'undeclared')", nil).Err(); err == nil || !strings.Contains(err.Error(), "wasn't passed in KEYS") {
+		t.Errorf("expected access to an undeclared key to fail, got %v", err)
+	}
+	if v, err := r.Eval(ctx, "x = 1", nil).Result(); err == nil {
+		t.Errorf("expected creating a global to fail, got %v", v)
+	}
+}
+
+func TestRedisUnimplementedCommandsFail(t *testing.T) {
+	ctx := context.Background()
+	r := NewRedis()
+
+	if err := r.ZAdd(ctx, "zset", &redis.Z{Score: 1, Member: "a"}).Err(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ZAdd to be unsupported, got %v", err)
+	}
+
+	pipe := r.Pipeline()
+	pipe.ZRem(ctx, "zset", "a")
+	if _, err := pipe.Exec(ctx); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected pipelines to be unsupported, got %v", err)
+	}
+}
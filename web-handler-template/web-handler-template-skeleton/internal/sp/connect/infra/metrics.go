@@ -0,0 +1,69 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// latencyBuckets are the histogram buckets, in milliseconds, shared by all of the latency metrics.
+var latencyBuckets = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// The latency histograms charted by cmd/grafana-builder, under the names its dashboards have always
+// used. Histograms with an "op" label are broken down by the operation performed against the
+// subsystem. The repo histograms predate the stores they now time, so their names don't always say
+// where the data lives:
+//
+//   - the connector repo is the connector spec, instance and ACL stores, and the audit log of their changes
+//   - the invocation repo is the outbox table that invocation and audit events are relayed from
+//   - the connector group repo is the queues of runtime commands, one per connector group
+//   - redis locks are the claims runtimes hold on the commands they're running
+var (
+	dynamoConnectorGroupLatency = newOpLatencyHistogram("sp_connect_dynamo_connector_group_latency_ms", "Latency of connector group repo operations")
+	dynamoConnectorLatency      = newOpLatencyHistogram("sp_connect_dynamo_connector_latency_ms", "Latency of connector repo operations")
+	dynamoInvocationLatency     = newOpLatencyHistogram("sp_connect_dynamo_invocation_latency_ms", "Latency of invocation repo operations")
+	queueLatency                = newOpLatencyHistogram("sp_connect_queue_latency_ms", "Latency of queue operations")
+	redisLockLatency            = newOpLatencyHistogram("sp_connect_redis_lock_latency_ms", "Latency of redis lock operations")
+	redisKVSLatency             = newOpLatencyHistogram("sp_connect_redis_kvs_latency_ms", "Latency of redis key/value store operations")
+	responseGatewayLatency      = newOpLatencyHistogram("sp_connect_response_gateway_latency_recv_ms", "Latency of receiving invocation responses from runtimes and global connectors")
+
+	publishKafkaLatency = newLatencyHistogram("sp_connect_publish_response_kafka_latency_ms", "Latency of publishing responses to kafka")
+	publishSQSLatency   = newLatencyHistogram("sp_connect_publish_sqs_response_latency_ms", "Latency of publishing responses to sqs")
+)
+
+// newOpLatencyHistogram registers a latency histogram with an "op" label.
+func newOpLatencyHistogram(name string, help string) *prometheus.HistogramVec {
+	return promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help,
+		Buckets: latencyBuckets,
+	}, []string{"op"})
+}
+
+// newLatencyHistogram registers a latency histogram without labels.
+func newLatencyHistogram(name string, help string) prometheus.Histogram {
+	return promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help,
+		Buckets: latencyBuckets,
+	})
+}
+
+// observeOp records the latency of an operation that began at start. It's intended to be deferred:
+//
+//	defer observeOp(redisKVSLatency, "get", time.Now())
+func observeOp(h *prometheus.HistogramVec, op string, start time.Time) {
+	h.WithLabelValues(op).Observe(sinceMillis(start))
+}
+
+// observe records the latency of an operation that began at start.
+func observe(h prometheus.Histogram, start time.Time) {
+	h.Observe(sinceMillis(start))
+}
+
+// sinceMillis returns the time elapsed since start in fractional milliseconds.
+func sinceMillis(start time.Time) float64 {
+	return float64(time.Since(start)) / float64(time.Millisecond)
+}
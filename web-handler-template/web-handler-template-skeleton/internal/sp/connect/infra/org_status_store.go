@@ -0,0 +1,43 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// kvsOrgStatusStore is an OrgStatusStore that records suspended orgs in a KeyValueStore.
+type kvsOrgStatusStore struct {
+	kvs model.KeyValueStore
+}
+
+// newOrgStatusStore constructs a new kvsOrgStatusStore.
+func newOrgStatusStore(kvs model.KeyValueStore) *kvsOrgStatusStore {
+	return &kvsOrgStatusStore{kvs: kvs}
+}
+
+// IsSuspended gets whether the tenant's org is suspended.
+func (s *kvsOrgStatusStore) IsSuspended(ctx context.Context, tenantID string) (bool, error) {
+	_, ok, err := s.kvs.Get(ctx, suspendedKey(tenantID))
+	return ok, err
+}
+
+// SetSuspended suspends or resumes the tenant's org. The suspension never expires.
+func (s *kvsOrgStatusStore) SetSuspended(ctx context.Context, tenantID string, suspended bool) error {
+	if !suspended {
+		return s.kvs.Delete(ctx, suspendedKey(tenantID))
+	}
+
+	return s.kvs.Set(ctx, suspendedKey(tenantID), "1", 0)
+}
+
+// PurgeOrg removes the tenant's suspension.
+func (s *kvsOrgStatusStore) PurgeOrg(ctx context.Context, tenantID string) error {
+	return s.kvs.Delete(ctx, suspendedKey(tenantID))
+}
+
+// suspendedKey returns the key that marks an org as suspended.
+func suspendedKey(tenantID string) string {
+	return "org-suspended:" + tenantID
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/event"
+	"github.com/sailpoint/atlas-go/atlas/log"
+)
+
+// maxOutboxBackoff caps the delay between delivery attempts of an outbox entry.
+const maxOutboxBackoff = 15 * time.Minute
+
+// outboxRelay periodically publishes pending outbox entries to Kafka. An entry is only deleted after
+// Kafka acknowledges it, so delivery is at-least-once.
+type outboxRelay struct {
+	outbox    outbox
+	publisher event.Publisher
+	interval  time.Duration
+	lease     time.Duration
+	batchSize int
+}
+
+// newOutboxRelay constructs a new outboxRelay.
+func newOutboxRelay(outbox outbox, publisher event.Publisher, interval time.Duration, batchSize int) *outboxRelay {
+	r := &outboxRelay{}
+	r.outbox = outbox
+	r.publisher = publisher
+	r.interval = interval
+	r.lease = 2 * time.Minute
+	r.batchSize = batchSize
+
+	return r
+}
+
+// Start relays pending entries until the context is cancelled.
+func (r *outboxRelay) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := r.relay(ctx); err != nil {
+				log.Errorf(ctx, "relay outbox: %v", err)
+			}
+		}
+	}
+}
+
+// relay publishes one batch of claimed entries. Entries that fail are retried once immediately,
+// and entries that fail again are rescheduled with exponential backoff.
+func (r *outboxRelay) relay(ctx context.Context) error {
+	now := time.Now()
+
+	entries, err := r.outbox.Claim(ctx, now, r.lease, r.batchSize)
+	if len(entries) == 0 {
+		return err
+	}
+
+	byID := make(map[string]*outboxEntry, len(entries))
+	batch := make([]event.EventAndTopic, 0, len(entries))
+	for _, entry := range entries {
+		topic, err := event.ParseTopic(string(entry.TopicID))
+		if err != nil {
+			log.Errorf(ctx, "parse topic of outbox entry %s: %v", entry.ID, err)
+			if err := r.outbox.Retry(ctx, entry, now.Add(maxOutboxBackoff), err); err != nil {
+				log.Errorf(ctx, "reschedule outbox entry %s: %v", entry.ID, err)
+			}
+			continue
+		}
+
+		byID[entry.ID] = entry
+		batch = append(batch, event.EventAndTopic{Event: entry.Event, Topic: topic})
+	}
+
+	if len(batch) == 0 {
+		return err
+	}
+
+	start := time.Now()
+	failed, err := r.publisher.BulkPublish(ctx, batch)
+	observe(publishKafkaLatency, start)
+	if err != nil {
+		return r.retryAll(ctx, byID, err)
+	}
+
+	if len(failed) > 0 {
+		retry := make([]event.EventAndTopic, 0, len(failed))
+		for _, f := range failed {
+			retry = append(retry, *f.EventAndTopic)
+		}
+
+		failed, err = r.publisher.BulkPublish(ctx, retry)
+		if err != nil {
+			return r.retryAll(ctx, byID, err)
+		}
+	}
+
+	for _, f := range failed {
+		entry := byID[f.EventAndTopic.Event.ID]
+		delete(byID, entry.ID)
+
+		if err := r.outbox.Retry(ctx, entry, now.Add(outboxBackoff(entry.Attempts)), f.Err); err != nil {
+			log.Errorf(ctx, "reschedule outbox entry %s: %v", entry.ID, err)
+		}
+	}
+
+	for _, entry := range byID {
+		if err := r.outbox.Delete(ctx, entry); err != nil {
+			log.Errorf(ctx, "delete outbox entry %s: %v", entry.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// retryAll reschedules every entry in a batch that couldn't be published at all.
+func (r *outboxRelay) retryAll(ctx context.Context, entries map[string]*outboxEntry, cause error) error {
+	now := time.Now()
+	for _, entry := range entries {
+		if err := r.outbox.Retry(ctx, entry, now.Add(outboxBackoff(entry.Attempts)), cause); err != nil {
+			log.Errorf(ctx, "reschedule outbox entry %s: %v", entry.ID, err)
+		}
+	}
+
+	return fmt.Errorf("publish outbox entries: %w", cause)
+}
+
+// outboxBackoff returns the delay before the next attempt of an entry that has already been
+// attempted the specified number of times.
+func outboxBackoff(attempts int64) time.Duration {
+	if attempts > 10 {
+		return maxOutboxBackoff
+	}
+
+	d := time.Second << uint(attempts)
+	if d > maxOutboxBackoff {
+		return maxOutboxBackoff
+	}
+
+	return d
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/event"
+)
+
+// fakeOutbox is an outbox that records how the relay settles each entry.
+type fakeOutbox struct {
+	entries []*outboxEntry
+	deleted []string
+	retried map[string]time.Time
+}
+
+func (o *fakeOutbox) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*outboxEntry, error) {
+	claimed := o.entries
+	o.entries = nil
+	return claimed, nil
+}
+
+func (o *fakeOutbox) Delete(ctx context.Context, entry *outboxEntry) error {
+	o.deleted = append(o.deleted, entry.ID)
+	return nil
+}
+
+func (o *fakeOutbox) Retry(ctx context.Context, entry *outboxEntry, nextAttempt time.Time, cause error) error {
+	if o.retried == nil {
+		o.retried = map[string]time.Time{}
+	}
+	o.retried[entry.ID] = nextAttempt
+	return nil
+}
+
+// fakeBulkPublisher is an event.Publisher that fails to publish the events with IDs in fail.
+type fakeBulkPublisher struct {
+	event.Publisher
+	fail  map[string]bool
+	calls int
+}
+
+func (p *fakeBulkPublisher) BulkPublish(ctx context.Context, events []event.EventAndTopic) ([]*event.FailedEventAndTopic, error) {
+	p.calls++
+
+	var failed []*event.FailedEventAndTopic
+	for i := range events {
+		if p.fail[events[i].Event.ID] {
+			failed = append(failed, &event.FailedEventAndTopic{EventAndTopic: &events[i], Err: errors.New("nack")})
+		}
+	}
+
+	return failed, nil
+}
+
+func TestOutboxRelayBacksOffFailedEntries(t *testing.T) {
+	outbox := &fakeOutbox{entries: []*outboxEntry{
+		{Shard: "0", ID: "ok", TopicID: "AUDIT", Event: &event.Event{ID: "ok"}},
+		{Shard: "0", ID: "nack", TopicID: "AUDIT", Event: &event.Event{ID: "nack"}, Attempts: 3},
+	}}
+	publisher := &fakeBulkPublisher{fail: map[string]bool{"nack": true}}
+
+	relay := newOutboxRelay(outbox, publisher, time.Second, 10)
+
+	start := time.Now()
+	if err := relay.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if publisher.calls != 2 {
+		t.Errorf("expected the failed entry to be retried once immediately, got %d publishes", publisher.calls)
+	}
+
+	if fmt.Sprint(outbox.deleted) != "[ok]" {
+		t.Errorf("expected only the published entry to be deleted, got %v", outbox.deleted)
+	}
+
+	next, ok := outbox.retried["nack"]
+	if !ok {
+		t.Fatalf("expected the failed entry to be rescheduled, got %v", outbox.retried)
+	}
+	if delay := next.Sub(start); delay < 8*time.Second || delay > 9*time.Second {
+		t.Errorf("expected a backoff of 8s after 3 attempts, got %v", delay)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int64
+		expected time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{5, 32 * time.Second},
+		{10, maxOutboxBackoff},
+		{64, maxOutboxBackoff},
+	}
+
+	for _, tt := range tests {
+		if d := outboxBackoff(tt.attempts); d != tt.expected {
+			t.Errorf("after %d attempts: expected %v, got %v", tt.attempts, tt.expected, d)
+		}
+	}
+}
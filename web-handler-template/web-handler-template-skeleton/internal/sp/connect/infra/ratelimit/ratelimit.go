@@ -0,0 +1,333 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package ratelimit admits connector invocations against per-tenant and per-connector-instance limits
+// on invocation rate (a token bucket) and on concurrent in-flight invocations. State is kept in Redis
+// and updated by a single script, so the limits hold across the cluster.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sailpoint/atlas-go/atlas/feature"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// keyPrefix namespaces the limiter's keys in the shared Redis cluster.
+const keyPrefix = "sp-connect:invocation-limits:"
+
+// Feature flags that override a tenant's limits. atlas feature flags are boolean, so overrides are
+// tiers: exempt tenants have no limits, and the multiplier flags scale every limit.
+const (
+	FlagExempt feature.Flag = "SP_CONNECT_INVOCATION_LIMITS_EXEMPT"
+	FlagX2     feature.Flag = "SP_CONNECT_INVOCATION_LIMITS_X2"
+	FlagX5     feature.Flag = "SP_CONNECT_INVOCATION_LIMITS_X5"
+	FlagX10    feature.Flag = "SP_CONNECT_INVOCATION_LIMITS_X10"
+)
+
+// multiplierFlags are checked in order, so the largest multiplier enabled for a tenant wins.
+var multiplierFlags = []struct {
+	flag   feature.Flag
+	factor float64
+}{
+	{FlagX10, 10},
+	{FlagX5, 5},
+	{FlagX2, 2},
+}
+
+// Limits are the invocation limits of a tenant or a connector instance. A zero value disables a limit.
+type Limits struct {
+
+	// Rate is the sustained number of invocations per second.
+	Rate float64
+
+	// Burst is the number of invocations that can be made at once after a quiet period.
+	Burst int
+
+	// Concurrency is the number of invocations that can be in flight at once.
+	Concurrency int
+}
+
+// scale multiplies every limit by a factor.
+func (l Limits) scale(factor float64) Limits {
+	return Limits{
+		Rate:        l.Rate * factor,
+		Burst:       int(math.Ceil(float64(l.Burst) * factor)),
+		Concurrency: int(math.Ceil(float64(l.Concurrency) * factor)),
+	}
+}
+
+// validate checks that the limits are usable. A token bucket with a rate must hold at least one
+// token, or it would refuse every invocation.
+func (l Limits) validate() error {
+	if l.Rate < 0 || l.Burst < 0 || l.Concurrency < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		return fmt.Errorf("burst must be at least 1 when the rate is limited")
+	}
+
+	return nil
+}
+
+// Config is the default configuration of a Limiter.
+type Config struct {
+	Tenant   Limits
+	Instance Limits
+
+	// Lease is how long an invocation holds its concurrency slot if it's never released, eg. because
+	// the instance that started it died.
+	Lease time.Duration
+
+	// ConcurrencyRetryAfter is the Retry-After given to callers that are over a concurrency limit,
+	// since there's no telling when an in-flight invocation will finish.
+	ConcurrencyRetryAfter time.Duration
+}
+
+// Validate checks that the tenant and instance limits are usable.
+func (c Config) Validate() error {
+	if err := c.Tenant.validate(); err != nil {
+		return fmt.Errorf("tenant: %w", err)
+	}
+	if err := c.Instance.validate(); err != nil {
+		return fmt.Errorf("instance: %w", err)
+	}
+
+	return nil
+}
+
+// Limiter is a model.InvocationLimiter backed by Redis.
+type Limiter struct {
+	client   redis.Cmdable
+	config   Config
+	features feature.Store
+	now      func() time.Time
+}
+
+// NewLimiter constructs a new Limiter. Tenant overrides are read from the feature store.
+func NewLimiter(client redis.Cmdable, config Config, features feature.Store) *Limiter {
+	l := &Limiter{}
+	l.client = client
+	l.config = config
+	l.features = features
+	l.now = time.Now
+
+	return l
+}
+
+// acquireScript checks the concurrency and rate limits of the tenant (KEYS[1] and KEYS[2]) and the
+// instance (KEYS[3] and KEYS[4]), and only consumes a token and takes a slot in each once both pass.
+// Admitted instances (ARGV[11]) are added to the tenant's set of instances (KEYS[5]), which lives as
+// long as their keys, so that the tenant's keys can be found when it's purged.
+// It returns the scope (0 for the tenant, 1 for the instance) and limit that refused the invocation
+// along with the retry delay in milliseconds, or a scope of -1 if the invocation was admitted.
+//
+// Buckets are hashes of the remaining tokens and the time they were last refilled. Slots are sorted
+// sets of invocation IDs scored by when their lease expires.
+var acquireScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local lease = tonumber(ARGV[2])
+local member = ARGV[3]
+local concurrencyRetry = tonumber(ARGV[4])
+
+local buckets = {}
+for scope = 0, 1 do
+	local rate = tonumber(ARGV[5 + scope * 3])
+	local burst = tonumber(ARGV[6 + scope * 3])
+	local concurrency = tonumber(ARGV[7 + scope * 3])
+	local bucketKey = KEYS[1 + scope * 2]
+	local slotsKey = KEYS[2 + scope * 2]
+
+	if concurrency > 0 then
+		redis.call('ZREMRANGEBYSCORE', slotsKey, '-inf', now)
+		if redis.call('ZCARD', slotsKey) >= concurrency then
+			return {scope, 'concurrency', concurrencyRetry}
+		end
+	end
+
+	if rate > 0 then
+		local state = redis.call('HMGET', bucketKey, 'tokens', 'refilled')
+		local tokens = tonumber(state[1]) or burst
+		local refilled = tonumber(state[2]) or now
+		tokens = math.min(burst, tokens + math.max(0, now - refilled) * rate / 1000)
+		if tokens < 1 then
+			return {scope, 'rate', math.ceil((1 - tokens) * 1000 / rate)}
+		end
+		buckets[#buckets + 1] = {bucketKey, tokens - 1, math.ceil(burst * 1000 / rate)}
+	end
+end
+
+local ttl = lease
+for _, bucket in ipairs(buckets) do
+	redis.call('HSET', bucket[1], 'tokens', tostring(bucket[2]), 'refilled', now)
+	redis.call('PEXPIRE', bucket[1], bucket[3] + 1000)
+	ttl = math.max(ttl, bucket[3] + 1000)
+end
+
+for scope = 0, 1 do
+	if tonumber(ARGV[7 + scope * 3]) > 0 then
+		redis.call('ZADD', KEYS[2 + scope * 2], now + lease, member)
+		redis.call('PEXPIRE', KEYS[2 + scope * 2], lease)
+	end
+end
+
+redis.call('SADD', KEYS[5], ARGV[11])
+if redis.call('PTTL', KEYS[5]) < ttl then
+	redis.call('PEXPIRE', KEYS[5], ttl)
+end
+
+return {-1, '', 0}
+`)
+
+// scopes names the scopes returned by acquireScript.
+var scopes = []string{"tenant", "connector instance"}
+
+// Acquire admits an invocation, reserving a concurrency slot for it until it's released. It returns
+// a *model.TooManyRequestsError if the tenant or the connector instance is over a limit.
+func (l *Limiter) Acquire(ctx context.Context, tenantID string, instanceID string, invocationID string) error {
+	tenant, instance, err := l.limits(ctx)
+	if err != nil {
+		return err
+	}
+	if tenant == (Limits{}) && instance == (Limits{}) {
+		return nil
+	}
+
+	keys := append(scopeKeys(tenantID, ""), scopeKeys(tenantID, instanceID)...)
+	keys = append(keys, instancesKey(tenantID))
+	args := []interface{}{
+		l.now().UnixNano() / int64(time.Millisecond),
+		l.config.Lease.Milliseconds(),
+		invocationID,
+		l.config.ConcurrencyRetryAfter.Milliseconds(),
+		tenant.Rate, tenant.Burst, tenant.Concurrency,
+		instance.Rate, instance.Burst, instance.Concurrency,
+		instanceID,
+	}
+
+	result, err := acquireScript.Run(ctx, l.client, keys, args...).Result()
+	if err != nil {
+		return fmt.Errorf("acquire invocation slot: %w", err)
+	}
+
+	return parseResult(result)
+}
+
+// releaseScript removes an invocation (ARGV[1]) from the slots of the tenant (KEYS[1]) and the
+// instance (KEYS[2]) in one round trip.
+var releaseScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	redis.call('ZREM', key, ARGV[1])
+end
+return 0
+`)
+
+// Release frees the concurrency slot of an invocation once it has finished.
+func (l *Limiter) Release(ctx context.Context, tenantID string, instanceID string, invocationID string) error {
+	keys := []string{scopeKeys(tenantID, "")[1], scopeKeys(tenantID, instanceID)[1]}
+
+	if err := releaseScript.Run(ctx, l.client, keys, invocationID).Err(); err != nil {
+		return fmt.Errorf("release invocation slot: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeOrg removes the tenant's buckets and slots, and those of its connector instances.
+func (l *Limiter) PurgeOrg(ctx context.Context, tenantID string) error {
+	instanceIDs, err := l.client.SMembers(ctx, instancesKey(tenantID)).Result()
+	if err != nil {
+		return fmt.Errorf("list limited instances: %w", err)
+	}
+
+	keys := scopeKeys(tenantID, "")
+	for _, instanceID := range instanceIDs {
+		keys = append(keys, scopeKeys(tenantID, instanceID)...)
+	}
+	keys = append(keys, instancesKey(tenantID))
+
+	if err := l.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("purge invocation limits: %w", err)
+	}
+
+	return nil
+}
+
+// limits gets the tenant and instance limits for the tenant of the request context, applying any
+// overrides enabled for it in the feature store.
+func (l *Limiter) limits(ctx context.Context) (Limits, Limits, error) {
+	exempt, err := l.features.IsEnabled(ctx, FlagExempt, false)
+	if err != nil {
+		return Limits{}, Limits{}, err
+	}
+	if exempt {
+		return Limits{}, Limits{}, nil
+	}
+
+	for _, m := range multiplierFlags {
+		enabled, err := l.features.IsEnabled(ctx, m.flag, false)
+		if err != nil {
+			return Limits{}, Limits{}, err
+		}
+		if enabled {
+			return l.config.Tenant.scale(m.factor), l.config.Instance.scale(m.factor), nil
+		}
+	}
+
+	return l.config.Tenant, l.config.Instance, nil
+}
+
+// scopeKeys gets the bucket and slots keys of a tenant, or of a connector instance when instanceID
+// is set. The tenant ID is a hash tag, so that every key the script touches is in the same slot.
+func scopeKeys(tenantID string, instanceID string) []string {
+	prefix := keyPrefix + "{" + tenantID + "}"
+	if instanceID != "" {
+		prefix += ":instance:" + instanceID
+	}
+
+	return []string{prefix + ":bucket", prefix + ":slots"}
+}
+
+// instancesKey gets the key of the set of a tenant's connector instances that have been admitted
+// invocations, in the same slot as their scope keys.
+func instancesKey(tenantID string) string {
+	return keyPrefix + "{" + tenantID + "}:instances"
+}
+
+// parseResult converts the result of acquireScript to an error.
+func parseResult(result interface{}) error {
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 3 {
+		return fmt.Errorf("unexpected acquire result: %v", result)
+	}
+
+	scope, _ := values[0].(int64)
+	if scope < 0 {
+		return nil
+	}
+	if int(scope) >= len(scopes) {
+		return fmt.Errorf("unexpected acquire result: %v", result)
+	}
+
+	limit, _ := values[1].(string)
+	retry, _ := values[2].(int64)
+
+	return &model.TooManyRequestsError{
+		Reason:     fmt.Sprintf("%s invocation %s limit exceeded", scopes[scope], limit),
+		RetryAfter: time.Duration(retry) * time.Millisecond,
+	}
+}
+
+// RetryAfter formats a delay as the value of a Retry-After header, in whole seconds of at least one.
+func RetryAfter(d time.Duration) string {
+	seconds := int64(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return strconv.FormatInt(seconds, 10)
+}
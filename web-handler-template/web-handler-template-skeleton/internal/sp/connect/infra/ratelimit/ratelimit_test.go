@@ -0,0 +1,267 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/feature"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/memory"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeFeatures map[feature.Flag]bool
+
+func (f fakeFeatures) IsEnabled(ctx context.Context, flag feature.Flag, defaultValue bool) (bool, error) {
+	if enabled, ok := f[flag]; ok {
+		return enabled, nil
+	}
+	return defaultValue, nil
+}
+
+func (f fakeFeatures) IsExistsAndEnabled(ctx context.Context, flag feature.Flag, defaultValue bool, defaultIfFlagDoesNotExist bool) (bool, error) {
+	return f.IsEnabled(ctx, flag, defaultValue)
+}
+
+func (f fakeFeatures) IsEnabledForUser(user feature.User, flag feature.Flag, defaultValue bool) (bool, error) {
+	return f.IsEnabled(context.Background(), flag, defaultValue)
+}
+
+func (f fakeFeatures) Close() {}
+
+var testConfig = Config{
+	Tenant:   Limits{Rate: 10, Burst: 50, Concurrency: 100},
+	Instance: Limits{Rate: 2, Burst: 10, Concurrency: 20},
+	Lease:    15 * time.Minute,
+}
+
+func TestLimitsOverrides(t *testing.T) {
+	tests := []struct {
+		name     string
+		features fakeFeatures
+		tenant   Limits
+		instance Limits
+	}{
+		{"defaults", fakeFeatures{}, testConfig.Tenant, testConfig.Instance},
+		{"exempt", fakeFeatures{FlagExempt: true, FlagX10: true}, Limits{}, Limits{}},
+		{"x2", fakeFeatures{FlagX2: true}, Limits{Rate: 20, Burst: 100, Concurrency: 200}, Limits{Rate: 4, Burst: 20, Concurrency: 40}},
+		{"largest multiplier wins", fakeFeatures{FlagX2: true, FlagX5: true}, Limits{Rate: 50, Burst: 250, Concurrency: 500}, Limits{Rate: 10, Burst: 50, Concurrency: 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant, instance, err := NewLimiter(nil, testConfig, tt.features).limits(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tenant != tt.tenant || instance != tt.instance {
+				t.Errorf("got %+v, %+v; want %+v, %+v", tenant, instance, tt.tenant, tt.instance)
+			}
+		})
+	}
+}
+
+func TestAcquireExemptSkipsRedis(t *testing.T) {
+	// A nil client would panic if the limiter tried to run the script.
+	l := NewLimiter(nil, testConfig, fakeFeatures{FlagExempt: true})
+	if err := l.Acquire(context.Background(), "acme", "instance", "1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseResult(t *testing.T) {
+	if err := parseResult([]interface{}{int64(-1), "", int64(0)}); err != nil {
+		t.Errorf("expected admission, got %v", err)
+	}
+
+	err := parseResult([]interface{}{int64(1), "rate", int64(1500)})
+
+	var tooMany *model.TooManyRequestsError
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("expected too many requests, got %v", err)
+	}
+	if tooMany.RetryAfter != 1500*time.Millisecond || tooMany.Reason != "connector instance invocation rate limit exceeded" {
+		t.Errorf("unexpected error: %+v", tooMany)
+	}
+
+	if err := parseResult("OK"); err == nil {
+		t.Error("expected malformed result to be rejected")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for d, expected := range map[time.Duration]string{0: "1", 200 * time.Millisecond: "1", 1500 * time.Millisecond: "2", time.Minute: "60"} {
+		if actual := RetryAfter(d); actual != expected {
+			t.Errorf("RetryAfter(%v) = %s, want %s", d, actual, expected)
+		}
+	}
+}
+
+func TestScopeKeysShareHashTag(t *testing.T) {
+	keys := append(scopeKeys("acme", ""), scopeKeys("acme", "instance")...)
+	expected := []string{
+		"sp-connect:invocation-limits:{acme}:bucket",
+		"sp-connect:invocation-limits:{acme}:slots",
+		"sp-connect:invocation-limits:{acme}:instance:instance:bucket",
+		"sp-connect:invocation-limits:{acme}:instance:instance:slots",
+	}
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Errorf("key %d = %s, want %s", i, keys[i], expected[i])
+		}
+	}
+}
+
+func TestInstancesKeySharesHashTag(t *testing.T) {
+	if key := instancesKey("acme"); key != "sp-connect:invocation-limits:{acme}:instances" {
+		t.Errorf("unexpected instances key %s", key)
+	}
+}
+
+func TestPurgeOrgDeletesTheTenantsKeys(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewRedis()
+	l := NewLimiter(client, testConfig, fakeFeatures{})
+
+	for _, tenantID := range []string{"acme", "other"} {
+		keys := append(scopeKeys(tenantID, ""), scopeKeys(tenantID, "instance")...)
+		for _, key := range keys {
+			client.HSet(ctx, key, "tokens", "1")
+		}
+		client.SAdd(ctx, instancesKey(tenantID), "instance")
+	}
+
+	if err := l.PurgeOrg(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+
+	purged := append(scopeKeys("acme", ""), scopeKeys("acme", "instance")...)
+	if n := client.Exists(ctx, append(purged, instancesKey("acme"))...).Val(); n != 0 {
+		t.Errorf("expected the tenant's keys to be purged, %d remain", n)
+	}
+	kept := append(scopeKeys("other", ""), scopeKeys("other", "instance")...)
+	if n := client.Exists(ctx, append(kept, instancesKey("other"))...).Val(); n != 5 {
+		t.Errorf("expected the other tenant's 5 keys to remain, got %d", n)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{"defaults", testConfig, true},
+		{"disabled", Config{}, true},
+		{"concurrency only", Config{Instance: Limits{Concurrency: 1}}, true},
+		{"rate without burst", Config{Tenant: Limits{Rate: 10}}, false},
+		{"negative", Config{Instance: Limits{Concurrency: -1}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+// newTestLimiter constructs a Limiter against an in-memory Redis, which runs acquireScript, with a
+// clock that the test controls.
+func newTestLimiter(config Config, now *time.Time) *Limiter {
+	l := NewLimiter(memory.NewRedis(), config, fakeFeatures{})
+	l.now = func() time.Time { return *now }
+
+	return l
+}
+
+func TestAcquireRateLimit(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newTestLimiter(Config{Instance: Limits{Rate: 2, Burst: 2}, Lease: time.Minute}, &now)
+
+	for _, id := range []string{"1", "2"} {
+		if err := l.Acquire(ctx, "acme", "instance", id); err != nil {
+			t.Fatalf("expected invocation %s within the burst to be admitted, got %v", id, err)
+		}
+	}
+
+	err := l.Acquire(ctx, "acme", "instance", "3")
+	var tooMany *model.TooManyRequestsError
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("expected the invocation over the burst to be refused, got %v", err)
+	}
+	if tooMany.RetryAfter != 500*time.Millisecond || tooMany.Reason != "connector instance invocation rate limit exceeded" {
+		t.Errorf("unexpected error: %+v", tooMany)
+	}
+
+	if err := l.Acquire(ctx, "acme", "other", "4"); err != nil {
+		t.Errorf("expected other instances to have their own bucket, got %v", err)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if err := l.Acquire(ctx, "acme", "instance", "5"); err != nil {
+		t.Errorf("expected a token to be refilled, got %v", err)
+	}
+	if err := l.Acquire(ctx, "acme", "instance", "6"); err == nil {
+		t.Error("expected the refilled token to be consumed")
+	}
+}
+
+func TestAcquireConcurrencyLimit(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := Config{Tenant: Limits{Concurrency: 1}, Lease: time.Minute, ConcurrencyRetryAfter: 5 * time.Second}
+	l := newTestLimiter(config, &now)
+
+	if err := l.Acquire(ctx, "acme", "instance", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := l.Acquire(ctx, "acme", "other", "2")
+	var tooMany *model.TooManyRequestsError
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("expected the tenant's second invocation to be refused, got %v", err)
+	}
+	if tooMany.RetryAfter != 5*time.Second || tooMany.Reason != "tenant invocation concurrency limit exceeded" {
+		t.Errorf("unexpected error: %+v", tooMany)
+	}
+	if err := l.Acquire(ctx, "other", "instance", "3"); err != nil {
+		t.Errorf("expected other tenants to have their own slots, got %v", err)
+	}
+
+	if err := l.Release(ctx, "acme", "instance", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Acquire(ctx, "acme", "other", "2"); err != nil {
+		t.Errorf("expected the released slot to be free, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := l.Acquire(ctx, "acme", "other", "4"); err != nil {
+		t.Errorf("expected the slot's lease to expire, got %v", err)
+	}
+}
+
+func TestAcquireRefusesWithoutConsuming(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := Config{Tenant: Limits{Rate: 1, Burst: 1}, Instance: Limits{Concurrency: 1}, Lease: time.Minute}
+	l := newTestLimiter(config, &now)
+
+	if err := l.Acquire(ctx, "acme", "instance", "1"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Second)
+
+	// The instance's slot is taken, so the tenant's refilled token mustn't be consumed.
+	if err := l.Acquire(ctx, "acme", "instance", "2"); err == nil {
+		t.Fatal("expected the instance's concurrency limit to refuse the invocation")
+	}
+	if err := l.Acquire(ctx, "acme", "other", "3"); err != nil {
+		t.Errorf("expected the tenant's token to be left for another instance, got %v", err)
+	}
+}
@@ -0,0 +1,374 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sailpoint/atlas-go/atlas/event"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// redisInvocationStore is an InvocationStore that keeps each invocation in a Redis hash, with its
+// results in a list, for deployments without an invocation table. Its changes are made by scripts
+// that check the invocation's status, so that a finished invocation never changes. Their events
+// are published directly once a change is made, since there's no outbox to write them to.
+//
+// Invocations expire after the retention period. Each tenant has a sorted set of its invocation IDs,
+// scored by when they expire, so that its keys can be found when it's purged.
+type redisInvocationStore struct {
+	client    redis.Cmdable
+	retention time.Duration
+	builder   resultEventBuilder
+	publisher event.Publisher
+}
+
+// newRedisInvocationStore constructs a new redisInvocationStore.
+func newRedisInvocationStore(client redis.Cmdable, retention time.Duration, builder resultEventBuilder, publisher event.Publisher) *redisInvocationStore {
+	s := &redisInvocationStore{}
+	s.client = client
+	s.retention = retention
+	s.builder = builder
+	s.publisher = publisher
+
+	return s
+}
+
+// createInvocationScript stores the invocation hash KEYS[1], with the fields and values ARGV[4:],
+// expiring after ARGV[3] milliseconds, and adds its ID ARGV[1] to the tenant's set KEYS[2], scored by
+// when it expires, ARGV[2]. IDs of expired invocations are trimmed from the set on the way.
+var createInvocationScript = redis.NewScript(`
+redis.call('HSET', KEYS[1], unpack(ARGV, 4))
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', tonumber(ARGV[2]) - tonumber(ARGV[3]))
+redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return 0
+`)
+
+// markStartedScript moves a pending invocation, the hash KEYS[1], to running, setting the time
+// ARGV[1] as when it started. It returns the updated hash, or false if the invocation doesn't exist
+// or isn't pending.
+var markStartedScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'status') ~= 'pending' then
+	return false
+end
+redis.call('HSET', KEYS[1], 'status', 'running', 'started', ARGV[1])
+return redis.call('HGETALL', KEYS[1])
+`)
+
+// addResultScript appends the result ARGV[1] to the list KEYS[2] of a pending or running invocation,
+// the hash KEYS[1], marking it running and counting the result. The time ARGV[2] is set as when the
+// first result was received. It returns the updated hash, or false if the invocation doesn't exist
+// or has finished.
+var addResultScript = redis.NewScript(`
+local status = redis.call('HGET', KEYS[1], 'status')
+if status ~= 'pending' and status ~= 'running' then
+	return false
+end
+local n = redis.call('RPUSH', KEYS[2], ARGV[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+redis.call('HSET', KEYS[1], 'status', 'running', 'resultCount', n)
+if n == 1 then
+	redis.call('HSET', KEYS[1], 'firstResult', ARGV[2])
+end
+return redis.call('HGETALL', KEYS[1])
+`)
+
+// nextResultsScript reads up to ARGV[1] results of the invocation, the hash KEYS[1], from its list
+// KEYS[2], starting after those already read, and counts them as read. It returns the updated hash
+// along with the results, or false if the invocation doesn't exist.
+var nextResultsScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+local read = tonumber(redis.call('HGET', KEYS[1], 'resultsRead') or '0')
+local results = redis.call('LRANGE', KEYS[2], read, read + tonumber(ARGV[1]) - 1)
+if #results > 0 then
+	redis.call('HSET', KEYS[1], 'resultsRead', read + #results)
+end
+return {redis.call('HGETALL', KEYS[1]), results}
+`)
+
+// finishInvocationScript moves a pending or running invocation, the hash KEYS[1], to the final status
+// ARGV[1] at the time ARGV[2], with the error type ARGV[3] and failure ARGV[4], if any. It returns
+// the updated hash, or false if the invocation doesn't exist or has already finished.
+var finishInvocationScript = redis.NewScript(`
+local status = redis.call('HGET', KEYS[1], 'status')
+if status ~= 'pending' and status ~= 'running' then
+	return false
+end
+redis.call('HSET', KEYS[1], 'status', ARGV[1], 'finished', ARGV[2], 'errorType', ARGV[3], 'failure', ARGV[4])
+return redis.call('HGETALL', KEYS[1])
+`)
+
+// CreateInvocation stores a new invocation and publishes its state.
+func (s *redisInvocationStore) CreateInvocation(ctx context.Context, inv *model.Invocation) error {
+	defer observeOp(dynamoInvocationLatency, "invocation_create", time.Now())
+
+	fields, err := invocationHash(inv)
+	if err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(s.retention)
+	args := []interface{}{inv.ID, expires.UnixNano() / int64(time.Millisecond), s.retention.Milliseconds()}
+	for _, field := range fields {
+		args = append(args, field)
+	}
+
+	keys := []string{invocationKey(inv.TenantID, inv.ID), tenantInvocationsKey(inv.TenantID)}
+	if err := createInvocationScript.Run(ctx, s.client, keys, args...).Err(); err != nil {
+		return fmt.Errorf("create invocation %s: %w", inv.ID, err)
+	}
+
+	state, err := invocationStateEvent(ctx, inv)
+	if err != nil {
+		return err
+	}
+
+	return publishEvents(ctx, s.publisher, []topicEvent{state})
+}
+
+// GetInvocation gets an invocation of the tenant, or nil if it doesn't exist.
+func (s *redisInvocationStore) GetInvocation(ctx context.Context, tenantID string, id string) (*model.Invocation, error) {
+	defer observeOp(dynamoInvocationLatency, "invocation_get", time.Now())
+
+	fields, err := s.client.HGetAll(ctx, invocationKey(tenantID, id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	return parseInvocationHash(fields)
+}
+
+// MarkStarted moves a pending invocation to running and publishes its state.
+func (s *redisInvocationStore) MarkStarted(ctx context.Context, tenantID string, id string) (*model.Invocation, error) {
+	defer observeOp(dynamoInvocationLatency, "invocation_start", time.Now())
+
+	inv, err := s.update(ctx, markStartedScript, []string{invocationKey(tenantID, id)}, formatInvocationTime(time.Now()))
+	if err != nil || inv == nil {
+		return nil, err
+	}
+
+	state, err := invocationStateEvent(ctx, inv)
+	if err != nil {
+		return nil, err
+	}
+
+	return inv, publishEvents(ctx, s.publisher, []topicEvent{state})
+}
+
+// AddResult appends a result to the invocation of the command and publishes its events.
+func (s *redisInvocationStore) AddResult(ctx context.Context, cmd *model.RuntimeCommand, output json.RawMessage) (*model.Invocation, error) {
+	defer observeOp(dynamoInvocationLatency, "invocation_result", time.Now())
+
+	keys := []string{invocationKey(cmd.TenantID, cmd.InvocationID), invocationResultsKey(cmd.TenantID, cmd.InvocationID)}
+	inv, err := s.update(ctx, addResultScript, keys, string(output), formatInvocationTime(time.Now()))
+	if err != nil || inv == nil {
+		return nil, err
+	}
+
+	events, err := resultEvents(ctx, s.builder, cmd, output, inv)
+	if err != nil {
+		return nil, err
+	}
+
+	return inv, publishEvents(ctx, s.publisher, events)
+}
+
+// NextResults reads the invocation's unread results and moves its read cursor past them.
+func (s *redisInvocationStore) NextResults(ctx context.Context, tenantID string, id string, limit int) (*model.Invocation, []json.RawMessage, error) {
+	defer observeOp(dynamoInvocationLatency, "invocation_read", time.Now())
+
+	keys := []string{invocationKey(tenantID, id), invocationResultsKey(tenantID, id)}
+	reply, err := nextResultsScript.Run(ctx, s.client, keys, limit).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read results of invocation %s: %w", id, err)
+	}
+
+	values, _ := reply.([]interface{})
+	if len(values) != 2 {
+		return nil, nil, fmt.Errorf("read results of invocation %s: unexpected reply %v", id, reply)
+	}
+
+	inv, err := parseInvocationReply(values[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replies, _ := values[1].([]interface{})
+	results := make([]json.RawMessage, 0, len(replies))
+	for _, r := range replies {
+		result, _ := r.(string)
+		results = append(results, json.RawMessage(result))
+	}
+
+	return inv, results, nil
+}
+
+// FinishInvocation moves the invocation to a final status and publishes its state.
+func (s *redisInvocationStore) FinishInvocation(ctx context.Context, tenantID string, id string, status model.InvocationStatus, failure *model.InvocationFailure) (*model.Invocation, error) {
+	defer observeOp(dynamoInvocationLatency, "invocation_finish", time.Now())
+
+	var errorType model.InvocationErrorType
+	var rawFailure []byte
+	if failure != nil {
+		errorType = failure.Type
+
+		var err error
+		if rawFailure, err = json.Marshal(failure); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := []string{invocationKey(tenantID, id)}
+	inv, err := s.update(ctx, finishInvocationScript, keys, string(status), formatInvocationTime(time.Now()), string(errorType), string(rawFailure))
+	if err != nil || inv == nil {
+		return nil, err
+	}
+
+	state, err := invocationStateEvent(ctx, inv)
+	if err != nil {
+		return nil, err
+	}
+
+	return inv, publishEvents(ctx, s.publisher, []topicEvent{state})
+}
+
+// PurgeOrg removes the tenant's invocations and their results.
+func (s *redisInvocationStore) PurgeOrg(ctx context.Context, tenantID string) error {
+	defer observeOp(dynamoInvocationLatency, "invocation_purge", time.Now())
+
+	ids, err := s.client.ZRange(ctx, tenantInvocationsKey(tenantID), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{tenantInvocationsKey(tenantID)}
+	for _, id := range ids {
+		keys = append(keys, invocationKey(tenantID, id), invocationResultsKey(tenantID, id))
+	}
+
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// update runs a script that changes an invocation and returns its hash, returning the updated
+// invocation, or nil if the script didn't change it.
+func (s *redisInvocationStore) update(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (*model.Invocation, error) {
+	result, err := script.Run(ctx, s.client, keys, args...).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update invocation: %w", err)
+	}
+
+	return parseInvocationReply(result)
+}
+
+// parseInvocationReply parses the hash of an invocation as returned by HGETALL within a script, as an
+// array of its fields and values.
+func parseInvocationReply(reply interface{}) (*model.Invocation, error) {
+	values, _ := reply.([]interface{})
+	fields := make(map[string]string, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		field, _ := values[i].(string)
+		fields[field], _ = values[i+1].(string)
+	}
+
+	return parseInvocationHash(fields)
+}
+
+// invocationHash gets the fields and values of the hash of a new invocation.
+func invocationHash(inv *model.Invocation) ([]string, error) {
+	return []string{
+		"id", inv.ID,
+		"tenantId", inv.TenantID,
+		"connectorInstanceId", inv.ConnectorInstanceID,
+		"type", string(inv.Type),
+		"topology", string(inv.Topology),
+		"status", string(inv.Status),
+		"context", string(inv.Context),
+		"resultCount", strconv.Itoa(inv.ResultCount),
+		"resultsRead", strconv.Itoa(inv.ResultsRead),
+		"created", formatInvocationTime(inv.CreatedAt),
+		"expiration", formatInvocationTime(inv.Expiration),
+	}, nil
+}
+
+// parseInvocationHash parses the hash of an invocation.
+func parseInvocationHash(fields map[string]string) (*model.Invocation, error) {
+	inv := &model.Invocation{
+		ID:                  fields["id"],
+		TenantID:            fields["tenantId"],
+		ConnectorInstanceID: fields["connectorInstanceId"],
+		Type:                model.CommandType(fields["type"]),
+		Topology:            model.Topology(fields["topology"]),
+		Status:              model.InvocationStatus(fields["status"]),
+		ErrorType:           model.InvocationErrorType(fields["errorType"]),
+	}
+	if raw := fields["context"]; raw != "" {
+		inv.Context = json.RawMessage(raw)
+	}
+
+	var err error
+	if inv.ResultCount, err = strconv.Atoi(fields["resultCount"]); err != nil {
+		return nil, fmt.Errorf("parse invocation %s: %w", inv.ID, err)
+	}
+	if inv.ResultsRead, err = strconv.Atoi(fields["resultsRead"]); err != nil {
+		return nil, fmt.Errorf("parse invocation %s: %w", inv.ID, err)
+	}
+
+	for field, t := range map[string]*time.Time{"created": &inv.CreatedAt, "expiration": &inv.Expiration, "started": &inv.StartedAt, "firstResult": &inv.FirstResultAt, "finished": &inv.FinishedAt} {
+		if fields[field] == "" {
+			continue
+		}
+		if *t, err = time.Parse(time.RFC3339Nano, fields[field]); err != nil {
+			return nil, fmt.Errorf("parse invocation %s: %w", inv.ID, err)
+		}
+	}
+
+	if raw := fields["failure"]; raw != "" {
+		inv.Failure = &model.InvocationFailure{}
+		if err := json.Unmarshal([]byte(raw), inv.Failure); err != nil {
+			return nil, fmt.Errorf("parse invocation %s: %w", inv.ID, err)
+		}
+	}
+
+	return inv, nil
+}
+
+// formatInvocationTime formats a time of an invocation for storage.
+func formatInvocationTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// invocationKey gets the key of the hash of an invocation, with the tenant ID as the hash tag.
+func invocationKey(tenantID string, id string) string {
+	return keyPrefix + "invocation:{" + tenantID + "}:" + id
+}
+
+// invocationResultsKey gets the key of the list of an invocation's results.
+func invocationResultsKey(tenantID string, id string) string {
+	return invocationKey(tenantID, id) + ":results"
+}
+
+// tenantInvocationsKey gets the key of the sorted set of the tenant's invocation IDs.
+func tenantInvocationsKey(tenantID string) string {
+	return keyPrefix + "invocation:{" + tenantID + "}"
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/event"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/memory"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// fakeResultEventBuilder is a resultEventBuilder that builds an event for every result of an
+// account list, the only command with a standard event here.
+type fakeResultEventBuilder struct{}
+
+func (b *fakeResultEventBuilder) CommandResultEvent(ctx context.Context, result model.CommandResult) (*event.Event, error) {
+	if result.Type != model.CommandAccountList {
+		return nil, nil
+	}
+
+	return event.NewEventJSON("ACCOUNT_AGGREGATED", string(result.Output), nil), nil
+}
+
+// newTestInvocation creates a pending invocation of an account list in the store.
+func newTestInvocation(t *testing.T, ctx context.Context, store model.InvocationStore, tenantID string, id string) *model.RuntimeCommand {
+	t.Helper()
+
+	inv := &model.Invocation{
+		ID:                  id,
+		TenantID:            tenantID,
+		ConnectorInstanceID: "instance",
+		Type:                model.CommandAccountList,
+		Topology:            model.TopologyRuntime,
+		Status:              model.InvocationPending,
+		Context:             json.RawMessage(`{"page":1}`),
+		CreatedAt:           time.Now().UTC(),
+	}
+	if err := store.CreateInvocation(ctx, inv); err != nil {
+		t.Fatal(err)
+	}
+
+	return &model.RuntimeCommand{InvocationID: id, TenantID: tenantID, ConnectorInstanceID: "instance", Type: model.CommandAccountList}
+}
+
+func TestRedisInvocationStoreLifecycle(t *testing.T) {
+	ctx := context.Background()
+	publisher := &fakeAuditPublisher{}
+	store := newRedisInvocationStore(memory.NewRedis(), time.Hour, &fakeResultEventBuilder{}, publisher)
+
+	cmd := newTestInvocation(t, ctx, store, "t1", "i1")
+	if publisher.published != 1 {
+		t.Errorf("expected the created state to be published, got %d events", publisher.published)
+	}
+
+	inv, err := store.MarkStarted(ctx, "t1", "i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv == nil || inv.Status != model.InvocationRunning || inv.StartedAt.IsZero() || publisher.published != 2 {
+		t.Fatalf("expected a started invocation with its state published, got %+v and %d events", inv, publisher.published)
+	}
+	if inv, err = store.MarkStarted(ctx, "t1", "i1"); err != nil || inv != nil {
+		t.Fatalf("expected a running invocation not to start again, got %+v, %v", inv, err)
+	}
+
+	if inv, err = store.AddResult(ctx, cmd, json.RawMessage(`{"id":"a1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if inv == nil || inv.Status != model.InvocationRunning || inv.ResultCount != 1 || inv.FirstResultAt.IsZero() {
+		t.Fatalf("expected a running invocation with its first result, got %+v", inv)
+	}
+	// The result's standard event and the running state.
+	if publisher.published != 4 {
+		t.Errorf("expected 2 events for the first result, got %d", publisher.published-2)
+	}
+
+	if inv, err = store.AddResult(ctx, cmd, json.RawMessage(`{"id":"a2"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if inv.ResultCount != 2 || publisher.published != 5 {
+		t.Errorf("expected a second result with only its standard event, got %d results and %d events", inv.ResultCount, publisher.published)
+	}
+
+	failure := &model.InvocationFailure{Type: model.InvocationErrorConnector, Message: "boom"}
+	if inv, err = store.FinishInvocation(ctx, "t1", "i1", model.InvocationFailed, failure); err != nil {
+		t.Fatal(err)
+	}
+	if inv == nil || inv.Status != model.InvocationFailed || inv.ErrorType != model.InvocationErrorConnector || inv.Failure.Message != "boom" || inv.FinishedAt.IsZero() {
+		t.Fatalf("expected a failed invocation, got %+v", inv)
+	}
+
+	got, err := store.GetInvocation(ctx, "t1", "i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != model.InvocationFailed || got.ResultCount != 2 || got.Failure == nil || !got.CreatedAt.Equal(inv.CreatedAt) || !got.StartedAt.Equal(inv.StartedAt) {
+		t.Errorf("unexpected stored invocation %+v", got)
+	}
+}
+
+func TestRedisInvocationStoreIgnoresChangesToFinishedInvocations(t *testing.T) {
+	ctx := context.Background()
+	publisher := &fakeAuditPublisher{}
+	store := newRedisInvocationStore(memory.NewRedis(), time.Hour, &fakeResultEventBuilder{}, publisher)
+
+	cmd := newTestInvocation(t, ctx, store, "t1", "i1")
+	if _, err := store.FinishInvocation(ctx, "t1", "i1", model.InvocationCompleted, nil); err != nil {
+		t.Fatal(err)
+	}
+	published := publisher.published
+
+	if inv, err := store.AddResult(ctx, cmd, json.RawMessage(`{}`)); err != nil || inv != nil {
+		t.Errorf("expected a result of a finished invocation to be dropped, got %+v, %v", inv, err)
+	}
+	if inv, err := store.FinishInvocation(ctx, "t1", "i1", model.InvocationCancelled, nil); err != nil || inv != nil {
+		t.Errorf("expected a finished invocation not to finish again, got %+v, %v", inv, err)
+	}
+	if inv, err := store.MarkStarted(ctx, "t1", "i1"); err != nil || inv != nil {
+		t.Errorf("expected a finished invocation not to start, got %+v, %v", inv, err)
+	}
+	if inv, err := store.FinishInvocation(ctx, "t1", "missing", model.InvocationCancelled, nil); err != nil || inv != nil {
+		t.Errorf("expected a missing invocation not to be finished, got %+v, %v", inv, err)
+	}
+	if publisher.published != published {
+		t.Errorf("expected no events for ignored changes, got %d", publisher.published-published)
+	}
+
+	if inv, _ := store.GetInvocation(ctx, "t1", "i1"); inv.Status != model.InvocationCompleted || inv.ResultCount != 0 {
+		t.Errorf("expected the invocation to stay completed, got %+v", inv)
+	}
+}
+
+func TestRedisInvocationStoreReadsResultsInPages(t *testing.T) {
+	testNextResults(t, newRedisInvocationStore(memory.NewRedis(), time.Hour, &fakeResultEventBuilder{}, &fakeAuditPublisher{}))
+}
+
+// testNextResults checks that the store reads an invocation's results in pages of at most the limit,
+// each starting after the last.
+func testNextResults(t *testing.T, store model.InvocationStore) {
+	ctx := testInvocationContext()
+
+	cmd := newTestInvocation(t, ctx, store, "t1", "i1")
+	for _, output := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		if _, err := store.AddResult(ctx, cmd, json.RawMessage(output)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []string{`[{"n":1},{"n":2}]`, `[{"n":3}]`, `[]`} {
+		inv, results, err := store.NextResults(ctx, "t1", "i1", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := json.Marshal(results); string(got) != want {
+			t.Errorf("expected results %s, got %s", want, got)
+		}
+		if inv.ResultCount != 3 || string(inv.Context) != `{"page":1}` {
+			t.Errorf("unexpected invocation %+v", inv)
+		}
+	}
+
+	inv, err := store.GetInvocation(ctx, "t1", "i1")
+	if err != nil || inv.ResultsRead != 3 {
+		t.Errorf("expected every result to be read, got %+v, %v", inv, err)
+	}
+
+	if inv, results, err := store.NextResults(ctx, "t1", "missing", 2); err != nil || inv != nil || results != nil {
+		t.Errorf("expected no results of a missing invocation, got %+v, %v, %v", inv, results, err)
+	}
+}
+
+func TestRedisInvocationStorePurgeOrgRemovesOnlyTheTenantsInvocations(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewRedis()
+	store := newRedisInvocationStore(client, time.Hour, &fakeResultEventBuilder{}, &fakeAuditPublisher{})
+
+	for _, tenantID := range []string{"t1", "t2"} {
+		cmd := newTestInvocation(t, ctx, store, tenantID, "i1")
+		if _, err := store.AddResult(ctx, cmd, json.RawMessage(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.PurgeOrg(ctx, "t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := client.Exists(ctx, invocationKey("t1", "i1"), invocationResultsKey("t1", "i1"), tenantInvocationsKey("t1")).Val(); n != 0 {
+		t.Errorf("expected the keys of t1 to be removed, %d remain", n)
+	}
+	if inv, _ := store.GetInvocation(ctx, "t2", "i1"); inv == nil || inv.ResultCount != 1 {
+		t.Errorf("expected the invocation of t2 to remain, got %+v", inv)
+	}
+}
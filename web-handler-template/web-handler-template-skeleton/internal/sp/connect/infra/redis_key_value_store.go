@@ -0,0 +1,57 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// keyPrefix namespaces all of the service's keys in the shared Redis cluster.
+const keyPrefix = "sp-connect:"
+
+// redisKeyValueStore is a KeyValueStore backed by Redis. The latency of every operation is recorded
+// in sp_connect_redis_kvs_latency_ms.
+type redisKeyValueStore struct {
+	client redis.Cmdable
+}
+
+// newRedisKeyValueStore constructs a new redisKeyValueStore.
+func newRedisKeyValueStore(client redis.Cmdable) *redisKeyValueStore {
+	return &redisKeyValueStore{client: client}
+}
+
+// Get returns the value stored under key and whether it exists.
+func (s *redisKeyValueStore) Get(ctx context.Context, key string) (string, bool, error) {
+	defer observeOp(redisKVSLatency, "get", time.Now())
+
+	value, err := s.client.Get(ctx, keyPrefix+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+// Set stores value under key, expiring after ttl.
+func (s *redisKeyValueStore) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	defer observeOp(redisKVSLatency, "set", time.Now())
+	return s.client.Set(ctx, keyPrefix+key, value, ttl).Err()
+}
+
+// SetIfAbsent stores value under key only if the key doesn't already exist, returning whether it was stored.
+func (s *redisKeyValueStore) SetIfAbsent(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	defer observeOp(redisKVSLatency, "set_if_absent", time.Now())
+	return s.client.SetNX(ctx, keyPrefix+key, value, ttl).Result()
+}
+
+// Delete removes key from the store.
+func (s *redisKeyValueStore) Delete(ctx context.Context, key string) error {
+	defer observeOp(redisKVSLatency, "delete", time.Now())
+	return s.client.Del(ctx, keyPrefix+key).Err()
+}
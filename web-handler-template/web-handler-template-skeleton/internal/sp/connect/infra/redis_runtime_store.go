@@ -0,0 +1,424 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// runtimeTenantsKey is the set of tenants whose runtimes have claimed commands, which the reaper walks
+// to find the claims of dead runtimes. Tenants stay in it until their org is purged.
+const runtimeTenantsKey = keyPrefix + "runtime:tenants"
+
+// redisRuntimeStore is a RuntimeStore and RuntimeCommandQueue backed by Redis.
+//
+// Each connector group of a tenant has a list of pending commands, and each runtime a hash of the
+// commands it has claimed, keyed by invocation ID. Claiming moves a command from one to the other in
+// a script, so a command is always either pending or claimed by exactly one runtime. Each tenant also
+// has a set of the runtimes that may hold claims, and sets of its registered runtimes and of the
+// groups commands were dispatched to, so that its keys can be found when it's purged. The tenant ID
+// is a hash tag in all of these keys, so that they're in the same cluster slot and the scripts, which
+// are passed every key they touch, can move commands between them.
+type redisRuntimeStore struct {
+	client redis.Cmdable
+}
+
+// newRedisRuntimeStore constructs a new redisRuntimeStore.
+func newRedisRuntimeStore(client redis.Cmdable) *redisRuntimeStore {
+	return &redisRuntimeStore{client: client}
+}
+
+// claimScript pops the next pending command from the first non-empty list of KEYS[3:] and stores it
+// in the claims hash KEYS[1], returning it, or false if every list is empty. The runtime ARGV[1] is
+// added to the claimants set KEYS[2] first, so that the reaper finds the claim even if the runtime
+// dies right after making it.
+var claimScript = redis.NewScript(`
+redis.call('SADD', KEYS[2], ARGV[1])
+for i = 3, #KEYS do
+	local raw = redis.call('RPOP', KEYS[i])
+	if raw then
+		redis.call('HSET', KEYS[1], cjson.decode(raw)['invocationId'], raw)
+		return raw
+	end
+end
+return false
+`)
+
+// requeueScript moves the claim ARGV[1] from the claims hash KEYS[1] back to the head of its group's
+// queue, the list KEYS[2], returning 1, or 0 if the claim isn't held.
+var requeueScript = redis.NewScript(`
+local raw = redis.call('HGET', KEYS[1], ARGV[1])
+if not raw then
+	return 0
+end
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('RPUSH', KEYS[2], raw)
+return 1
+`)
+
+// requeueAbandonedScript requeues the claims of the runtime ARGV[1], unless its alive key KEYS[1] has
+// reappeared: the claims in the hash KEYS[2] go back to the head of their groups' queues, the lists
+// KEYS[4:] of the groups ARGV[2:], as in requeueScript. Once it holds no claims, the runtime is removed
+// from the claimants set KEYS[3], so claims of groups that weren't passed are left for the next run. It
+// returns the IDs of the requeued invocations.
+var requeueAbandonedScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return {}
+end
+local queues = {}
+for i = 2, #ARGV do
+	queues[ARGV[i]] = KEYS[i + 2]
+end
+local requeued = {}
+local claims = redis.call('HGETALL', KEYS[2])
+for i = 1, #claims, 2 do
+	local queue = queues[cjson.decode(claims[i + 1])['connectorGroup']]
+	if queue then
+		redis.call('HDEL', KEYS[2], claims[i])
+		redis.call('RPUSH', queue, claims[i + 1])
+		requeued[#requeued + 1] = claims[i]
+	end
+end
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	redis.call('SREM', KEYS[3], ARGV[1])
+end
+return requeued
+`)
+
+// SaveRuntime creates or replaces a runtime.
+func (s *redisRuntimeStore) SaveRuntime(ctx context.Context, runtime *model.Runtime) error {
+	defer observeOp(redisKVSLatency, "runtime_save", time.Now())
+
+	raw, err := json.Marshal(runtime)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.SAdd(ctx, tenantRuntimesKey(runtime.TenantID), runtime.ID).Err(); err != nil {
+		return err
+	}
+
+	return s.client.Set(ctx, runtimeKey(runtime.ID), raw, 0).Err()
+}
+
+// GetRuntime gets a runtime by ID, or nil if it doesn't exist.
+func (s *redisRuntimeStore) GetRuntime(ctx context.Context, id string) (*model.Runtime, error) {
+	defer observeOp(redisKVSLatency, "runtime_get", time.Now())
+
+	raw, err := s.client.Get(ctx, runtimeKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	runtime := &model.Runtime{}
+	if err := json.Unmarshal(raw, runtime); err != nil {
+		return nil, fmt.Errorf("parse runtime %s: %w", id, err)
+	}
+
+	return runtime, nil
+}
+
+// Heartbeat marks the runtime alive for the specified duration.
+func (s *redisRuntimeStore) Heartbeat(ctx context.Context, runtime *model.Runtime, timeout time.Duration) error {
+	defer observeOp(redisKVSLatency, "runtime_heartbeat", time.Now())
+	return s.client.Set(ctx, aliveKey(runtime.TenantID, runtime.ID), time.Now().UTC().Format(time.RFC3339), timeout).Err()
+}
+
+// Dispatch queues a command for the runtimes of its connector group.
+func (s *redisRuntimeStore) Dispatch(ctx context.Context, cmd *model.RuntimeCommand) error {
+	defer observeOp(dynamoConnectorGroupLatency, "dispatch", time.Now())
+
+	raw, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.SAdd(ctx, tenantGroupsKey(cmd.TenantID), cmd.ConnectorGroup).Err(); err != nil {
+		return err
+	}
+
+	if err := s.client.LPush(ctx, pendingKey(cmd.TenantID, cmd.ConnectorGroup), raw).Err(); err != nil {
+		return err
+	}
+
+	// Connected runtimes are woken up to claim the command. They also poll, so a lost
+	// notification only delays the command.
+	return s.client.Publish(ctx, dispatchedChannel(cmd.TenantID, cmd.ConnectorGroup), cmd.InvocationID).Err()
+}
+
+// Dispatched returns a channel that receives whenever a command is dispatched to one of the runtime's
+// connector groups, along with a function that stops the subscription. The channel is nil if the
+// Redis client doesn't support subscriptions.
+func (s *redisRuntimeStore) Dispatched(ctx context.Context, runtime *model.Runtime) (<-chan struct{}, func()) {
+	subscriber, ok := s.client.(interface {
+		Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+	})
+	if !ok {
+		return nil, func() {}
+	}
+
+	channels := make([]string, 0, len(runtime.ConnectorGroups))
+	for _, g := range runtime.ConnectorGroups {
+		channels = append(channels, dispatchedChannel(runtime.TenantID, g))
+	}
+
+	pubsub := subscriber.Subscribe(ctx, channels...)
+	wake := make(chan struct{}, 1)
+	go func() {
+		for range pubsub.Channel() {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return wake, func() { _ = pubsub.Close() }
+}
+
+// Claim takes the next pending command of the runtime's connector groups, or returns nil if there
+// are none. The runtime is recorded as a claimant in the same script, and its tenant beforehand, so
+// that the reaper finds the claim even if the runtime dies right after making it.
+func (s *redisRuntimeStore) Claim(ctx context.Context, runtime *model.Runtime) (*model.RuntimeCommand, error) {
+	defer observeOp(redisLockLatency, "claim", time.Now())
+
+	if err := s.client.SAdd(ctx, runtimeTenantsKey, runtime.TenantID).Err(); err != nil {
+		return nil, err
+	}
+
+	keys := []string{claimsKey(runtime.TenantID, runtime.ID), claimantsKey(runtime.TenantID)}
+	for _, g := range runtime.ConnectorGroups {
+		keys = append(keys, pendingKey(runtime.TenantID, g))
+	}
+
+	raw, err := claimScript.Run(ctx, s.client, keys, runtime.ID).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim runtime command: %w", err)
+	}
+
+	return parseRuntimeCommand(raw)
+}
+
+// GetClaim gets a command claimed by the runtime, or nil if the runtime doesn't hold the claim.
+func (s *redisRuntimeStore) GetClaim(ctx context.Context, runtime *model.Runtime, invocationID string) (*model.RuntimeCommand, error) {
+	defer observeOp(redisLockLatency, "get_claim", time.Now())
+
+	raw, err := s.client.HGet(ctx, claimsKey(runtime.TenantID, runtime.ID), invocationID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRuntimeCommand(raw)
+}
+
+// Complete releases a claim once its invocation has finished, returning whether the runtime held it.
+func (s *redisRuntimeStore) Complete(ctx context.Context, runtime *model.Runtime, invocationID string) (bool, error) {
+	defer observeOp(redisLockLatency, "complete", time.Now())
+
+	n, err := s.client.HDel(ctx, claimsKey(runtime.TenantID, runtime.ID), invocationID).Result()
+	return n > 0, err
+}
+
+// Requeue returns a claimed command to the head of its group's queue.
+func (s *redisRuntimeStore) Requeue(ctx context.Context, runtime *model.Runtime, invocationID string) (bool, error) {
+	defer observeOp(redisLockLatency, "requeue_claim", time.Now())
+
+	return s.requeue(ctx, runtime.TenantID, runtime.ID, invocationID)
+}
+
+// RequeueAbandoned requeues the claims of runtimes that have stopped sending heartbeats. Each
+// runtime's liveness is checked again in the script that requeues its claims and removes it from
+// the claimants, so a runtime that comes back in the meantime keeps both. A claim is only requeued
+// by whoever deletes it, so concurrent reapers (and completions) never duplicate it. Requeued
+// commands go to the head of their group's queue, ahead of newer commands.
+func (s *redisRuntimeStore) RequeueAbandoned(ctx context.Context) (int, error) {
+	defer observeOp(dynamoConnectorGroupLatency, "requeue", time.Now())
+
+	tenants, err := s.client.SMembers(ctx, runtimeTenantsKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for _, tenantID := range tenants {
+		claimants, err := s.client.SMembers(ctx, claimantsKey(tenantID)).Result()
+		if err != nil {
+			return requeued, err
+		}
+		groups, err := s.client.SMembers(ctx, tenantGroupsKey(tenantID)).Result()
+		if err != nil {
+			return requeued, err
+		}
+
+		for _, runtimeID := range claimants {
+			alive, err := s.client.Exists(ctx, aliveKey(tenantID, runtimeID)).Result()
+			if err != nil {
+				return requeued, err
+			}
+			if alive > 0 {
+				continue
+			}
+
+			// Claims can be of any of the groups the tenant's commands were dispatched to, and every key
+			// the script touches has to be passed in KEYS, so each group's queue is.
+			keys := []string{aliveKey(tenantID, runtimeID), claimsKey(tenantID, runtimeID), claimantsKey(tenantID)}
+			args := []interface{}{runtimeID}
+			for _, group := range groups {
+				keys = append(keys, pendingKey(tenantID, group))
+				args = append(args, group)
+			}
+
+			result, err := requeueAbandonedScript.Run(ctx, s.client, keys, args...).Result()
+			if err != nil {
+				return requeued, fmt.Errorf("requeue claims of runtime %s: %w", runtimeID, err)
+			}
+
+			invocationIDs, _ := result.([]interface{})
+			for _, invocationID := range invocationIDs {
+				log.Warnf(ctx, "requeued invocation %s abandoned by runtime %s", invocationID, runtimeID)
+			}
+			requeued += len(invocationIDs)
+		}
+	}
+
+	return requeued, nil
+}
+
+// PurgeOrg removes the tenant's runtime registrations, claims and pending commands. Claims that are
+// removed aren't requeued, so their invocations never finish.
+func (s *redisRuntimeStore) PurgeOrg(ctx context.Context, tenantID string) error {
+	defer observeOp(dynamoConnectorGroupLatency, "purge", time.Now())
+
+	runtimes, err := s.client.SMembers(ctx, tenantRuntimesKey(tenantID)).Result()
+	if err != nil {
+		return err
+	}
+	claimants, err := s.client.SMembers(ctx, claimantsKey(tenantID)).Result()
+	if err != nil {
+		return err
+	}
+	groups, err := s.client.SMembers(ctx, tenantGroupsKey(tenantID)).Result()
+	if err != nil {
+		return err
+	}
+
+	// Registrations aren't in the tenant's cluster slot, so they're deleted one by one.
+	for _, runtimeID := range runtimes {
+		if err := s.client.Del(ctx, runtimeKey(runtimeID)).Err(); err != nil {
+			return err
+		}
+	}
+
+	keys := []string{claimantsKey(tenantID), tenantGroupsKey(tenantID)}
+	for _, runtimeID := range append(runtimes, claimants...) {
+		keys = append(keys, aliveKey(tenantID, runtimeID), claimsKey(tenantID, runtimeID))
+	}
+	for _, group := range groups {
+		keys = append(keys, pendingKey(tenantID, group))
+	}
+	keys = append(keys, tenantRuntimesKey(tenantID))
+
+	if err := s.client.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+
+	return s.client.SRem(ctx, runtimeTenantsKey, tenantID).Err()
+}
+
+// requeue moves a claim back to the head of its group's queue, if it's still held. The claim is read
+// first to find its group's queue, which the script has to be passed in KEYS; a claim's group never
+// changes, so the script only has to check that it's still held.
+func (s *redisRuntimeStore) requeue(ctx context.Context, tenantID string, runtimeID string, invocationID string) (bool, error) {
+	raw, err := s.client.HGet(ctx, claimsKey(tenantID, runtimeID), invocationID).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	cmd, err := parseRuntimeCommand(raw)
+	if err != nil {
+		return false, err
+	}
+
+	keys := []string{claimsKey(tenantID, runtimeID), pendingKey(tenantID, cmd.ConnectorGroup)}
+	n, err := requeueScript.Run(ctx, s.client, keys, invocationID).Int()
+	if err != nil {
+		return false, fmt.Errorf("requeue invocation %s: %w", invocationID, err)
+	}
+
+	return n > 0, nil
+}
+
+// runtimeKey gets the key of a runtime's registration. Runtimes are looked up by ID alone, since a
+// runtime's tenant is only known once it's authenticated.
+func runtimeKey(id string) string {
+	return keyPrefix + "runtime:" + id
+}
+
+// runtimeScopedKey gets a tenant-scoped runtime key, with the tenant ID as the hash tag.
+func runtimeScopedKey(tenantID string, suffix string) string {
+	return keyPrefix + "runtime:{" + tenantID + "}:" + suffix
+}
+
+// pendingKey gets the key of a connector group's pending commands.
+func pendingKey(tenantID string, group string) string {
+	return runtimeScopedKey(tenantID, "group:"+group+":pending")
+}
+
+// dispatchedChannel gets the channel that announces commands dispatched to a connector group.
+func dispatchedChannel(tenantID string, group string) string {
+	return runtimeScopedKey(tenantID, "group:"+group+":dispatched")
+}
+
+// claimantsKey gets the key of the set of the tenant's runtimes that may hold claims.
+func claimantsKey(tenantID string) string {
+	return runtimeScopedKey(tenantID, "claimants")
+}
+
+// tenantRuntimesKey gets the key of the set of the tenant's registered runtimes.
+func tenantRuntimesKey(tenantID string) string {
+	return runtimeScopedKey(tenantID, "runtimes")
+}
+
+// tenantGroupsKey gets the key of the set of the tenant's connector groups that commands were
+// dispatched to.
+func tenantGroupsKey(tenantID string) string {
+	return runtimeScopedKey(tenantID, "groups")
+}
+
+// aliveKey gets the key that's set while a runtime keeps sending heartbeats.
+func aliveKey(tenantID string, runtimeID string) string {
+	return runtimeScopedKey(tenantID, "runtime:"+runtimeID+":alive")
+}
+
+// claimsKey gets the key of a runtime's claimed commands.
+func claimsKey(tenantID string, runtimeID string) string {
+	return runtimeScopedKey(tenantID, "runtime:"+runtimeID+":claims")
+}
+
+// parseRuntimeCommand parses a queued runtime command.
+func parseRuntimeCommand(raw string) (*model.RuntimeCommand, error) {
+	cmd := &model.RuntimeCommand{}
+	if err := json.Unmarshal([]byte(raw), cmd); err != nil {
+		return nil, fmt.Errorf("parse runtime command: %w", err)
+	}
+
+	return cmd, nil
+}
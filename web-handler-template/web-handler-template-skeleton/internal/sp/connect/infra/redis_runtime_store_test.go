@@ -0,0 +1,223 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/memory"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+func TestRuntimeStorePurgeOrgRemovesTheTenantsRuntimesAndCommands(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewRedis()
+	store := newRedisRuntimeStore(client)
+
+	for _, runtime := range []*model.Runtime{
+		{ID: "r1", TenantID: "t1", ConnectorGroups: []string{"g"}},
+		{ID: "r2", TenantID: "t2", ConnectorGroups: []string{"g"}},
+	} {
+		if err := store.SaveRuntime(ctx, runtime); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Heartbeat(ctx, runtime, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		for _, invocationID := range []string{"claimed", "pending"} {
+			if err := store.Dispatch(ctx, &model.RuntimeCommand{InvocationID: invocationID, TenantID: runtime.TenantID, ConnectorGroup: "g"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if cmd, err := store.Claim(ctx, runtime); err != nil || cmd == nil {
+			t.Fatalf("expected a claim, got %+v (%v)", cmd, err)
+		}
+	}
+
+	if err := store.PurgeOrg(ctx, "t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime, err := store.GetRuntime(ctx, "r1"); err != nil || runtime != nil {
+		t.Errorf("expected r1 to be purged, got %+v (%v)", runtime, err)
+	}
+	purged := []string{
+		aliveKey("t1", "r1"), claimsKey("t1", "r1"), claimantsKey("t1"), pendingKey("t1", "g"),
+		tenantRuntimesKey("t1"), tenantGroupsKey("t1"),
+	}
+	if n := client.Exists(ctx, purged...).Val(); n != 0 {
+		t.Errorf("expected the tenant's keys to be purged, %d remain", n)
+	}
+	if tenants := client.SMembers(ctx, runtimeTenantsKey).Val(); len(tenants) != 1 || tenants[0] != "t2" {
+		t.Errorf("expected only t2 to remain among the tenants, got %v", tenants)
+	}
+
+	if runtime, err := store.GetRuntime(ctx, "r2"); err != nil || runtime == nil {
+		t.Errorf("expected r2 to remain, got %+v (%v)", runtime, err)
+	}
+	kept := []string{aliveKey("t2", "r2"), claimsKey("t2", "r2"), claimantsKey("t2"), pendingKey("t2", "g")}
+	if n := client.Exists(ctx, kept...).Val(); n != int64(len(kept)) {
+		t.Errorf("expected the other tenant's %d keys to remain, got %d", len(kept), n)
+	}
+}
+
+// dispatchTestCommands dispatches a command for each invocation ID to a connector group of tenant t1.
+func dispatchTestCommands(t *testing.T, store *redisRuntimeStore, group string, invocationIDs ...string) {
+	t.Helper()
+
+	for _, invocationID := range invocationIDs {
+		cmd := &model.RuntimeCommand{InvocationID: invocationID, TenantID: "t1", ConnectorGroup: group, Type: "std:test"}
+		if err := store.Dispatch(context.Background(), cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// claimTestCommand claims the runtime's next command, failing unless it's the expected invocation's.
+func claimTestCommand(t *testing.T, store *redisRuntimeStore, runtime *model.Runtime, invocationID string) {
+	t.Helper()
+
+	cmd, err := store.Claim(context.Background(), runtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invocationID == "" {
+		if cmd != nil {
+			t.Fatalf("expected no command, got %s", cmd.InvocationID)
+		}
+		return
+	}
+	if cmd == nil || cmd.InvocationID != invocationID {
+		t.Fatalf("expected to claim %s, got %+v", invocationID, cmd)
+	}
+}
+
+func TestRuntimeStoreClaimsInDispatchOrder(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewRedis()
+	store := newRedisRuntimeStore(client)
+	runtime := &model.Runtime{ID: "r1", TenantID: "t1", ConnectorGroups: []string{"g1", "g2"}}
+
+	claimTestCommand(t, store, runtime, "")
+
+	dispatchTestCommands(t, store, "g2", "3")
+	dispatchTestCommands(t, store, "g1", "1", "2")
+	dispatchTestCommands(t, store, "other", "4")
+
+	claimTestCommand(t, store, runtime, "1")
+	claimTestCommand(t, store, runtime, "2")
+	claimTestCommand(t, store, runtime, "3")
+	claimTestCommand(t, store, runtime, "")
+
+	cmd, err := store.GetClaim(ctx, runtime, "2")
+	if err != nil || cmd == nil || cmd.ConnectorGroup != "g1" || cmd.Type != "std:test" {
+		t.Errorf("expected the claim of 2, got %+v (%v)", cmd, err)
+	}
+	if claimants := client.SMembers(ctx, claimantsKey("t1")).Val(); len(claimants) != 1 || claimants[0] != "r1" {
+		t.Errorf("expected r1 to be a claimant, got %v", claimants)
+	}
+	if tenants := client.SMembers(ctx, runtimeTenantsKey).Val(); len(tenants) != 1 || tenants[0] != "t1" {
+		t.Errorf("expected t1 to be among the tenants, got %v", tenants)
+	}
+
+	if held, err := store.Complete(ctx, runtime, "2"); err != nil || !held {
+		t.Errorf("expected to complete the claim, got %v (%v)", held, err)
+	}
+	if cmd, err := store.GetClaim(ctx, runtime, "2"); err != nil || cmd != nil {
+		t.Errorf("expected the completed claim to be released, got %+v (%v)", cmd, err)
+	}
+}
+
+func TestRuntimeStoreRequeue(t *testing.T) {
+	ctx := context.Background()
+	store := newRedisRuntimeStore(memory.NewRedis())
+	runtime := &model.Runtime{ID: "r1", TenantID: "t1", ConnectorGroups: []string{"g"}}
+
+	dispatchTestCommands(t, store, "g", "1", "2")
+	claimTestCommand(t, store, runtime, "1")
+
+	if requeued, err := store.Requeue(ctx, runtime, "1"); err != nil || !requeued {
+		t.Fatalf("expected the claim to be requeued, got %v (%v)", requeued, err)
+	}
+	if requeued, err := store.Requeue(ctx, runtime, "1"); err != nil || requeued {
+		t.Errorf("expected a claim that isn't held not to be requeued, got %v (%v)", requeued, err)
+	}
+
+	// Requeued commands go ahead of newer ones.
+	claimTestCommand(t, store, runtime, "1")
+	claimTestCommand(t, store, runtime, "2")
+}
+
+func TestRuntimeStoreRequeueAbandoned(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewRedis()
+	store := newRedisRuntimeStore(client)
+	dead := &model.Runtime{ID: "dead", TenantID: "t1", ConnectorGroups: []string{"g1", "g2"}}
+	alive := &model.Runtime{ID: "alive", TenantID: "t1", ConnectorGroups: []string{"g1", "g2"}}
+
+	if err := store.Heartbeat(ctx, alive, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	dispatchTestCommands(t, store, "g1", "1", "2")
+	dispatchTestCommands(t, store, "g2", "3")
+	claimTestCommand(t, store, dead, "1")
+	claimTestCommand(t, store, alive, "2")
+	claimTestCommand(t, store, dead, "3")
+
+	requeued, err := store.RequeueAbandoned(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued != 2 {
+		t.Errorf("expected the dead runtime's 2 claims to be requeued, got %d", requeued)
+	}
+	if cmd, err := store.GetClaim(ctx, alive, "2"); err != nil || cmd == nil {
+		t.Errorf("expected the live runtime to keep its claim, got %+v (%v)", cmd, err)
+	}
+	if claimants := client.SMembers(ctx, claimantsKey("t1")).Val(); len(claimants) != 1 || claimants[0] != "alive" {
+		t.Errorf("expected only the live runtime to remain a claimant, got %v", claimants)
+	}
+
+	claimTestCommand(t, store, alive, "1")
+	claimTestCommand(t, store, alive, "3")
+	claimTestCommand(t, store, alive, "")
+}
+
+func TestRuntimeStoreRequeueAbandonedKeepsClaimsOfUnknownGroups(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewRedis()
+	store := newRedisRuntimeStore(client)
+	runtime := &model.Runtime{ID: "r1", TenantID: "t1", ConnectorGroups: []string{"g"}}
+
+	dispatchTestCommands(t, store, "g", "1")
+	claimTestCommand(t, store, runtime, "1")
+
+	// A claim of a group that isn't in the tenant's set of groups can't be requeued, since the script
+	// isn't passed its queue, so it's kept, along with the runtime's place among the claimants.
+	client.HSet(ctx, claimsKey("t1", "r1"), "2", `{"invocationId":"2","connectorGroup":"unknown"}`)
+
+	if requeued, err := store.RequeueAbandoned(ctx); err != nil || requeued != 1 {
+		t.Fatalf("expected 1 claim to be requeued, got %d (%v)", requeued, err)
+	}
+	if claimants := client.SMembers(ctx, claimantsKey("t1")).Val(); len(claimants) != 1 {
+		t.Errorf("expected the runtime to remain a claimant, got %v", claimants)
+	}
+	if cmd, err := store.GetClaim(ctx, runtime, "2"); err != nil || cmd == nil {
+		t.Errorf("expected the claim of the unknown group to be kept, got %+v (%v)", cmd, err)
+	}
+}
+
+func TestRuntimeStoreKeysShareTheTenantsHashTag(t *testing.T) {
+	keys := []string{
+		pendingKey("t1", "g"), dispatchedChannel("t1", "g"), claimantsKey("t1"), tenantRuntimesKey("t1"),
+		tenantGroupsKey("t1"), aliveKey("t1", "r1"), claimsKey("t1", "r1"),
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, keyPrefix+"runtime:{t1}:") {
+			t.Errorf("expected %s to have the tenant's hash tag", key)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/atlas-go/atlas/config"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/atlas-go/atlas/web"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/runtimesocket"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+	"go.uber.org/zap"
+)
+
+// runtimeKeyScheme is the Authorization scheme of runtime keys.
+const runtimeKeyScheme = "Runtime "
+
+// runtimeContextKey is the context key of the authenticated runtime.
+type runtimeContextKey struct{}
+
+// buildRuntimeRoutes configures the runtime-facing endpoints under /runtime/. They're authenticated
+// with runtime keys rather than user tokens, so the atlas Authenticate middleware must skip them.
+func (s *ConnectService) buildRuntimeRoutes(r *mux.Router) {
+	r.Handle("/runtimes", s.requireRight("sp:connector:create", s.registerRuntime())).Methods("POST")
+
+	rr := r.PathPrefix("/runtime/").Subrouter()
+	rr.Use(s.authenticateRuntime)
+
+	rr.Handle("/heartbeat", s.runtimeHeartbeat()).Methods("POST")
+	rr.Handle("/commands/claim", s.claimRuntimeCommand()).Methods("POST")
+	rr.Handle("/invocations/{id}/results", s.uploadRuntimeResults()).Methods("POST")
+	rr.Handle("/invocations/{id}/complete", s.completeRuntimeInvocation()).Methods("POST")
+}
+
+// buildHandler wraps the service's routes with the runtime socket endpoint. The socket is served
+// outside of the atlas router, whose response logging and metrics hide the connection from the
+// WebSocket upgrade. The development token endpoint is also served outside of it, since it's
+// unauthenticated.
+func (s *ConnectService) buildHandler() http.Handler {
+	routes := s.buildRoutes()
+	socket := web.Recover()(web.Trace()(s.authenticateRuntime(s.connectRuntimeSocket())))
+
+	var devToken http.Handler
+	if s.devIssuer != nil {
+		devToken = web.Recover()(web.Trace()(s.issueDevToken()))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/runtime/connect" && r.Method == http.MethodGet {
+			socket.ServeHTTP(w, r)
+			return
+		}
+
+		if devToken != nil && r.URL.Path == devTokenPath && r.Method == http.MethodPost {
+			devToken.ServeHTTP(w, r)
+			return
+		}
+
+		routes.ServeHTTP(w, r)
+	})
+}
+
+// authenticateRuntime is a middleware that authenticates a runtime by the key in the Authorization
+// header ("Runtime <key>"), and runs the request in the runtime's tenant.
+func (s *ConnectService) authenticateRuntime(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, runtimeKeyScheme) {
+			web.Unauthorized(ctx, w)
+			return
+		}
+
+		runtime, err := cmd.AuthenticateRuntime(ctx, s.runtimeStore, strings.TrimPrefix(header, runtimeKeyScheme))
+		if errors.Is(err, cmd.ErrInvalidRuntimeKey) {
+			web.Unauthorized(ctx, w)
+			return
+		}
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		ctx = context.WithValue(ctx, runtimeContextKey{}, runtime)
+		ctx = atlas.WithRequestContext(ctx, &atlas.RequestContext{
+			TenantID: atlas.TenantID(runtime.TenantID),
+			Pod:      atlas.Pod(runtime.Pod),
+			Org:      atlas.Org(runtime.Org),
+		})
+		ctx = log.WithFields(ctx, zap.String("org", runtime.Org), zap.String("runtime_id", runtime.ID))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestRuntime gets the runtime authenticated by authenticateRuntime.
+func requestRuntime(ctx context.Context) *model.Runtime {
+	runtime, _ := ctx.Value(runtimeContextKey{}).(*model.Runtime)
+	return runtime
+}
+
+// registerRuntime registers a runtime for the caller's tenant. The response carries the runtime's
+// key, which can't be retrieved again.
+func (s *ConnectService) registerRuntime() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		rc := atlas.GetRequestContext(ctx)
+		if rc == nil {
+			web.Unauthorized(ctx, w)
+			return
+		}
+
+		cmd, err := cmd.NewRegisterRuntime(string(rc.TenantID), string(rc.Pod), string(rc.Org), body)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		result, err := cmd.Handle(ctx, s.runtimeStore)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
+
+// runtimeHeartbeat keeps the runtime's claims from being requeued.
+func (s *ConnectService) runtimeHeartbeat() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if err := s.runtimeStore.Heartbeat(ctx, requestRuntime(ctx), s.runtimeHeartbeatTimeout()); err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		web.NoContent(w)
+	}
+}
+
+// claimRuntimeCommand long-polls for the next command of the runtime's connector groups, waiting up
+// to the "wait" query parameter (eg. "10s"). It responds 204 if no command was dispatched in time.
+func (s *ConnectService) claimRuntimeCommand() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var wait time.Duration
+		if v := r.URL.Query().Get("wait"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				web.BadRequest(ctx, w, err)
+				return
+			}
+			wait = d
+		}
+
+		// The wait must stay below the server's write timeout (15s by default).
+		maxWait := config.GetDuration(s.Config, "RUNTIME_CLAIM_MAX_WAIT", 10*time.Second)
+
+		cmd, err := cmd.NewClaimRuntimeCommand(requestRuntime(ctx), wait, maxWait, s.runtimeHeartbeatTimeout())
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		claimed, err := cmd.Handle(ctx, s.runtimeStore, s.runtimeQueue, s.runtimeResults)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		if claimed == nil {
+			web.NoContent(w)
+			return
+		}
+
+		web.WriteJSON(ctx, w, claimed)
+	}
+}
+
+// uploadRuntimeResults accepts a stream of newline delimited JSON results for a claimed invocation.
+func (s *ConnectService) uploadRuntimeResults() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		cmd, err := cmd.NewUploadRuntimeResults(requestRuntime(ctx), mux.Vars(r)["id"])
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		accepted, err := cmd.Handle(ctx, s.runtimeQueue, s.runtimeResults, r.Body)
+		if err != nil {
+			writeRuntimeError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, map[string]int{"accepted": accepted})
+	}
+}
+
+// completeRuntimeInvocation finishes a claimed invocation. A body of {"error": {"type", "message"}}
+// marks it failed.
+func (s *ConnectService) completeRuntimeInvocation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		cmd, err := cmd.NewCompleteRuntimeInvocation(requestRuntime(ctx), mux.Vars(r)["id"], body)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		if err := cmd.Handle(ctx, s.runtimeQueue, s.runtimeResults); err != nil {
+			writeRuntimeError(ctx, w, err)
+			return
+		}
+
+		web.NoContent(w)
+	}
+}
+
+// connectRuntimeSocket upgrades the request to a WebSocket over which commands are pushed to the
+// runtime as they're dispatched.
+func (s *ConnectService) connectRuntimeSocket() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runtime := requestRuntime(r.Context())
+
+		wake, stop := s.runtimeDispatched(r.Context(), runtime)
+		defer stop()
+
+		s.runtimeSocket.Serve(w, r, runtime, wake)
+	}
+}
+
+// writeRuntimeError writes the error response for a runtime request, which is 404 when the runtime
+// no longer holds the invocation's claim.
+func writeRuntimeError(ctx context.Context, w http.ResponseWriter, err error) {
+	if errors.Is(err, model.ErrNotClaimed) {
+		web.NotFoundWithError(ctx, w, err)
+		return
+	}
+
+	WriteJSONWithError(ctx, w, err)
+}
+
+// runtimeHeartbeatTimeout gets how long a runtime may go without a heartbeat before its claims are requeued.
+func (s *ConnectService) runtimeHeartbeatTimeout() time.Duration {
+	return config.GetDuration(s.Config, "RUNTIME_HEARTBEAT_TIMEOUT", 30*time.Second)
+}
+
+// runtimeSocketConfig gets the configuration of runtime sockets.
+func (s *ConnectService) runtimeSocketConfig() runtimesocket.Config {
+	return runtimesocket.Config{
+		PingInterval:     config.GetDuration(s.Config, "RUNTIME_SOCKET_PING_INTERVAL", 15*time.Second),
+		WriteTimeout:     config.GetDuration(s.Config, "RUNTIME_SOCKET_WRITE_TIMEOUT", 10*time.Second),
+		PollInterval:     config.GetDuration(s.Config, "RUNTIME_SOCKET_POLL_INTERVAL", 5*time.Second),
+		MaxInFlight:      config.GetInt(s.Config, "RUNTIME_SOCKET_MAX_IN_FLIGHT", 10),
+		HeartbeatTimeout: s.runtimeHeartbeatTimeout(),
+	}
+}
+
+// startRuntimeReaper periodically requeues the claims of runtimes that have stopped sending heartbeats.
+func (s *ConnectService) startRuntimeReaper(ctx context.Context) error {
+	ticker := time.NewTicker(config.GetDuration(s.Config, "RUNTIME_REAP_INTERVAL", 10*time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := s.runtimeQueue.RequeueAbandoned(ctx); err != nil {
+				log.Errorf(ctx, "requeue abandoned runtime commands: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package runtimesocket serves the optional WebSocket channel of connector runtimes. Commands are
+// pushed to a connected runtime as soon as they're dispatched, and the runtime streams results back
+// over the same connection. Claims belong to the runtime rather than to the connection, so a runtime
+// whose socket drops can carry on with the poll-based endpoints without losing an invocation.
+package runtimesocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// The types of Message. Commands are sent by the service; the runtime acknowledges each command it
+// receives and then sends its results and completion. Errors are sent by the service in response to
+// messages it couldn't handle.
+const (
+	MessageCommand  = "command"
+	MessageAck      = "ack"
+	MessageResult   = "result"
+	MessageComplete = "complete"
+	MessageError    = "error"
+)
+
+// Message is a frame exchanged with a runtime.
+type Message struct {
+	Type         string                   `json:"type"`
+	InvocationID string                   `json:"invocationId,omitempty"`
+	Command      *model.RuntimeCommand    `json:"command,omitempty"`
+	Output       json.RawMessage          `json:"output,omitempty"`
+	Error        *model.InvocationFailure `json:"error,omitempty"`
+	Message      string                   `json:"message,omitempty"`
+}
+
+// Config is the configuration of a Server.
+type Config struct {
+
+	// PingInterval is how often the runtime is pinged. A runtime that doesn't answer within twice the
+	// interval is disconnected, and each pong counts as a heartbeat.
+	PingInterval time.Duration
+
+	// WriteTimeout is how long a write may block on a runtime that isn't reading.
+	WriteTimeout time.Duration
+
+	// PollInterval is how often the session checks for commands when it isn't woken up by a dispatch.
+	PollInterval time.Duration
+
+	// MaxInFlight is the number of commands a runtime may hold over the socket before it has to
+	// complete one to be sent another.
+	MaxInFlight int
+
+	// HeartbeatTimeout is how long a runtime may go without a heartbeat before its claims are requeued.
+	HeartbeatTimeout time.Duration
+}
+
+// Server serves the WebSocket sessions of runtimes.
+type Server struct {
+	store    model.RuntimeStore
+	queue    model.RuntimeCommandQueue
+	handler  model.InvocationResultHandler
+	config   Config
+	upgrader websocket.Upgrader
+}
+
+// NewServer constructs a new Server.
+func NewServer(store model.RuntimeStore, queue model.RuntimeCommandQueue, handler model.InvocationResultHandler, config Config) *Server {
+	s := &Server{}
+	s.store = store
+	s.queue = queue
+	s.handler = handler
+	s.config = config
+
+	// Runtimes aren't browsers, so there's no origin to check.
+	s.upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+
+	return s
+}
+
+// Serve upgrades the request to a WebSocket and runs the runtime's session until the connection
+// closes. Commands are claimed when wake receives and every PollInterval; wake may be nil. Commands
+// that were sent but never acknowledged are requeued once the connection closes.
+func (s *Server) Serve(w http.ResponseWriter, r *http.Request, runtime *model.Runtime, wake <-chan struct{}) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded.
+		log.Warnf(r.Context(), "upgrade runtime socket: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+
+	sess := &session{}
+	sess.Server = s
+	sess.conn = conn
+	sess.runtime = runtime
+	sess.send = make(chan *Message, s.config.MaxInFlight+16)
+	sess.capacity = make(chan struct{}, 1)
+	sess.inFlight = make(map[string]bool)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sess.write(ctx)
+		_ = conn.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		sess.dispatch(ctx, wake)
+	}()
+
+	sess.read(ctx)
+	cancel()
+	_ = conn.Close()
+	wg.Wait()
+
+	sess.requeueUnacknowledged()
+}
+
+// session is the state of one runtime connection.
+type session struct {
+	*Server
+	conn     *websocket.Conn
+	runtime  *model.Runtime
+	send     chan *Message
+	capacity chan struct{}
+
+	// inFlight maps the commands sent over the connection and not yet completed to whether the
+	// runtime acknowledged them.
+	mu       sync.Mutex
+	inFlight map[string]bool
+}
+
+// write sends queued messages and pings until the context is cancelled or a write fails.
+func (s *session) write(ctx context.Context) {
+	ping := time.NewTicker(s.config.PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(s.config.WriteTimeout))
+			return
+		case m := <-s.send:
+			_ = s.conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+			if err := s.conn.WriteJSON(m); err != nil {
+				log.Warnf(ctx, "write to runtime %s: %v", s.runtime.ID, err)
+				return
+			}
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.config.WriteTimeout)); err != nil {
+				log.Warnf(ctx, "ping runtime %s: %v", s.runtime.ID, err)
+				return
+			}
+		}
+	}
+}
+
+// dispatch claims commands and queues them for sending while the runtime has capacity for them.
+func (s *session) dispatch(ctx context.Context, wake <-chan struct{}) {
+	poll := time.NewTicker(s.config.PollInterval)
+	defer poll.Stop()
+
+	for {
+		for s.hasCapacity() {
+			claim, err := cmd.NewClaimRuntimeCommand(s.runtime, 0, 0, s.config.HeartbeatTimeout)
+			if err != nil {
+				log.Errorf(ctx, "claim runtime command: %v", err)
+				break
+			}
+
+			claimed, err := claim.Handle(ctx, s.store, s.queue, s.handler)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Errorf(ctx, "claim runtime command: %v", err)
+				}
+				break
+			}
+			if claimed == nil {
+				break
+			}
+
+			// The command is tracked before it's sent, so that it's requeued if the connection closes
+			// before the runtime acknowledges it.
+			s.mu.Lock()
+			s.inFlight[claimed.InvocationID] = false
+			s.mu.Unlock()
+
+			if !s.enqueue(ctx, &Message{Type: MessageCommand, InvocationID: claimed.InvocationID, Command: claimed}) {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-poll.C:
+		case <-s.capacity:
+		}
+	}
+}
+
+// read handles messages from the runtime until the connection fails or misses its pongs.
+func (s *session) read(ctx context.Context) {
+	s.conn.SetReadLimit(cmd.MaxRuntimeResultSize + 4096)
+
+	pongWait := 2 * s.config.PingInterval
+	_ = s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		_ = s.conn.SetReadDeadline(time.Now().Add(pongWait))
+		if err := s.store.Heartbeat(ctx, s.runtime, s.config.HeartbeatTimeout); err != nil {
+			log.Warnf(ctx, "heartbeat runtime %s: %v", s.runtime.ID, err)
+		}
+		return nil
+	})
+
+	for {
+		m := &Message{}
+		if err := s.conn.ReadJSON(m); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) && ctx.Err() == nil {
+				log.Warnf(ctx, "read from runtime %s: %v", s.runtime.ID, err)
+			}
+			return
+		}
+
+		if err := s.handle(ctx, m); err != nil {
+			s.enqueue(ctx, &Message{Type: MessageError, InvocationID: m.InvocationID, Message: err.Error()})
+		}
+	}
+}
+
+// handle handles one message from the runtime. Results are handled before the next message is read,
+// so a runtime can't send results faster than they're processed.
+func (s *session) handle(ctx context.Context, m *Message) error {
+	switch m.Type {
+	case MessageAck:
+		s.mu.Lock()
+		if _, ok := s.inFlight[m.InvocationID]; ok {
+			s.inFlight[m.InvocationID] = true
+		}
+		s.mu.Unlock()
+		return nil
+
+	case MessageResult:
+		output := &bytes.Buffer{}
+		if err := json.Compact(output, m.Output); err != nil {
+			return model.NewBadRequestError("invalid output: %v", err)
+		}
+
+		upload, err := cmd.NewUploadRuntimeResults(s.runtime, m.InvocationID)
+		if err != nil {
+			return err
+		}
+		_, err = upload.Handle(ctx, s.queue, s.handler, output)
+		return err
+
+	case MessageComplete:
+		body, err := json.Marshal(struct {
+			Error *model.InvocationFailure `json:"error,omitempty"`
+		}{m.Error})
+		if err != nil {
+			return err
+		}
+
+		complete, err := cmd.NewCompleteRuntimeInvocation(s.runtime, m.InvocationID, body)
+		if err != nil {
+			return err
+		}
+
+		err = complete.Handle(ctx, s.queue, s.handler)
+		if err == nil || errors.Is(err, model.ErrNotClaimed) {
+			s.release(m.InvocationID)
+		}
+		return err
+	}
+
+	return model.NewBadRequestError("unknown message type %q", m.Type)
+}
+
+// hasCapacity gets whether the runtime can be sent another command.
+func (s *session) hasCapacity() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.inFlight) < s.config.MaxInFlight
+}
+
+// release stops tracking a completed command and lets the dispatcher send another.
+func (s *session) release(invocationID string) {
+	s.mu.Lock()
+	delete(s.inFlight, invocationID)
+	s.mu.Unlock()
+
+	select {
+	case s.capacity <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue queues a message for sending, returning false if the session ended first.
+func (s *session) enqueue(ctx context.Context, m *Message) bool {
+	select {
+	case s.send <- m:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// requeueUnacknowledged requeues the commands the runtime never acknowledged, since it may not have
+// received them. Acknowledged commands stay claimed: the runtime may still complete them over HTTP,
+// and they're requeued if it stops sending heartbeats.
+func (s *session) requeueUnacknowledged() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.WriteTimeout)
+	defer cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for invocationID, acked := range s.inFlight {
+		if acked {
+			continue
+		}
+
+		if _, err := s.queue.Requeue(ctx, s.runtime, invocationID); err != nil {
+			log.Errorf(ctx, "requeue invocation %s unacknowledged by runtime %s: %v", invocationID, s.runtime.ID, err)
+		}
+	}
+}
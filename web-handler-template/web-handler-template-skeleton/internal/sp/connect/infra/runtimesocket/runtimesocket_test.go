@@ -0,0 +1,294 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package runtimesocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+type fakeRuntimeStore struct {
+	mu         sync.Mutex
+	heartbeats int
+}
+
+func (s *fakeRuntimeStore) SaveRuntime(ctx context.Context, runtime *model.Runtime) error {
+	return nil
+}
+
+func (s *fakeRuntimeStore) GetRuntime(ctx context.Context, id string) (*model.Runtime, error) {
+	return nil, nil
+}
+
+func (s *fakeRuntimeStore) Heartbeat(ctx context.Context, runtime *model.Runtime, timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heartbeats++
+	return nil
+}
+
+type fakeRuntimeQueue struct {
+	mu      sync.Mutex
+	pending []*model.RuntimeCommand
+	claims  map[string]*model.RuntimeCommand
+}
+
+func (q *fakeRuntimeQueue) Dispatch(ctx context.Context, cmd *model.RuntimeCommand) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, cmd)
+	return nil
+}
+
+func (q *fakeRuntimeQueue) Claim(ctx context.Context, runtime *model.Runtime) (*model.RuntimeCommand, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return nil, nil
+	}
+	cmd := q.pending[0]
+	q.pending = q.pending[1:]
+	q.claims[cmd.InvocationID] = cmd
+	return cmd, nil
+}
+
+func (q *fakeRuntimeQueue) GetClaim(ctx context.Context, runtime *model.Runtime, invocationID string) (*model.RuntimeCommand, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.claims[invocationID], nil
+}
+
+func (q *fakeRuntimeQueue) Complete(ctx context.Context, runtime *model.Runtime, invocationID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.claims[invocationID]
+	delete(q.claims, invocationID)
+	return ok, nil
+}
+
+func (q *fakeRuntimeQueue) Requeue(ctx context.Context, runtime *model.Runtime, invocationID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cmd, ok := q.claims[invocationID]
+	if ok {
+		delete(q.claims, invocationID)
+		q.pending = append([]*model.RuntimeCommand{cmd}, q.pending...)
+	}
+	return ok, nil
+}
+
+func (q *fakeRuntimeQueue) RequeueAbandoned(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+// state gets the IDs of the pending and claimed invocations.
+func (q *fakeRuntimeQueue) state() (pending []string, claimed []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, cmd := range q.pending {
+		pending = append(pending, cmd.InvocationID)
+	}
+	for id := range q.claims {
+		claimed = append(claimed, id)
+	}
+	return pending, claimed
+}
+
+type fakeResultHandler struct {
+	mu          sync.Mutex
+	started     []string
+	results     []string
+	completions []string
+}
+
+func (h *fakeResultHandler) HandleStart(ctx context.Context, cmd *model.RuntimeCommand) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.started = append(h.started, cmd.InvocationID)
+	return true, nil
+}
+
+func (h *fakeResultHandler) HandleResult(ctx context.Context, cmd *model.RuntimeCommand, output json.RawMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.results = append(h.results, string(output))
+	return nil
+}
+
+func (h *fakeResultHandler) HandleCompletion(ctx context.Context, cmd *model.RuntimeCommand, status model.InvocationStatus, failure *model.InvocationFailure) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.completions = append(h.completions, cmd.InvocationID+":"+string(status))
+	return nil
+}
+
+var testConfig = Config{
+	PingInterval:     time.Second,
+	WriteTimeout:     time.Second,
+	PollInterval:     20 * time.Millisecond,
+	MaxInFlight:      1,
+	HeartbeatTimeout: 30 * time.Second,
+}
+
+type harness struct {
+	queue   *fakeRuntimeQueue
+	handler *fakeResultHandler
+	conn    *websocket.Conn
+	done    chan struct{}
+}
+
+// connect serves a session for a runtime with the given pending invocations, and dials it.
+func connect(t *testing.T, invocationIDs ...string) *harness {
+	t.Helper()
+
+	h := &harness{}
+	h.queue = &fakeRuntimeQueue{claims: map[string]*model.RuntimeCommand{}}
+	h.handler = &fakeResultHandler{}
+	h.done = make(chan struct{})
+
+	for _, id := range invocationIDs {
+		_ = h.queue.Dispatch(context.Background(), &model.RuntimeCommand{
+			InvocationID:   id,
+			TenantID:       "acme",
+			ConnectorGroup: "on-prem",
+			Type:           "std:test-connection",
+			Expiration:     time.Now().Add(time.Hour),
+		})
+	}
+
+	runtime := &model.Runtime{ID: "r1", TenantID: "acme", ConnectorGroups: []string{"on-prem"}}
+	server := NewServer(&fakeRuntimeStore{}, h.queue, h.handler, testConfig)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(h.done)
+		server.Serve(w, r, runtime, nil)
+	}))
+	t.Cleanup(ts.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.conn = conn
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return h
+}
+
+func (h *harness) receive(t *testing.T) *Message {
+	t.Helper()
+
+	_ = h.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	m := &Message{}
+	if err := h.conn.ReadJSON(m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func (h *harness) sendMessage(t *testing.T, m *Message) {
+	t.Helper()
+
+	if err := h.conn.WriteJSON(m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// closed waits for the server to end the session.
+func (h *harness) closed(t *testing.T) {
+	t.Helper()
+
+	_ = h.conn.Close()
+	select {
+	case <-h.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("session didn't end")
+	}
+}
+
+func TestSessionPushesCommandsAndHandlesResults(t *testing.T) {
+	h := connect(t, "inv-1", "inv-2")
+
+	m := h.receive(t)
+	if m.Type != MessageCommand || m.InvocationID != "inv-1" || m.Command == nil || m.Command.Type != "std:test-connection" {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+
+	h.sendMessage(t, &Message{Type: MessageAck, InvocationID: "inv-1"})
+	h.sendMessage(t, &Message{Type: MessageResult, InvocationID: "inv-1", Output: json.RawMessage(`{ "id": 1 }`)})
+	h.sendMessage(t, &Message{Type: MessageComplete, InvocationID: "inv-1"})
+
+	// With one slot, the second command is only pushed once the first completes.
+	m = h.receive(t)
+	if m.Type != MessageCommand || m.InvocationID != "inv-2" {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+
+	h.sendMessage(t, &Message{Type: MessageAck, InvocationID: "inv-2"})
+	h.sendMessage(t, &Message{Type: MessageComplete, InvocationID: "inv-2", Error: &model.InvocationFailure{Type: "ConnectorError", Message: "boom"}})
+	h.sendMessage(t, &Message{Type: MessageComplete, InvocationID: "inv-2"})
+
+	m = h.receive(t)
+	if m.Type != MessageError || m.InvocationID != "inv-2" {
+		t.Fatalf("expected an error for an invocation that's no longer claimed, got %+v", m)
+	}
+
+	h.closed(t)
+
+	h.handler.mu.Lock()
+	defer h.handler.mu.Unlock()
+	if len(h.handler.results) != 1 || h.handler.results[0] != `{"id":1}` {
+		t.Errorf("unexpected results: %v", h.handler.results)
+	}
+	if strings.Join(h.handler.completions, ",") != "inv-1:completed,inv-2:failed" {
+		t.Errorf("unexpected completions: %v", h.handler.completions)
+	}
+	if strings.Join(h.handler.started, ",") != "inv-1,inv-2" {
+		t.Errorf("expected each pushed command to start its invocation, got %v", h.handler.started)
+	}
+}
+
+func TestSessionRequeuesUnacknowledgedCommands(t *testing.T) {
+	h := connect(t, "inv-1")
+
+	if m := h.receive(t); m.InvocationID != "inv-1" {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+
+	h.closed(t)
+
+	pending, claimed := h.queue.state()
+	if len(pending) != 1 || pending[0] != "inv-1" || len(claimed) != 0 {
+		t.Errorf("expected inv-1 to be requeued, got pending %v and claimed %v", pending, claimed)
+	}
+}
+
+func TestSessionKeepsAcknowledgedCommands(t *testing.T) {
+	h := connect(t, "inv-1")
+
+	if m := h.receive(t); m.InvocationID != "inv-1" {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+	h.sendMessage(t, &Message{Type: MessageAck, InvocationID: "inv-1"})
+
+	// The ack has to be read before the connection closes for the claim to be kept.
+	h.sendMessage(t, &Message{Type: "unknown"})
+	if m := h.receive(t); m.Type != MessageError {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+
+	h.closed(t)
+
+	pending, claimed := h.queue.state()
+	if len(pending) != 0 || len(claimed) != 1 {
+		t.Errorf("expected inv-1 to stay claimed, got pending %v and claimed %v", pending, claimed)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/qri-io/jsonschema"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// OutputMode is how a standard command returns its output.
+type OutputMode string
+
+const (
+	// OutputSingle commands return exactly one result.
+	OutputSingle OutputMode = "single"
+
+	// OutputStream commands return any number of results.
+	OutputStream OutputMode = "stream"
+)
+
+// standardCommandFile is the file format of a command definition in dist/standard_commands.
+type standardCommandFile struct {
+	Type          model.CommandType `json:"type"`
+	OutputMode    OutputMode        `json:"outputMode"`
+	InputSchema   json.RawMessage   `json:"inputSchema"`
+	InputExample  json.RawMessage   `json:"inputExample"`
+	OutputSchema  json.RawMessage   `json:"outputSchema"`
+	OutputExample json.RawMessage   `json:"outputExample"`
+}
+
+// StandardCommand is the contract of a command defined in dist/standard_commands.
+type StandardCommand struct {
+	Type       model.CommandType
+	OutputMode OutputMode
+
+	// InputExample and OutputExample are examples of the command's input and of one of its results.
+	// Either may be nil if the definition has none.
+	InputExample  json.RawMessage
+	OutputExample json.RawMessage
+
+	inputSchema  *jsonschema.Schema
+	outputSchema *jsonschema.Schema
+}
+
+// LoadStandardCommands loads the shared schemas in dist/common and the command definitions in
+// dist/standard_commands, keyed by command type.
+func LoadStandardCommands(distDir string) (map[model.CommandType]*StandardCommand, error) {
+	if _, err := registerCommonSchemas(filepath.Join(distDir, "common")); err != nil {
+		return nil, err
+	}
+
+	return loadCommands(filepath.Join(distDir, "standard_commands"))
+}
+
+// loadCommands loads the command definitions in dir, keyed by command type. The shared schemas they
+// reference must already be registered.
+func loadCommands(dir string) (map[model.CommandType]*StandardCommand, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	commands := make(map[model.CommandType]*StandardCommand, len(files))
+	for _, f := range files {
+		raw, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f, err)
+		}
+
+		var sc standardCommandFile
+		if err := json.Unmarshal(raw, &sc); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", f, err)
+		}
+
+		if sc.OutputMode != OutputSingle && sc.OutputMode != OutputStream {
+			return nil, fmt.Errorf("%s: invalid output mode %q", sc.Type, sc.OutputMode)
+		}
+
+		c := &StandardCommand{Type: sc.Type, OutputMode: sc.OutputMode, InputExample: sc.InputExample, OutputExample: sc.OutputExample}
+		if c.inputSchema, err = parseSchema(sc.InputSchema); err != nil {
+			return nil, fmt.Errorf("parse input schema of %s: %w", sc.Type, err)
+		}
+		if c.outputSchema, err = parseSchema(sc.OutputSchema); err != nil {
+			return nil, fmt.Errorf("parse output schema of %s: %w", sc.Type, err)
+		}
+
+		commands[sc.Type] = c
+	}
+
+	return commands, nil
+}
+
+// ValidateInput returns an error if the payload doesn't conform to the command's input schema.
+func (c *StandardCommand) ValidateInput(ctx context.Context, payload json.RawMessage) error {
+	return validate(ctx, c.inputSchema, payload)
+}
+
+// ValidateOutput returns an error if the payload doesn't conform to the command's output schema.
+func (c *StandardCommand) ValidateOutput(ctx context.Context, payload json.RawMessage) error {
+	return validate(ctx, c.outputSchema, payload)
+}
+
+// parseSchema compiles a schema, which accepts anything if raw is empty.
+func parseSchema(raw json.RawMessage) (*jsonschema.Schema, error) {
+	s := &jsonschema.Schema{}
+	if len(raw) == 0 {
+		raw = json.RawMessage(`{}`)
+	}
+
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
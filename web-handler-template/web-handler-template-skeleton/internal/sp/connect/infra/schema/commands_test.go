@@ -0,0 +1,43 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+func TestLoadStandardCommands(t *testing.T) {
+	commands, err := LoadStandardCommands(testDistDir)
+	if err != nil {
+		t.Fatalf("load commands: %v", err)
+	}
+
+	ctx := context.Background()
+	for commandType, c := range commands {
+		if c.InputExample != nil {
+			if err := c.ValidateInput(ctx, c.InputExample); err != nil {
+				t.Errorf("input example of %s: %v", commandType, err)
+			}
+		}
+		if c.OutputExample != nil {
+			if err := c.ValidateOutput(ctx, c.OutputExample); err != nil {
+				t.Errorf("output example of %s: %v", commandType, err)
+			}
+		}
+	}
+
+	list := commands[model.CommandAccountList]
+	if list == nil || list.OutputMode != OutputStream {
+		t.Fatalf("expected %s to stream its output", model.CommandAccountList)
+	}
+	if err := list.ValidateOutput(ctx, json.RawMessage(`{"attributes": {}}`)); err == nil {
+		t.Error("expected an object output without identity to be invalid")
+	}
+
+	if c := commands[model.CommandTestConnection]; c == nil || c.OutputMode != OutputSingle {
+		t.Errorf("expected %s to have a single output", model.CommandTestConnection)
+	}
+}
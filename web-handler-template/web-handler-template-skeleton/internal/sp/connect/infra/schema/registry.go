@@ -0,0 +1,173 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package schema loads the JSON schemas published in dist and validates connector payloads against them.
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/qri-io/jsonschema"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// ValidationError is returned when a payload doesn't conform to its schema.
+type ValidationError struct {
+	Errors []jsonschema.KeyError
+}
+
+// Error joins the individual schema violations into a single message.
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, ke := range e.Errors {
+		messages = append(messages, ke.Error())
+	}
+
+	return "schema validation failed: " + strings.Join(messages, "; ")
+}
+
+// standardEvent is the file format of an event definition in dist/standard_events.
+type standardEvent struct {
+	Type    model.StandardEventType `json:"type"`
+	Schema  json.RawMessage         `json:"schema"`
+	Example json.RawMessage         `json:"example"`
+}
+
+// specSchemaFile is the file of the connector spec schema in dist/common.
+const specSchemaFile = "connector_spec_schema.json"
+
+// Registry holds the compiled schemas loaded from a dist directory.
+type Registry struct {
+	events   map[model.StandardEventType]*jsonschema.Schema
+	spec     *jsonschema.Schema
+	commands map[model.CommandType]*StandardCommand
+}
+
+// NewRegistry loads the shared schemas in dist/common, the event schemas in dist/standard_events and
+// the command definitions in dist/standard_commands. Every event example is validated against its
+// own schema so that broken definitions fail at startup.
+func NewRegistry(distDir string) (*Registry, error) {
+	common, err := registerCommonSchemas(filepath.Join(distDir, "common"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Registry{}
+	r.events = make(map[model.StandardEventType]*jsonschema.Schema)
+
+	r.spec = common[specSchemaFile]
+	if r.spec == nil {
+		return nil, fmt.Errorf("missing %s", filepath.Join(distDir, "common", specSchemaFile))
+	}
+
+	files, err := filepath.Glob(filepath.Join(distDir, "standard_events", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		raw, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f, err)
+		}
+
+		var se standardEvent
+		if err := json.Unmarshal(raw, &se); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", f, err)
+		}
+
+		s := &jsonschema.Schema{}
+		if err := json.Unmarshal(se.Schema, s); err != nil {
+			return nil, fmt.Errorf("parse schema of %s: %w", se.Type, err)
+		}
+		r.events[se.Type] = s
+
+		if err := r.ValidateEvent(context.Background(), se.Type, se.Example); err != nil {
+			return nil, fmt.Errorf("example of %s: %w", se.Type, err)
+		}
+	}
+
+	if r.commands, err = loadCommands(filepath.Join(distDir, "standard_commands")); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// ValidateEvent returns an error if the payload doesn't conform to the schema of the event type.
+func (r *Registry) ValidateEvent(ctx context.Context, eventType model.StandardEventType, payload json.RawMessage) error {
+	s, ok := r.events[eventType]
+	if !ok {
+		return fmt.Errorf("unknown event type: %s", eventType)
+	}
+
+	return validate(ctx, s, payload)
+}
+
+// ValidateSpec returns an error if the document doesn't conform to the connector spec schema.
+func (r *Registry) ValidateSpec(ctx context.Context, document json.RawMessage) error {
+	return validate(ctx, r.spec, document)
+}
+
+// ValidateCommandInput returns an error if the input doesn't conform to the input schema of the
+// standard command type. The input of other commands isn't checked.
+func (r *Registry) ValidateCommandInput(ctx context.Context, commandType model.CommandType, input json.RawMessage) error {
+	c, ok := r.commands[commandType]
+	if !ok {
+		return nil
+	}
+
+	return c.ValidateInput(ctx, input)
+}
+
+// Command gets the definition of a standard command, or nil if the type isn't one.
+func (r *Registry) Command(commandType model.CommandType) *StandardCommand {
+	return r.commands[commandType]
+}
+
+// validate validates a JSON document against a compiled schema.
+func validate(ctx context.Context, s *jsonschema.Schema, payload json.RawMessage) error {
+	errs, err := s.ValidateBytes(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
+
+// registerCommonSchemas registers the schemas in dir with the global jsonschema registry so that
+// they can be referenced by their $id (eg. "http://connect.sailpoint.com/schemas/object_output"). It
+// returns the schemas by file name.
+func registerCommonSchemas(dir string) (map[string]*jsonschema.Schema, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := make(map[string]*jsonschema.Schema, len(files))
+
+	for _, f := range files {
+		raw, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f, err)
+		}
+
+		s := &jsonschema.Schema{}
+		if err := json.Unmarshal(raw, s); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", f, err)
+		}
+
+		s.Register("", jsonschema.GetSchemaRegistry())
+		schemas[filepath.Base(f)] = s
+	}
+
+	return schemas, nil
+}
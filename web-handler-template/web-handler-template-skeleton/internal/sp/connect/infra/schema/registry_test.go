@@ -0,0 +1,97 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+const testDistDir = "../../../../../dist"
+
+func TestValidateEvent(t *testing.T) {
+	r, err := NewRegistry(testDistDir)
+	if err != nil {
+		t.Fatalf("load registry: %v", err)
+	}
+
+	tests := []struct {
+		eventType model.StandardEventType
+		payload   string
+		valid     bool
+	}{
+		{model.StandardEventAccountUpdated, `{"identity": "john.doe", "attributes": {"first": "john"}}`, true},
+		{model.StandardEventAccountUpdated, `{"uuid": "1234"}`, false},
+		{model.StandardEventAccountDeleted, `{"identity": "john.doe", "uuid": "1234"}`, true},
+		{model.StandardEventAccountDeleted, `{"identity": "john.doe", "attributes": {}}`, false},
+		{"std:unknown", `{}`, false},
+	}
+
+	for _, tt := range tests {
+		err := r.ValidateEvent(context.Background(), tt.eventType, json.RawMessage(tt.payload))
+		if tt.valid && err != nil {
+			t.Errorf("%s %s: unexpected error: %v", tt.eventType, tt.payload, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s %s: expected error", tt.eventType, tt.payload)
+		}
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	r, err := NewRegistry(testDistDir)
+	if err != nil {
+		t.Fatalf("load registry: %v", err)
+	}
+
+	tests := []struct {
+		document string
+		valid    bool
+	}{
+		{`{"name": "Acme", "visibility": "private", "topology": "global", "endpoint": "https://acme.example.com", "commands": ["std:account:list"], "sourceConfig": []}`, true},
+		{`{"name": "Acme", "visibility": "private", "topology": "global", "commands": [], "sourceConfig": []}`, false},
+		{`{"name": "Acme", "visibility": "private", "topology": "internal"}`, false},
+		{`{"name": "Acme", "visibility": "secret", "topology": "runtime"}`, false},
+	}
+
+	for _, tt := range tests {
+		err := r.ValidateSpec(context.Background(), json.RawMessage(tt.document))
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.document, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected error", tt.document)
+		}
+	}
+}
+
+func TestValidateCommandInput(t *testing.T) {
+	r, err := NewRegistry(testDistDir)
+	if err != nil {
+		t.Fatalf("load registry: %v", err)
+	}
+
+	tests := []struct {
+		commandType model.CommandType
+		input       string
+		valid       bool
+	}{
+		{model.CommandTestConnection, `{}`, true},
+		{model.CommandTestConnection, `{"identity": "john.doe"}`, false},
+		{model.CommandAccountRead, `{"identity": "john.doe"}`, true},
+		{model.CommandAccountRead, `{}`, false},
+		{"custom:command", `{"anything": true}`, true},
+	}
+
+	for _, tt := range tests {
+		err := r.ValidateCommandInput(context.Background(), tt.commandType, json.RawMessage(tt.input))
+		if tt.valid && err != nil {
+			t.Errorf("%s %s: unexpected error: %v", tt.commandType, tt.input, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s %s: expected error", tt.commandType, tt.input)
+		}
+	}
+}
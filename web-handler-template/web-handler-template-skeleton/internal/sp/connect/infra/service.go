@@ -3,27 +3,166 @@ package infra
 
 import (
 	"context"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/sailpoint/atlas-go/atlas"
 	"github.com/sailpoint/atlas-go/atlas/application"
+	"github.com/sailpoint/atlas-go/atlas/auth"
+	"github.com/sailpoint/atlas-go/atlas/beacon"
+	"github.com/sailpoint/atlas-go/atlas/config"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/atlas-go/atlas/queue"
 	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/devauth"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/dispatch"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/globalconnector"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/internalconnector"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/runtimesocket"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/schema"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/tracing"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
 )
 
 // ConnectService is the main application structure.
 type ConnectService struct {
 	*application.Application
-	app cmd.App
+	app                    cmd.App
+	schemaRegistry         *schema.Registry
+	standardEventPublisher model.StandardEventPublisher
+	keyValueStore          model.KeyValueStore
+	orgStatusStore         model.OrgStatusStore
+	specStore              model.ConnectorSpecStore
+	instanceStore          model.ConnectorInstanceStore
+	aclStore               model.ACLStore
+	apiKeyStore            model.APIKeyStore
+	orgPurgers             []model.OrgPurger
+	outbox                 *dynamoOutbox
+	outboxRelay            *outboxRelay
+	invocationObserver     model.InvocationObserver
+	traceProvider          *tracing.Provider
+	dynamoClient           *dynamodb.DynamoDB
+	queueService           queue.Service
+	auditLog               *dynamoAuditLog
+	invocationStore        model.InvocationStore
+	invocationLimiter      model.InvocationLimiter
+	runtimeStore           model.RuntimeStore
+	runtimeQueue           model.RuntimeCommandQueue
+	runtimeResults         model.InvocationResultHandler
+	runtimeDispatched      func(context.Context, *model.Runtime) (<-chan struct{}, func())
+	runtimeSocket          *runtimesocket.Server
+	globalExecutor         *globalconnector.Executor
+	commandDispatcher      *dispatch.Dispatcher
+	commandInvoker         *commandInvoker
+
+	// devIssuer is nil unless DEV_AUTH_ENABLED is set in development.
+	devIssuer *devauth.Issuer
 }
 
-// NewConnectService constructs a new service instance.
-func NewConnectService() (*ConnectService, error) {
-	application, err := application.New("sp-connect")
+// NewConnectService constructs a new service instance. The options override the atlas defaults, such
+// as the backends of an in-process service in tests.
+func NewConnectService(options ...application.ConfigurationOption) (*ConnectService, error) {
+	s := &ConnectService{}
+
+	application, err := application.New("sp-connect", append(options, s.withDevAuth())...)
 	if err != nil {
 		return nil, err
 	}
-
-	s := &ConnectService{}
 	s.Application = application
 
+	s.traceProvider, err = newTraceProvider(s.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// The service runs from the dist directory by default (see `make run`).
+	distDir := config.GetString(s.Config, "DIST_DIR", ".")
+	s.schemaRegistry, err = schema.NewRegistry(distDir)
+	if err != nil {
+		return nil, err
+	}
+
+	s.dynamoClient = newDynamoClient()
+	s.queueService = newInstrumentedQueueService(queue.NewSqsQueueService())
+
+	standardEventPublisher := newStandardEventPublisher(s.EventPublisher, s.schemaRegistry)
+	s.standardEventPublisher = standardEventPublisher
+	s.keyValueStore = newRedisKeyValueStore(s.RedisClient)
+
+	specStore, err := newConnectorSpecStore(s.RedisClient, distDir)
+	if err != nil {
+		return nil, err
+	}
+	s.specStore = specStore
+
+	instanceStore := newConnectorInstanceStore(s.RedisClient)
+	s.instanceStore = instanceStore
+
+	invocationLimiter, err := s.newInvocationLimiter()
+	if err != nil {
+		return nil, err
+	}
+	s.invocationLimiter = invocationLimiter
+
+	s.invocationObserver = invocationObservers{newInvocationMetrics(), newInvocationSlotReleaser(s.invocationLimiter)}
+
+	// Invocation and audit changes are written to the outbox in the same transaction as the change, so
+	// that their events are published if and only if the change is persisted.
+	if table := config.GetString(s.Config, "CONNECTOR_OUTBOX_TABLE_NAME", ""); table != "" {
+		s.outbox = newDynamoOutbox(s.dynamoClient, table, config.GetInt(s.Config, "OUTBOX_SHARDS", 8))
+		s.outboxRelay = newOutboxRelay(s.outbox, s.EventPublisher, config.GetDuration(s.Config, "OUTBOX_RELAY_INTERVAL", time.Second), config.GetInt(s.Config, "OUTBOX_RELAY_BATCH_SIZE", 100))
+	}
+
+	invocationStore := s.newInvocationStore(standardEventPublisher)
+	s.invocationStore = invocationStore
+
+	runtimeStore := newRedisRuntimeStore(s.RedisClient)
+	s.runtimeStore = runtimeStore
+	s.runtimeQueue = newTracedRuntimeQueue(runtimeStore)
+	s.runtimeResults = newInvocationResultHandler(s.invocationStore, s.invocationObserver)
+	s.runtimeDispatched = runtimeStore.Dispatched
+	s.runtimeSocket = runtimesocket.NewServer(s.runtimeStore, s.runtimeQueue, s.runtimeResults, s.runtimeSocketConfig())
+
+	// Connectors with the global topology are called at their spec's endpoint with service tokens, so
+	// only endpoints on the allowed hosts are called.
+	globalConfig := globalconnector.Config{
+		DefaultTimeout: config.GetDuration(s.Config, "GLOBAL_CONNECTOR_DEFAULT_TIMEOUT", 5*time.Minute),
+		MaxResultSize:  cmd.MaxRuntimeResultSize,
+		Endpoints:      &globalconnector.EndpointPolicy{AllowedHosts: config.GetStringSlice(s.Config, "GLOBAL_CONNECTOR_ALLOWED_HOSTS", nil)},
+	}
+	s.globalExecutor = globalconnector.NewExecutor(s.InternalClientProvider, newInvocationResultHandler(s.invocationStore, s.invocationObserver), globalConfig)
+
+	// In Beacon mode, commands of orgs with a developer's runtime registered are sent to it instead of the
+	// queue. Beacon's endpoints are internal, so they aren't restricted like those of specs.
+	var beaconRegistrar beacon.Registrar
+	if config.GetBool(s.Config, "BEACON_ENABLED", false) {
+		beaconRegistrar = s.BeaconRegistrar
+	}
+	beaconConfig := globalConfig
+	beaconConfig.Endpoints = nil
+	beaconExecutor := globalconnector.NewExecutor(s.InternalClientProvider, newInvocationResultHandler(s.invocationStore, s.invocationObserver), beaconConfig)
+	s.commandDispatcher = dispatch.NewDispatcher(s.runtimeQueue, beaconRegistrar, beaconExecutor, config.GetString(s.Config, "BEACON_RUNTIME_SERVICE", "sp-connect-runtime"))
+	internalExecutor := internalconnector.NewExecutor(s.schemaRegistry, newInvocationResultHandler(s.invocationStore, s.invocationObserver))
+	s.commandInvoker = newCommandInvoker(s.instanceStore, s.specStore, s.invocationStore, s.commandDispatcher, s.globalExecutor, internalExecutor, s.invocationObserver, config.GetDuration(s.Config, "INVOCATION_DEFAULT_TIMEOUT", 5*time.Minute))
+
+	aclStore := newACLStore(s.RedisClient)
+	s.aclStore = aclStore
+	apiKeyStore := newAPIKeyStore(s.RedisClient)
+	s.apiKeyStore = apiKeyStore
+	s.AccessSummarizer = &apiKeySummarizer{delegate: s.AccessSummarizer}
+
+	orgStatusStore := newOrgStatusStore(s.keyValueStore)
+	s.orgStatusStore = orgStatusStore
+
+	// Without an audit table, audit records are only published to the AUDIT topic.
+	s.auditLog = newDynamoAuditLog(s.dynamoClient, config.GetString(s.Config, "CONNECTOR_AUDIT_TABLE_NAME", ""), config.GetDuration(s.Config, "AUDIT_RETENTION", 365*24*time.Hour), s.outbox, s.EventPublisher)
+
+	// Every store that holds tenant data must be purged when the org is deleted.
+	s.orgPurgers = []model.OrgPurger{orgStatusStore, specStore, instanceStore, aclStore, apiKeyStore, runtimeStore, invocationLimiter, invocationStore, s.auditLog}
+
+	s.registerHealthChecks()
+
 	return s, nil
 }
 
@@ -33,14 +172,73 @@ func (s *ConnectService) Run() error {
 
 	ar, ctx := atlas.NewRoutineWithContext(ctx)
 	ar.Go(ctx, func() error { return s.StartBeaconHeartbeat(ctx) })
-	//ar.Go(ctx, func() error { return s.StartEventConsumer(ctx, s.bindEventHandlers()) })
+	ar.Go(ctx, func() error { return s.StartEventConsumer(ctx, s.bindEventHandlers()) })
 	ar.Go(ctx, func() error { return s.StartMetricsServer(ctx) })
-	ar.Go(ctx, func() error { return s.StartWebServer(ctx, s.buildRoutes()) })
+	if s.outboxRelay != nil {
+		ar.Go(ctx, func() error { return s.outboxRelay.Start(ctx) })
+	}
+	ar.Go(ctx, func() error { return s.startRuntimeReaper(ctx) })
+	ar.Go(ctx, func() error { return s.StartWebServer(ctx, s.buildHandler()) })
 	ar.Go(ctx, func() error { return s.WaitForInterrupt(ctx, done) })
 
-	if err := ar.Wait(); err != nil && err != context.Canceled {
+	err := ar.Wait()
+
+	if s.traceProvider != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := s.traceProvider.Shutdown(shutdownCtx); err != nil {
+			log.Warnf(shutdownCtx, "flush traces: %v", err)
+		}
+	}
+
+	if err != nil && err != context.Canceled {
 		return err
 	}
 
 	return nil
 }
+
+// Handler returns the service's HTTP handler, for serving it without Run, as in an in-process test
+// server. Event consumers and background routines aren't started.
+func (s *ConnectService) Handler() http.Handler {
+	return s.buildHandler()
+}
+
+// requestTenantID gets the tenant ID of the request context, which is set from the token of an
+// HTTP request or the headers of an event.
+func requestTenantID(ctx context.Context) string {
+	if rc := atlas.GetRequestContext(ctx); rc != nil {
+		return string(rc.TenantID)
+	}
+
+	return ""
+}
+
+// requestActor gets the name of the identity or client that made the request, for audit records.
+func requestActor(ctx context.Context) string {
+	token := auth.GetToken(ctx)
+	if token == nil {
+		return ""
+	}
+
+	switch {
+	case token.IdentityName != "":
+		return string(token.IdentityName)
+	case token.IdentityID != "":
+		return string(token.IdentityID)
+	default:
+		return token.ClientID
+	}
+}
+
+// recordAudit records a change to a connector instance or spec made by the current request. before
+// is nil for creates and after is nil for deletes; the values of secretKeys are redacted.
+func (s *ConnectService) recordAudit(ctx context.Context, action model.AuditAction, resourceType model.AuditResourceType, resourceID string, before interface{}, after interface{}, secretKeys []string) error {
+	cmd, err := cmd.NewRecordAudit(requestTenantID(ctx), requestActor(ctx), action, resourceType, resourceID, before, after, secretKeys)
+	if err != nil {
+		return err
+	}
+
+	return cmd.Handle(ctx, s.auditLog)
+}
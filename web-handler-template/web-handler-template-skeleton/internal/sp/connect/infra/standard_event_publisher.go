@@ -0,0 +1,156 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/atlas-go/atlas/event"
+	"github.com/sailpoint/atlas-go/atlas/trace"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/tracing"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// standardEventTopic is the org-scoped topic that standard connector events are published to.
+var standardEventTopic = event.NewSimpleTopicDescriptor(event.TopicScopeOrg, "sp_connect_standard_event")
+
+// headerKeyConnectorInstanceID is the event header that identifies the connector instance an event originated from.
+const headerKeyConnectorInstanceID = "connectorInstanceId"
+
+// kafkaStandardEventPublisher is a StandardEventPublisher that validates events against their
+// dist/standard_events schema and publishes them to Kafka. It also builds the standard events of
+// command results, which the invocation store writes along with the results.
+type kafkaStandardEventPublisher struct {
+	publisher event.Publisher
+	validator model.SchemaValidator
+}
+
+// newStandardEventPublisher constructs a new kafkaStandardEventPublisher.
+func newStandardEventPublisher(publisher event.Publisher, validator model.SchemaValidator) *kafkaStandardEventPublisher {
+	p := &kafkaStandardEventPublisher{}
+	p.publisher = publisher
+	p.validator = validator
+
+	return p
+}
+
+// CommandResultEvent builds the standard event that corresponds to the command result, for
+// standardEventTopic, or returns nil if there is none: std:account:updated for successful account
+// creates and updates, and std:account:deleted for successful account deletes. The invocation store
+// writes it along with the result.
+func (p *kafkaStandardEventPublisher) CommandResultEvent(ctx context.Context, result model.CommandResult) (*event.Event, error) {
+	var eventType model.StandardEventType
+	var payload model.AccountEvent
+
+	switch result.Type {
+	case model.CommandAccountCreate, model.CommandAccountUpdate:
+		var output struct {
+			model.AccountEvent
+			Key *model.ObjectKey `json:"key"`
+		}
+		if err := json.Unmarshal(result.Output, &output); err != nil {
+			return nil, fmt.Errorf("parse %s output: %w", result.Type, err)
+		}
+
+		// An update may legitimately return an empty object, in which case there's nothing to announce.
+		payload = output.AccountEvent
+		if payload.Identity == "" {
+			payload.Identity = output.Key.Identity()
+		}
+		if payload.Identity == "" {
+			return nil, nil
+		}
+
+		eventType = model.StandardEventAccountUpdated
+	case model.CommandAccountDelete:
+		var input struct {
+			Identity string           `json:"identity"`
+			Key      *model.ObjectKey `json:"key"`
+		}
+		if err := json.Unmarshal(result.Input, &input); err != nil {
+			return nil, fmt.Errorf("parse %s input: %w", result.Type, err)
+		}
+
+		payload.Identity = input.Identity
+		if payload.Identity == "" {
+			payload.Identity = input.Key.Identity()
+		}
+
+		eventType = model.StandardEventAccountDeleted
+	default:
+		return nil, nil
+	}
+
+	return p.newEvent(ctx, result.ConnectorInstanceID, eventType, payload)
+}
+
+// PublishConnectorEvents publishes a batch of connector-submitted events onto the org's standard event topic,
+// returning the IDs of the events that failed to publish.
+func (p *kafkaStandardEventPublisher) PublishConnectorEvents(ctx context.Context, instanceID string, events []model.ConnectorEvent) ([]string, error) {
+	topic, err := event.NewTopic(ctx, standardEventTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := make([]event.EventAndTopic, 0, len(events))
+	for _, ce := range events {
+		e := event.NewEventJSON(string(ce.Type), string(ce.Payload), eventHeaders(ctx, instanceID))
+		e.ID = ce.ID
+
+		batch = append(batch, event.EventAndTopic{Event: e, Topic: topic})
+	}
+
+	start := time.Now()
+	failed, err := p.publisher.BulkPublish(ctx, batch)
+	observe(publishKafkaLatency, start)
+	if err != nil {
+		return nil, fmt.Errorf("publish connector events: %w", err)
+	}
+
+	failedIDs := make([]string, 0, len(failed))
+	for _, f := range failed {
+		failedIDs = append(failedIDs, f.EventAndTopic.Event.ID)
+	}
+
+	return failedIDs, nil
+}
+
+// newEvent validates the payload against the event schema and builds the event for the org's
+// standard event topic.
+func (p *kafkaStandardEventPublisher) newEvent(ctx context.Context, instanceID string, eventType model.StandardEventType, payload interface{}) (*event.Event, error) {
+	content, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.validator.ValidateEvent(ctx, eventType, content); err != nil {
+		return nil, fmt.Errorf("validate %s: %w", eventType, err)
+	}
+
+	return event.NewEventJSON(string(eventType), string(content), eventHeaders(ctx, instanceID)), nil
+}
+
+// eventHeaders builds the headers for an event published on behalf of a connector instance. The
+// tracing and request context headers let consumers continue the originating request and its trace.
+func eventHeaders(ctx context.Context, instanceID string) event.Headers {
+	headers := event.Headers{
+		event.HeaderKeyPartitionKey:  instanceID,
+		headerKeyConnectorInstanceID: instanceID,
+	}
+
+	if tc := trace.GetTracingContext(ctx); tc != nil {
+		headers[event.HeaderKeyRequestID] = string(tc.RequestID)
+	}
+	tracing.Inject(ctx, headers)
+
+	if rc := atlas.GetRequestContext(ctx); rc != nil {
+		headers[event.HeaderKeyTenantID] = string(rc.TenantID)
+		headers[event.HeaderKeyPod] = string(rc.Pod)
+		headers[event.HeaderKeyOrg] = string(rc.Org)
+	}
+
+	return headers
+}
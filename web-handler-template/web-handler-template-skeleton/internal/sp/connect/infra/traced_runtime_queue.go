@@ -0,0 +1,91 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/tracing"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// runtimeMessagingSystem is the messaging system runtime commands are attributed to in spans.
+const runtimeMessagingSystem = "redis"
+
+// tracedRuntimeQueue is a model.RuntimeCommandQueue that propagates trace context through the
+// commands of the underlying queue. Each command is dispatched within a producer span, whose context
+// is set as the command's traceparent, and each claim continues the trace with a consumer span (see
+// startMessageSpan), whose context is handed to the runtime in place of the dispatcher's.
+type tracedRuntimeQueue struct {
+	queue model.RuntimeCommandQueue
+}
+
+// newTracedRuntimeQueue wraps a model.RuntimeCommandQueue.
+func newTracedRuntimeQueue(queue model.RuntimeCommandQueue) *tracedRuntimeQueue {
+	return &tracedRuntimeQueue{queue: queue}
+}
+
+// Dispatch queues a command for the runtimes of its connector group within a producer span.
+func (q *tracedRuntimeQueue) Dispatch(ctx context.Context, cmd *model.RuntimeCommand) (err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "send "+cmd.ConnectorGroup,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			label.String("messaging.system", runtimeMessagingSystem),
+			label.String("messaging.destination", cmd.ConnectorGroup),
+			label.String("messaging.message_id", cmd.InvocationID),
+		))
+	defer func() { endSpan(span, err) }()
+
+	cmd.Traceparent = traceparent(ctx)
+
+	return q.queue.Dispatch(ctx, cmd)
+}
+
+// Claim takes the next pending command of the runtime's connector groups, continuing its trace with a
+// consumer span.
+func (q *tracedRuntimeQueue) Claim(ctx context.Context, runtime *model.Runtime) (*model.RuntimeCommand, error) {
+	claimed, err := q.queue.Claim(ctx, runtime)
+	if err != nil || claimed == nil {
+		return claimed, err
+	}
+
+	spanCtx, span := startMessageSpan(ctx, runtimeMessagingSystem, claimed.ConnectorGroup, map[string]string{"traceparent": claimed.Traceparent})
+	span.SetAttributes(label.String("messaging.message_id", claimed.InvocationID), label.String("runtime.id", runtime.ID))
+	defer endSpan(span, nil)
+
+	if tp := traceparent(spanCtx); tp != "" {
+		claimed.Traceparent = tp
+	}
+
+	return claimed, nil
+}
+
+// GetClaim gets a command claimed by the runtime.
+func (q *tracedRuntimeQueue) GetClaim(ctx context.Context, runtime *model.Runtime, invocationID string) (*model.RuntimeCommand, error) {
+	return q.queue.GetClaim(ctx, runtime, invocationID)
+}
+
+// Complete releases the runtime's claim of a command.
+func (q *tracedRuntimeQueue) Complete(ctx context.Context, runtime *model.Runtime, invocationID string) (bool, error) {
+	return q.queue.Complete(ctx, runtime, invocationID)
+}
+
+// Requeue returns a command claimed by the runtime to its group's queue.
+func (q *tracedRuntimeQueue) Requeue(ctx context.Context, runtime *model.Runtime, invocationID string) (bool, error) {
+	return q.queue.Requeue(ctx, runtime, invocationID)
+}
+
+// RequeueAbandoned requeues the claims of runtimes that have stopped sending heartbeats.
+func (q *tracedRuntimeQueue) RequeueAbandoned(ctx context.Context) (int, error) {
+	return q.queue.RequeueAbandoned(ctx)
+}
+
+// traceparent gets the W3C trace context of ctx, or "" if it has none.
+func traceparent(ctx context.Context) string {
+	carrier := map[string]string{}
+	tracing.Inject(ctx, carrier)
+
+	return carrier["traceparent"]
+}
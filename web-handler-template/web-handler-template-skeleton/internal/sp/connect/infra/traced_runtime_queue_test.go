@@ -0,0 +1,52 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/memory"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/tracing"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+	"go.opentelemetry.io/otel"
+)
+
+func TestTracedRuntimeQueueCarriesTheTraceToTheRuntime(t *testing.T) {
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tracing.NewProvider("test", tracing.NewWriterExporter(ioutil.Discard)))
+	otel.SetTextMapPropagator(tracing.Propagator())
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	queue := newTracedRuntimeQueue(newRedisRuntimeStore(memory.NewRedis()))
+	runtime := &model.Runtime{ID: "r1", TenantID: "t1", ConnectorGroups: []string{"on-prem"}}
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "invoke")
+	traceID := span.SpanContext().TraceID.String()
+	err := queue.Dispatch(ctx, &model.RuntimeCommand{InvocationID: "i1", TenantID: "t1", ConnectorGroup: "on-prem"})
+	span.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := queue.Claim(context.Background(), runtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed == nil || !strings.Contains(claimed.Traceparent, traceID) {
+		t.Fatalf("expected the claimed command to continue trace %s, got %+v", traceID, claimed)
+	}
+
+	// The runtime is handed the claim's span, while the queue keeps the dispatcher's.
+	held, err := queue.GetClaim(context.Background(), runtime, "i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(held.Traceparent, traceID) || held.Traceparent == claimed.Traceparent {
+		t.Errorf("expected the dispatched command to carry the dispatch span of trace %s, got %s", traceID, held.Traceparent)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package infra
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sailpoint/atlas-go/atlas/config"
+	"github.com/sailpoint/atlas-go/atlas/event"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// tracerName is the name spans started by the service are attributed to.
+const tracerName = "github.com/sailpoint/sp-connect"
+
+// newTraceProvider configures trace propagation and, unless OTEL_TRACES_EXPORTER is "none" (the
+// default), installs a tracing.Provider as the global tracer provider. Spans are exported over OTLP to
+// OTEL_EXPORTER_OTLP_ENDPOINT, or written as JSON lines to stdout or OTEL_TRACES_FILE when offline.
+func newTraceProvider(cfg config.Source) (*tracing.Provider, error) {
+	otel.SetTextMapPropagator(tracing.Propagator())
+
+	var exporter tracing.Exporter
+	switch name := config.GetString(cfg, "OTEL_TRACES_EXPORTER", "none"); name {
+	case "none":
+		return nil, nil
+	case "otlp":
+		exporter = tracing.NewOTLPExporter(config.GetString(cfg, "OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"), &http.Client{Timeout: 10 * time.Second})
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	case "file":
+		f, err := os.OpenFile(config.GetString(cfg, "OTEL_TRACES_FILE", "traces.json"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		exporter = tracing.NewWriterExporter(f)
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q (expected otlp, stdout, file or none)", name)
+	}
+
+	ratio, err := strconv.ParseFloat(config.GetString(cfg, "OTEL_TRACES_SAMPLER_ARG", "1"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG: %w", err)
+	}
+
+	provider := tracing.NewProvider("sp-connect", exporter,
+		tracing.WithSampleRatio(ratio),
+		tracing.WithBatching(config.GetDuration(cfg, "OTEL_BSP_SCHEDULE_DELAY", 5*time.Second), config.GetInt(cfg, "OTEL_BSP_MAX_EXPORT_BATCH_SIZE", 512)))
+	otel.SetTracerProvider(provider)
+
+	return provider, nil
+}
+
+// traceEvents is event middleware that continues the trace carried in an event's headers with a
+// consumer span around its handler.
+func traceEvents() event.MiddlewareFunc {
+	return func(next event.Handler) event.Handler {
+		return event.HandlerFunc(func(ctx context.Context, topic event.Topic, e *event.Event) error {
+			ctx = tracing.Extract(ctx, e.Headers)
+			ctx, span := otel.Tracer(tracerName).Start(ctx, string(topic.Name())+" "+e.Type,
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(
+					label.String("messaging.system", "kafka"),
+					label.String("messaging.destination", string(topic.Name())),
+					label.String("messaging.message_id", e.ID),
+					label.String("event.type", e.Type),
+				))
+			defer span.End()
+
+			if sc := span.SpanContext(); sc.IsValid() {
+				ctx = log.WithFields(ctx, zap.String("trace_id", sc.TraceID.String()))
+			}
+
+			err := next.HandleEvent(ctx, topic, e)
+			if err != nil {
+				span.RecordError(err)
+			}
+
+			return err
+		})
+	}
+}
+
+// startMessageSpan continues the trace carried in a message's attributes with a consumer span, for
+// workers that process messages taken from a queue of the messaging system. The caller must end the
+// span.
+func startMessageSpan(ctx context.Context, system string, destination string, attributes map[string]string) (context.Context, trace.Span) {
+	ctx = tracing.Extract(ctx, attributes)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "process "+destination,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			label.String("messaging.system", system),
+			label.String("messaging.destination", destination),
+		))
+
+	if sc := span.SpanContext(); sc.IsValid() {
+		ctx = log.WithFields(ctx, zap.String("trace_id", sc.TraceID.String()))
+	}
+
+	return ctx, span
+}
+
+// endSpan records err on the span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetStatus(codes.Ok, "")
+	}
+	span.End()
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+)
+
+var (
+	droppedSpans = promauto.NewCounter(prometheus.CounterOpts{Name: "sp_connect_trace_spans_dropped_total", Help: "Spans dropped because the exporter couldn't keep up"})
+	exportErrors = promauto.NewCounter(prometheus.CounterOpts{Name: "sp_connect_trace_export_errors_total", Help: "Batches of spans that failed to export"})
+)
+
+// Exporter sends ended spans to a tracing backend.
+type Exporter interface {
+
+	// ExportSpans exports a batch of spans.
+	ExportSpans(ctx context.Context, spans []*SpanData) error
+}
+
+// writerExporter writes spans as JSON lines, eg. to stdout or a file when there's no collector.
+type writerExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter constructs an Exporter that writes each span to w as a line of JSON.
+func NewWriterExporter(w io.Writer) Exporter {
+	return &writerExporter{w: w}
+}
+
+// ExportSpans writes the spans.
+func (e *writerExporter) ExportSpans(ctx context.Context, spans []*SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		if err := enc.Encode(toOTLPSpan(s)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// otlpExporter posts spans to an OpenTelemetry collector using OTLP/HTTP with JSON encoding.
+type otlpExporter struct {
+	url    string
+	client *http.Client
+}
+
+// NewOTLPExporter constructs an Exporter that posts spans to the collector at endpoint (eg.
+// http://localhost:4318), on the standard /v1/traces path.
+func NewOTLPExporter(endpoint string, client *http.Client) Exporter {
+	return &otlpExporter{url: strings.TrimSuffix(endpoint, "/") + "/v1/traces", client: client}
+}
+
+// ExportSpans posts the spans, grouped by service and instrumentation.
+func (e *otlpExporter) ExportSpans(ctx context.Context, spans []*SpanData) error {
+	body, err := json.Marshal(toOTLPRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("otlp export to %s failed: %s: %s", e.url, resp.Status, msg)
+	}
+
+	return nil
+}
+
+// The OTLP JSON encoding of spans, per opentelemetry-proto's trace.proto. IDs are hex encoded and
+// 64-bit integers are strings.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		TraceState        string         `json:"traceState,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Events            []otlpEvent    `json:"events,omitempty"`
+		Links             []otlpLink     `json:"links,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+
+	otlpEvent struct {
+		TimeUnixNano string         `json:"timeUnixNano"`
+		Name         string         `json:"name"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	}
+
+	otlpLink struct {
+		TraceID    string         `json:"traceId"`
+		SpanID     string         `json:"spanId"`
+		Attributes []otlpKeyValue `json:"attributes,omitempty"`
+	}
+
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+
+	otlpAnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// toOTLPRequest groups spans by service, then by instrumentation scope.
+func toOTLPRequest(spans []*SpanData) otlpRequest {
+	var req otlpRequest
+	resources := map[string]int{}
+	scopes := map[[2]string]int{}
+
+	for _, s := range spans {
+		r, ok := resources[s.Service]
+		if !ok {
+			r = len(req.ResourceSpans)
+			resources[s.Service] = r
+			req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+				Resource: otlpResource{Attributes: toOTLPAttributes([]label.KeyValue{label.String("service.name", s.Service)})},
+			})
+		}
+
+		rs := &req.ResourceSpans[r]
+		key := [2]string{s.Service, s.InstrumentationName}
+		i, ok := scopes[key]
+		if !ok {
+			i = len(rs.ScopeSpans)
+			scopes[key] = i
+			rs.ScopeSpans = append(rs.ScopeSpans, otlpScopeSpans{
+				Scope: otlpScope{Name: s.InstrumentationName},
+			})
+		}
+
+		rs.ScopeSpans[i].Spans = append(rs.ScopeSpans[i].Spans, toOTLPSpan(s))
+	}
+
+	return req
+}
+
+// toOTLPSpan converts a span to its OTLP JSON encoding.
+func toOTLPSpan(s *SpanData) otlpSpan {
+	span := otlpSpan{
+		TraceID:           s.SpanContext.TraceID.String(),
+		SpanID:            s.SpanContext.SpanID.String(),
+		TraceState:        s.SpanContext.TraceState.String(),
+		Name:              s.Name,
+		Kind:              int(s.Kind), // otel's span kinds have the same values as OTLP's
+		StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+		Attributes:        toOTLPAttributes(s.Attributes),
+		Status:            otlpStatus{Code: otlpStatusCode(s.StatusCode), Message: s.StatusMessage},
+	}
+
+	if s.ParentSpanID.IsValid() {
+		span.ParentSpanID = s.ParentSpanID.String()
+	}
+
+	for _, e := range s.Events {
+		span.Events = append(span.Events, otlpEvent{
+			TimeUnixNano: strconv.FormatInt(e.Time.UnixNano(), 10),
+			Name:         e.Name,
+			Attributes:   toOTLPAttributes(e.Attributes),
+		})
+	}
+
+	for _, l := range s.Links {
+		span.Links = append(span.Links, otlpLink{
+			TraceID:    l.TraceID.String(),
+			SpanID:     l.SpanID.String(),
+			Attributes: toOTLPAttributes(l.Attributes),
+		})
+	}
+
+	return span
+}
+
+// otlpStatusCode maps an otel status code to OTLP's, which orders Ok and Error the other way round.
+func otlpStatusCode(code codes.Code) int {
+	switch code {
+	case codes.Ok:
+		return 1
+	case codes.Error:
+		return 2
+	}
+
+	return 0
+}
+
+// toOTLPAttributes converts attributes to OTLP key/values. Arrays are encoded as strings.
+func toOTLPAttributes(kvs []label.KeyValue) []otlpKeyValue {
+	attrs := make([]otlpKeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		var v otlpAnyValue
+		switch kv.Value.Type() {
+		case label.BOOL:
+			b := kv.Value.AsBool()
+			v.BoolValue = &b
+		case label.INT32, label.INT64, label.UINT32, label.UINT64:
+			i := kv.Value.Emit()
+			v.IntValue = &i
+		case label.FLOAT32, label.FLOAT64:
+			f := kv.Value.AsFloat64()
+			if kv.Value.Type() == label.FLOAT32 {
+				f = float64(kv.Value.AsFloat32())
+			}
+			v.DoubleValue = &f
+		default:
+			str := kv.Value.Emit()
+			v.StringValue = &str
+		}
+		attrs = append(attrs, otlpKeyValue{Key: string(kv.Key), Value: v})
+	}
+
+	return attrs
+}
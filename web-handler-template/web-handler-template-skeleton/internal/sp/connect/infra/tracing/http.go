@@ -0,0 +1,99 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package tracing
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sailpoint/atlas-go/atlas/log"
+	atlastrace "github.com/sailpoint/atlas-go/atlas/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// instrumentationName is the name spans started by this package are attributed to.
+const instrumentationName = "github.com/sailpoint/sp-connect/internal/sp/connect/infra/tracing"
+
+// headerCarrier carries trace context in HTTP headers.
+type headerCarrier http.Header
+
+// Get returns the value of the header.
+func (c headerCarrier) Get(key string) string {
+	return http.Header(c).Get(key)
+}
+
+// Set sets the header.
+func (c headerCarrier) Set(key string, value string) {
+	if value != "" {
+		http.Header(c).Set(key, value)
+	}
+}
+
+// InjectHTTP writes the trace context of the request's context into its headers, for outgoing requests.
+func InjectHTTP(r *http.Request) {
+	otel.GetTextMapPropagator().Inject(r.Context(), headerCarrier(r.Header))
+}
+
+// Middleware starts a server span for every request, continuing the caller's trace if the request
+// carries one. It's meant to follow web.Trace(): the atlas request ID is recorded on the span, and the
+// trace ID is added to the request's log fields so that logs can be joined to the trace. Health
+// probes aren't traced.
+func Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/health/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), headerCarrier(r.Header))
+
+			name := r.URL.Path
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					name = template
+				}
+			}
+
+			attrs := []label.KeyValue{
+				label.String("http.method", r.Method),
+				label.String("http.route", name),
+				label.String("http.target", r.URL.RequestURI()),
+			}
+			if tc := atlastrace.GetTracingContext(ctx); tc != nil {
+				attrs = append(attrs, label.String("atlas.request_id", string(tc.RequestID)))
+			}
+
+			ctx, span := otel.Tracer(instrumentationName).Start(ctx, r.Method+" "+name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+			defer span.End()
+
+			if sc := span.SpanContext(); sc.IsValid() {
+				ctx = log.WithFields(ctx, zap.String("trace_id", sc.TraceID.String()))
+			}
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			span.SetAttributes(label.Int("http.status_code", sw.status))
+			if sw.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(sw.status))
+			}
+		})
+	}
+}
+
+// statusWriter records the status code written to a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code and writes it.
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
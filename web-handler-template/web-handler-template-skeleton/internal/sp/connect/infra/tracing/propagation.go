@@ -0,0 +1,46 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// mapCarrier carries trace context in a string map, such as queue message attributes or event headers.
+type mapCarrier map[string]string
+
+// Get returns the value of the key.
+func (c mapCarrier) Get(key string) string {
+	return c[key]
+}
+
+// Set sets the key. Empty values are skipped, since SQS rejects empty message attributes.
+func (c mapCarrier) Set(key string, value string) {
+	if value != "" {
+		c[key] = value
+	}
+}
+
+// Inject writes the trace context of ctx into a string map, eg. the attributes of a queue message or
+// the headers of an event.
+func Inject(ctx context.Context, carrier map[string]string) {
+	otel.GetTextMapPropagator().Inject(ctx, mapCarrier(carrier))
+}
+
+// Extract returns a context carrying the trace context in a string map, so that spans started from it
+// continue the trace.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, mapCarrier(carrier))
+}
+
+// Fields are the keys that Inject writes, eg. to request them as queue message attributes.
+func Fields() []string {
+	return otel.GetTextMapPropagator().Fields()
+}
+
+// Propagator is the propagator the service uses: W3C trace context and baggage.
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package tracing records OpenTelemetry spans and exports them over OTLP or as JSON lines. Only the
+// otel API is vendored, so this package provides the minimal SDK the service needs: a sampling
+// TracerProvider, W3C trace context propagation over HTTP headers and string maps (queue message
+// attributes, event headers), and batching exporters.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Provider is a trace.TracerProvider that records sampled spans and hands them to an Exporter in batches.
+type Provider struct {
+	service     string
+	exporter    Exporter
+	sampleRatio float64
+	spans       chan *SpanData
+	interval    time.Duration
+	batchSize   int
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// Option configures a Provider.
+type Option func(p *Provider)
+
+// WithSampleRatio samples the given fraction of new traces (default: 1). Spans with a parent follow
+// the parent's sampling decision, so that traces are never partial.
+func WithSampleRatio(ratio float64) Option {
+	return func(p *Provider) {
+		p.sampleRatio = ratio
+	}
+}
+
+// WithBatching sets how often spans are exported and the most spans exported at once (default: 5s, 512).
+func WithBatching(interval time.Duration, batchSize int) Option {
+	return func(p *Provider) {
+		p.interval = interval
+		p.batchSize = batchSize
+	}
+}
+
+// NewProvider constructs a Provider and starts exporting spans. Call Shutdown to export the remaining spans.
+func NewProvider(service string, exporter Exporter, options ...Option) *Provider {
+	p := &Provider{
+		service:     service,
+		exporter:    exporter,
+		sampleRatio: 1,
+		spans:       make(chan *SpanData, 4096),
+		interval:    5 * time.Second,
+		batchSize:   512,
+		stop:        make(chan struct{}),
+	}
+	for _, option := range options {
+		option(p)
+	}
+
+	p.wg.Add(1)
+	go p.run()
+
+	return p
+}
+
+// Tracer returns a Tracer whose spans are attributed to the instrumentation name.
+func (p *Provider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return &tracer{provider: p, name: name}
+}
+
+// Shutdown stops the provider, exporting any spans that have ended.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	p.once.Do(func() { close(p.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue queues an ended span for export. Spans are dropped rather than blocking the caller when
+// the exporter can't keep up.
+func (p *Provider) enqueue(s *SpanData) {
+	select {
+	case p.spans <- s:
+	default:
+		droppedSpans.Inc()
+	}
+}
+
+// run exports batches of spans until the provider is shut down.
+func (p *Provider) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, p.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := p.exporter.ExportSpans(ctx, batch); err != nil {
+			exportErrors.Inc()
+		}
+		batch = make([]*SpanData, 0, p.batchSize)
+	}
+
+	for {
+		select {
+		case s := <-p.spans:
+			batch = append(batch, s)
+			if len(batch) >= p.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-p.stop:
+			for {
+				select {
+				case s := <-p.spans:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// sampled decides whether a new trace is sampled, from the low bits of its random trace ID.
+func (p *Provider) sampled(id trace.TraceID) bool {
+	if p.sampleRatio >= 1 {
+		return true
+	}
+
+	return float64(binary.BigEndian.Uint64(id[8:])>>1) < p.sampleRatio*float64(uint64(1)<<63)
+}
+
+// tracer starts spans for a Provider.
+type tracer struct {
+	provider *Provider
+	name     string
+}
+
+// Start starts a span as a child of the span (or remote span context) in ctx, if there is one.
+func (t *tracer) Start(ctx context.Context, name string, opts ...trace.SpanOption) (context.Context, trace.Span) {
+	config := trace.NewSpanConfig(opts...)
+
+	var parent trace.SpanContext
+	if !config.NewRoot {
+		parent = trace.SpanContextFromContext(ctx)
+		if !parent.IsValid() {
+			parent = trace.RemoteSpanContextFromContext(ctx)
+		}
+	}
+
+	sc := trace.SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.TraceFlags = parent.TraceFlags
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newTraceID()
+		if t.provider.sampled(sc.TraceID) {
+			sc.TraceFlags = trace.FlagsSampled
+		}
+	}
+
+	s := &span{tracer: t, sc: sc, recording: sc.IsSampled()}
+	if s.recording {
+		start := config.Timestamp
+		if start.IsZero() {
+			start = time.Now()
+		}
+
+		s.data = &SpanData{
+			Name:                name,
+			SpanContext:         sc,
+			ParentSpanID:        parent.SpanID,
+			Kind:                trace.ValidateSpanKind(config.SpanKind),
+			StartTime:           start,
+			Attributes:          config.Attributes,
+			Links:               config.Links,
+			Service:             t.provider.service,
+			InstrumentationName: t.name,
+		}
+	}
+
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+// newTraceID generates a random trace ID.
+func newTraceID() trace.TraceID {
+	var id trace.TraceID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// newSpanID generates a random span ID.
+func newSpanID() trace.SpanID {
+	var id trace.SpanID
+	_, _ = rand.Read(id[:])
+	return id
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package tracing
+
+import (
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanData is a span that has ended, as handed to an Exporter.
+type SpanData struct {
+	Name                string
+	SpanContext         trace.SpanContext
+	ParentSpanID        trace.SpanID
+	Kind                trace.SpanKind
+	StartTime           time.Time
+	EndTime             time.Time
+	Attributes          []label.KeyValue
+	Events              []Event
+	Links               []trace.Link
+	StatusCode          codes.Code
+	StatusMessage       string
+	Service             string
+	InstrumentationName string
+}
+
+// Event is something that happened during a span.
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes []label.KeyValue
+}
+
+// span is a trace.Span. Spans that aren't sampled only carry their span context so that it can be
+// propagated, and record nothing.
+type span struct {
+	tracer    *tracer
+	sc        trace.SpanContext
+	recording bool
+
+	mu    sync.Mutex
+	data  *SpanData
+	ended bool
+}
+
+// Tracer returns the Tracer that created the span.
+func (s *span) Tracer() trace.Tracer {
+	return s.tracer
+}
+
+// End completes the span and queues it for export.
+func (s *span) End(options ...trace.SpanOption) {
+	if !s.recording {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+
+	s.data.EndTime = trace.NewSpanConfig(options...).Timestamp
+	if s.data.EndTime.IsZero() {
+		s.data.EndTime = time.Now()
+	}
+	s.mu.Unlock()
+
+	s.tracer.provider.enqueue(s.data)
+}
+
+// AddEvent adds an event to the span.
+func (s *span) AddEvent(name string, options ...trace.EventOption) {
+	s.update(func(d *SpanData) {
+		config := trace.NewEventConfig(options...)
+		if config.Timestamp.IsZero() {
+			config.Timestamp = time.Now()
+		}
+		d.Events = append(d.Events, Event{Name: name, Time: config.Timestamp, Attributes: config.Attributes})
+	})
+}
+
+// IsRecording gets whether the span is sampled and hasn't ended.
+func (s *span) IsRecording() bool {
+	if !s.recording {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.ended
+}
+
+// RecordError records an error as an "exception" event and marks the span as failed.
+func (s *span) RecordError(err error, options ...trace.EventOption) {
+	if err == nil {
+		return
+	}
+
+	s.AddEvent("exception", append(options, trace.WithAttributes(label.String("exception.message", err.Error())))...)
+	s.SetStatus(codes.Error, err.Error())
+}
+
+// SpanContext returns the span's context.
+func (s *span) SpanContext() trace.SpanContext {
+	return s.sc
+}
+
+// SetStatus sets the status of the span.
+func (s *span) SetStatus(code codes.Code, msg string) {
+	s.update(func(d *SpanData) {
+		d.StatusCode = code
+		d.StatusMessage = msg
+	})
+}
+
+// SetName sets the span name.
+func (s *span) SetName(name string) {
+	s.update(func(d *SpanData) {
+		d.Name = name
+	})
+}
+
+// SetAttributes sets attributes of the span, replacing any with the same key.
+func (s *span) SetAttributes(kv ...label.KeyValue) {
+	s.update(func(d *SpanData) {
+		for _, attr := range kv {
+			replaced := false
+			for i := range d.Attributes {
+				if d.Attributes[i].Key == attr.Key {
+					d.Attributes[i] = attr
+					replaced = true
+				}
+			}
+			if !replaced {
+				d.Attributes = append(d.Attributes, attr)
+			}
+		}
+	})
+}
+
+// update modifies a recording span that hasn't ended.
+func (s *span) update(f func(d *SpanData)) {
+	if !s.recording {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.ended {
+		f(s.data)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingExporter keeps the spans it's given.
+type recordingExporter struct {
+	spans []*SpanData
+}
+
+func (e *recordingExporter) ExportSpans(ctx context.Context, spans []*SpanData) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// install sets up a provider as the global tracer provider for the duration of a test.
+func install(t *testing.T, exporter Exporter, options ...Option) *Provider {
+	provider := NewProvider("test", exporter, options...)
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(Propagator())
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	return provider
+}
+
+func TestTraceAcrossHops(t *testing.T) {
+	exporter := &recordingExporter{}
+	provider := install(t, exporter)
+
+	// An HTTP request publishes a message, which a worker then consumes.
+	attributes := map[string]string{}
+	r := mux.NewRouter()
+	r.Use(Middleware())
+	r.HandleFunc("/invocations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		Inject(r.Context(), attributes)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/invocations/1", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	ctx := Extract(context.Background(), attributes)
+	_, span := otel.Tracer("worker").Start(ctx, "process", trace.WithSpanKind(trace.SpanKindConsumer))
+	span.RecordError(errors.New("boom"))
+	span.End()
+
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(exporter.spans))
+	}
+
+	server, worker := exporter.spans[0], exporter.spans[1]
+	if server.Name != "POST /invocations/{id}" || server.Kind != trace.SpanKindServer {
+		t.Errorf("unexpected server span: %+v", server)
+	}
+	if server.SpanContext.TraceID.String() != "0af7651916cd43dd8448eb211c80319c" || server.ParentSpanID.String() != "b7ad6b7169203331" {
+		t.Errorf("expected server span to continue the caller's trace: %+v", server.SpanContext)
+	}
+	if worker.SpanContext.TraceID != server.SpanContext.TraceID || worker.ParentSpanID != server.SpanContext.SpanID {
+		t.Errorf("expected worker span to be a child of the server span: %+v", worker)
+	}
+	if len(worker.Events) != 1 || worker.Events[0].Name != "exception" || worker.StatusMessage != "boom" {
+		t.Errorf("expected error to be recorded: %+v", worker)
+	}
+}
+
+func TestUnsampledTracesStillPropagate(t *testing.T) {
+	exporter := &recordingExporter{}
+	provider := install(t, exporter, WithSampleRatio(0))
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "root")
+	carrier := map[string]string{}
+	Inject(ctx, carrier)
+	span.End()
+
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exporter.spans) != 0 {
+		t.Errorf("expected no spans to be exported, got %d", len(exporter.spans))
+	}
+	if !strings.HasSuffix(carrier["traceparent"], "-00") {
+		t.Errorf("expected an unsampled traceparent, got %q", carrier["traceparent"])
+	}
+	if _, ok := carrier["tracestate"]; ok {
+		t.Error("expected empty tracestate to be skipped")
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	provider := install(t, NewOTLPExporter(srv.URL+"/", srv.Client()))
+	_, span := otel.Tracer("lib").Start(context.Background(), "op")
+	span.RecordError(errors.New("boom"))
+	span.End()
+
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := json.Marshal(body)
+	for _, expected := range []string{
+		`"key":"service.name","value":{"stringValue":"test"}`,
+		`"scopeSpans":[{"scope":{"name":"lib"}`,
+		`"name":"op"`,
+		`"status":{"code":2,"message":"boom"}`,
+	} {
+		if !bytes.Contains(raw, []byte(expected)) {
+			t.Errorf("expected %s in %s", expected, raw)
+		}
+	}
+}
+
+func TestOTLPExporterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := NewOTLPExporter(srv.URL, srv.Client()).ExportSpans(context.Background(), []*SpanData{{Name: "op"}})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected export to fail, got %v", err)
+	}
+}
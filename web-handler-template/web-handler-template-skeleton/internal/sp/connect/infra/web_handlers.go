@@ -2,34 +2,76 @@
 package infra
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
 	"github.com/gorilla/mux"
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/atlas-go/atlas/config"
+	"github.com/sailpoint/atlas-go/atlas/trace"
 	"github.com/sailpoint/atlas-go/atlas/web"
 	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
-	"net/http"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/healthcheck"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/ratelimit"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/tracing"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
 )
 
 // buildRoutes configures all of the HTTP endpoints for the service.
 func (s *ConnectService) buildRoutes() *mux.Router {
-	r := web.NewRouter(web.DefaultAuthenticationConfig(s.TokenValidator))
+	authConfig := web.DefaultAuthenticationConfig(newAPIKeyTokenValidator(s.TokenValidator, s.apiKeyStore))
+	authConfig.TokenExtractor = web.TokenExtractorFunc(apiKeyTokenExtractor)
+	authConfig.IgnorePath("^/health/(live|ready)$")
+	authConfig.IgnorePath("^/runtime/")
+
+	r := web.NewRouter(authConfig)
+	r.Use(tracing.Middleware())
+
+	r.Handle("/health/live", healthcheck.LivenessHandler()).Methods("GET")
+	r.Handle("/health/ready", healthcheck.ReadinessHandler()).Methods("GET")
 
 	r.Handle("/hello-world", s.returnHelloWorld()).Methods("GET")
 
-	//r.Handle("/connector-specifications", s.requireRight("sp:connector:create", s.createConnectorSpecification())).Methods("POST")
-	//r.Handle("/connector-specifications", s.requireRight("sp:connector:read", s.listConnectorSpecifications())).Methods("GET")
-	//r.Handle("/connector-specifications/{id}", s.requireRight("sp:connector:read", s.getConnectorSpecification())).Methods("GET")
-	//r.Handle("/connector-specifications/{id}", s.requireRight("sp:connector:update", s.updateConnectorSpecification())).Methods("PUT")
-	//r.Handle("/connector-specifications/validate", s.requireRight("sp:connector:create", s.validateConnectorSpecification())).Methods("POST")
-	//r.Handle("/connector-specification/{id}", s.requireRight("sp:connector:update", s.patchConnectorSpecification())).Methods("PATCH")
+	r.Handle("/connector-specifications", s.requireRight("sp:connector:create", s.createConnectorSpecification())).Methods("POST")
+	r.Handle("/connector-specifications", s.requireRight("sp:connector:read", s.listConnectorSpecifications())).Methods("GET")
+	r.Handle("/connector-specifications/validate", s.requireRight("sp:connector:create", s.validateConnectorSpecification())).Methods("POST")
+	r.Handle("/connector-specifications/{id}", s.requireRight("sp:connector:read", s.getConnectorSpecification())).Methods("GET")
+	r.Handle("/connector-specifications/{id}", s.requireRight("sp:connector:update", s.updateConnectorSpecification())).Methods("PUT")
+	r.Handle("/connector-specifications/{id}", s.requireRight("sp:connector:update", s.patchConnectorSpecification())).Methods("PATCH")
 
-	//r.Handle("/connector-instances", s.requireRight("sp:connector:create", s.createConnectorInstance())).Methods("POST")
-	//r.Handle("/connector-instances", s.requireRight("sp:connector:read", s.listConnectorInstances())).Methods("GET")
-	//r.Handle("/connector-instances/{id}", s.requireRight("sp:connector:delete", s.deleteConnectorInstance())).Methods("DELETE")
-	//r.Handle("/connector-instances/{id}", s.requireRight("sp:connector:update", s.updateConnectorInstance())).Methods("PUT")
-	//r.Handle("/connector-instances/{id}", s.requireRight("sp:connector:read", s.getConnectorInstance())).Methods("GET")
-	//r.Handle("/connector-instances/{id}/commands", s.requireRight("sp:connector:invoke", s.invokeCommand())).Methods("POST")
+	r.Handle("/connector-instances", s.requireRight("sp:connector:create", s.createConnectorInstance())).Methods("POST")
+	r.Handle("/connector-instances", s.requireRight("sp:connector:read", s.listConnectorInstances())).Methods("GET")
+	r.Handle("/connector-instances/{id}", s.requireRight("sp:connector:delete", s.requireInstanceAccess(aclVerb(model.ACLUpdate), s.deleteConnectorInstance()))).Methods("DELETE")
+	r.Handle("/connector-instances/{id}", s.requireRight("sp:connector:update", s.requireInstanceAccess(aclVerb(model.ACLUpdate), s.updateConnectorInstance()))).Methods("PUT")
+	r.Handle("/connector-instances/{id}", s.requireRight("sp:connector:read", s.requireInstanceAccess(aclVerb(model.ACLRead), s.getConnectorInstance()))).Methods("GET")
+	r.Handle("/connector-instances/{id}/commands", s.requireRight("sp:connector:invoke", s.requireInstanceAccess(aclInvokeVerb, s.invokeCommand()))).Methods("POST")
+	r.Handle("/connector-instances/{id}/events", s.requireRight("sp:connector:update", s.requireInstanceAccess(aclVerb(model.ACLUpdate), s.ingestConnectorEvents()))).Methods("POST")
+
+	r.Handle("/connector-instances/{id}/acl", s.requireRight("sp:connector:read", s.requireInstanceAccess(aclVerb(model.ACLRead), s.getInstanceACL()))).Methods("GET")
+	r.Handle("/connector-instances/{id}/acl", s.requireRight("sp:connector:update", s.requireInstanceAccess(aclVerb(model.ACLUpdate), s.putInstanceACL()))).Methods("PUT")
+	r.Handle("/connector-instances/{id}/acl", s.requireRight("sp:connector:update", s.requireInstanceAccess(aclVerb(model.ACLUpdate), s.deleteInstanceACL()))).Methods("DELETE")
+
+	r.Handle("/api-keys", s.requireRight("sp:connector:create", s.createAPIKey())).Methods("POST")
+	r.Handle("/api-keys/{id}/rotate", s.requireRight("sp:connector:create", s.rotateAPIKey())).Methods("POST")
+	r.Handle("/api-keys/{id}", s.requireRight("sp:connector:delete", s.revokeAPIKey())).Methods("DELETE")
+
+	if s.auditLog.Persisted() {
+		r.Handle("/audit", s.requireRight("sp:connector:read", s.listAuditRecords())).Methods("GET")
+	}
 
-	//r.Handle("/invocations/{id}/next-result", s.requireRight("sp:connector:invoke", s.iterateInvocationResult())).Methods("POST")
-	//r.Handle("/invocations/{id}/cancel", s.requireRight("sp:connector:invoke", s.cancelInvocation())).Methods("POST")
+	s.buildRuntimeRoutes(r)
+
+	if s.commandDispatcher.BeaconEnabled() {
+		r.Handle("/debug/beacon-routes", s.requireRight("sp:connector:read", s.listBeaconRoutes())).Methods("GET")
+	}
+
+	r.Handle("/invocations/{id}/next-result", s.requireRight("sp:connector:invoke", s.iterateInvocationResult())).Methods("POST")
+	r.Handle("/invocations/{id}/cancel", s.requireRight("sp:connector:invoke", s.cancelInvocation())).Methods("POST")
 
 	return r
 }
@@ -43,7 +85,7 @@ func (s *ConnectService) returnHelloWorld() http.HandlerFunc {
 		str, err := cmd.Handle(ctx) //output s
 
 		if err != nil {
-			//WriteJSONWithError(ctx, w, err)
+			WriteJSONWithError(ctx, w, err)
 			return
 		}
 
@@ -51,6 +93,235 @@ func (s *ConnectService) returnHelloWorld() http.HandlerFunc {
 	}
 }
 
+// ingestConnectorEvents accepts a batch of events from a connector instance and forwards the
+// events that haven't been seen before to the standard event topic.
+func (s *ConnectService) ingestConnectorEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var body struct {
+			Events []model.ConnectorEvent `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		tenantID := requestTenantID(ctx)
+
+		suspended, err := s.orgStatusStore.IsSuspended(ctx, tenantID)
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+		if suspended {
+			web.Forbidden(ctx, w)
+			return
+		}
+
+		dedupTTL := config.GetDuration(s.Config, "CONNECTOR_EVENT_DEDUP_TTL", 24*time.Hour)
+
+		cmd, err := cmd.NewIngestConnectorEvents(tenantID, mux.Vars(r)["id"], body.Events, dedupTTL)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		result, err := cmd.Handle(ctx, s.schemaRegistry, s.keyValueStore, s.standardEventPublisher)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, result)
+	}
+}
+
+// startedInvocation is an invocation as it's returned when it's started, along with its input.
+type startedInvocation struct {
+	InvocationID        string            `json:"invocationId"`
+	ConnectorInstanceID string            `json:"connectorInstanceId"`
+	Type                model.CommandType `json:"type"`
+	Input               json.RawMessage   `json:"input"`
+	Created             time.Time         `json:"created"`
+	Expiration          time.Time         `json:"expiration"`
+}
+
+// invokeCommand invokes a command against a connector instance, subject to the tenant's and the
+// instance's invocation limits, and responds with the started invocation. Callers over a limit get a
+// 429 with a Retry-After header.
+func (s *ConnectService) invokeCommand() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		cmd, err := cmd.NewInvokeCommand(requestTenantID(ctx), mux.Vars(r)["id"], body)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		inv, err := cmd.Handle(ctx, s.schemaRegistry, s.orgStatusStore, s.invocationLimiter, s.commandInvoker)
+		if errors.Is(err, model.ErrOrgSuspended) {
+			web.Forbidden(ctx, w)
+			return
+		}
+		if err != nil {
+			writeConnectorError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, &startedInvocation{
+			InvocationID:        inv.ID,
+			ConnectorInstanceID: inv.ConnectorInstanceID,
+			Type:                inv.Type,
+			Input:               cmd.Input,
+			Created:             inv.CreatedAt,
+			Expiration:          inv.Expiration,
+		})
+	}
+}
+
+// iterateInvocationResult long-polls for the next page of an invocation's results.
+func (s *ConnectService) iterateInvocationResult() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		// The wait must stay below the server's write timeout (15s by default).
+		maxWait := config.GetDuration(s.Config, "INVOCATION_RESULT_MAX_WAIT", 10*time.Second)
+
+		cmd, err := cmd.NewIterateInvocationResult(requestTenantID(ctx), mux.Vars(r)["id"], body, maxWait)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		page, err := cmd.Handle(ctx, s.invocationStore)
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, page)
+	}
+}
+
+// cancelInvocation cancels an invocation of the tenant that hasn't finished, responding with the
+// invocation as it is afterwards.
+func (s *ConnectService) cancelInvocation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		cmd, err := cmd.NewCancelInvocation(requestTenantID(ctx), mux.Vars(r)["id"])
+		if err != nil {
+			WriteJSONWithError(ctx, w, err)
+			return
+		}
+
+		inv, err := cmd.Handle(ctx, s.commandInvoker)
+		if err != nil {
+			writeConnectorError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, newInvocationState(inv))
+	}
+}
+
+// listAuditRecords lists the tenant's audit records, newest first by default. It supports V3 filters
+// and sorters, offset and limit, and with count=true sets X-Total-Count to the number of records that
+// matched. Counting reads every match, so unlike the other lists it's only done on request.
+func (s *ConnectService) listAuditRecords() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		options, err := web.GetQueryOptions(r, auditSortableFields, auditFilterBuilder(), auditQueryableFields)
+		if err != nil {
+			web.BadRequest(ctx, w, err)
+			return
+		}
+
+		count := web.IsCountHeaderRequested(r)
+		records, total, err := s.auditLog.List(ctx, requestTenantID(ctx), options, count)
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		if count {
+			w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		}
+		web.WriteJSON(ctx, w, records)
+	}
+}
+
+// listBeaconRoutes lists the local runtimes registered in Beacon and where each routes commands. With
+// an "org" query parameter, it gets the route of that org's commands instead.
+func (s *ConnectService) listBeaconRoutes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if org := r.URL.Query().Get("org"); org != "" {
+			web.WriteJSON(ctx, w, s.commandDispatcher.Route(atlas.Org(org)))
+			return
+		}
+
+		routes, err := s.commandDispatcher.Routes()
+		if err != nil {
+			web.InternalServerError(ctx, w, err)
+			return
+		}
+
+		web.WriteJSON(ctx, w, routes)
+	}
+}
+
+// WriteJSONWithError writes the error response that corresponds to err: 400 for invalid input,
+// 429 for requests over a limit and 500 for everything else.
+func WriteJSONWithError(ctx context.Context, w http.ResponseWriter, err error) {
+	var badRequest *model.BadRequestError
+	if errors.As(err, &badRequest) {
+		web.BadRequest(ctx, w, err)
+		return
+	}
+
+	var tooManyRequests *model.TooManyRequestsError
+	if errors.As(err, &tooManyRequests) {
+		writeTooManyRequests(ctx, w, tooManyRequests)
+		return
+	}
+
+	web.InternalServerError(ctx, w, err)
+}
+
+// writeTooManyRequests writes a 429 error in the standard JSON format, with a Retry-After header.
+// atlas has no helper for 429s, so the error is built here.
+func writeTooManyRequests(ctx context.Context, w http.ResponseWriter, err *model.TooManyRequestsError) {
+	e := web.Error{
+		DetailCode: http.StatusText(http.StatusTooManyRequests),
+		Messages:   []web.ErrorMessage{{Locale: "en-US", LocaleOrigin: "DEFAULT", Text: err.Error()}},
+	}
+	if tc := trace.GetTracingContext(ctx); tc != nil {
+		e.TrackingID = string(tc.RequestID)
+	}
+
+	w.Header().Set("Retry-After", ratelimit.RetryAfter(err.RetryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(e)
+}
+
 // requireRight is a middleware function that ensures that the current request
 // has the specified right before calling the next handler in the chain.
 // Requests that are missing the specified right will be terminated with
@@ -0,0 +1,124 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// ACLVerb is an operation an ACL grants on a connector instance.
+type ACLVerb string
+
+const (
+	ACLRead   ACLVerb = "read"
+	ACLUpdate ACLVerb = "update"
+
+	// ACLInvokeAny grants invoking every command type.
+	ACLInvokeAny ACLVerb = "invoke:*"
+)
+
+// aclInvokePrefix is the prefix of the verbs that grant invoking a command type.
+const aclInvokePrefix = "invoke:"
+
+// ACLInvoke gets the verb that grants invoking the command type.
+func ACLInvoke(commandType CommandType) ACLVerb {
+	return ACLVerb(aclInvokePrefix + string(commandType))
+}
+
+// Valid gets whether the verb is read, update or invoke of a command type.
+func (v ACLVerb) Valid() bool {
+	return v == ACLRead || v == ACLUpdate || (strings.HasPrefix(string(v), aclInvokePrefix) && len(v) > len(aclInvokePrefix))
+}
+
+// Grants gets whether the verb grants the requested one.
+func (v ACLVerb) Grants(requested ACLVerb) bool {
+	return v == requested || (v == ACLInvokeAny && strings.HasPrefix(string(requested), aclInvokePrefix))
+}
+
+// ACLPrincipalType is the kind of principal an ACL entry applies to.
+type ACLPrincipalType string
+
+const (
+	// ACLIdentity is an identity, by ID.
+	ACLIdentity ACLPrincipalType = "identity"
+
+	// ACLClient is an OAuth client, by client ID.
+	ACLClient ACLPrincipalType = "client"
+
+	// ACLGroup is a group of principals: a token authority (eg. "ORG_ADMIN") or an AMS right set.
+	ACLGroup ACLPrincipalType = "group"
+)
+
+// ACLEntry grants verbs to a principal.
+type ACLEntry struct {
+	PrincipalType ACLPrincipalType `json:"principalType"`
+	PrincipalID   string           `json:"principalId"`
+	Verbs         []ACLVerb        `json:"verbs"`
+}
+
+// InstanceACL restricts access to a connector instance to the principals of its entries. Instances
+// without an ACL are only governed by rights.
+type InstanceACL struct {
+	TenantID   string     `json:"-"`
+	InstanceID string     `json:"instanceId"`
+	Entries    []ACLEntry `json:"entries"`
+	Modified   time.Time  `json:"modified"`
+}
+
+// Principal is who a request is made by.
+type Principal struct {
+	IdentityID string
+	ClientID   string
+
+	// Groups are the authorities and right sets of the principal.
+	Groups []string
+}
+
+// String describes the principal for logs.
+func (p *Principal) String() string {
+	if p.IdentityID != "" {
+		return "identity:" + p.IdentityID
+	}
+
+	return "client:" + p.ClientID
+}
+
+// Matches gets whether the entry applies to the principal.
+func (p *Principal) Matches(entry *ACLEntry) bool {
+	switch entry.PrincipalType {
+	case ACLIdentity:
+		return p.IdentityID != "" && entry.PrincipalID == p.IdentityID
+	case ACLClient:
+		return p.ClientID != "" && entry.PrincipalID == p.ClientID
+	case ACLGroup:
+		for _, g := range p.Groups {
+			if g == entry.PrincipalID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// AccessDecision is the outcome of checking a principal's access to a connector instance.
+type AccessDecision struct {
+	Allowed bool
+
+	// Reason explains the decision, eg. the entry that granted access.
+	Reason string
+}
+
+// ACLStore is an interface for storing the ACLs of connector instances.
+type ACLStore interface {
+
+	// GetACL gets the ACL of the connector instance, or nil if it has none.
+	GetACL(ctx context.Context, tenantID string, instanceID string) (*InstanceACL, error)
+
+	// SaveACL creates or replaces the ACL of a connector instance.
+	SaveACL(ctx context.Context, acl *InstanceACL) error
+
+	// DeleteACL removes the ACL of the connector instance, leaving it governed only by rights.
+	DeleteACL(ctx context.Context, tenantID string, instanceID string) error
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// APIKey is a credential for automation that may only invoke a set of command types on a set of
+// connector instances of one tenant, until it expires.
+type APIKey struct {
+	ID           string        `json:"id"`
+	TenantID     string        `json:"tenantId"`
+	Pod          string        `json:"pod"`
+	Org          string        `json:"org"`
+	Name         string        `json:"name"`
+	InstanceIDs  []string      `json:"instanceIds"`
+	CommandTypes []CommandType `json:"commandTypes"`
+	Created      time.Time     `json:"created"`
+	CreatedBy    string        `json:"createdBy"`
+	Expires      time.Time     `json:"expires"`
+
+	// Rotated is when the key's secret was last replaced, if ever.
+	Rotated time.Time `json:"rotated,omitempty"`
+
+	// KeyHash is the hex HMAC-SHA256 of the key's secret, keyed with its ID; the secret itself isn't
+	// stored.
+	KeyHash string `json:"keyHash"`
+}
+
+// Expired gets whether the key has expired.
+func (k *APIKey) Expired(now time.Time) bool {
+	return !now.Before(k.Expires)
+}
+
+// Allows gets whether the key may perform the verb on the connector instance. Keys may read and
+// invoke their command types on their instances, and nothing else.
+func (k *APIKey) Allows(instanceID string, verb ACLVerb) bool {
+	found := false
+	for _, id := range k.InstanceIDs {
+		if id == instanceID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+
+	if verb == ACLRead {
+		return true
+	}
+
+	for _, t := range k.CommandTypes {
+		if verb == ACLInvoke(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// APIKeyStore is an interface for storing API keys.
+type APIKeyStore interface {
+
+	// SaveAPIKey creates or replaces an API key.
+	SaveAPIKey(ctx context.Context, key *APIKey) error
+
+	// GetAPIKey gets an API key by ID, or nil if it doesn't exist.
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+
+	// DeleteAPIKey removes an API key.
+	DeleteAPIKey(ctx context.Context, id string) error
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// AuditAction is the kind of change recorded by an audit record.
+type AuditAction string
+
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	AuditPatch  AuditAction = "patch"
+	AuditDelete AuditAction = "delete"
+)
+
+// AuditResourceType is the type of resource an audit record is about.
+type AuditResourceType string
+
+const (
+	AuditConnectorInstance AuditResourceType = "connector-instance"
+	AuditConnectorSpec     AuditResourceType = "connector-spec"
+	AuditConnectorACL      AuditResourceType = "connector-instance-acl"
+	AuditAPIKey            AuditResourceType = "api-key"
+)
+
+// AuditRecord records who changed a resource, when, and how.
+type AuditRecord struct {
+	ID           string            `json:"id"`
+	TenantID     string            `json:"tenantId"`
+	Actor        string            `json:"actor"`
+	Action       AuditAction       `json:"action"`
+	ResourceType AuditResourceType `json:"resourceType"`
+	ResourceID   string            `json:"resourceId"`
+	Timestamp    time.Time         `json:"timestamp"`
+
+	// Diff is a JSON merge patch (RFC 7386) from the resource before the change to after it, with
+	// secret values redacted.
+	Diff json.RawMessage `json:"diff"`
+}
+
+// AuditRecorder persists and publishes audit records.
+type AuditRecorder interface {
+
+	// Record persists the audit record and publishes it to the audit topic.
+	Record(ctx context.Context, record *AuditRecord) error
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import "encoding/json"
+
+// CommandType is the type of a connector command, as defined in dist/standard_commands (eg. "std:account:create").
+type CommandType string
+
+const (
+	CommandAccountCreate         CommandType = "std:account:create"
+	CommandAccountDelete         CommandType = "std:account:delete"
+	CommandAccountDisable        CommandType = "std:account:disable"
+	CommandAccountDiscoverSchema CommandType = "std:account:discover-schema"
+	CommandAccountEnable         CommandType = "std:account:enable"
+	CommandAccountList           CommandType = "std:account:list"
+	CommandAccountRead           CommandType = "std:account:read"
+	CommandAccountUnlock         CommandType = "std:account:unlock"
+	CommandAccountUpdate         CommandType = "std:account:update"
+	CommandAuthenticate          CommandType = "std:authenticate"
+	CommandEntitlementList       CommandType = "std:entitlement:list"
+	CommandEntitlementRead       CommandType = "std:entitlement:read"
+	CommandResourceRead          CommandType = "std:resource:read"
+	CommandSpecRead              CommandType = "std:spec:read"
+	CommandTestConnection        CommandType = "std:test-connection"
+)
+
+// CommandResult is the outcome of a command that completed successfully against a connector instance.
+type CommandResult struct {
+	ConnectorInstanceID string
+	Type                CommandType
+	Input               json.RawMessage
+	Output              json.RawMessage
+}
+
+// ObjectKey is the key of an account or entitlement, per the object_key schema in dist/common.
+type ObjectKey struct {
+	Simple   *SimpleKey   `json:"simple,omitempty"`
+	Compound *CompoundKey `json:"compound,omitempty"`
+}
+
+// SimpleKey is a key made up of a single native id.
+type SimpleKey struct {
+	ID string `json:"id"`
+}
+
+// CompoundKey is a key made up of a lookup id and a unique id.
+type CompoundKey struct {
+	LookupID string `json:"lookupId"`
+	UniqueID string `json:"uniqueId"`
+}
+
+// Identity gets the native identity encoded by the key.
+func (k *ObjectKey) Identity() string {
+	switch {
+	case k == nil:
+		return ""
+	case k.Simple != nil:
+		return k.Simple.ID
+	case k.Compound != nil:
+		return k.Compound.LookupID
+	}
+
+	return ""
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// CommandInvoker invokes commands against connector instances.
+type CommandInvoker interface {
+
+	// Invoke starts a command against the connector instance. Results are delivered asynchronously.
+	Invoke(ctx context.Context, instanceID string, commandType CommandType, input json.RawMessage) error
+}
+
+// InvocationRequest is a command to invoke against a connector instance as the invocation with the ID.
+type InvocationRequest struct {
+	InvocationID        string
+	ConnectorInstanceID string
+	Type                CommandType
+	Input               json.RawMessage
+
+	// Context is the caller's context of the invocation, which is kept with it.
+	Context json.RawMessage
+
+	// Timeout is how long the invocation may run before it expires, or zero for the spec's timeout.
+	Timeout time.Duration
+
+	// Response is what a connector with the internal topology answers the command with, as an
+	// internalconnector.Response. It's ignored by the other topologies.
+	Response json.RawMessage
+}
+
+// InvocationStarter starts invocations whose ID is chosen by the caller, eg. to admit the invocation
+// against the limits under the same ID before it's started.
+type InvocationStarter interface {
+
+	// StartInvocation starts the request's command against its connector instance, returning the new
+	// invocation. Results are delivered asynchronously.
+	StartInvocation(ctx context.Context, req *InvocationRequest) (*Invocation, error)
+}
+
+// InvocationCanceller cancels invocations that haven't finished yet.
+type InvocationCanceller interface {
+
+	// CancelInvocation moves an invocation of the tenant that hasn't finished to cancelled, so that
+	// its command isn't executed if it hasn't started and its later results are dropped. It returns
+	// the invocation as it is afterwards, or nil if it doesn't exist.
+	CancelInvocation(ctx context.Context, tenantID string, id string) (*Invocation, error)
+}
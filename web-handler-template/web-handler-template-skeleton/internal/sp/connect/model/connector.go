@@ -0,0 +1,146 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// ConnectorSpec describes a connector: where its commands are executed, which commands it supports and
+// how its instances are configured, per dist/common/connector_spec_schema.json.
+type ConnectorSpec struct {
+	ID         string        `json:"id"`
+	TenantID   string        `json:"-"`
+	Name       string        `json:"name"`
+	Visibility string        `json:"visibility"`
+	Topology   Topology      `json:"topology"`
+	Endpoint   string        `json:"endpoint,omitempty"`
+	Commands   []CommandType `json:"commands"`
+
+	// Timeout is how long invocations run before they expire by default, eg. "5m", or empty for the
+	// service's default.
+	Timeout string `json:"timeout,omitempty"`
+
+	// Created and Modified are zero for built-in specs.
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+
+	// Document is the spec as submitted, including the fields the service doesn't interpret (eg.
+	// sourceConfig and accountSchema).
+	Document json.RawMessage `json:"-"`
+}
+
+// connectorSpecFields is ConnectorSpec without its methods, for encoding its own fields.
+type connectorSpecFields ConnectorSpec
+
+// MarshalJSON encodes the spec as its document, with the fields above taking precedence.
+func (s *ConnectorSpec) MarshalJSON() ([]byte, error) {
+	doc := map[string]json.RawMessage{}
+	if len(s.Document) > 0 {
+		if err := json.Unmarshal(s.Document, &doc); err != nil {
+			return nil, err
+		}
+	}
+
+	fields, err := json.Marshal((*connectorSpecFields)(s))
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := map[string]json.RawMessage{}
+	if err := json.Unmarshal(fields, &overrides); err != nil {
+		return nil, err
+	}
+
+	// Built-in specs have no times, which are left out rather than encoded as zero.
+	for _, k := range []string{"created", "modified"} {
+		if string(overrides[k]) == `"0001-01-01T00:00:00Z"` {
+			delete(overrides, k)
+		}
+	}
+
+	for k, v := range overrides {
+		doc[k] = v
+	}
+
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON decodes the fields of the spec and keeps the whole document.
+func (s *ConnectorSpec) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*connectorSpecFields)(s)); err != nil {
+		return err
+	}
+	s.Document = append(json.RawMessage(nil), data...)
+
+	return nil
+}
+
+// SecretKeys gets the keys of the config fields that hold secrets, per the spec's sourceConfig.
+func (s *ConnectorSpec) SecretKeys() []string {
+	var doc struct {
+		SourceConfig []struct {
+			Items []struct {
+				Key  string `json:"key"`
+				Type string `json:"type"`
+			} `json:"items"`
+		} `json:"sourceConfig"`
+	}
+	_ = json.Unmarshal(s.Document, &doc)
+
+	keys := []string{}
+	for _, section := range doc.SourceConfig {
+		for _, item := range section.Items {
+			if item.Type == "secret" || item.Type == "secrettextarea" {
+				keys = append(keys, item.Key)
+			}
+		}
+	}
+
+	return keys
+}
+
+// ConnectorInstance is a configured connector of a tenant, against which commands are invoked.
+type ConnectorInstance struct {
+	ID              string          `json:"id"`
+	TenantID        string          `json:"-"`
+	Name            string          `json:"name"`
+	ConnectorSpecID string          `json:"connectorSpecId"`
+	Config          json.RawMessage `json:"config"`
+	Created         time.Time       `json:"created"`
+	Modified        time.Time       `json:"modified"`
+}
+
+// ConnectorSpecStore is an interface for the persistence of connector specs. Built-in specs are
+// visible to every tenant and can't be saved over.
+type ConnectorSpecStore interface {
+
+	// ListSpecs lists the built-in specs and those of the tenant.
+	ListSpecs(ctx context.Context, tenantID string) ([]*ConnectorSpec, error)
+
+	// GetSpec gets a built-in spec or one of the tenant's, or nil if it doesn't exist.
+	GetSpec(ctx context.Context, tenantID string, id string) (*ConnectorSpec, error)
+
+	// IsBuiltIn gets whether the spec with the ID is built in.
+	IsBuiltIn(id string) bool
+
+	// SaveSpec creates or replaces a spec of the tenant.
+	SaveSpec(ctx context.Context, spec *ConnectorSpec) error
+}
+
+// ConnectorInstanceStore is an interface for the persistence of connector instances.
+type ConnectorInstanceStore interface {
+
+	// ListInstances lists the instances of the tenant.
+	ListInstances(ctx context.Context, tenantID string) ([]*ConnectorInstance, error)
+
+	// GetInstance gets an instance of the tenant, or nil if it doesn't exist.
+	GetInstance(ctx context.Context, tenantID string, id string) (*ConnectorInstance, error)
+
+	// SaveInstance creates or replaces an instance.
+	SaveInstance(ctx context.Context, instance *ConnectorInstance) error
+
+	// DeleteInstance removes an instance of the tenant, returning whether it existed.
+	DeleteInstance(ctx context.Context, tenantID string, id string) (bool, error)
+}
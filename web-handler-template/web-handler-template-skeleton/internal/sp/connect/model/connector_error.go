@@ -0,0 +1,75 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import "fmt"
+
+// ConnectorErrorCategory is the broad class of a ConnectorError, which decides how it's reported
+// and whether the command may be retried.
+type ConnectorErrorCategory string
+
+const (
+	// ConnectorErrorClient is a command the connector rejected (eg. invalid input or an unknown object).
+	ConnectorErrorClient ConnectorErrorCategory = "client"
+
+	// ConnectorErrorAuth is a connector that refused the service's credentials.
+	ConnectorErrorAuth ConnectorErrorCategory = "auth"
+
+	// ConnectorErrorThrottled is a connector that asked for fewer requests.
+	ConnectorErrorThrottled ConnectorErrorCategory = "throttled"
+
+	// ConnectorErrorServer is a connector that failed to process the command.
+	ConnectorErrorServer ConnectorErrorCategory = "server"
+
+	// ConnectorErrorTimeout is a connector that didn't finish before the invocation expired.
+	ConnectorErrorTimeout ConnectorErrorCategory = "timeout"
+
+	// ConnectorErrorTransport is a connector that couldn't be reached, or whose response broke off.
+	ConnectorErrorTransport ConnectorErrorCategory = "transport"
+
+	// ConnectorErrorProtocol is a response that couldn't be parsed.
+	ConnectorErrorProtocol ConnectorErrorCategory = "protocol"
+)
+
+// ConnectorError is a failure executing a command against a connector.
+type ConnectorError struct {
+	Category ConnectorErrorCategory `json:"category"`
+
+	// Type is the connector's own classification of the error (eg. "InvalidConfigurationError"), or
+	// derived from the HTTP status when the connector didn't give one.
+	Type    string `json:"type"`
+	Message string `json:"message"`
+
+	// StatusCode is the HTTP status of the connector's response, if there was one.
+	StatusCode int `json:"statusCode,omitempty"`
+}
+
+// Error describes the error with its category and type.
+func (e *ConnectorError) Error() string {
+	return fmt.Sprintf("connector error (%s/%s): %s", e.Category, e.Type, e.Message)
+}
+
+// Retryable gets whether the command may succeed if it's sent again.
+func (e *ConnectorError) Retryable() bool {
+	switch e.Category {
+	case ConnectorErrorThrottled, ConnectorErrorServer, ConnectorErrorTransport:
+		return true
+	}
+
+	return false
+}
+
+// Failure gets the invocation failure that reports the error.
+func (e *ConnectorError) Failure() *InvocationFailure {
+	failure := &InvocationFailure{Type: InvocationErrorConnector, Message: e.Error(), Connector: e}
+
+	switch e.Category {
+	case ConnectorErrorTimeout:
+		failure.Type = InvocationErrorTimeout
+	case ConnectorErrorTransport:
+		failure.Type = InvocationErrorTransport
+	case ConnectorErrorProtocol:
+		failure.Type = InvocationErrorInvalidOutput
+	}
+
+	return failure
+}
@@ -0,0 +1,12 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import "encoding/json"
+
+// ConnectorEvent is an event submitted by a connector runtime on behalf of a connector instance,
+// for example a change pushed by a source system's webhook.
+type ConnectorEvent struct {
+	ID      string            `json:"id"`
+	Type    StandardEventType `json:"type"`
+	Payload json.RawMessage   `json:"payload"`
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// BadRequestError indicates that a request can't be processed because its input is invalid.
+type BadRequestError struct {
+	Err error
+}
+
+// NewBadRequestError constructs a BadRequestError with a formatted message.
+func NewBadRequestError(format string, args ...interface{}) *BadRequestError {
+	return &BadRequestError{Err: fmt.Errorf(format, args...)}
+}
+
+// Error returns the message of the underlying error.
+func (e *BadRequestError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *BadRequestError) Unwrap() error {
+	return e.Err
+}
+
+// TooManyRequestsError indicates that a request was refused because the caller is over a limit.
+type TooManyRequestsError struct {
+	Reason string
+
+	// RetryAfter is how long the caller should wait before retrying.
+	RetryAfter time.Duration
+}
+
+// Error returns the reason the request was refused.
+func (e *TooManyRequestsError) Error() string {
+	return e.Reason
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Topology is where a connector spec's commands are executed, per dist/common/connector_spec_schema.json.
+type Topology string
+
+const (
+	TopologyGlobal   Topology = "global"
+	TopologyRuntime  Topology = "runtime"
+	TopologyInternal Topology = "internal"
+)
+
+// InvocationStatus is the state of an invocation.
+type InvocationStatus string
+
+const (
+	InvocationPending   InvocationStatus = "pending"
+	InvocationRunning   InvocationStatus = "running"
+	InvocationCompleted InvocationStatus = "completed"
+	InvocationFailed    InvocationStatus = "failed"
+	InvocationCancelled InvocationStatus = "cancelled"
+	InvocationExpired   InvocationStatus = "expired"
+)
+
+// InvocationErrorType classifies why an invocation failed.
+type InvocationErrorType string
+
+const (
+	// InvocationErrorConnector is an error returned by the connector itself.
+	InvocationErrorConnector InvocationErrorType = "connector"
+
+	// InvocationErrorTimeout is a connector that didn't respond in time.
+	InvocationErrorTimeout InvocationErrorType = "timeout"
+
+	// InvocationErrorTransport is a failure delivering the command or its results.
+	InvocationErrorTransport InvocationErrorType = "transport"
+
+	// InvocationErrorInvalidOutput is output that doesn't conform to the command's schema.
+	InvocationErrorInvalidOutput InvocationErrorType = "invalid_output"
+
+	// InvocationErrorInternal is a failure within the service.
+	InvocationErrorInternal InvocationErrorType = "internal"
+)
+
+// Final gets whether the status is one an invocation finishes with, after which it doesn't change.
+func (s InvocationStatus) Final() bool {
+	return s != InvocationPending && s != InvocationRunning
+}
+
+// InvocationFailure describes why an invocation failed.
+type InvocationFailure struct {
+	Type    InvocationErrorType `json:"type"`
+	Message string              `json:"message"`
+
+	// Connector is the error returned by the connector, if that's why the invocation failed.
+	Connector *ConnectorError `json:"connector,omitempty"`
+}
+
+// Invocation is a command invoked against a connector instance, with the times it moved through its lifecycle.
+type Invocation struct {
+	ID                  string
+	TenantID            string
+	ConnectorInstanceID string
+	Type                CommandType
+	Topology            Topology
+	Status              InvocationStatus
+
+	// ErrorType is set when the invocation failed.
+	ErrorType InvocationErrorType
+
+	// Failure describes why the invocation failed, if it did.
+	Failure *InvocationFailure
+
+	// Context is the caller's context of the invocation, handed back along with its last results.
+	Context json.RawMessage
+
+	// ResultCount is the number of results received so far.
+	ResultCount int
+
+	// ResultsRead is the number of results read with NextResults so far.
+	ResultsRead int
+
+	CreatedAt time.Time
+
+	// Expiration is when the invocation expires if it hasn't finished.
+	Expiration time.Time
+
+	// StartedAt is when the command was picked up for execution.
+	StartedAt time.Time
+
+	// FirstResultAt is when the first result was received.
+	FirstResultAt time.Time
+
+	// FinishedAt is when the invocation completed, failed, was cancelled or expired.
+	FinishedAt time.Time
+}
+
+// InvocationObserver is notified as invocations move through their lifecycle, eg. to record metrics.
+type InvocationObserver interface {
+
+	// InvocationCreated is called when the invocation is created.
+	InvocationCreated(inv *Invocation)
+
+	// InvocationStarted is called when the invocation is picked up for execution, with StartedAt set.
+	InvocationStarted(inv *Invocation)
+
+	// InvocationFirstResult is called when the first result is received, with FirstResultAt set.
+	InvocationFirstResult(inv *Invocation)
+
+	// InvocationFinished is called once the invocation has reached a final status, with FinishedAt set.
+	InvocationFinished(inv *Invocation)
+}
+
+// InvocationStore persists invocations and their results. Each change is written along with the
+// events that announce it, so that they're published if and only if the change is persisted.
+type InvocationStore interface {
+
+	// CreateInvocation persists a new, pending invocation.
+	CreateInvocation(ctx context.Context, inv *Invocation) error
+
+	// GetInvocation gets an invocation of the tenant, or nil if it doesn't exist.
+	GetInvocation(ctx context.Context, tenantID string, id string) (*Invocation, error)
+
+	// MarkStarted moves a pending invocation to running as its command is picked up for execution.
+	// It returns the updated invocation, or nil if the invocation doesn't exist or isn't pending.
+	MarkStarted(ctx context.Context, tenantID string, id string) (*Invocation, error)
+
+	// AddResult appends a result to the invocation of the command, marking it running, along with the
+	// standard event the result corresponds to, if any. It returns the updated invocation, or nil if
+	// the invocation doesn't exist or has already finished.
+	AddResult(ctx context.Context, cmd *RuntimeCommand, output json.RawMessage) (*Invocation, error)
+
+	// NextResults reads up to limit of the invocation's results that haven't been read yet, in the order
+	// they were received, and counts them as read. It returns the invocation as of the read, or nil if
+	// it doesn't exist.
+	NextResults(ctx context.Context, tenantID string, id string, limit int) (*Invocation, []json.RawMessage, error)
+
+	// FinishInvocation moves the invocation to a final status, with the reason it failed if it did. It
+	// returns the updated invocation, or nil if the invocation doesn't exist or has already finished.
+	FinishInvocation(ctx context.Context, tenantID string, id string, status InvocationStatus, failure *InvocationFailure) (*Invocation, error)
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import "context"
+
+// InvocationLimiter enforces the per-tenant and per-connector-instance limits on invocation rate
+// and on concurrent in-flight invocations.
+type InvocationLimiter interface {
+
+	// Acquire admits an invocation, reserving a concurrency slot for it until it's released. It
+	// returns a *TooManyRequestsError if the tenant or the connector instance is over a limit.
+	Acquire(ctx context.Context, tenantID string, instanceID string, invocationID string) error
+
+	// Release frees the concurrency slot of an invocation once it has finished.
+	Release(ctx context.Context, tenantID string, instanceID string, invocationID string) error
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// KeyValueStore is an interface for a cluster-wide key/value store with expiring entries.
+type KeyValueStore interface {
+
+	// Get returns the value stored under key and whether it exists.
+	Get(ctx context.Context, key string) (string, bool, error)
+
+	// Set stores value under key, expiring after ttl.
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+
+	// SetIfAbsent stores value under key only if the key doesn't already exist, returning whether it was stored.
+	SetIfAbsent(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+
+	// Delete removes key from the store.
+	Delete(ctx context.Context, key string) error
+}
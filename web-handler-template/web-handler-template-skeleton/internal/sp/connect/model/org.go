@@ -0,0 +1,28 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrOrgSuspended is returned when connector activity is requested for a suspended org.
+var ErrOrgSuspended = errors.New("org is suspended")
+
+// OrgStatusStore tracks whether connector activity is paused for an org.
+type OrgStatusStore interface {
+
+	// IsSuspended gets whether the tenant's org is suspended.
+	IsSuspended(ctx context.Context, tenantID string) (bool, error)
+
+	// SetSuspended suspends or resumes the tenant's org.
+	SetSuspended(ctx context.Context, tenantID string, suspended bool) error
+}
+
+// OrgPurger is implemented by every store that holds tenant data, so that the data can be removed
+// when an org is deleted.
+type OrgPurger interface {
+
+	// PurgeOrg removes all of the tenant's data from the store.
+	PurgeOrg(ctx context.Context, tenantID string) error
+}
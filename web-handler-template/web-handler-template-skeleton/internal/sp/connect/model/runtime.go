@@ -0,0 +1,118 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrNotClaimed is returned when a runtime reports on an invocation it doesn't hold a claim on, eg.
+// because the claim was requeued after the runtime missed its heartbeats.
+var ErrNotClaimed = errors.New("invocation is not claimed by this runtime")
+
+// Runtime is a remote connector runtime, eg. an on-prem agent, that pulls the commands of the
+// connector groups it serves and pushes back their results.
+type Runtime struct {
+	ID              string    `json:"id"`
+	TenantID        string    `json:"tenantId"`
+	Pod             string    `json:"pod"`
+	Org             string    `json:"org"`
+	Name            string    `json:"name"`
+	ConnectorGroups []string  `json:"connectorGroups"`
+	Created         time.Time `json:"created"`
+
+	// KeyHash is the hex HMAC-SHA256 of the secret part of the runtime's key, keyed with its ID, as for
+	// API keys. The key itself is only returned on registration.
+	KeyHash string `json:"keyHash"`
+}
+
+// Serves gets whether the runtime serves the connector group.
+func (r *Runtime) Serves(group string) bool {
+	for _, g := range r.ConnectorGroups {
+		if g == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RuntimeCommand is a command dispatched to the runtimes that serve a connector group.
+type RuntimeCommand struct {
+	InvocationID        string          `json:"invocationId"`
+	TenantID            string          `json:"tenantId"`
+	ConnectorInstanceID string          `json:"connectorInstanceId"`
+	ConnectorGroup      string          `json:"connectorGroup"`
+	Type                CommandType     `json:"type"`
+	Input               json.RawMessage `json:"input"`
+	Created             time.Time       `json:"created"`
+
+	// Expiration is when the invocation expires if it hasn't completed.
+	Expiration time.Time `json:"expiration"`
+
+	// Traceparent is the W3C trace context of the hop that delivered the command, so that the runtime
+	// executing it continues the invoking request's trace.
+	Traceparent string `json:"traceparent,omitempty"`
+}
+
+// Expired gets whether the command has expired.
+func (c *RuntimeCommand) Expired(now time.Time) bool {
+	return !c.Expiration.IsZero() && !now.Before(c.Expiration)
+}
+
+// RuntimeStore keeps track of registered runtimes and whether they're alive.
+type RuntimeStore interface {
+
+	// SaveRuntime creates or replaces a runtime.
+	SaveRuntime(ctx context.Context, runtime *Runtime) error
+
+	// GetRuntime gets a runtime by ID, or nil if it doesn't exist.
+	GetRuntime(ctx context.Context, id string) (*Runtime, error)
+
+	// Heartbeat marks the runtime alive for the specified duration.
+	Heartbeat(ctx context.Context, runtime *Runtime, timeout time.Duration) error
+}
+
+// RuntimeCommandQueue dispatches commands to runtimes. A claimed command stays with the runtime that
+// claimed it until it's completed, or until the runtime stops sending heartbeats, at which point it's
+// requeued for another runtime of the group.
+type RuntimeCommandQueue interface {
+
+	// Dispatch queues a command for the runtimes of its connector group.
+	Dispatch(ctx context.Context, cmd *RuntimeCommand) error
+
+	// Claim takes the next pending command of the runtime's connector groups, or returns nil if there
+	// are none. It doesn't wait for a command to be dispatched.
+	Claim(ctx context.Context, runtime *Runtime) (*RuntimeCommand, error)
+
+	// GetClaim gets a command claimed by the runtime, or nil if the runtime doesn't hold the claim.
+	GetClaim(ctx context.Context, runtime *Runtime, invocationID string) (*RuntimeCommand, error)
+
+	// Complete releases a claim once its invocation has finished, returning whether the runtime held it.
+	Complete(ctx context.Context, runtime *Runtime, invocationID string) (bool, error)
+
+	// Requeue returns a claimed command to the head of its group's queue, eg. because it couldn't be
+	// delivered to the runtime. It returns whether the runtime held the claim.
+	Requeue(ctx context.Context, runtime *Runtime, invocationID string) (bool, error)
+
+	// RequeueAbandoned requeues the claims of runtimes that have stopped sending heartbeats, returning
+	// the number of commands requeued.
+	RequeueAbandoned(ctx context.Context) (int, error)
+}
+
+// InvocationResultHandler follows the execution of commands executed outside the service.
+type InvocationResultHandler interface {
+
+	// HandleStart is called when the command is picked up for execution. It returns false if the
+	// invocation has already finished, eg. because it was cancelled, in which case the command
+	// mustn't be executed.
+	HandleStart(ctx context.Context, cmd *RuntimeCommand) (bool, error)
+
+	// HandleResult is called with each result of an invocation, in order.
+	HandleResult(ctx context.Context, cmd *RuntimeCommand, output json.RawMessage) error
+
+	// HandleCompletion is called once an invocation has finished, with the reason it failed if it did.
+	HandleCompletion(ctx context.Context, cmd *RuntimeCommand, status InvocationStatus, failure *InvocationFailure) error
+}
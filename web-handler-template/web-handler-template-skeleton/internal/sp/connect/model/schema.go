@@ -0,0 +1,21 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// SchemaValidator validates connector payloads against the JSON schemas published in dist.
+type SchemaValidator interface {
+
+	// ValidateEvent returns an error if the payload doesn't conform to the schema of the event type.
+	ValidateEvent(ctx context.Context, eventType StandardEventType, payload json.RawMessage) error
+
+	// ValidateSpec returns an error if the document doesn't conform to the connector spec schema.
+	ValidateSpec(ctx context.Context, document json.RawMessage) error
+
+	// ValidateCommandInput returns an error if the input doesn't conform to the input schema of the
+	// standard command type. The input of other commands isn't checked.
+	ValidateCommandInput(ctx context.Context, commandType CommandType, input json.RawMessage) error
+}
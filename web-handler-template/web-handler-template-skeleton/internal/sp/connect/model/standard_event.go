@@ -0,0 +1,30 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package model
+
+import "context"
+
+// StandardEventType is the type of an event defined in dist/standard_events (eg. "std:account:updated").
+type StandardEventType string
+
+const (
+	StandardEventAccountUpdated StandardEventType = "std:account:updated"
+	StandardEventAccountDeleted StandardEventType = "std:account:deleted"
+)
+
+// AccountEvent is the payload of the std:account:updated and std:account:deleted events.
+type AccountEvent struct {
+	Identity   string                 `json:"identity"`
+	UUID       string                 `json:"uuid,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// StandardEventPublisher publishes the standard events submitted directly by connector instances.
+// Those that result from successful commands are written by the InvocationStore along with the
+// results.
+type StandardEventPublisher interface {
+
+	// PublishConnectorEvents publishes events submitted by a connector instance, returning the IDs of any
+	// events that couldn't be published. The events must already be validated, and each keeps its submitted
+	// ID so that consumers can deduplicate redeliveries.
+	PublishConnectorEvents(ctx context.Context, instanceID string, events []ConnectorEvent) ([]string, error)
+}
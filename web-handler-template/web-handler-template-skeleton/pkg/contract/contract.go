@@ -0,0 +1,282 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+
+// Package contract checks that a connector implementation honours the contracts of the standard
+// commands in dist/standard_commands. Each command listed in the connector's spec is invoked with
+// its definition's inputExample, and its results are validated against the definition's outputSchema
+// and outputMode. Connectors are reached through a Target: an HTTP endpoint, as with global
+// connectors, a runtime connected over the runtime socket, or sp-connect's own internal connector.
+//
+// The package is importable from connectors' own tests: NewRunner loads the standard commands, and
+// NewEndpointTarget or NewRuntimeTarget(DefaultRuntimeConfig()) reach the connector.
+package contract
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/schema"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// DefaultTimeout bounds each command when the Runner has no timeout.
+const DefaultTimeout = time.Minute
+
+// tenantID and connectorGroup are the tenant and connector group of the commands sent to targets.
+const (
+	tenantID       = "contract-test"
+	connectorGroup = "contract-test"
+)
+
+// Spec is the part of a connector spec that's checked: the commands it implements.
+type Spec struct {
+	ID       string              `json:"id"`
+	Name     string              `json:"name"`
+	Commands []model.CommandType `json:"commands"`
+}
+
+// LoadSpec loads a connector spec from a JSON file.
+func LoadSpec(path string) (*Spec, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &Spec{}
+	if err := json.Unmarshal(raw, spec); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	return spec, nil
+}
+
+// Invocation is the outcome of a command run against a target.
+type Invocation struct {
+	Outputs []json.RawMessage
+
+	// Failure is why the command failed, or nil if it completed.
+	Failure *model.InvocationFailure
+}
+
+// Target runs commands against a connector implementation.
+type Target interface {
+
+	// Invoke runs the command and waits for it to complete. The returned error is a failure to run the
+	// command at all; commands that fail are reported in the Invocation.
+	Invoke(ctx context.Context, cmd *model.RuntimeCommand) (*Invocation, error)
+}
+
+// Case is the outcome of checking one command.
+type Case struct {
+	Command  model.CommandType
+	Duration time.Duration
+
+	// Failure describes how the connector broke the command's contract, and Error why the command
+	// couldn't be checked. Both are empty if it passed.
+	Failure string
+	Error   string
+}
+
+// Passed gets whether the command honoured its contract.
+func (c *Case) Passed() bool {
+	return c.Failure == "" && c.Error == ""
+}
+
+// Report is the outcome of checking a connector.
+type Report struct {
+	Name     string
+	Started  time.Time
+	Duration time.Duration
+	Cases    []Case
+}
+
+// Passed gets whether every command honoured its contract.
+func (r *Report) Passed() bool {
+	for i := range r.Cases {
+		if !r.Cases[i].Passed() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Runner checks connectors against the standard commands.
+type Runner struct {
+	Commands map[model.CommandType]*schema.StandardCommand
+
+	// Timeout bounds each command, or is DefaultTimeout if zero.
+	Timeout time.Duration
+}
+
+// NewRunner constructs a new Runner of the standard commands defined in the dist directory, whose
+// commands bound each command with the timeout.
+func NewRunner(distDir string, timeout time.Duration) (*Runner, error) {
+	commands, err := schema.LoadStandardCommands(distDir)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Runner{}
+	r.Commands = commands
+	r.Timeout = timeout
+
+	return r, nil
+}
+
+// Run invokes each of the spec's commands against the target, in order, and reports whether their
+// results honour the commands' contracts.
+func (r *Runner) Run(ctx context.Context, spec *Spec, target Target) *Report {
+	report := &Report{Name: spec.ID, Started: time.Now()}
+	if spec.Name != "" {
+		report.Name = spec.Name
+	}
+
+	for _, commandType := range spec.Commands {
+		started := time.Now()
+		c := r.check(ctx, commandType, target)
+		c.Duration = time.Since(started)
+		report.Cases = append(report.Cases, c)
+	}
+
+	report.Duration = time.Since(report.Started)
+	return report
+}
+
+// check runs one command and validates its results.
+func (r *Runner) check(ctx context.Context, commandType model.CommandType, target Target) Case {
+	c := Case{Command: commandType}
+
+	sc, ok := r.Commands[commandType]
+	if !ok {
+		c.Failure = fmt.Sprintf("%s isn't a standard command", commandType)
+		return c
+	}
+
+	// Commands without an example take no input.
+	input := sc.InputExample
+	if len(input) == 0 {
+		input = json.RawMessage(`{}`)
+	}
+
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	inv, err := target.Invoke(ctx, &model.RuntimeCommand{
+		InvocationID:   uuid.New().String(),
+		TenantID:       tenantID,
+		ConnectorGroup: connectorGroup,
+		Type:           commandType,
+		Input:          input,
+		Created:        now,
+		Expiration:     now.Add(timeout),
+	})
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+
+	if inv.Failure != nil {
+		c.Failure = fmt.Sprintf("command failed (%s): %s", inv.Failure.Type, inv.Failure.Message)
+		return c
+	}
+
+	if sc.OutputMode == schema.OutputSingle && len(inv.Outputs) != 1 {
+		c.Failure = fmt.Sprintf("output mode is single, but the connector returned %d results", len(inv.Outputs))
+		return c
+	}
+
+	for i, output := range inv.Outputs {
+		if err := sc.ValidateOutput(ctx, output); err != nil {
+			c.Failure = fmt.Sprintf("result %d: %v", i+1, err)
+			return c
+		}
+	}
+
+	return c
+}
+
+// collector is an InvocationResultHandler that gathers the results of invocations until they complete.
+type collector struct {
+	mu      sync.Mutex
+	pending map[string]*pendingInvocation
+}
+
+// pendingInvocation is an invocation whose results are being gathered. done is closed on completion.
+type pendingInvocation struct {
+	Invocation
+	done chan struct{}
+}
+
+// newCollector constructs a new collector.
+func newCollector() *collector {
+	return &collector{pending: make(map[string]*pendingInvocation)}
+}
+
+// start starts gathering the results of an invocation.
+func (c *collector) start(invocationID string) *pendingInvocation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := &pendingInvocation{done: make(chan struct{})}
+	c.pending[invocationID] = p
+	return p
+}
+
+// stop stops gathering the results of an invocation.
+func (c *collector) stop(invocationID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, invocationID)
+}
+
+// HandleStart lets the command of an invocation being gathered execute.
+func (c *collector) HandleStart(ctx context.Context, cmd *model.RuntimeCommand) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.pending[cmd.InvocationID]
+	return ok, nil
+}
+
+// HandleResult gathers a result of the invocation.
+func (c *collector) HandleResult(ctx context.Context, cmd *model.RuntimeCommand, output json.RawMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.pending[cmd.InvocationID]
+	if !ok {
+		return fmt.Errorf("unexpected result of invocation %s", cmd.InvocationID)
+	}
+
+	p.Outputs = append(p.Outputs, output)
+	return nil
+}
+
+// HandleCompletion records how the invocation finished.
+func (c *collector) HandleCompletion(ctx context.Context, cmd *model.RuntimeCommand, status model.InvocationStatus, failure *model.InvocationFailure) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.pending[cmd.InvocationID]
+	if !ok {
+		return fmt.Errorf("unexpected completion of invocation %s", cmd.InvocationID)
+	}
+
+	if status != model.InvocationCompleted && failure == nil {
+		failure = &model.InvocationFailure{Type: model.InvocationErrorInternal, Message: string(status)}
+	}
+	p.Failure = failure
+	close(p.done)
+	return nil
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package contract
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/runtimesocket"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/schema"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+const testDistDir = "../../dist"
+
+// loadRunner loads the standard commands and the internal connector's spec, which lists most of them.
+func loadRunner(t *testing.T) (*Runner, *Spec) {
+	t.Helper()
+
+	runner, err := NewRunner(testDistDir, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := LoadSpec(testDistDir + "/connectors/internal_connector.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return runner, spec
+}
+
+// exampleOutputs gets the results of a connector that answers each command with its output example,
+// twice for commands that stream. The examples are compacted so they can be sent as NDJSON.
+func exampleOutputs(r *Runner, commandType model.CommandType) []json.RawMessage {
+	sc := r.Commands[commandType]
+
+	var output bytes.Buffer
+	_ = json.Compact(&output, sc.OutputExample)
+
+	if sc.OutputMode == schema.OutputStream {
+		return []json.RawMessage{output.Bytes(), output.Bytes()}
+	}
+
+	return []json.RawMessage{output.Bytes()}
+}
+
+// assertPassed fails the test with each failed case of the report.
+func assertPassed(t *testing.T, report *Report, commands int) {
+	t.Helper()
+
+	if len(report.Cases) != commands {
+		t.Errorf("expected %d cases, got %d", commands, len(report.Cases))
+	}
+	for _, c := range report.Cases {
+		if !c.Passed() {
+			t.Errorf("%s: %s%s", c.Command, c.Failure, c.Error)
+		}
+	}
+}
+
+func TestExampleConnectorPassesOverEndpoint(t *testing.T) {
+	runner, spec := loadRunner(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Type  model.CommandType `json:"type"`
+			Input json.RawMessage   `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if err := runner.Commands[req.Type].ValidateInput(r.Context(), req.Input); err != nil {
+			t.Errorf("%s: input example isn't valid: %v", req.Type, err)
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, output := range exampleOutputs(runner, req.Type) {
+			_, _ = w.Write(append(output, '\n'))
+		}
+	}))
+	defer ts.Close()
+
+	report := runner.Run(context.Background(), spec, NewEndpointTarget(ts.URL, ts.Client()))
+	assertPassed(t, report, len(spec.Commands))
+}
+
+func TestExampleConnectorPassesOverRuntimeSocket(t *testing.T) {
+	runner, spec := loadRunner(t)
+
+	target := NewRuntimeTarget(runtimesocket.Config{
+		PingInterval:     time.Second,
+		WriteTimeout:     time.Second,
+		PollInterval:     20 * time.Millisecond,
+		MaxInFlight:      1,
+		HeartbeatTimeout: 30 * time.Second,
+	})
+	ts := httptest.NewServer(target.Handler())
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+RuntimePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The runtime acknowledges each command and answers with the command's output examples.
+	go func() {
+		for {
+			var m runtimesocket.Message
+			if err := conn.ReadJSON(&m); err != nil {
+				return
+			}
+			if m.Type != runtimesocket.MessageCommand {
+				continue
+			}
+
+			id := m.Command.InvocationID
+			_ = conn.WriteJSON(&runtimesocket.Message{Type: runtimesocket.MessageAck, InvocationID: id})
+			for _, output := range exampleOutputs(runner, m.Command.Type) {
+				_ = conn.WriteJSON(&runtimesocket.Message{Type: runtimesocket.MessageResult, InvocationID: id, Output: output})
+			}
+			_ = conn.WriteJSON(&runtimesocket.Message{Type: runtimesocket.MessageComplete, InvocationID: id})
+		}
+	}()
+
+	select {
+	case <-target.Connected():
+	case <-time.After(5 * time.Second):
+		t.Fatal("runtime didn't connect")
+	}
+
+	report := runner.Run(context.Background(), spec, target)
+	assertPassed(t, report, len(spec.Commands))
+}
+
+func TestInternalConnectorPasses(t *testing.T) {
+	runner, spec := loadRunner(t)
+
+	target, err := NewInternalTarget(testDistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := runner.Run(context.Background(), spec, target)
+	assertPassed(t, report, len(spec.Commands))
+}
+
+// targetFunc is a Target that runs commands with a function.
+type targetFunc func(cmd *model.RuntimeCommand) (*Invocation, error)
+
+func (f targetFunc) Invoke(ctx context.Context, cmd *model.RuntimeCommand) (*Invocation, error) {
+	return f(cmd)
+}
+
+func TestRunReportsContractViolations(t *testing.T) {
+	runner, _ := loadRunner(t)
+
+	account := json.RawMessage(`{"identity": "john.doe", "uuid": "1234", "attributes": {}}`)
+	outcomes := map[model.CommandType]*Invocation{
+		model.CommandAccountRead:     {Outputs: []json.RawMessage{account, account}},
+		model.CommandAccountList:     {Outputs: []json.RawMessage{account, json.RawMessage(`{"identity": "jane.doe"}`)}},
+		model.CommandAuthenticate:    {Failure: &model.InvocationFailure{Type: model.InvocationErrorConnector, Message: "bad credentials"}},
+		model.CommandEntitlementList: {Outputs: nil},
+	}
+
+	spec := &Spec{ID: "broken", Commands: []model.CommandType{
+		model.CommandAccountRead,
+		model.CommandAccountList,
+		model.CommandAuthenticate,
+		model.CommandEntitlementList,
+		model.CommandTestConnection,
+		"std:unknown",
+	}}
+
+	report := runner.Run(context.Background(), spec, targetFunc(func(cmd *model.RuntimeCommand) (*Invocation, error) {
+		if cmd.Type == model.CommandTestConnection {
+			return nil, errors.New("connection refused")
+		}
+		return outcomes[cmd.Type], nil
+	}))
+
+	expected := []struct {
+		failure string
+		err     string
+	}{
+		{failure: "output mode is single, but the connector returned 2 results"},
+		{failure: "result 2: schema validation failed"},
+		{failure: "command failed (connector): bad credentials"},
+		{},
+		{err: "connection refused"},
+		{failure: "std:unknown isn't a standard command"},
+	}
+
+	if report.Passed() {
+		t.Error("expected the report to fail")
+	}
+	for i, e := range expected {
+		c := report.Cases[i]
+		if !strings.HasPrefix(c.Failure, e.failure) || (e.failure == "" && c.Failure != "") || c.Error != e.err {
+			t.Errorf("%s: expected failure %q and error %q, got %q and %q", c.Command, e.failure, e.err, c.Failure, c.Error)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, report); err != nil {
+		t.Fatal(err)
+	}
+
+	junit, _ := ioutil.ReadAll(&buf)
+	for _, s := range []string{
+		`<testsuite name="broken" tests="6" failures="4" errors="1"`,
+		`<testcase name="std:entitlement:list" classname="broken"`,
+		`<failure message="command failed (connector): bad credentials">`,
+		`<error message="connection refused">`,
+	} {
+		if !strings.Contains(string(junit), s) {
+			t.Errorf("expected the JUnit report to contain %s, got:\n%s", s, junit)
+		}
+	}
+}
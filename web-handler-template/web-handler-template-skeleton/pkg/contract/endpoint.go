@@ -0,0 +1,62 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package contract
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/sailpoint/atlas-go/atlas"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/cmd"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/globalconnector"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// EndpointTarget sends commands to a connector endpoint over HTTP, as sp-connect does for connectors
+// with the global topology.
+type EndpointTarget struct {
+	endpoint  string
+	collector *collector
+	executor  *globalconnector.Executor
+}
+
+// clientProvider is an InternalClientProvider that returns the same client for every tenant.
+type clientProvider struct {
+	client *http.Client
+}
+
+// GetInternalClient returns the client.
+func (p clientProvider) GetInternalClient(tenantID atlas.TenantID, org atlas.Org) *http.Client {
+	return p.client
+}
+
+// NewEndpointTarget constructs a new EndpointTarget that calls endpoint with client. The client adds
+// any authentication the endpoint requires.
+func NewEndpointTarget(endpoint string, client *http.Client) *EndpointTarget {
+	t := &EndpointTarget{}
+	t.endpoint = endpoint
+	t.collector = newCollector()
+	t.executor = globalconnector.NewExecutor(clientProvider{client}, t.collector, globalconnector.Config{
+		DefaultTimeout: DefaultTimeout,
+		MaxResultSize:  cmd.MaxRuntimeResultSize,
+	})
+
+	return t
+}
+
+// Invoke sends the command to the endpoint and gathers the results it streams back.
+func (t *EndpointTarget) Invoke(ctx context.Context, cmd *model.RuntimeCommand) (*Invocation, error) {
+	p := t.collector.start(cmd.InvocationID)
+	defer t.collector.stop(cmd.InvocationID)
+
+	// Failed calls are reported to the collector as the invocation's failure, so only a failure of
+	// the collector itself is an error here.
+	if err := t.executor.Execute(ctx, tenantID, t.endpoint, cmd); err != nil {
+		var connectorErr *model.ConnectorError
+		if !errors.As(err, &connectorErr) {
+			return nil, err
+		}
+	}
+
+	return &p.Invocation, nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package contract
+
+import (
+	"context"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/internalconnector"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/schema"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// InternalTarget runs commands against sp-connect's own implementation of connectors with the
+// internal topology, which answers each command with its output example.
+type InternalTarget struct {
+	collector *collector
+	executor  *internalconnector.Executor
+}
+
+// NewInternalTarget constructs a new InternalTarget whose output examples are those of the standard
+// commands defined in the dist directory.
+func NewInternalTarget(distDir string) (*InternalTarget, error) {
+	registry, err := schema.NewRegistry(distDir)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &InternalTarget{}
+	t.collector = newCollector()
+	t.executor = internalconnector.NewExecutor(registry, t.collector)
+
+	return t, nil
+}
+
+// Invoke answers the command as the internal connector does for invocations without a response.
+func (t *InternalTarget) Invoke(ctx context.Context, cmd *model.RuntimeCommand) (*Invocation, error) {
+	p := t.collector.start(cmd.InvocationID)
+	defer t.collector.stop(cmd.InvocationID)
+
+	if err := t.executor.Execute(ctx, cmd, nil); err != nil {
+		return nil, err
+	}
+
+	return &p.Invocation, nil
+}
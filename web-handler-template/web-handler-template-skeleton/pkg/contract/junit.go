@@ -0,0 +1,88 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package contract
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// junitSuites is the root element of a JUnit XML report.
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+// junitSuite is a JUnit test suite, which is the check of one connector.
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+// junitCase is a JUnit test case, which is the check of one command.
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+// junitMessage is the failure or error of a JUnit test case.
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the reports to w in the JUnit XML format, with a test suite per report and a test
+// case per command.
+func WriteJUnit(w io.Writer, reports ...*Report) error {
+	root := junitSuites{}
+	for _, r := range reports {
+		suite := junitSuite{
+			Name:      r.Name,
+			Tests:     len(r.Cases),
+			Time:      seconds(r.Duration),
+			Timestamp: r.Started.UTC().Format("2006-01-02T15:04:05"),
+		}
+
+		for _, c := range r.Cases {
+			jc := junitCase{Name: string(c.Command), ClassName: r.Name, Time: seconds(c.Duration)}
+			if c.Failure != "" {
+				suite.Failures++
+				jc.Failure = &junitMessage{Message: c.Failure, Text: c.Failure}
+			}
+			if c.Error != "" {
+				suite.Errors++
+				jc.Error = &junitMessage{Message: c.Error, Text: c.Error}
+			}
+			suite.Cases = append(suite.Cases, jc)
+		}
+
+		root.Suites = append(root.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// seconds formats a duration in seconds, as JUnit reports times.
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2022, SailPoint Technologies, Inc. All rights reserved.
+package contract
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sailpoint/sp-connect/internal/sp/connect/infra/runtimesocket"
+	"github.com/sailpoint/sp-connect/internal/sp/connect/model"
+)
+
+// RuntimePath is the path runtimes connect to, as on sp-connect.
+const RuntimePath = "/runtime/connect"
+
+// RuntimeTarget stands in for sp-connect towards a connector runtime: the runtime connects to its
+// Handler over the runtime socket, as it would to the service, and is sent the commands to check. Any
+// runtime key is accepted.
+type RuntimeTarget struct {
+	collector *collector
+	queue     *runtimeQueue
+	server    *runtimesocket.Server
+	runtime   *model.Runtime
+
+	connectedOnce sync.Once
+	connected     chan struct{}
+}
+
+// DefaultRuntimeConfig gets the runtime socket configuration of a RuntimeTarget that checks one
+// command at a time.
+func DefaultRuntimeConfig() runtimesocket.Config {
+	return runtimesocket.Config{
+		PingInterval:     15 * time.Second,
+		WriteTimeout:     10 * time.Second,
+		PollInterval:     time.Second,
+		MaxInFlight:      1,
+		HeartbeatTimeout: 30 * time.Second,
+	}
+}
+
+// NewRuntimeTarget constructs a new RuntimeTarget that serves runtimes with the socket configuration.
+func NewRuntimeTarget(config runtimesocket.Config) *RuntimeTarget {
+	t := &RuntimeTarget{}
+	t.collector = newCollector()
+	t.queue = newRuntimeQueue()
+	t.server = runtimesocket.NewServer(noopRuntimeStore{}, t.queue, t.collector, config)
+	t.runtime = &model.Runtime{ID: "contract-test", TenantID: tenantID, Name: "contract-test", ConnectorGroups: []string{connectorGroup}}
+	t.connected = make(chan struct{})
+
+	return t
+}
+
+// Handler serves the runtime socket at RuntimePath.
+func (t *RuntimeTarget) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(RuntimePath, func(w http.ResponseWriter, r *http.Request) {
+		t.connectedOnce.Do(func() { close(t.connected) })
+		t.server.Serve(w, r, t.runtime, t.queue.wake)
+	})
+
+	return mux
+}
+
+// Connected returns a channel that's closed once a runtime has connected.
+func (t *RuntimeTarget) Connected() <-chan struct{} {
+	return t.connected
+}
+
+// Invoke queues the command for the runtime and waits for it to complete.
+func (t *RuntimeTarget) Invoke(ctx context.Context, cmd *model.RuntimeCommand) (*Invocation, error) {
+	p := t.collector.start(cmd.InvocationID)
+	defer t.collector.stop(cmd.InvocationID)
+
+	if err := t.queue.Dispatch(ctx, cmd); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-p.done:
+		return &p.Invocation, nil
+	case <-ctx.Done():
+		t.queue.remove(cmd.InvocationID)
+		return &Invocation{Failure: &model.InvocationFailure{Type: model.InvocationErrorTimeout, Message: "runtime didn't complete the command in time"}}, nil
+	}
+}
+
+// noopRuntimeStore is a RuntimeStore for the target's single runtime, which needs no bookkeeping.
+type noopRuntimeStore struct{}
+
+// SaveRuntime does nothing.
+func (noopRuntimeStore) SaveRuntime(ctx context.Context, runtime *model.Runtime) error {
+	return nil
+}
+
+// GetRuntime returns nil.
+func (noopRuntimeStore) GetRuntime(ctx context.Context, id string) (*model.Runtime, error) {
+	return nil, nil
+}
+
+// Heartbeat does nothing.
+func (noopRuntimeStore) Heartbeat(ctx context.Context, runtime *model.Runtime, timeout time.Duration) error {
+	return nil
+}
+
+// runtimeQueue is an in-memory RuntimeCommandQueue for a single runtime. wake receives whenever a
+// command is dispatched or requeued.
+type runtimeQueue struct {
+	mu      sync.Mutex
+	pending []*model.RuntimeCommand
+	claims  map[string]*model.RuntimeCommand
+	wake    chan struct{}
+}
+
+// newRuntimeQueue constructs a new runtimeQueue.
+func newRuntimeQueue() *runtimeQueue {
+	return &runtimeQueue{claims: make(map[string]*model.RuntimeCommand), wake: make(chan struct{}, 1)}
+}
+
+// Dispatch queues a command.
+func (q *runtimeQueue) Dispatch(ctx context.Context, cmd *model.RuntimeCommand) error {
+	q.mu.Lock()
+	q.pending = append(q.pending, cmd)
+	q.mu.Unlock()
+
+	q.notify()
+	return nil
+}
+
+// Claim takes the next pending command, or returns nil if there are none.
+func (q *runtimeQueue) Claim(ctx context.Context, runtime *model.Runtime) (*model.RuntimeCommand, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return nil, nil
+	}
+
+	cmd := q.pending[0]
+	q.pending = q.pending[1:]
+	q.claims[cmd.InvocationID] = cmd
+	return cmd, nil
+}
+
+// GetClaim gets a claimed command, or nil if it isn't claimed.
+func (q *runtimeQueue) GetClaim(ctx context.Context, runtime *model.Runtime, invocationID string) (*model.RuntimeCommand, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.claims[invocationID], nil
+}
+
+// Complete releases a claim, returning whether it was held.
+func (q *runtimeQueue) Complete(ctx context.Context, runtime *model.Runtime, invocationID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, ok := q.claims[invocationID]
+	delete(q.claims, invocationID)
+	return ok, nil
+}
+
+// Requeue returns a claimed command to the head of the queue, returning whether it was held.
+func (q *runtimeQueue) Requeue(ctx context.Context, runtime *model.Runtime, invocationID string) (bool, error) {
+	q.mu.Lock()
+	cmd, ok := q.claims[invocationID]
+	if ok {
+		delete(q.claims, invocationID)
+		q.pending = append([]*model.RuntimeCommand{cmd}, q.pending...)
+	}
+	q.mu.Unlock()
+
+	if ok {
+		q.notify()
+	}
+	return ok, nil
+}
+
+// RequeueAbandoned does nothing, since the target's runtime is only checked while it's connected.
+func (q *runtimeQueue) RequeueAbandoned(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+// remove drops a command, whether it's pending or claimed.
+func (q *runtimeQueue) remove(invocationID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.claims, invocationID)
+	for i, cmd := range q.pending {
+		if cmd.InvocationID == invocationID {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// notify wakes the runtime's session, unless a wake-up is already pending.
+func (q *runtimeQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}